@@ -0,0 +1,49 @@
+// cmd/purge-trash/main.go
+// ゴミ箱に TRASH_RETENTION_DAYS 日以上入っているoccurrenceを完全に消すコマンドなのだ
+// cronなどから定期的に実行する想定なのだ
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/saku-730/web-specimen/backend/config"
+	"github.com/saku-730/web-specimen/backend/internal/infrastructure"
+	"github.com/saku-730/web-specimen/backend/internal/repository"
+	"github.com/saku-730/web-specimen/backend/internal/service"
+)
+
+func main() {
+	// load config
+	cfg, err := configs.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed load config: %v", err)
+	}
+
+	// connect database
+	db, err := database.NewDatabaseConnection(cfg)
+	if err != nil {
+		log.Fatalf("Failed connect database: %v", err)
+	}
+
+	occService := service.NewOccurrenceService(
+		db,
+		repository.NewOccurrenceRepository(db),
+		repository.NewUserDefaultsRepository(db),
+		repository.NewAttachmentRepository(),
+		repository.NewAttachmentGroupRepository(),
+		repository.NewFileExtensionRepository(),
+		repository.NewChangeLogRepository(db),
+		repository.NewProjectMemberRepository(db),
+		repository.NewProjectRepository(db),
+		repository.NewInstitutionRepository(db),
+	)
+
+	retention := time.Duration(cfg.TrashRetentionDays) * 24 * time.Hour
+	purged, err := occService.PurgeExpiredTrash(retention)
+	if err != nil {
+		log.Fatalf("Failed purge trash (purged %d): %v", purged, err)
+	}
+
+	log.Printf("Purged %d occurrences older than %d days from trash", purged, cfg.TrashRetentionDays)
+}
@@ -17,6 +17,54 @@ type Config struct {
 	DBSSLMode  string `mapstructure:"DB_SSLMODE"`
 	ServerPort string `mapstructure:"SERVER_PORT"`
 	JWTSecret  string `mapstructure:"JWT_SECRET_KEY"`
+
+	// lifetime of access tokens and refresh tokens
+	AccessTokenTTLMinutes int `mapstructure:"ACCESS_TOKEN_TTL_MINUTES"`
+	RefreshTokenTTLDays   int `mapstructure:"REFRESH_TOKEN_TTL_DAYS"`
+
+	// OpenID Connect single sign-on (disabled when OIDC_ISSUER_URL is empty)
+	OIDCIssuerURL       string `mapstructure:"OIDC_ISSUER_URL"`
+	OIDCClientID        string `mapstructure:"OIDC_CLIENT_ID"`
+	OIDCClientSecret    string `mapstructure:"OIDC_CLIENT_SECRET"`
+	OIDCRedirectURL     string `mapstructure:"OIDC_REDIRECT_URL"`
+	OIDCScopes          string `mapstructure:"OIDC_SCOPES"`
+	OIDCAutoCreateUsers bool   `mapstructure:"OIDC_AUTO_CREATE_USERS"`
+	OIDCDefaultRole     string `mapstructure:"OIDC_DEFAULT_ROLE"`
+
+	// outgoing mail (log only when SMTP_HOST is empty)
+	SMTPHost     string `mapstructure:"SMTP_HOST"`
+	SMTPPort     string `mapstructure:"SMTP_PORT"`
+	SMTPUsername string `mapstructure:"SMTP_USERNAME"`
+	SMTPPassword string `mapstructure:"SMTP_PASSWORD"`
+	MailFrom     string `mapstructure:"MAIL_FROM"`
+
+	// frontend url used in links of mails
+	AppBaseURL string `mapstructure:"APP_BASE_URL"`
+
+	// invitations, self registration, password reset and email change
+	InvitationTTLHours      int    `mapstructure:"INVITATION_TTL_HOURS"`
+	PasswordResetTTLMinutes int    `mapstructure:"PASSWORD_RESET_TTL_MINUTES"`
+	EmailChangeTTLMinutes   int    `mapstructure:"EMAIL_CHANGE_TTL_MINUTES"`
+	SelfRegistrationEnabled bool   `mapstructure:"SELF_REGISTRATION_ENABLED"`
+	SelfRegistrationRole    string `mapstructure:"SELF_REGISTRATION_ROLE"`
+
+	// brute-force protection of password login
+	LoginMaxAccountFailures int `mapstructure:"LOGIN_MAX_ACCOUNT_FAILURES"`
+	LoginMaxIPFailures      int `mapstructure:"LOGIN_MAX_IP_FAILURES"`
+	LoginIPWindowMinutes    int `mapstructure:"LOGIN_IP_WINDOW_MINUTES"`
+	LoginLockoutBaseSeconds int `mapstructure:"LOGIN_LOCKOUT_BASE_SECONDS"`
+	LoginLockoutMaxMinutes  int `mapstructure:"LOGIN_LOCKOUT_MAX_MINUTES"`
+
+	// rate limit of registration and password reset mails (lockout grows like login lockout)
+	MailMaxPerAddress int `mapstructure:"MAIL_MAX_PER_ADDRESS"`
+	MailMaxPerIP      int `mapstructure:"MAIL_MAX_PER_IP"`
+	MailWindowMinutes int `mapstructure:"MAIL_WINDOW_MINUTES"`
+
+	// issuer shown in authenticator apps for TOTP two factor authentication
+	TOTPIssuer string `mapstructure:"TOTP_ISSUER"`
+
+	// days to keep soft deleted occurrences before purge
+	TrashRetentionDays int `mapstructure:"TRASH_RETENTION_DAYS"`
 }
 
 // DSN:database source name
@@ -34,6 +82,31 @@ func LoadConfig() (*Config, error) {
 
 	viper.AutomaticEnv()
 
+	// default values
+	viper.SetDefault("TRASH_RETENTION_DAYS", 30)
+	viper.SetDefault("ACCESS_TOKEN_TTL_MINUTES", 15)
+	viper.SetDefault("REFRESH_TOKEN_TTL_DAYS", 14)
+	viper.SetDefault("OIDC_SCOPES", "openid email profile")
+	viper.SetDefault("OIDC_AUTO_CREATE_USERS", false)
+	viper.SetDefault("OIDC_DEFAULT_ROLE", "viewer")
+	viper.SetDefault("SMTP_PORT", "25")
+	viper.SetDefault("MAIL_FROM", "noreply@localhost")
+	viper.SetDefault("APP_BASE_URL", "http://localhost:3000")
+	viper.SetDefault("INVITATION_TTL_HOURS", 72)
+	viper.SetDefault("PASSWORD_RESET_TTL_MINUTES", 30)
+	viper.SetDefault("EMAIL_CHANGE_TTL_MINUTES", 60)
+	viper.SetDefault("SELF_REGISTRATION_ENABLED", false)
+	viper.SetDefault("SELF_REGISTRATION_ROLE", "viewer")
+	viper.SetDefault("LOGIN_MAX_ACCOUNT_FAILURES", 5)
+	viper.SetDefault("LOGIN_MAX_IP_FAILURES", 20)
+	viper.SetDefault("LOGIN_IP_WINDOW_MINUTES", 15)
+	viper.SetDefault("LOGIN_LOCKOUT_BASE_SECONDS", 30)
+	viper.SetDefault("LOGIN_LOCKOUT_MAX_MINUTES", 60)
+	viper.SetDefault("MAIL_MAX_PER_ADDRESS", 3)
+	viper.SetDefault("MAIL_MAX_PER_IP", 10)
+	viper.SetDefault("MAIL_WINDOW_MINUTES", 60)
+	viper.SetDefault("TOTP_ISSUER", "web-specimen")
+
 	if err := viper.ReadInConfig(); err != nil {
 		return nil, fmt.Errorf("Failed load .env file: %w", err)
 	}
@@ -0,0 +1,35 @@
+// internal/entity/api_key_entity.go
+package entity
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// APIKey は public.api_keys テーブルのレコードをマッピングするための構造体なのだ
+// キーそのものは持たないで、ハッシュと一覧用の先頭の文字だけを持っているのだ
+type APIKey struct {
+	// --- Table Columns ---
+	APIKeyID   uint           `gorm:"primaryKey;column:api_key_id"`
+	UserID     uint           `gorm:"column:user_id;not null"`
+	Name       string         `gorm:"column:name;not null"`
+	KeyPrefix  string         `gorm:"column:key_prefix;not null"`
+	KeyHash    string         `gorm:"column:key_hash;not null;unique"`
+	Scopes     datatypes.JSON `gorm:"column:scopes;not null"` // ["read", "occurrence:write"] のようなJSONの配列なのだ
+	CreatedAt  time.Time      `gorm:"column:created_at;autoCreateTime"`
+	ExpiresAt  *time.Time     `gorm:"column:expires_at"`
+	LastUsedAt *time.Time     `gorm:"column:last_used_at"`
+	RevokedAt  *time.Time     `gorm:"column:revoked_at"`
+
+	// --- Relationships ---
+
+	// ◆ Belongs To (所属)の関係 ◆
+	// api_keysテーブルが外部キー(user_id)を持っている関係なのだ ➡️
+	User User `gorm:"foreignKey:UserID"`
+}
+
+// TableName メソッドで、GORMにこの構造体がどのテーブルに対応するかを教えるのだ
+func (APIKey) TableName() string {
+	return "api_keys"
+}
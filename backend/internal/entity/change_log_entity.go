@@ -9,14 +9,16 @@ import (
 // データベースの定義に沿って、すべてのカラムと関係性を定義しているのだ
 type ChangeLog struct {
 	// --- Table Columns ---
-	LogID       uint      `gorm:"primaryKey;column:log_id"`
-	Type        *string   `gorm:"column:type"`
-	ChangedID   *int      `gorm:"column:changed_id"`
-	BeforeValue *string   `gorm:"column:before_value"`
-	AfterValue  *string   `gorm:"column:after_value"`
-	UserID      *int      `gorm:"column:user_id"`
-	Date        time.Time `gorm:"column:date;autoCreateTime"`
-	Row         *string   `gorm:"column:row"` // "row"はGoの予約語ではないのでそのまま使えるのだ
+	LogID        uint      `gorm:"primaryKey;column:log_id"`
+	Type         *string   `gorm:"column:type"`         // 操作の種類 (create / update / delete) が入るのだ
+	ChangedID    *int      `gorm:"column:changed_id"`   // 変更された行の主キーなのだ
+	BeforeValue  *string   `gorm:"column:before_value"` // 変更前の行のJSON (createの時はnil)
+	AfterValue   *string   `gorm:"column:after_value"`  // 変更後の行のJSON (deleteの時はnil)
+	UserID       *int      `gorm:"column:user_id"`
+	Date         time.Time `gorm:"column:date;autoCreateTime"`
+	Row          *string   `gorm:"column:row"`           // "row"はGoの予約語ではないのでそのまま使えるのだ
+	ChangedTable *string   `gorm:"column:table_name"`    // 変更されたテーブル名なのだ (TableNameはメソッド名とかぶるのでこの名前なのだ)
+	OccurrenceID *uint     `gorm:"column:occurrence_id"` // どのoccurrenceに関係する変更かをまとめるためのIDなのだ
 
 	// --- Relationships ---
 
@@ -0,0 +1,33 @@
+// internal/entity/entry_template_entity.go
+package entity
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// EntryTemplate は public.entry_templates テーブルのレコードをマッピングするための構造体なのだ
+// 作成ページに入れておく値を、名前を付けていくつも持てるのだ
+type EntryTemplate struct {
+	// --- Table Columns ---
+	TemplateID     uint           `gorm:"primaryKey;column:template_id"`
+	UserID         uint           `gorm:"column:user_id;not null"`
+	ProjectID      *uint          `gorm:"column:project_id"` // 入っていたら、そのプロジェクトのメンバーにも見せるのだ
+	TemplateName   string         `gorm:"column:template_name;not null"`
+	TemplateValues datatypes.JSON `gorm:"column:template_values;not null"` // model.DefaultValuesUpdate のJSONなのだ
+	CreatedAt      time.Time      `gorm:"column:created_at;autoCreateTime"`
+	UpdatedAt      time.Time      `gorm:"column:updated_at;autoUpdateTime"`
+
+	// --- Relationships ---
+
+	// ◆ Belongs To (所属)の関係 ◆
+	// entry_templatesテーブルが外部キー(user_id, project_id)を持っている関係なのだ ➡️
+	User    User     `gorm:"foreignKey:UserID"`
+	Project *Project `gorm:"foreignKey:ProjectID"`
+}
+
+// TableName メソッドで、GORMにこの構造体がどのテーブルに対応するかを教えるのだ
+func (EntryTemplate) TableName() string {
+	return "entry_templates"
+}
@@ -2,12 +2,24 @@
 
 package entity
 
+import "time"
+
 // InstitutionIDCode は public.institution_id_code テーブルのレコードをマッピングするための構造体なのだ
 // データベースの定義に沿って、すべてのカラムと関係性を定義しているのだ
 type InstitutionIDCode struct {
 	// --- Table Columns ---
-	InstitutionID   uint    `gorm:"primaryKey;column:institution_id"`
-	InstitutionCode *string `gorm:"column:institution_code"`
+	InstitutionID        uint       `gorm:"primaryKey;column:institution_id"`
+	InstitutionCode      *string    `gorm:"column:institution_code"`
+	InstitutionName      *string    `gorm:"column:institution_name"`
+	Acronym              *string    `gorm:"column:acronym"`
+	Address              *string    `gorm:"column:address"`
+	CountryCode          *string    `gorm:"column:country_code"`
+	GRSciCollID          *string    `gorm:"column:grscicoll_id"`
+	IndexHerbariorumCode *string    `gorm:"column:index_herbariorum_code"`
+	ContactName          *string    `gorm:"column:contact_name"`
+	ContactEmail         *string    `gorm:"column:contact_email"`
+	URL                  *string    `gorm:"column:url"`
+	DeactivatedAt        *time.Time `gorm:"column:deactivated_at"`
 
 	// --- Relationships ---
 
@@ -0,0 +1,34 @@
+// internal/entity/invitation_entity.go
+package entity
+
+import (
+	"time"
+)
+
+// Invitation は public.invitations テーブルのレコードをマッピングするための構造体なのだ
+// 管理者からの招待と、自分で申し込んだ登録の両方がここに入るのだ
+type Invitation struct {
+	// --- Table Columns ---
+	InvitationID   uint       `gorm:"primaryKey;column:invitation_id"`
+	MailAddress    string     `gorm:"column:mail_address;not null"`
+	RoleID         uint       `gorm:"column:role_id;not null"`
+	InvitedBy      *uint      `gorm:"column:invited_by"` // 自分で申し込んだ時はnilなのだ
+	TokenID        string     `gorm:"column:token_id;not null;unique"`
+	CreatedAt      time.Time  `gorm:"column:created_at;autoCreateTime"`
+	ExpiresAt      time.Time  `gorm:"column:expires_at;not null"`
+	AcceptedAt     *time.Time `gorm:"column:accepted_at"`
+	AcceptedUserID *uint      `gorm:"column:accepted_user_id"`
+	RevokedAt      *time.Time `gorm:"column:revoked_at"`
+
+	// --- Relationships ---
+
+	// ◆ Belongs To (所属)の関係 ◆
+	// invitationsテーブルが外部キー(role_id, invited_by)を持っている関係なのだ ➡️
+	UserRole UserRole `gorm:"foreignKey:RoleID"`
+	Inviter  *User    `gorm:"foreignKey:InvitedBy"`
+}
+
+// TableName メソッドで、GORMにこの構造体がどのテーブルに対応するかを教えるのだ
+func (Invitation) TableName() string {
+	return "invitations"
+}
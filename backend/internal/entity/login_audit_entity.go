@@ -0,0 +1,30 @@
+// internal/entity/login_audit_entity.go
+package entity
+
+import (
+	"time"
+)
+
+// LoginAudit は public.login_audits テーブルのレコードをマッピングするための構造体なのだ
+type LoginAudit struct {
+	// --- Table Columns ---
+	LoginAuditID uint      `gorm:"primaryKey;column:login_audit_id"`
+	UserID       *uint     `gorm:"column:user_id"`
+	MailAddress  string    `gorm:"column:mail_address;not null"`
+	IPAddress    string    `gorm:"column:ip_address;not null"`
+	UserAgent    *string   `gorm:"column:user_agent"`
+	Event        string    `gorm:"column:event;not null"`
+	Detail       *string   `gorm:"column:detail"`
+	CreatedAt    time.Time `gorm:"column:created_at;autoCreateTime"`
+
+	// --- Relationships ---
+
+	// ◆ Belongs To (所属)の関係 ◆
+	// login_auditsテーブルが外部キー(user_id)を持っている関係なのだ ➡️
+	User *User `gorm:"foreignKey:UserID"`
+}
+
+// TableName メソッドで、GORMにこの構造体がどのテーブルに対応するかを教えるのだ
+func (LoginAudit) TableName() string {
+	return "login_audits"
+}
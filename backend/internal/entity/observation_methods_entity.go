@@ -2,13 +2,19 @@
 
 package entity
 
+import (
+	"time"
+)
+
 // ObservationMethod は public.observation_methods テーブルのレコードをマッピングするための構造体なのだ
 // データベースの定義に沿って、すべてのカラムと関係性を定義しているのだ
 type ObservationMethod struct {
 	// --- Table Columns ---
-	ObservationMethodID uint    `gorm:"primaryKey;column:observation_method_id"`
-	MethodCommonName    *string `gorm:"column:method_common_name"`
-	PageID              *uint    `gorm:"column:pageid"`
+	ObservationMethodID uint       `gorm:"primaryKey;column:observation_method_id"`
+	MethodCommonName    *string    `gorm:"column:method_common_name"`
+	PageID              *uint      `gorm:"column:pageid"`
+	DeprecatedAt        *time.Time `gorm:"column:deprecated_at"` // 入っていたら作成ページの選択肢には出さないのだ
+	MergedInto          *uint      `gorm:"column:merged_into"`   // 統合した先のIDなのだ
 
 	// --- Relationships ---
 
@@ -2,6 +2,8 @@ package entity
 
 import (
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // Occurrence は public.occurrence テーブルのレコードをマッピングするための構造体なのだ
@@ -22,6 +24,10 @@ type Occurrence struct {
 	Note              *string    `gorm:"column:note"`
 	CreatedAt         *time.Time  `gorm:"column:created_at;autoCreateTime"`
 	Timezone          *string      `gorm:"column:timezone;not null"`
+	// Version は楽観的排他制御のための行バージョンなのだ。更新するたびに1ずつ増えるのだ
+	Version           int        `gorm:"column:version;not null;default:1"`
+	// DeletedAt があるとGORMが自動で論理削除(ゴミ箱)として扱ってくれるのだ
+	DeletedAt         gorm.DeletedAt `gorm:"column:deleted_at;index"`
 
 	// --- Relationships ---
 
@@ -8,6 +8,7 @@ import (
 	"database/sql/driver"
 	"fmt"
 	"math"
+	"time"
 )
 
 // Point は PostGISの geography(Point,4326) 型をGORMで扱うためのカスタム型
@@ -94,7 +95,11 @@ type Place struct {
 	PlaceID      uint     `gorm:"primaryKey;column:place_id"`
 	Coordinates  *Point   `gorm:"type:geography(Point,4326);column:coordinates"`
 	PlaceNameID  *uint     `gorm:"column:place_name_id"`
-	Accuracy     *float64 `gorm:"column:accuracy"`
+	Accuracy     *float64 `gorm:"column:accuracy"` // 座標の不確かさ (メートル) なのだ
+	GeoreferenceSource *string    `gorm:"column:georeference_source"` // gps, map, gazetteer のどれかなのだ
+	GeodeticDatum      *string    `gorm:"column:geodetic_datum"`      // 入力した時の測地系なのだ。座標はWGS84にしてから入れるのだ
+	GeoreferencedBy    *string    `gorm:"column:georeferenced_by"`
+	GeoreferencedDate  *time.Time `gorm:"type:date;column:georeferenced_date"`
 
 	// --- Relationships ---
 
@@ -15,6 +15,7 @@ type ProjectMember struct {
 	UserID          *int       `gorm:"column:user_id"`
 	JoinDay         *time.Time `gorm:"column:join_day"`
 	FinishDay       *time.Time `gorm:"column:finish_day"`
+	ProjectRole     string     `gorm:"column:project_role;not null;default:contributor"` // lead / contributor / observer なのだ
 
 	// --- Relationships ---
 
@@ -16,6 +16,7 @@ type Project struct {
 	FinishedDay  *time.Time `gorm:"column:finished_day"`
 	UpdatedDay   *time.Time `gorm:"column:updated_day"`
 	Note         *string    `gorm:"column:note"`
+	ArchivedAt   *time.Time `gorm:"column:archived_at"` // 入っていたら、occurrenceは読むだけになるのだ
 
 	// --- Relationships ---
 
@@ -0,0 +1,46 @@
+// internal/entity/refresh_token_entity.go
+package entity
+
+import (
+	"time"
+)
+
+// RefreshToken は public.refresh_tokens テーブルのレコードをマッピングするための構造体なのだ
+// トークンそのものは持たないで、ハッシュだけを持っているのだ
+type RefreshToken struct {
+	// --- Table Columns ---
+	RefreshTokenID uint       `gorm:"primaryKey;column:refresh_token_id"`
+	UserID         uint       `gorm:"column:user_id;not null"`
+	TokenHash      string     `gorm:"column:token_hash;not null;unique"`
+	FamilyID       string     `gorm:"column:family_id;not null"`
+	AccessJTI      *string    `gorm:"column:access_jti"`
+	ExpiresAt      time.Time  `gorm:"column:expires_at;not null"`
+	CreatedAt      time.Time  `gorm:"column:created_at;autoCreateTime"`
+	UsedAt         *time.Time `gorm:"column:used_at"`
+	RevokedAt      *time.Time `gorm:"column:revoked_at"`
+
+	// --- Relationships ---
+
+	// ◆ Belongs To (所属)の関係 ◆
+	// refresh_tokensテーブルが外部キー(user_id)を持っている関係なのだ ➡️
+	User User `gorm:"foreignKey:UserID"`
+}
+
+// TableName メソッドで、GORMにこの構造体がどのテーブルに対応するかを教えるのだ
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
+
+// RevokedAccessToken は public.revoked_access_tokens テーブルのレコードをマッピングするための構造体なのだ
+type RevokedAccessToken struct {
+	// --- Table Columns ---
+	JTI       string    `gorm:"primaryKey;column:jti"`
+	UserID    *uint     `gorm:"column:user_id"`
+	ExpiresAt time.Time `gorm:"column:expires_at;not null"`
+	RevokedAt time.Time `gorm:"column:revoked_at;autoCreateTime"`
+}
+
+// TableName メソッドで、GORMにこの構造体がどのテーブルに対応するかを教えるのだ
+func (RevokedAccessToken) TableName() string {
+	return "revoked_access_tokens"
+}
@@ -2,13 +2,19 @@
 
 package entity
 
+import (
+	"time"
+)
+
 // SpecimenMethod は public.specimen_methods テーブルのレコードをマッピングするための構造体なのだ
 // データベースの定義に沿って、すべてのカラムと関係性を定義しているのだ
 type SpecimenMethod struct {
 	// --- Table Columns ---
-	SpecimenMethodsID uint    `gorm:"primaryKey;column:specimen_methods_id"`
-	MethodCommonName  *string `gorm:"column:method_common_name"`
-	PageID            *uint    `gorm:"column:page_id"`
+	SpecimenMethodsID uint       `gorm:"primaryKey;column:specimen_methods_id"`
+	MethodCommonName  *string    `gorm:"column:method_common_name"`
+	PageID            *uint      `gorm:"column:page_id"`
+	DeprecatedAt      *time.Time `gorm:"column:deprecated_at"` // 入っていたら作成ページの選択肢には出さないのだ
+	MergedInto        *uint      `gorm:"column:merged_into"`   // 統合した先のIDなのだ
 
 	// --- Relationships ---
 
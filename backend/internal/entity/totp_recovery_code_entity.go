@@ -0,0 +1,22 @@
+// internal/entity/totp_recovery_code_entity.go
+package entity
+
+import (
+	"time"
+)
+
+// TOTPRecoveryCode は public.totp_recovery_codes テーブルのレコードをマッピングするための構造体なのだ
+// コードそのものは持たないで、ハッシュだけを持っているのだ
+type TOTPRecoveryCode struct {
+	// --- Table Columns ---
+	RecoveryCodeID uint       `gorm:"primaryKey;column:recovery_code_id"`
+	UserID         uint       `gorm:"column:user_id;not null"`
+	CodeHash       string     `gorm:"column:code_hash;not null"`
+	CreatedAt      time.Time  `gorm:"column:created_at;autoCreateTime"`
+	UsedAt         *time.Time `gorm:"column:used_at"`
+}
+
+// TableName メソッドで、GORMにこの構造体がどのテーブルに対応するかを教えるのだ
+func (TOTPRecoveryCode) TableName() string {
+	return "totp_recovery_codes"
+}
@@ -9,14 +9,20 @@ import (
 // データベースの定義に沿って、すべてのカラムと関係性を定義しているのだ
 type User struct {
 	// --- Table Columns ---
-	UserID      uint      `gorm:"primaryKey;column:user_id"`
-	UserName    string    `gorm:"column:user_name;not null"`
-	DisplayName string    `gorm:"column:display_name;not null"`
-	MailAddress *string   `gorm:"column:mail_address;unique"`
-	Password    *string   `gorm:"column:password"`
-	RoleID      *int      `gorm:"column:role_id"`
-	CreatedAt   time.Time `gorm:"column:created_at;autoCreateTime"`
-	Timezone    int16     `gorm:"column:timezone;not null"`
+	UserID        uint       `gorm:"primaryKey;column:user_id"`
+	UserName      string     `gorm:"column:user_name;not null"`
+	DisplayName   string     `gorm:"column:display_name;not null"`
+	MailAddress   *string    `gorm:"column:mail_address;unique"`
+	Password      *string    `gorm:"column:password"`
+	RoleID        *int       `gorm:"column:role_id"`
+	CreatedAt     time.Time  `gorm:"column:created_at;autoCreateTime"`
+	Timezone      *string    `gorm:"column:timezone"`
+	OIDCIssuer    *string    `gorm:"column:oidc_issuer"`  // OpenID Connectでログインする時のIdPなのだ
+	OIDCSubject   *string    `gorm:"column:oidc_subject"` // IdPの中でのユーザーのsubなのだ
+	TOTPSecret    *string    `gorm:"column:totp_secret"`  // 暗号にしたTOTPの秘密鍵なのだ
+	TOTPEnabledAt *time.Time `gorm:"column:totp_enabled_at"`
+	TOTPLastStep  *int64     `gorm:"column:totp_last_step"`
+	DeactivatedAt *time.Time `gorm:"column:deactivated_at"` // 無効にしたユーザーはログインできないのだ
 
 	// --- Relationships ---
 
@@ -26,7 +32,7 @@ type User struct {
 
 	// ◆ Has One / Has Many (所有)の関係 ◆
 	// 他のテーブルからuser_idで参照されている関係なのだ ⬅️
-	
+
 	// Userは一つのUserDefaultsを持つ (Has One)
 	UserDefault UserDefault `gorm:"foreignKey:UserID"`
 
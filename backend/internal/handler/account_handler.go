@@ -0,0 +1,186 @@
+// internal/handler/account_handler.go
+package handler
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/saku-730/web-specimen/backend/internal/service"
+	"gorm.io/gorm"
+)
+
+type AccountHandler interface {
+	ListInvitations(c *gin.Context)
+	CreateInvitation(c *gin.Context)
+	RevokeInvitation(c *gin.Context)
+	Register(c *gin.Context)
+	AcceptInvitation(c *gin.Context)
+	ForgotPassword(c *gin.Context)
+	ResetPassword(c *gin.Context)
+	ConfirmEmailChange(c *gin.Context)
+}
+
+type accountHandler struct {
+	service service.AccountService
+}
+
+func NewAccountHandler(s service.AccountService) AccountHandler {
+	return &accountHandler{service: s}
+}
+
+// ListInvitations はまだ受け入れられていない招待の一覧を返すのだ
+func (h *accountHandler) ListInvitations(c *gin.Context) {
+	invitations, err := h.service.ListInvitations()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed get invitations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, invitations)
+}
+
+// CreateInvitation はメールアドレスと役割を決めて招待を送るのだ
+func (h *accountHandler) CreateInvitation(c *gin.Context) {
+	var req model.InvitationCreate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request format: " + err.Error()})
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	invitation, err := h.service.Invite(c.Request.Context(), actor, &req)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, invitation)
+}
+
+func (h *accountHandler) RevokeInvitation(c *gin.Context) {
+	idStr := c.Param("invitation_id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
+		return
+	}
+
+	if err := h.service.RevokeInvitation(uint(id)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found pending invitation"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed revoke invitation"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Register は自分での登録の申し込みなのだ。登録済みのアドレスでも同じ202を返すのだ
+func (h *accountHandler) Register(c *gin.Context) {
+	var req model.RegistrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request format: " + err.Error()})
+		return
+	}
+
+	if err := h.service.Register(c.Request.Context(), &req, clientInfoFromContext(c)); err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "confirmation mail has been sent"})
+}
+
+// AcceptInvitation は招待のトークンでアカウントを作って、ログインした時と同じトークンを返すのだ
+func (h *accountHandler) AcceptInvitation(c *gin.Context) {
+	var req model.AcceptInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request format: " + err.Error()})
+		return
+	}
+
+	tokens, err := h.service.AcceptInvitation(&req)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, tokens)
+}
+
+// ForgotPassword は知らないアドレスでも同じ202を返すのだ
+func (h *accountHandler) ForgotPassword(c *gin.Context) {
+	var req model.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request format: " + err.Error()})
+		return
+	}
+
+	if err := h.service.ForgotPassword(c.Request.Context(), &req, clientInfoFromContext(c)); err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "if the address is registered, a reset mail has been sent"})
+}
+
+func (h *accountHandler) ResetPassword(c *gin.Context) {
+	var req model.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request format: " + err.Error()})
+		return
+	}
+
+	if err := h.service.ResetPassword(&req); err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ConfirmEmailChange は新しいアドレスに届いたトークンでメールアドレスを変えるのだ
+func (h *accountHandler) ConfirmEmailChange(c *gin.Context) {
+	var req model.ConfirmEmailChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request format: " + err.Error()})
+		return
+	}
+
+	if err := h.service.ConfirmEmailChange(&req); err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// respondAccountError は招待・登録・パスワード再設定のエラーをステータスコードにするのだ
+func respondAccountError(c *gin.Context, err error) {
+	var throttled *service.MailThrottledError
+	switch {
+	case errors.As(err, &throttled):
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many mail requests, try again later"})
+	case errors.Is(err, service.ErrInvalidRole), errors.Is(err, service.ErrInvalidAccountToken):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrEmailTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrSelfRegistrationDisabled):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrSendMail):
+		c.JSON(http.StatusBadGateway, gin.H{"error": "failed send mail"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server error occured"})
+	}
+}
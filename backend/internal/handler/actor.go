@@ -0,0 +1,38 @@
+// backend/internal/handler/actor.go
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+)
+
+// actorFromContext は認証ミドルウェアがcontextにセットしたユーザー情報からActorを作るのだ
+// 取り出せなかった時はここでレスポンスを返して false になるのだ
+func actorFromContext(c *gin.Context) (*model.Actor, bool) {
+	userIDInterface, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Not fount userID context"})
+		return nil, false
+	}
+
+	userID, ok := userIDInterface.(int)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid context userID type"})
+		return nil, false
+	}
+
+	return &model.Actor{UserID: uint(userID), Role: c.GetString("role")}, true
+}
+
+// uintParam はパスの name を数字として読むのだ。読めなかったら400を返すのだ
+func uintParam(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
+		return 0, false
+	}
+	return uint(id), true
+}
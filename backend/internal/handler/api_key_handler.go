@@ -0,0 +1,95 @@
+// internal/handler/api_key_handler.go
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/saku-730/web-specimen/backend/internal/service"
+	"gorm.io/gorm"
+)
+
+type APIKeyHandler interface {
+	ListAPIKeys(c *gin.Context)
+	CreateAPIKey(c *gin.Context)
+	RevokeAPIKey(c *gin.Context)
+}
+
+type apiKeyHandler struct {
+	service service.APIKeyService
+}
+
+func NewAPIKeyHandler(s service.APIKeyService) APIKeyHandler {
+	return &apiKeyHandler{service: s}
+}
+
+// ListAPIKeys は自分のAPIキーの一覧を返すのだ。キーそのものは返さないのだ
+func (h *apiKeyHandler) ListAPIKeys(c *gin.Context) {
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	keys, err := h.service.ListAPIKeys(actor)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed get api keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// CreateAPIKey は新しいAPIキーを作るのだ。キーはこのレスポンスでしか見られないのだ
+func (h *apiKeyHandler) CreateAPIKey(c *gin.Context) {
+	var req model.APIKeyCreate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request format: " + err.Error()})
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	created, err := h.service.CreateAPIKey(actor, &req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidScope) || errors.Is(err, service.ErrInvalidExpiry) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed create api key"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, created)
+}
+
+// RevokeAPIKey は自分のAPIキーを無効にするのだ
+func (h *apiKeyHandler) RevokeAPIKey(c *gin.Context) {
+	idStr := c.Param("api_key_id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.RevokeAPIKey(actor, uint(id)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found api key"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed revoke api key"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -3,7 +3,10 @@ package handler
 
 import (
 	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/saku-730/web-specimen/backend/internal/model"
@@ -12,6 +15,9 @@ import (
 
 type AuthHandler interface {
 	Login(c *gin.Context)
+	Refresh(c *gin.Context)
+	Logout(c *gin.Context)
+	VerifyTwoFactor(c *gin.Context)
 }
 
 type authHandler struct {
@@ -29,16 +35,105 @@ func (h *authHandler) Login(c *gin.Context) {
 		return
 	}
 
-	token, err := h.authService.Login(req.Email, req.Password)
+	tokens, err := h.authService.Login(req.Email, req.Password, clientInfoFromContext(c))
 	if err != nil {
+		var locked *service.LoginLockedError
+		if errors.As(err, &locked) {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many failed login attempts, try again later"})
+			return
+		}
 		if errors.Is(err, service.ErrInvalidCredentials) {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "main address or password id different"})
 			return
 		}
+		if errors.Is(err, service.ErrAccountDeactivated) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "server error occured"})
 		return
 	}
 
 	// 成功したら、model.LoginResponseの形でトークンを返す
-	c.JSON(http.StatusOK, model.LoginResponse{Token: token})
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Refresh はリフレッシュトークンを新しいトークンの組に取り換えるのだ
+func (h *authHandler) Refresh(c *gin.Context) {
+	var req model.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request format"})
+		return
+	}
+
+	tokens, err := h.authService.Refresh(req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRefreshToken) || errors.Is(err, service.ErrRefreshTokenReused) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server error occured"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Logout は今のアクセストークンと、送られてきたリフレッシュトークンのログインを無効にするのだ
+func (h *authHandler) Logout(c *gin.Context) {
+	var req model.LogoutRequest
+	// bodyは無くてもいいのだ
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request format"})
+			return
+		}
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+	expiresAt, _ := c.Get("tokenExpiresAt")
+	tokenExpiresAt, _ := expiresAt.(time.Time)
+
+	if err := h.authService.Logout(actor.UserID, c.GetString("jti"), tokenExpiresAt, &req); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server error occured"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// VerifyTwoFactor はログインで返したchallenge_tokenと、認証アプリのコードかリカバリーコードでトークンを発行するのだ
+func (h *authHandler) VerifyTwoFactor(c *gin.Context) {
+	var req model.TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request format"})
+		return
+	}
+
+	tokens, err := h.authService.VerifyTwoFactor(req.ChallengeToken, req.Code, clientInfoFromContext(c))
+	if err != nil {
+		var locked *service.LoginLockedError
+		if errors.As(err, &locked) {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many failed login attempts, try again later"})
+			return
+		}
+		if errors.Is(err, service.ErrInvalidChallenge) || errors.Is(err, service.ErrInvalidTwoFactorCode) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server error occured"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// clientInfoFromContext はログインの記録に残す、クライアントのIPアドレスとUser-Agentを取るのだ
+func clientInfoFromContext(c *gin.Context) *model.ClientInfo {
+	return &model.ClientInfo{IPAddress: c.ClientIP(), UserAgent: c.Request.UserAgent()}
 }
@@ -0,0 +1,143 @@
+// internal/handler/entry_template_handler.go
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/saku-730/web-specimen/backend/internal/service"
+	"gorm.io/gorm"
+)
+
+type EntryTemplateHandler interface {
+	ListTemplates(c *gin.Context)
+	GetTemplate(c *gin.Context)
+	CreateTemplate(c *gin.Context)
+	UpdateTemplate(c *gin.Context)
+	DeleteTemplate(c *gin.Context)
+}
+
+type entryTemplateHandler struct {
+	service service.EntryTemplateService
+}
+
+func NewEntryTemplateHandler(s service.EntryTemplateService) EntryTemplateHandler {
+	return &entryTemplateHandler{service: s}
+}
+
+// ListTemplates は使えるテンプレートの一覧を返すのだ
+func (h *entryTemplateHandler) ListTemplates(c *gin.Context) {
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	templates, err := h.service.ListTemplates(actor)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed get templates"})
+		return
+	}
+
+	c.JSON(http.StatusOK, templates)
+}
+
+func (h *entryTemplateHandler) GetTemplate(c *gin.Context) {
+	id, ok := uintParam(c, "template_id")
+	if !ok {
+		return
+	}
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	template, err := h.service.GetTemplate(actor, id)
+	if err != nil {
+		respondTemplateError(c, err, "failed get template")
+		return
+	}
+
+	c.JSON(http.StatusOK, template)
+}
+
+// CreateTemplate はテンプレートを作って、201と作ったテンプレートを返すのだ
+func (h *entryTemplateHandler) CreateTemplate(c *gin.Context) {
+	var req model.EntryTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request format: " + err.Error()})
+		return
+	}
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	template, err := h.service.CreateTemplate(actor, &req)
+	if err != nil {
+		respondTemplateError(c, err, "failed create template")
+		return
+	}
+
+	c.JSON(http.StatusCreated, template)
+}
+
+func (h *entryTemplateHandler) UpdateTemplate(c *gin.Context) {
+	id, ok := uintParam(c, "template_id")
+	if !ok {
+		return
+	}
+	var req model.EntryTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request format: " + err.Error()})
+		return
+	}
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	template, err := h.service.UpdateTemplate(actor, id, &req)
+	if err != nil {
+		respondTemplateError(c, err, "failed update template")
+		return
+	}
+
+	c.JSON(http.StatusOK, template)
+}
+
+func (h *entryTemplateHandler) DeleteTemplate(c *gin.Context) {
+	id, ok := uintParam(c, "template_id")
+	if !ok {
+		return
+	}
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteTemplate(actor, id); err != nil {
+		respondTemplateError(c, err, "failed delete template")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// respondTemplateError はテンプレートのエラーをステータスコードに変えるのだ
+func respondTemplateError(c *gin.Context, err error, fallback string) {
+	if respondForbidden(c, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found template"})
+	case errors.Is(err, service.ErrTemplateNameTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidDefaults):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -0,0 +1,142 @@
+// internal/handler/institution_handler.go
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/saku-730/web-specimen/backend/internal/service"
+	"gorm.io/gorm"
+)
+
+type InstitutionHandler interface {
+	ListInstitutions(c *gin.Context)
+	GetInstitution(c *gin.Context)
+	CreateInstitution(c *gin.Context)
+	UpdateInstitution(c *gin.Context)
+	DeactivateInstitution(c *gin.Context)
+	ReactivateInstitution(c *gin.Context)
+}
+
+type institutionHandler struct {
+	service service.InstitutionService
+}
+
+func NewInstitutionHandler(s service.InstitutionService) InstitutionHandler {
+	return &institutionHandler{service: s}
+}
+
+// ListInstitutions は機関の一覧を返すのだ
+func (h *institutionHandler) ListInstitutions(c *gin.Context) {
+	var query model.InstitutionQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid query paramate: " + err.Error()})
+		return
+	}
+
+	institutions, err := h.service.ListInstitutions(&query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed get institutions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, institutions)
+}
+
+func (h *institutionHandler) GetInstitution(c *gin.Context) {
+	id, ok := uintParam(c, "institution_id")
+	if !ok {
+		return
+	}
+
+	institution, err := h.service.GetInstitution(id)
+	if err != nil {
+		respondInstitutionError(c, err, "failed get institution")
+		return
+	}
+
+	c.JSON(http.StatusOK, institution)
+}
+
+// CreateInstitution は機関を登録して、201と登録した機関を返すのだ
+func (h *institutionHandler) CreateInstitution(c *gin.Context) {
+	var req model.InstitutionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request format: " + err.Error()})
+		return
+	}
+
+	institution, err := h.service.CreateInstitution(&req)
+	if err != nil {
+		respondInstitutionError(c, err, "failed create institution")
+		return
+	}
+
+	c.Header("Location", fmt.Sprintf("/institution/%d", institution.InstitutionID))
+	c.JSON(http.StatusCreated, institution)
+}
+
+func (h *institutionHandler) UpdateInstitution(c *gin.Context) {
+	id, ok := uintParam(c, "institution_id")
+	if !ok {
+		return
+	}
+	var req model.InstitutionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request format: " + err.Error()})
+		return
+	}
+
+	institution, err := h.service.UpdateInstitution(id, &req)
+	if err != nil {
+		respondInstitutionError(c, err, "failed update institution")
+		return
+	}
+
+	c.JSON(http.StatusOK, institution)
+}
+
+// DeactivateInstitution はDELETEで呼ばれるけど、行は消さないで新しい標本に付けられないようにするだけなのだ
+func (h *institutionHandler) DeactivateInstitution(c *gin.Context) {
+	id, ok := uintParam(c, "institution_id")
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeactivateInstitution(id); err != nil {
+		respondInstitutionError(c, err, "failed deactivate institution")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *institutionHandler) ReactivateInstitution(c *gin.Context) {
+	id, ok := uintParam(c, "institution_id")
+	if !ok {
+		return
+	}
+
+	institution, err := h.service.ReactivateInstitution(id)
+	if err != nil {
+		respondInstitutionError(c, err, "failed reactivate institution")
+		return
+	}
+
+	c.JSON(http.StatusOK, institution)
+}
+
+// respondInstitutionError は機関の管理のエラーをステータスコードに変えるのだ
+func respondInstitutionError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found institution"})
+	case errors.Is(err, service.ErrInstitutionCodeTaken), errors.Is(err, service.ErrGRSciCollIDTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -0,0 +1,69 @@
+// internal/handler/login_audit_handler.go
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/saku-730/web-specimen/backend/internal/service"
+	"gorm.io/gorm"
+)
+
+type LoginAuditHandler interface {
+	SearchLoginAudits(c *gin.Context)
+	UnlockUser(c *gin.Context)
+}
+
+type loginAuditHandler struct {
+	service service.LoginAuditService
+}
+
+func NewLoginAuditHandler(s service.LoginAuditService) LoginAuditHandler {
+	return &loginAuditHandler{service: s}
+}
+
+// SearchLoginAudits はログインの記録を絞り込んで返すのだ
+func (h *loginAuditHandler) SearchLoginAudits(c *gin.Context) {
+	var query model.LoginAuditQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid query paramate: " + err.Error()})
+		return
+	}
+
+	response, err := h.service.SearchLoginAudits(&query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed get login audits"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// UnlockUser は失敗が続いてロックされたアカウントを、すぐにログインできるようにするのだ
+func (h *loginAuditHandler) UnlockUser(c *gin.Context) {
+	idStr := c.Param("user_id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.UnlockAccount(actor, uint(id), clientInfoFromContext(c)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found user"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed unlock user"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,169 @@
+// internal/handler/method_handler.go
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/saku-730/web-specimen/backend/internal/service"
+	"gorm.io/gorm"
+)
+
+// MethodHandler は /observation と /specimen の両方で使うのだ
+type MethodHandler interface {
+	ListMethods(c *gin.Context)
+	GetMethod(c *gin.Context)
+	CreateMethod(c *gin.Context)
+	UpdateMethod(c *gin.Context)
+	DeprecateMethod(c *gin.Context)
+	RestoreMethod(c *gin.Context)
+	MergeMethod(c *gin.Context)
+}
+
+type methodHandler struct {
+	service service.MethodService
+}
+
+func NewMethodHandler(s service.MethodService) MethodHandler {
+	return &methodHandler{service: s}
+}
+
+// ListMethods は方法の一覧を返すのだ
+func (h *methodHandler) ListMethods(c *gin.Context) {
+	var query model.MethodQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid query paramate: " + err.Error()})
+		return
+	}
+
+	methods, err := h.service.ListMethods(&query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed get methods"})
+		return
+	}
+
+	c.JSON(http.StatusOK, methods)
+}
+
+func (h *methodHandler) GetMethod(c *gin.Context) {
+	id, ok := uintParam(c, "method_id")
+	if !ok {
+		return
+	}
+
+	method, err := h.service.GetMethod(id)
+	if err != nil {
+		respondMethodError(c, err, "failed get method")
+		return
+	}
+
+	c.JSON(http.StatusOK, method)
+}
+
+func (h *methodHandler) CreateMethod(c *gin.Context) {
+	var req model.MethodRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request format: " + err.Error()})
+		return
+	}
+
+	method, err := h.service.CreateMethod(&req)
+	if err != nil {
+		respondMethodError(c, err, "failed create method")
+		return
+	}
+
+	c.JSON(http.StatusCreated, method)
+}
+
+// UpdateMethod は方法の名前を変えるのだ
+func (h *methodHandler) UpdateMethod(c *gin.Context) {
+	id, ok := uintParam(c, "method_id")
+	if !ok {
+		return
+	}
+	var req model.MethodRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request format: " + err.Error()})
+		return
+	}
+
+	method, err := h.service.UpdateMethod(id, &req)
+	if err != nil {
+		respondMethodError(c, err, "failed update method")
+		return
+	}
+
+	c.JSON(http.StatusOK, method)
+}
+
+// DeprecateMethod はDELETEで呼ばれるけど、行は消さないで使わないようにするだけなのだ
+func (h *methodHandler) DeprecateMethod(c *gin.Context) {
+	id, ok := uintParam(c, "method_id")
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeprecateMethod(id); err != nil {
+		respondMethodError(c, err, "failed deprecate method")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *methodHandler) RestoreMethod(c *gin.Context) {
+	id, ok := uintParam(c, "method_id")
+	if !ok {
+		return
+	}
+
+	method, err := h.service.RestoreMethod(id)
+	if err != nil {
+		respondMethodError(c, err, "failed restore method")
+		return
+	}
+
+	c.JSON(http.StatusOK, method)
+}
+
+// MergeMethod はパスの方法を into_method_id の方法にまとめて、まとめた先を返すのだ
+func (h *methodHandler) MergeMethod(c *gin.Context) {
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+	id, ok := uintParam(c, "method_id")
+	if !ok {
+		return
+	}
+	var req model.MethodMergeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request format: " + err.Error()})
+		return
+	}
+
+	method, err := h.service.MergeMethod(actor, id, &req)
+	if err != nil {
+		respondMethodError(c, err, "failed merge method")
+		return
+	}
+
+	c.JSON(http.StatusOK, method)
+}
+
+// respondMethodError は方法の管理のエラーをステータスコードに変えるのだ
+func respondMethodError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found method"})
+	case errors.Is(err, service.ErrMethodNameTaken), errors.Is(err, service.ErrMethodMerged):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidMerge), errors.Is(err, service.ErrUnknownPage):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -2,8 +2,12 @@
 package handler
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"gorm.io/gorm"
 
 	"github.com/gin-gonic/gin"
@@ -16,16 +20,26 @@ type OccurrenceHandler interface {
 	CreateOccurrence(c *gin.Context)
 	AttachFiles(c *gin.Context)
 	SearchPage(c *gin.Context)
+	GetTile(c *gin.Context)
 	GetOccurrenceDetail(c *gin.Context)
 	UpdateOccurrence(c *gin.Context)
+	PatchOccurrence(c *gin.Context)
+	DeleteOccurrence(c *gin.Context)
+	ListTrash(c *gin.Context)
+	RestoreOccurrence(c *gin.Context)
+	PurgeOccurrence(c *gin.Context)
+	GetOccurrenceHistory(c *gin.Context)
+	PreviewRevert(c *gin.Context)
+	ApplyRevert(c *gin.Context)
 }
 
 type occurrenceHandler struct {
 	service service.OccurrenceService
+	templates service.EntryTemplateService // GET /create?template= の時だけ使うのだ
 }
 
-func NewOccurrenceHandler(occS service.OccurrenceService) OccurrenceHandler {
-	return &occurrenceHandler{service: occS}
+func NewOccurrenceHandler(occS service.OccurrenceService, templateS service.EntryTemplateService) OccurrenceHandler {
+	return &occurrenceHandler{service: occS, templates: templateS}
 }
 
 
@@ -51,6 +65,23 @@ func (h *occurrenceHandler) GetCreatePage(c *gin.Context) {
 		return
 	}
 
+	// ?template= があれば、ユーザーのデフォルト値の代わりにそのテンプレートを使うのだ
+	if templateStr := c.Query("template"); templateStr != "" {
+		templateID, err := strconv.ParseUint(templateStr, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid template ID format"})
+			return
+		}
+		actor := &model.Actor{UserID: uint(userID), Role: c.GetString("role")}
+		defaultValues, err := h.templates.TemplateDefaultValues(actor, uint(templateID))
+		if err != nil {
+			respondTemplateError(c, err, "failed get template")
+			return
+		}
+		c.JSON(http.StatusOK, model.CreatePageData{DropdownList: *dropdowns, DefaultValue: *defaultValues})
+		return
+	}
+
 	defaultValues, err := h.service.GetDefaultValues(userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"get default value service error": err.Error()})
@@ -72,8 +103,20 @@ func(h * occurrenceHandler) CreateOccurrence(c *gin.Context) {
 		return
 	}
 
-	created, err := h.service.CreateOccurrence(&req)
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	created, err := h.service.CreateOccurrence(actor, &req)
 	if err != nil {
+		if respondForbidden(c, err) {
+			return
+		}
+		if errors.Is(err, service.ErrInactiveInstitution) || errors.Is(err, service.ErrInvalidGeoreference) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body: " + err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"create occurrence service error": err.Error()})
 		return
 	}
@@ -98,9 +141,19 @@ func (h *occurrenceHandler) AttachFiles(c *gin.Context) {
 	}
 	files := form.File["upload_files"]
 
-	userID := c.MustGet("userID").(int)
-	savedFileNames, err := h.service.AttachFiles(uint(occurrenceID), uint(userID), files)
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+	savedFileNames, err := h.service.AttachFiles(actor, uint(occurrenceID), files)
 	if err != nil {
+		if respondForbidden(c, err) {
+			return
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found occurrence the data"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed upload file: " + err.Error()})
 		return
 	}
@@ -113,7 +166,7 @@ func (h *occurrenceHandler) AttachFiles(c *gin.Context) {
 
 func (h *occurrenceHandler) SearchPage(c *gin.Context) {
 	//no query get dropdown only
-	if len(c.Request.URL.RawQuery) == 0 {
+	if len(c.Request.URL.RawQuery) == 0 && !wantsGeoJSON(c) {
 		
 		dropdowns, err := h.service.PrepareCreatePage()
 		if err != nil {
@@ -131,8 +184,22 @@ func (h *occurrenceHandler) SearchPage(c *gin.Context) {
 		return
 	}
 
-	response, err := h.service.Search(&query)
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	if wantsGeoJSON(c) {
+		h.streamGeoJSON(c, actor, &query)
+		return
+	}
+
+	response, err := h.service.Search(actor, &query)
 	if err != nil {
+		if errors.Is(err, service.ErrInvalidSpatialFilter) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid query paramate: " + err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed search process: " + err.Error()})
 		return
 	}
@@ -141,6 +208,111 @@ func (h *occurrenceHandler) SearchPage(c *gin.Context) {
 }
 
 
+// wantsGeoJSON は format=geojson か Accept: application/geo+json の時に true なのだ
+func wantsGeoJSON(c *gin.Context) bool {
+	return c.Query("format") == "geojson" || strings.Contains(c.GetHeader("Accept"), model.GeoJSONMediaType)
+}
+
+// geoJSONFlushEvery はこの件数ごとにクライアントへ送り出すのだ
+const geoJSONFlushEvery = 200
+
+// streamGeoJSON は検索結果をページに分けないで、GeoJSONのFeatureCollectionとして少しずつ書き出すのだ
+// 最初のFeatureを書くまではふつうのエラーを返せるけど、書き始めた後に失敗したら途中で切るしかないのだ
+// (閉じていないJSONになるので、クライアントは失敗に気づけるのだ)
+func (h *occurrenceHandler) streamGeoJSON(c *gin.Context, actor *model.Actor, query *model.SearchQuery) {
+	started := false
+	start := func() {
+		c.Header("Content-Type", model.GeoJSONMediaType)
+		c.Status(http.StatusOK)
+		c.Writer.WriteString(`{"type":"FeatureCollection","features":[`)
+		started = true
+	}
+
+	count := 0
+	err := h.service.SearchEach(actor, query, func(result *model.OccurrenceResult) error {
+		feature, err := json.Marshal(model.NewOccurrenceFeature(result))
+		if err != nil {
+			return err
+		}
+		if !started {
+			start()
+		} else if _, err := c.Writer.WriteString(","); err != nil {
+			return err
+		}
+		if _, err := c.Writer.Write(feature); err != nil {
+			return err
+		}
+		count++
+		if count%geoJSONFlushEvery == 0 {
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		if started {
+			c.Error(err)
+			return
+		}
+		if errors.Is(err, service.ErrInvalidSpatialFilter) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid query paramate: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed search process: " + err.Error()})
+		return
+	}
+
+	if !started {
+		start()
+	}
+	c.Writer.WriteString("]}")
+}
+
+// GetTile は /tiles/{z}/{x}/{y}.mvt で、検索と同じクエリで絞ったoccurrenceをベクタータイルにして返すのだ
+// ETagが同じならタイルは変わっていないので、304を返すのだ
+func (h *occurrenceHandler) GetTile(c *gin.Context) {
+	yText, hasExt := strings.CutSuffix(c.Param("y"), ".mvt")
+	z, zErr := strconv.Atoi(c.Param("z"))
+	x, xErr := strconv.Atoi(c.Param("x"))
+	y, yErr := strconv.Atoi(yText)
+	if !hasExt || zErr != nil || xErr != nil || yErr != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tile path must be /tiles/{z}/{x}/{y}.mvt"})
+		return
+	}
+
+	var query model.SearchQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid query paramate: " + err.Error()})
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	tile, err := h.service.GetTile(actor, &query, z, x, y)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidTile) || errors.Is(err, service.ErrInvalidSpatialFilter) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed get tile: " + err.Error()})
+		return
+	}
+
+	c.Header("ETag", tile.ETag)
+	c.Header("Cache-Control", "private, no-cache")
+	if c.GetHeader("If-None-Match") == tile.ETag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	if len(tile.Data) == 0 {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	c.Data(http.StatusOK, model.MVTMediaType, tile.Data)
+}
+
 func (h *occurrenceHandler) GetOccurrenceDetail(c *gin.Context) {
 	//get query paramate
 	idStr := c.Param("occurrence_id")
@@ -150,8 +322,16 @@ func (h *occurrenceHandler) GetOccurrenceDetail(c *gin.Context) {
 		return
 	}
 
-	detail, err := h.service.GetOccurrenceDetail(uint(id))
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	detail, err := h.service.GetOccurrenceDetail(actor, uint(id))
 	if err != nil {
+		if respondForbidden(c, err) {
+			return
+		}
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "not found occurrence data"})
 		} else {
@@ -160,11 +340,18 @@ func (h *occurrenceHandler) GetOccurrenceDetail(c *gin.Context) {
 		return
 	}
 
+	etag := occurrenceETag(detail.Version)
+	c.Header("ETag", etag)
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
 	c.JSON(http.StatusOK, detail)
 }
 
 
-func (h *occurrenceHandler) updateOccurrence(c *gin.Context) {
+func (h *occurrenceHandler) UpdateOccurrence(c *gin.Context) {
 	// get ID from path paramate
 	idStr := c.Param("occurrence_id")
 	id, err := strconv.ParseUint(idStr, 10, 32)
@@ -173,6 +360,16 @@ func (h *occurrenceHandler) updateOccurrence(c *gin.Context) {
 		return
 	}
 
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	expectedVersion, ok := parseIfMatch(c)
+	if !ok {
+		return
+	}
+
 	// binding request body
 	var req model.OccurrenceUpdate
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -181,16 +378,371 @@ func (h *occurrenceHandler) updateOccurrence(c *gin.Context) {
 	}
     
 	// to service
-	updated, err := h.service.UpdateOccurrence(uint(id), &req)
+	updated, err := h.service.UpdateOccurrence(actor, uint(id), expectedVersion, &req)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
+		if respondForbidden(c, err) {
+			return
+		}
+		if errors.Is(err, service.ErrVersionConflict) {
+			h.respondVersionConflict(c, actor, uint(id))
+		} else if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "not found occurrence the data"})
+		} else if errors.Is(err, service.ErrChildNotFound) || errors.Is(err, service.ErrInactiveInstitution) || errors.Is(err, service.ErrInvalidGeoreference) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body: " + err.Error()})
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update: " + err.Error()})
 		}
 		return
 	}
 
+	c.Header("ETag", occurrenceETag(updated.Version))
 	c.JSON(http.StatusOK, updated)
 }
 
+
+
+// PatchOccurrence は RFC 7396 (JSON Merge Patch) で一部だけ書き換えるのだ
+func (h *occurrenceHandler) PatchOccurrence(c *gin.Context) {
+	// get ID from path paramate
+	idStr := c.Param("occurrence_id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
+		return
+	}
+
+	contentType := c.ContentType()
+	if contentType != "application/merge-patch+json" && contentType != "application/json" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "content type must be application/merge-patch+json"})
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	expectedVersion, ok := parseIfMatch(c)
+	if !ok {
+		return
+	}
+
+	patch, err := c.GetRawData()
+	if err != nil || len(patch) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+
+	// to service
+	updated, err := h.service.PatchOccurrence(actor, uint(id), expectedVersion, patch)
+	if err != nil {
+		if respondForbidden(c, err) {
+			return
+		}
+		if errors.Is(err, service.ErrVersionConflict) {
+			h.respondVersionConflict(c, actor, uint(id))
+		} else if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found occurrence the data"})
+		} else if errors.Is(err, service.ErrInvalidPatch) || errors.Is(err, service.ErrChildNotFound) || errors.Is(err, service.ErrInactiveInstitution) || errors.Is(err, service.ErrInvalidGeoreference) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body: " + err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update: " + err.Error()})
+		}
+		return
+	}
+
+	c.Header("ETag", occurrenceETag(updated.Version))
+	c.JSON(http.StatusOK, updated)
+}
+
+func (h *occurrenceHandler) DeleteOccurrence(c *gin.Context) {
+	// get ID from path paramate
+	idStr := c.Param("occurrence_id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	expectedVersion, ok := parseIfMatch(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteOccurrence(actor, uint(id), expectedVersion); err != nil {
+		if respondForbidden(c, err) {
+			return
+		}
+		if errors.Is(err, service.ErrVersionConflict) {
+			h.respondVersionConflict(c, actor, uint(id))
+		} else if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found occurrence the data"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete: " + err.Error()})
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *occurrenceHandler) ListTrash(c *gin.Context) {
+	var query model.TrashQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid query paramate: " + err.Error()})
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	response, err := h.service.ListTrash(actor, &query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed get trash: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *occurrenceHandler) RestoreOccurrence(c *gin.Context) {
+	idStr := c.Param("occurrence_id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.RestoreOccurrence(actor, uint(id)); err != nil {
+		if respondForbidden(c, err) {
+			return
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found occurrence in trash"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to restore: " + err.Error()})
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *occurrenceHandler) PurgeOccurrence(c *gin.Context) {
+	idStr := c.Param("occurrence_id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.PurgeOccurrence(actor, uint(id)); err != nil {
+		if respondForbidden(c, err) {
+			return
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found occurrence in trash"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to purge: " + err.Error()})
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetOccurrenceHistory はoccurrenceの変更履歴を古い順に返すのだ
+func (h *occurrenceHandler) GetOccurrenceHistory(c *gin.Context) {
+	idStr := c.Param("occurrence_id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	history, err := h.service.GetOccurrenceHistory(actor, uint(id))
+	if err != nil {
+		if respondForbidden(c, err) {
+			return
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found occurrence the data"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed get history: " + err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"history": history})
+}
+
+// PreviewRevert は log_id か at で指定した時点に戻すと何が変わるかを返すのだ
+func (h *occurrenceHandler) PreviewRevert(c *gin.Context) {
+	idStr := c.Param("occurrence_id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
+		return
+	}
+
+	var query model.RevertQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid query paramate: " + err.Error()})
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	preview, err := h.service.PreviewRevert(actor, uint(id), &query)
+	if err != nil {
+		respondRevertError(c, err)
+		return
+	}
+
+	c.Header("ETag", occurrenceETag(preview.Version))
+	c.JSON(http.StatusOK, preview)
+}
+
+// ApplyRevert は指定した時点の状態を新しい変更として書き込むのだ。If-Matchが必要なのだ
+func (h *occurrenceHandler) ApplyRevert(c *gin.Context) {
+	idStr := c.Param("occurrence_id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
+		return
+	}
+
+	var query model.RevertQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid query paramate: " + err.Error()})
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	expectedVersion, ok := parseIfMatch(c)
+	if !ok {
+		return
+	}
+
+	updated, err := h.service.ApplyRevert(actor, uint(id), expectedVersion, &query)
+	if err != nil {
+		if respondForbidden(c, err) {
+			return
+		}
+		if errors.Is(err, service.ErrVersionConflict) {
+			h.respondVersionConflict(c, actor, uint(id))
+		} else {
+			respondRevertError(c, err)
+		}
+		return
+	}
+
+	c.Header("ETag", occurrenceETag(updated.Version))
+	c.JSON(http.StatusOK, updated)
+}
+
+// respondRevertError はrevertのエラーをステータスコードに振り分けるのだ
+func respondRevertError(c *gin.Context, err error) {
+	if respondForbidden(c, err) {
+		return
+	}
+	if errors.Is(err, service.ErrInvalidRevertTarget) || errors.Is(err, service.ErrInactiveInstitution) || errors.Is(err, service.ErrInvalidGeoreference) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	} else if errors.Is(err, service.ErrRevisionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	} else if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found occurrence the data"})
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revert: " + err.Error()})
+	}
+}
+
+// respondForbidden はプロジェクトの権限が足りないエラーなら403を返して true になるのだ
+func respondForbidden(c *gin.Context, err error) bool {
+	if !errors.Is(err, service.ErrForbidden) {
+		return false
+	}
+
+	body := model.ForbiddenResponse{Error: err.Error(), Role: c.GetString("role")}
+	var projectErr *service.ProjectForbiddenError
+	if errors.As(err, &projectErr) {
+		body.RequiredPermission = projectErr.Permission
+		body.ProjectID = &projectErr.ProjectID
+	}
+	var archivedErr *service.ProjectArchivedError
+	if errors.As(err, &archivedErr) {
+		body.ProjectID = &archivedErr.ProjectID
+	}
+	c.JSON(http.StatusForbidden, body)
+	return true
+}
+
+// occurrenceETag はoccurrenceの行バージョンからETagを作るのだ
+func occurrenceETag(version int) string {
+	return fmt.Sprintf("\"%d\"", version)
+}
+
+// parseIfMatch はIf-Matchヘッダーからバージョンを取り出すのだ。"*" の時は0 (確認しない) を返すのだ
+// ヘッダーが無かったり壊れていたりしたら、ここでレスポンスを返して false になるのだ
+func parseIfMatch(c *gin.Context) (int, bool) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" {
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": "If-Match header is required"})
+		return 0, false
+	}
+	if header == "*" {
+		return 0, true
+	}
+
+	tag := strings.Trim(strings.TrimPrefix(header, "W/"), "\"")
+	version, err := strconv.Atoi(tag)
+	if err != nil || version <= 0 {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "invalid If-Match header"})
+		return 0, false
+	}
+	return version, true
+}
+
+// respondVersionConflict は412と一緒に今のサーバーの状態を返すのだ。クライアントはこれを使ってマージできるのだ
+func (h *occurrenceHandler) respondVersionConflict(c *gin.Context, actor *model.Actor, id uint) {
+	current, err := h.service.GetOccurrenceDetail(actor, id)
+	if err != nil {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "occurrence was modified by someone else"})
+		return
+	}
+
+	c.Header("ETag", occurrenceETag(current.Version))
+	c.JSON(http.StatusPreconditionFailed, gin.H{
+		"error":   "occurrence was modified by someone else",
+		"current": current,
+	})
+}
@@ -4,14 +4,20 @@ package handler
 import (
 	"encoding/json"
 	"errors"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/saku-730/web-specimen/backend/internal/entity"
 	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/saku-730/web-specimen/backend/internal/service"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
 )
 
 // --- ステップ1: サービスのモックを作るのだ ---
@@ -38,8 +44,8 @@ func (m *mockOccurrenceService) PrepareCreatePage() (*model.Dropdowns, error) {
 	return r0, ret.Error(1)
 }
 
-func (m *mockOccurrenceService) GetDefaultValue() (*model.DefaultValues, error) {
-	ret := m.Called()
+func (m *mockOccurrenceService) GetDefaultValues(userID int) (*model.DefaultValues, error) {
+	ret := m.Called(userID)
 	var r0 *model.DefaultValues
 	if ret.Get(0) != nil {
 		r0 = ret.Get(0).(*model.DefaultValues)
@@ -47,17 +53,190 @@ func (m *mockOccurrenceService) GetDefaultValue() (*model.DefaultValues, error)
 	return r0, ret.Error(1)
 }
 
-//func (m *mockOccurrenceService) CreateOccurrence(req *model.OccurrenceCreate) (*model.Occurrence, error) {
-//	ret := m.Called(req)
-//	var r0 *model.Occurrence
-//	if ret.Get(0) != nil {
-//		r0 = ret.Get(0).(*model.Occurrence)
-//	}
-//	return r0, ret.Error(1)
-//}
+func (m *mockOccurrenceService) CreateOccurrence(actor *model.Actor, req *model.OccurrenceCreate) (*entity.Occurrence, error) {
+	ret := m.Called(actor, req)
+	var r0 *entity.Occurrence
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*entity.Occurrence)
+	}
+	return r0, ret.Error(1)
+}
 
 // AttachFiles のモックも同様に作る（今回はテストしないので中身は省略）
-// func (m *mockOccurrenceService) UploadAttachments(...) ...
+func (m *mockOccurrenceService) AttachFiles(actor *model.Actor, occurrenceID uint, files []*multipart.FileHeader) ([]string, error) {
+	ret := m.Called(actor, occurrenceID, files)
+	var r0 []string
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]string)
+	}
+	return r0, ret.Error(1)
+}
+
+func (m *mockOccurrenceService) Search(actor *model.Actor, query *model.SearchQuery) (*model.SearchResponse, error) {
+	ret := m.Called(actor, query)
+	var r0 *model.SearchResponse
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.SearchResponse)
+	}
+	return r0, ret.Error(1)
+}
+
+// SearchEach のモックは、Return に渡した結果を順番に fn に渡すのだ
+func (m *mockOccurrenceService) SearchEach(actor *model.Actor, query *model.SearchQuery, fn func(result *model.OccurrenceResult) error) error {
+	ret := m.Called(actor, query)
+	if results, ok := ret.Get(0).([]model.OccurrenceResult); ok {
+		for i := range results {
+			if err := fn(&results[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return ret.Error(1)
+}
+
+func (m *mockOccurrenceService) GetTile(actor *model.Actor, query *model.SearchQuery, z, x, y int) (*model.Tile, error) {
+	ret := m.Called(actor, query, z, x, y)
+	var r0 *model.Tile
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.Tile)
+	}
+	return r0, ret.Error(1)
+}
+
+func (m *mockOccurrenceService) GetOccurrenceDetail(actor *model.Actor, id uint) (*model.OccurrenceDetailResponse, error) {
+	ret := m.Called(actor, id)
+	var r0 *model.OccurrenceDetailResponse
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.OccurrenceDetailResponse)
+	}
+	return r0, ret.Error(1)
+}
+
+func (m *mockOccurrenceService) UpdateOccurrence(actor *model.Actor, id uint, expectedVersion int, req *model.OccurrenceUpdate) (*model.OccurrenceDetailResponse, error) {
+	ret := m.Called(actor, id, expectedVersion, req)
+	var r0 *model.OccurrenceDetailResponse
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.OccurrenceDetailResponse)
+	}
+	return r0, ret.Error(1)
+}
+
+func (m *mockOccurrenceService) PatchOccurrence(actor *model.Actor, id uint, expectedVersion int, patch []byte) (*model.OccurrenceDetailResponse, error) {
+	ret := m.Called(actor, id, expectedVersion, patch)
+	var r0 *model.OccurrenceDetailResponse
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.OccurrenceDetailResponse)
+	}
+	return r0, ret.Error(1)
+}
+
+func (m *mockOccurrenceService) DeleteOccurrence(actor *model.Actor, id uint, expectedVersion int) error {
+	return m.Called(actor, id, expectedVersion).Error(0)
+}
+
+func (m *mockOccurrenceService) ListTrash(actor *model.Actor, query *model.TrashQuery) (*model.TrashResponse, error) {
+	ret := m.Called(actor, query)
+	var r0 *model.TrashResponse
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.TrashResponse)
+	}
+	return r0, ret.Error(1)
+}
+
+func (m *mockOccurrenceService) RestoreOccurrence(actor *model.Actor, id uint) error {
+	return m.Called(actor, id).Error(0)
+}
+
+func (m *mockOccurrenceService) PurgeOccurrence(actor *model.Actor, id uint) error {
+	return m.Called(actor, id).Error(0)
+}
+
+func (m *mockOccurrenceService) PurgeExpiredTrash(retention time.Duration) (int, error) {
+	ret := m.Called(retention)
+	return ret.Int(0), ret.Error(1)
+}
+
+func (m *mockOccurrenceService) GetOccurrenceHistory(actor *model.Actor, id uint) ([]model.ChangeLogResponse, error) {
+	ret := m.Called(actor, id)
+	var r0 []model.ChangeLogResponse
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]model.ChangeLogResponse)
+	}
+	return r0, ret.Error(1)
+}
+
+func (m *mockOccurrenceService) PreviewRevert(actor *model.Actor, id uint, query *model.RevertQuery) (*model.RevertPreview, error) {
+	ret := m.Called(actor, id, query)
+	var r0 *model.RevertPreview
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.RevertPreview)
+	}
+	return r0, ret.Error(1)
+}
+
+func (m *mockOccurrenceService) ApplyRevert(actor *model.Actor, id uint, expectedVersion int, query *model.RevertQuery) (*model.OccurrenceDetailResponse, error) {
+	ret := m.Called(actor, id, expectedVersion, query)
+	var r0 *model.OccurrenceDetailResponse
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.OccurrenceDetailResponse)
+	}
+	return r0, ret.Error(1)
+}
+
+// service.EntryTemplateService のモックなのだ。GET /create?template= のテストで使うのだ
+type mockEntryTemplateService struct {
+	mock.Mock
+}
+
+func (m *mockEntryTemplateService) ListTemplates(actor *model.Actor) ([]model.EntryTemplateResponse, error) {
+	ret := m.Called(actor)
+	var r0 []model.EntryTemplateResponse
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]model.EntryTemplateResponse)
+	}
+	return r0, ret.Error(1)
+}
+
+func (m *mockEntryTemplateService) GetTemplate(actor *model.Actor, id uint) (*model.EntryTemplateResponse, error) {
+	ret := m.Called(actor, id)
+	var r0 *model.EntryTemplateResponse
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.EntryTemplateResponse)
+	}
+	return r0, ret.Error(1)
+}
+
+func (m *mockEntryTemplateService) CreateTemplate(actor *model.Actor, req *model.EntryTemplateRequest) (*model.EntryTemplateResponse, error) {
+	ret := m.Called(actor, req)
+	var r0 *model.EntryTemplateResponse
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.EntryTemplateResponse)
+	}
+	return r0, ret.Error(1)
+}
+
+func (m *mockEntryTemplateService) UpdateTemplate(actor *model.Actor, id uint, req *model.EntryTemplateRequest) (*model.EntryTemplateResponse, error) {
+	ret := m.Called(actor, id, req)
+	var r0 *model.EntryTemplateResponse
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.EntryTemplateResponse)
+	}
+	return r0, ret.Error(1)
+}
+
+func (m *mockEntryTemplateService) DeleteTemplate(actor *model.Actor, id uint) error {
+	ret := m.Called(actor, id)
+	return ret.Error(0)
+}
+
+func (m *mockEntryTemplateService) TemplateDefaultValues(actor *model.Actor, id uint) (*model.DefaultValues, error) {
+	ret := m.Called(actor, id)
+	var r0 *model.DefaultValues
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.DefaultValues)
+	}
+	return r0, ret.Error(1)
+}
 
 // --- ステップ2: テスト関数を書くのだ ---
 
@@ -75,11 +254,13 @@ func TestGetCreatePage(t *testing.T) {
 
 		// モックの振る舞いを定義：「このメソッドが呼ばれたら、この値を返す」と設定
 		mockService.On("PrepareCreatePage").Return(expectedDropdowns, nil)
-		mockService.On("GetDefaultValue").Return(expectedDefaults, nil)
+		mockService.On("GetDefaultValues", 1).Return(expectedDefaults, nil)
 		
 		// テスト用のHTTPレコーダーとGinコンテキストを作成
 		w := httptest.NewRecorder()
 		c, _ := gin.CreateTestContext(w)
+		// 認証ミドルウェアがセットするuserIDを代わりに入れておくのだ
+		c.Set("userID", 1)
 
 		// ハンドラに本物ではなく、モックのサービスを注入する！
 		handler := &occurrenceHandler{service: mockService}
@@ -120,11 +301,601 @@ func TestGetCreatePage(t *testing.T) {
 		// ステータスコードが 500 Internal Server Error か？
 		assert.Equal(t, http.StatusInternalServerError, w.Code)
 		
-		// GetDefaultValue は呼ばれていないはずなのだ
-		mockService.AssertNotCalled(t, "GetDefaultValue")
+		// GetDefaultValues は呼ばれていないはずなのだ
+		mockService.AssertNotCalled(t, "GetDefaultValues")
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("テンプレートを指定したケース", func(t *testing.T) {
+		mockService := new(mockOccurrenceService)
+		mockTemplates := new(mockEntryTemplateService)
+
+		projectName := "pitfall survey"
+		projectID := 3
+		expectedDropdowns := &model.Dropdowns{}
+		expectedDefaults := &model.DefaultValues{UserID: 1, ProjectID: &projectID, ProjectName: &projectName}
+
+		mockService.On("PrepareCreatePage").Return(expectedDropdowns, nil)
+		mockTemplates.On("TemplateDefaultValues", &model.Actor{UserID: 1, Role: "editor"}, uint(7)).Return(expectedDefaults, nil)
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/create?template=7", nil)
+		c.Set("userID", 1)
+		c.Set("role", "editor")
+
+		handler := &occurrenceHandler{service: mockService, templates: mockTemplates}
+		handler.GetCreatePage(c)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var pageData model.CreatePageData
+		json.Unmarshal(w.Body.Bytes(), &pageData)
+		assert.Equal(t, *expectedDefaults, pageData.DefaultValue)
+
+		// テンプレートを使う時は、ユーザーのデフォルト値は読まないのだ
+		mockService.AssertNotCalled(t, "GetDefaultValues")
 		mockService.AssertExpectations(t)
+		mockTemplates.AssertExpectations(t)
+	})
+
+	t.Run("見られないテンプレートを指定したケース", func(t *testing.T) {
+		mockService := new(mockOccurrenceService)
+		mockTemplates := new(mockEntryTemplateService)
+
+		mockService.On("PrepareCreatePage").Return(&model.Dropdowns{}, nil)
+		mockTemplates.On("TemplateDefaultValues", mock.Anything, uint(8)).Return(nil, service.ErrForbidden)
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/create?template=8", nil)
+		c.Set("userID", 1)
+
+		handler := &occurrenceHandler{service: mockService, templates: mockTemplates}
+		handler.GetCreatePage(c)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		mockTemplates.AssertExpectations(t)
 	})
 }
 
 // CreateOccurrence のテストも同様に書けるのだ！
 // t.Run() を使うと、1つのテスト関数の中に複数のテストケースを書けて便利なのだ。
+
+func TestUpdateOccurrence(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("成功ケース", func(t *testing.T) {
+		mockService := new(mockOccurrenceService)
+		expected := &model.OccurrenceDetailResponse{OccurrenceID: 5, Version: 3, UserID: 1}
+		mockService.On("UpdateOccurrence", &model.Actor{UserID: 1}, uint(5), 2, mock.AnythingOfType("*model.OccurrenceUpdate")).Return(expected, nil)
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Set("userID", 1)
+		c.Params = gin.Params{{Key: "occurrence_id", Value: "5"}}
+		c.Request = httptest.NewRequest(http.MethodPut, "/occurrences/5", strings.NewReader(`{"user_id":1,"observation":[{"observation_id":3,"behavior":"flying"},{"behavior":"resting"}]}`))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Request.Header.Set("If-Match", `"2"`)
+
+		handler := &occurrenceHandler{service: mockService}
+		handler.UpdateOccurrence(c)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+
+		// 子レコードのIDがあるものと無いものが、ちゃんと区別されてserviceに渡っているか確認するのだ
+		req := mockService.Calls[0].Arguments.Get(3).(*model.OccurrenceUpdate)
+		assert.Len(t, req.Observations, 2)
+		assert.Equal(t, uint(3), *req.Observations[0].ObservationID)
+		assert.Nil(t, req.Observations[1].ObservationID)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("存在しないoccurrenceのケース", func(t *testing.T) {
+		mockService := new(mockOccurrenceService)
+		mockService.On("UpdateOccurrence", &model.Actor{UserID: 1}, uint(9), 0, mock.Anything).Return(nil, gorm.ErrRecordNotFound)
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Set("userID", 1)
+		c.Params = gin.Params{{Key: "occurrence_id", Value: "9"}}
+		c.Request = httptest.NewRequest(http.MethodPut, "/occurrences/9", strings.NewReader(`{"user_id":1}`))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Request.Header.Set("If-Match", "*")
+
+		handler := &occurrenceHandler{service: mockService}
+		handler.UpdateOccurrence(c)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("user_idが無いと400なのだ", func(t *testing.T) {
+		mockService := new(mockOccurrenceService)
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Set("userID", 1)
+		c.Params = gin.Params{{Key: "occurrence_id", Value: "5"}}
+		c.Request = httptest.NewRequest(http.MethodPut, "/occurrences/5", strings.NewReader(`{"note":"no owner"}`))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Request.Header.Set("If-Match", `"2"`)
+
+		handler := &occurrenceHandler{service: mockService}
+		handler.UpdateOccurrence(c)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		mockService.AssertNotCalled(t, "UpdateOccurrence", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestPatchOccurrence(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("merge-patch+jsonならそのままserviceに渡すのだ", func(t *testing.T) {
+		mockService := new(mockOccurrenceService)
+		body := `{"note":null,"classification":{"genus":"Carabus"}}`
+		mockService.On("PatchOccurrence", &model.Actor{UserID: 1}, uint(5), 4, []byte(body)).Return(&model.OccurrenceDetailResponse{OccurrenceID: 5}, nil)
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Set("userID", 1)
+		c.Params = gin.Params{{Key: "occurrence_id", Value: "5"}}
+		c.Request = httptest.NewRequest(http.MethodPatch, "/occurrences/5", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/merge-patch+json")
+		c.Request.Header.Set("If-Match", `W/"4"`)
+
+		handler := &occurrenceHandler{service: mockService}
+		handler.PatchOccurrence(c)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("Content-Typeが違うと415なのだ", func(t *testing.T) {
+		mockService := new(mockOccurrenceService)
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Set("userID", 1)
+		c.Params = gin.Params{{Key: "occurrence_id", Value: "5"}}
+		c.Request = httptest.NewRequest(http.MethodPatch, "/occurrences/5", strings.NewReader(`note=x`))
+		c.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		handler := &occurrenceHandler{service: mockService}
+		handler.PatchOccurrence(c)
+
+		assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+		mockService.AssertNotCalled(t, "PatchOccurrence")
+	})
+
+	t.Run("壊れたpatchは400なのだ", func(t *testing.T) {
+		mockService := new(mockOccurrenceService)
+		mockService.On("PatchOccurrence", &model.Actor{UserID: 1}, uint(5), 0, mock.Anything).Return(nil, service.ErrInvalidPatch)
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Set("userID", 1)
+		c.Params = gin.Params{{Key: "occurrence_id", Value: "5"}}
+		c.Request = httptest.NewRequest(http.MethodPatch, "/occurrences/5", strings.NewReader(`[1,2]`))
+		c.Request.Header.Set("Content-Type", "application/merge-patch+json")
+		c.Request.Header.Set("If-Match", "*")
+
+		handler := &occurrenceHandler{service: mockService}
+		handler.PatchOccurrence(c)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestOccurrenceConcurrency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("If-Matchが無いと428なのだ", func(t *testing.T) {
+		mockService := new(mockOccurrenceService)
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Set("userID", 1)
+		c.Params = gin.Params{{Key: "occurrence_id", Value: "5"}}
+		c.Request = httptest.NewRequest(http.MethodDelete, "/occurrences/5", nil)
+
+		handler := &occurrenceHandler{service: mockService}
+		handler.DeleteOccurrence(c)
+
+		assert.Equal(t, http.StatusPreconditionRequired, w.Code)
+		mockService.AssertNotCalled(t, "DeleteOccurrence")
+	})
+
+	t.Run("バージョンが合わないと412と今の状態を返すのだ", func(t *testing.T) {
+		mockService := new(mockOccurrenceService)
+		current := &model.OccurrenceDetailResponse{OccurrenceID: 5, Version: 7}
+		mockService.On("DeleteOccurrence", &model.Actor{UserID: 1}, uint(5), 6).Return(service.ErrVersionConflict)
+		mockService.On("GetOccurrenceDetail", &model.Actor{UserID: 1}, uint(5)).Return(current, nil)
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Set("userID", 1)
+		c.Params = gin.Params{{Key: "occurrence_id", Value: "5"}}
+		c.Request = httptest.NewRequest(http.MethodDelete, "/occurrences/5", nil)
+		c.Request.Header.Set("If-Match", `"6"`)
+
+		handler := &occurrenceHandler{service: mockService}
+		handler.DeleteOccurrence(c)
+
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+		assert.Equal(t, `"7"`, w.Header().Get("ETag"))
+
+		var body struct {
+			Current model.OccurrenceDetailResponse `json:"current"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		assert.Equal(t, 7, body.Current.Version)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("GETでETagを返すのだ", func(t *testing.T) {
+		mockService := new(mockOccurrenceService)
+		mockService.On("GetOccurrenceDetail", &model.Actor{UserID: 1}, uint(5)).Return(&model.OccurrenceDetailResponse{OccurrenceID: 5, Version: 2}, nil)
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Set("userID", 1)
+		c.Params = gin.Params{{Key: "occurrence_id", Value: "5"}}
+		c.Request = httptest.NewRequest(http.MethodGet, "/occurrences/5", nil)
+
+		handler := &occurrenceHandler{service: mockService}
+		handler.GetOccurrenceDetail(c)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	})
+}
+
+func TestGetOccurrenceHistory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("変更履歴をそのまま返すのだ", func(t *testing.T) {
+		mockService := new(mockOccurrenceService)
+		rowID := 5
+		history := []model.ChangeLogResponse{
+			{LogID: 1, Operation: "create", TableName: "occurrence", RowID: &rowID, Before: json.RawMessage("null"), After: json.RawMessage(`{"note":"a"}`)},
+			{LogID: 2, Operation: "update", TableName: "occurrence", RowID: &rowID, Before: json.RawMessage(`{"note":"a"}`), After: json.RawMessage(`{"note":"b"}`)},
+		}
+		mockService.On("GetOccurrenceHistory", &model.Actor{UserID: 1}, uint(5)).Return(history, nil)
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Set("userID", 1)
+		c.Params = gin.Params{{Key: "occurrence_id", Value: "5"}}
+		c.Request = httptest.NewRequest(http.MethodGet, "/occurrences/5/history", nil)
+
+		handler := &occurrenceHandler{service: mockService}
+		handler.GetOccurrenceHistory(c)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var body struct {
+			History []model.ChangeLogResponse `json:"history"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		assert.Len(t, body.History, 2)
+		assert.Equal(t, "update", body.History[1].Operation)
+		assert.JSONEq(t, `{"note":"b"}`, string(body.History[1].After))
+		mockService.AssertExpectations(t)
+	})
+}
+
+func TestRevertOccurrence(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("log_idでプレビューを返すのだ", func(t *testing.T) {
+		mockService := new(mockOccurrenceService)
+		logID := uint(12)
+		preview := &model.RevertPreview{
+			OccurrenceID: 5,
+			Version:      4,
+			LogID:        12,
+			Changes:      []model.RevertChange{{Field: "note", Current: json.RawMessage(`"b"`), Reverted: json.RawMessage(`"a"`)}},
+		}
+		mockService.On("PreviewRevert", &model.Actor{UserID: 1}, uint(5), &model.RevertQuery{LogID: &logID}).Return(preview, nil)
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Set("userID", 1)
+		c.Params = gin.Params{{Key: "occurrence_id", Value: "5"}}
+		c.Request = httptest.NewRequest(http.MethodGet, "/occurrences/5/revert?log_id=12", nil)
+
+		handler := &occurrenceHandler{service: mockService}
+		handler.PreviewRevert(c)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `"4"`, w.Header().Get("ETag"))
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("log_idもatも無いと400なのだ", func(t *testing.T) {
+		mockService := new(mockOccurrenceService)
+		mockService.On("PreviewRevert", &model.Actor{UserID: 1}, uint(5), &model.RevertQuery{}).Return(nil, service.ErrInvalidRevertTarget)
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Set("userID", 1)
+		c.Params = gin.Params{{Key: "occurrence_id", Value: "5"}}
+		c.Request = httptest.NewRequest(http.MethodGet, "/occurrences/5/revert", nil)
+
+		handler := &occurrenceHandler{service: mockService}
+		handler.PreviewRevert(c)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("適用するとETagを返すのだ", func(t *testing.T) {
+		mockService := new(mockOccurrenceService)
+		at := time.Date(2025, 4, 1, 9, 0, 0, 0, time.UTC)
+		mockService.On("ApplyRevert", &model.Actor{UserID: 1}, uint(5), 4, mock.AnythingOfType("*model.RevertQuery")).
+			Return(&model.OccurrenceDetailResponse{OccurrenceID: 5, Version: 5}, nil)
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Set("userID", 1)
+		c.Params = gin.Params{{Key: "occurrence_id", Value: "5"}}
+		c.Request = httptest.NewRequest(http.MethodPost, "/occurrences/5/revert?at=2025-04-01T09:00:00Z", nil)
+		c.Request.Header.Set("If-Match", `"4"`)
+
+		handler := &occurrenceHandler{service: mockService}
+		handler.ApplyRevert(c)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `"5"`, w.Header().Get("ETag"))
+		query := mockService.Calls[0].Arguments.Get(3).(*model.RevertQuery)
+		assert.True(t, at.Equal(*query.At))
+		mockService.AssertExpectations(t)
+	})
+}
+
+func TestProjectForbidden(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("プロジェクトの権限が足りないと403とプロジェクトIDを返すのだ", func(t *testing.T) {
+		mockService := new(mockOccurrenceService)
+		forbidden := &service.ProjectForbiddenError{ProjectID: 3, Permission: model.PermissionDeleteOccurrence}
+		mockService.On("DeleteOccurrence", &model.Actor{UserID: 1, Role: model.RoleCurator}, uint(5), 0).Return(forbidden)
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Set("userID", 1)
+		c.Set("role", model.RoleCurator)
+		c.Params = gin.Params{{Key: "occurrence_id", Value: "5"}}
+		c.Request = httptest.NewRequest(http.MethodDelete, "/occurrences/5", nil)
+		c.Request.Header.Set("If-Match", "*")
+
+		handler := &occurrenceHandler{service: mockService}
+		handler.DeleteOccurrence(c)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		var body model.ForbiddenResponse
+		json.Unmarshal(w.Body.Bytes(), &body)
+		assert.Equal(t, model.PermissionDeleteOccurrence, body.RequiredPermission)
+		assert.Equal(t, uint(3), *body.ProjectID)
+		assert.Equal(t, model.RoleCurator, body.Role)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("アーカイブしたプロジェクトは管理者でも403なのだ", func(t *testing.T) {
+		mockService := new(mockOccurrenceService)
+		archived := &service.ProjectArchivedError{ProjectID: 4}
+		mockService.On("DeleteOccurrence", &model.Actor{UserID: 1, Role: model.RoleAdmin}, uint(6), 0).Return(archived)
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Set("userID", 1)
+		c.Set("role", model.RoleAdmin)
+		c.Params = gin.Params{{Key: "occurrence_id", Value: "6"}}
+		c.Request = httptest.NewRequest(http.MethodDelete, "/occurrences/6", nil)
+		c.Request.Header.Set("If-Match", "*")
+
+		handler := &occurrenceHandler{service: mockService}
+		handler.DeleteOccurrence(c)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		var body model.ForbiddenResponse
+		json.Unmarshal(w.Body.Bytes(), &body)
+		assert.Equal(t, uint(4), *body.ProjectID)
+		assert.Contains(t, body.Error, "archived")
+		mockService.AssertExpectations(t)
+	})
+}
+
+func TestSearchGeoJSON(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	actor := &model.Actor{UserID: 1, Role: model.RoleAdmin}
+	lat, lng := 35.6, 139.7
+	species := "Apis cerana"
+
+	newContext := func(target string, accept string) (*httptest.ResponseRecorder, *gin.Context) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Set("userID", 1)
+		c.Set("role", model.RoleAdmin)
+		c.Request = httptest.NewRequest(http.MethodGet, target, nil)
+		if accept != "" {
+			c.Request.Header.Set("Accept", accept)
+		}
+		return w, c
+	}
+
+	t.Run("format=geojsonならFeatureCollectionを返すのだ", func(t *testing.T) {
+		mockService := new(mockOccurrenceService)
+		results := []model.OccurrenceResult{
+			{OccurrenceID: 2, UserName: "saku", Latitude: &lat, Longitude: &lng, Classification: &model.ClassificationResult{Species: &species}},
+			{OccurrenceID: 1, UserName: "saku"},
+		}
+		mockService.On("SearchEach", actor, mock.AnythingOfType("*model.SearchQuery")).Return(results, nil)
+
+		w, c := newContext("/search?format=geojson&species=Apis", "")
+		handler := &occurrenceHandler{service: mockService}
+		handler.SearchPage(c)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, model.GeoJSONMediaType, w.Header().Get("Content-Type"))
+		var body struct {
+			Type     string `json:"type"`
+			Features []struct {
+				Type     string                 `json:"type"`
+				ID       uint                   `json:"id"`
+				Geometry *model.PointGeometry   `json:"geometry"`
+				Props    map[string]interface{} `json:"properties"`
+			} `json:"features"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Equal(t, "FeatureCollection", body.Type)
+		assert.Len(t, body.Features, 2)
+		assert.Equal(t, uint(2), body.Features[0].ID)
+		assert.Equal(t, [2]float64{lng, lat}, body.Features[0].Geometry.Coordinates) // 経度が先なのだ
+		assert.Equal(t, species, body.Features[0].Props["species"])
+		assert.Nil(t, body.Features[1].Geometry)
+		assert.Contains(t, body.Features[1].Props, "species") // 値が無くてもキーはそろうのだ
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("Acceptヘッダーだけでも、結果が無くてもGeoJSONなのだ", func(t *testing.T) {
+		mockService := new(mockOccurrenceService)
+		mockService.On("SearchEach", actor, mock.AnythingOfType("*model.SearchQuery")).Return(nil, nil)
+
+		w, c := newContext("/search", model.GeoJSONMediaType)
+		handler := &occurrenceHandler{service: mockService}
+		handler.SearchPage(c)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"type":"FeatureCollection","features":[]}`, w.Body.String())
+		mockService.AssertNotCalled(t, "PrepareCreatePage")
+	})
+
+	t.Run("書き始める前のエラーはふつうのエラーで返すのだ", func(t *testing.T) {
+		mockService := new(mockOccurrenceService)
+		mockService.On("SearchEach", actor, mock.AnythingOfType("*model.SearchQuery")).Return(nil, service.ErrInvalidSpatialFilter)
+
+		w, c := newContext("/search?format=geojson&bbox=1,2,3", "")
+		handler := &occurrenceHandler{service: mockService}
+		handler.SearchPage(c)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestGetTile(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	actor := &model.Actor{UserID: 1, Role: model.RoleAdmin}
+
+	// 304や204はボディが無いので、ルーターを通して最後にヘッダーを書かせるのだ
+	serve := func(handler *occurrenceHandler, path string, ifNoneMatch string) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.GET("/tiles/:z/:x/:y", func(c *gin.Context) {
+			c.Set("userID", 1)
+			c.Set("role", model.RoleAdmin)
+			handler.GetTile(c)
+		})
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("タイルとETagを返して、同じETagなら304なのだ", func(t *testing.T) {
+		mockService := new(mockOccurrenceService)
+		tile := &model.Tile{Data: []byte{0x1a, 0x02}, ETag: `"42-abc"`}
+		mockService.On("GetTile", actor, mock.MatchedBy(func(q *model.SearchQuery) bool { return q.Species == "Apis" }), 3, 7, 2).Return(tile, nil)
+		handler := &occurrenceHandler{service: mockService}
+
+		w := serve(handler, "/tiles/3/7/2.mvt?species=Apis", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, model.MVTMediaType, w.Header().Get("Content-Type"))
+		assert.Equal(t, `"42-abc"`, w.Header().Get("ETag"))
+		assert.Equal(t, tile.Data, w.Body.Bytes())
+
+		w = serve(handler, "/tiles/3/7/2.mvt?species=Apis", `"42-abc"`)
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Empty(t, w.Body.Bytes())
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("点が無いタイルは204なのだ", func(t *testing.T) {
+		mockService := new(mockOccurrenceService)
+		mockService.On("GetTile", actor, mock.Anything, 0, 0, 0).Return(&model.Tile{ETag: `"1-x"`}, nil)
+
+		w := serve(&occurrenceHandler{service: mockService}, "/tiles/0/0/0.mvt", "")
+		assert.Equal(t, http.StatusNoContent, w.Code)
+	})
+
+	t.Run("パスが壊れていたり範囲外なら400なのだ", func(t *testing.T) {
+		mockService := new(mockOccurrenceService)
+		mockService.On("GetTile", actor, mock.Anything, 1, 5, 0).Return(nil, service.ErrInvalidTile)
+		handler := &occurrenceHandler{service: mockService}
+
+		w := serve(handler, "/tiles/1/0/0.png", "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = serve(handler, "/tiles/1/5/0.mvt", "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		mockService.AssertExpectations(t)
+	})
+}
+
+func TestCreateOccurrenceGeoreference(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	actor := &model.Actor{UserID: 1}
+
+	create := func(handler *occurrenceHandler, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Set("userID", 1)
+		c.Request = httptest.NewRequest(http.MethodPost, "/create", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		handler.CreateOccurrence(c)
+		return w
+	}
+
+	t.Run("座標の不確かさと決め方がserviceに渡るのだ", func(t *testing.T) {
+		mockService := new(mockOccurrenceService)
+		mockService.On("CreateOccurrence", actor, mock.AnythingOfType("*model.OccurrenceCreate")).Return(&entity.Occurrence{OccurrenceID: 4}, nil)
+
+		w := create(&occurrenceHandler{service: mockService}, `{"user_id":1,"latitude":35.6,"longitude":139.7,"coordinate_uncertainty_in_meters":30,"georeference_source":"gps","geodetic_datum":"WGS84","georeferenced_by":"Sato","georeferenced_date":"2024-05-01"}`)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		req := mockService.Calls[0].Arguments.Get(1).(*model.OccurrenceCreate)
+		assert.Equal(t, 30.0, *req.CoordinateUncertaintyInMeters)
+		assert.Equal(t, "gps", *req.GeoreferenceSource)
+		assert.Equal(t, "WGS84", *req.GeodeticDatum)
+		assert.Equal(t, "Sato", *req.GeoreferencedBy)
+		assert.Equal(t, "2024-05-01", *req.GeoreferencedDate)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("読めない値はserviceを呼ばないで400なのだ", func(t *testing.T) {
+		mockService := new(mockOccurrenceService)
+		handler := &occurrenceHandler{service: mockService}
+
+		for _, body := range []string{
+			`{"user_id":1,"coordinate_uncertainty_in_meters":-1}`,
+			`{"user_id":1,"georeference_source":"guess"}`,
+			`{"user_id":1,"georeferenced_date":"01/05/2024"}`,
+		} {
+			w := create(handler, body)
+			assert.Equal(t, http.StatusBadRequest, w.Code, body)
+		}
+		mockService.AssertNotCalled(t, "CreateOccurrence")
+	})
+
+	t.Run("serviceが正しくないと返したら400なのだ", func(t *testing.T) {
+		mockService := new(mockOccurrenceService)
+		mockService.On("CreateOccurrence", actor, mock.Anything).Return(nil, service.ErrInvalidGeoreference)
+
+		w := create(&occurrenceHandler{service: mockService}, `{"user_id":1,"latitude":35.6,"longitude":139.7}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		mockService.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,89 @@
+// internal/handler/oidc_handler.go
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saku-730/web-specimen/backend/internal/oidc"
+	"github.com/saku-730/web-specimen/backend/internal/service"
+)
+
+// oidcStateCookie はログイン途中のstateを持っておくcookieの名前なのだ
+const oidcStateCookie = "oidc_state"
+
+type OIDCHandler interface {
+	Login(c *gin.Context)
+	Callback(c *gin.Context)
+}
+
+type oidcHandler struct {
+	service      service.OIDCService
+	secureCookie bool
+}
+
+// NewOIDCHandler のsecureCookieは、https で動かす時にtrueにするのだ
+func NewOIDCHandler(s service.OIDCService, secureCookie bool) OIDCHandler {
+	return &oidcHandler{service: s, secureCookie: secureCookie}
+}
+
+// Login はstateをcookieに入れて、ブラウザをIdPのログイン画面にリダイレクトするのだ
+func (h *oidcHandler) Login(c *gin.Context) {
+	if !h.service.Enabled() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "oidc login is not configured"})
+		return
+	}
+
+	start, err := h.service.BeginLogin(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "failed start oidc login"})
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, start.StateCookie, start.MaxAge, "/", "", h.secureCookie, true)
+	c.Redirect(http.StatusFound, start.AuthURL)
+}
+
+// Callback はIdPから戻ってきた認可コードで、アプリのトークンを発行するのだ
+func (h *oidcHandler) Callback(c *gin.Context) {
+	if !h.service.Enabled() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "oidc login is not configured"})
+		return
+	}
+
+	// stateは一度しか使わないので、成功しても失敗してもcookieは消すのだ
+	stateCookie, _ := c.Cookie(oidcStateCookie)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, "", -1, "/", "", h.secureCookie, true)
+
+	if idpError := c.Query("error"); idpError != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "oidc login failed: " + idpError, "error_description": c.Query("error_description")})
+		return
+	}
+	code := c.Query("code")
+	if code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code is required"})
+		return
+	}
+
+	tokens, err := h.service.CompleteLogin(c.Request.Context(), code, c.Query("state"), stateCookie)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrOIDCInvalidState):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, oidc.ErrInvalidIDToken):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid id token"})
+		case errors.Is(err, service.ErrOIDCNoAccount), errors.Is(err, service.ErrAccountDeactivated):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrOIDCAccountConflict):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusBadGateway, gin.H{"error": "failed complete oidc login"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
@@ -0,0 +1,272 @@
+// internal/handler/project_handler.go
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/saku-730/web-specimen/backend/internal/service"
+	"gorm.io/gorm"
+)
+
+type ProjectHandler interface {
+	ListProjects(c *gin.Context)
+	GetProject(c *gin.Context)
+	CreateProject(c *gin.Context)
+	UpdateProject(c *gin.Context)
+	DeleteProject(c *gin.Context)
+	ArchiveProject(c *gin.Context)
+	UnarchiveProject(c *gin.Context)
+	ListMembers(c *gin.Context)
+	AddMember(c *gin.Context)
+	UpdateMember(c *gin.Context)
+	RemoveMember(c *gin.Context)
+}
+
+type projectHandler struct {
+	service service.ProjectService
+}
+
+func NewProjectHandler(s service.ProjectService) ProjectHandler {
+	return &projectHandler{service: s}
+}
+
+// ListProjects はプロジェクトの一覧を返すのだ
+func (h *projectHandler) ListProjects(c *gin.Context) {
+	var query model.ProjectQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid query paramate: " + err.Error()})
+		return
+	}
+
+	projects, err := h.service.ListProjects(&query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed get projects"})
+		return
+	}
+
+	c.JSON(http.StatusOK, projects)
+}
+
+func (h *projectHandler) GetProject(c *gin.Context) {
+	id, ok := uintParam(c, "project_id")
+	if !ok {
+		return
+	}
+
+	project, err := h.service.GetProject(id)
+	if err != nil {
+		respondProjectError(c, err, "failed get project")
+		return
+	}
+
+	c.JSON(http.StatusOK, project)
+}
+
+// CreateProject はプロジェクトを作って、201と作ったプロジェクトを返すのだ
+func (h *projectHandler) CreateProject(c *gin.Context) {
+	var req model.ProjectRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request format: " + err.Error()})
+		return
+	}
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	project, err := h.service.CreateProject(actor, &req)
+	if err != nil {
+		respondProjectError(c, err, "failed create project")
+		return
+	}
+
+	c.Header("Location", fmt.Sprintf("/project/%d", project.ProjectID))
+	c.JSON(http.StatusCreated, project)
+}
+
+func (h *projectHandler) UpdateProject(c *gin.Context) {
+	id, ok := uintParam(c, "project_id")
+	if !ok {
+		return
+	}
+	var req model.ProjectRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request format: " + err.Error()})
+		return
+	}
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	project, err := h.service.UpdateProject(actor, id, &req)
+	if err != nil {
+		respondProjectError(c, err, "failed update project")
+		return
+	}
+
+	c.JSON(http.StatusOK, project)
+}
+
+func (h *projectHandler) DeleteProject(c *gin.Context) {
+	id, ok := uintParam(c, "project_id")
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteProject(id); err != nil {
+		respondProjectError(c, err, "failed delete project")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ArchiveProject はプロジェクトをアーカイブして、中のoccurrenceを読むだけにするのだ
+func (h *projectHandler) ArchiveProject(c *gin.Context) {
+	id, ok := uintParam(c, "project_id")
+	if !ok {
+		return
+	}
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	project, err := h.service.ArchiveProject(actor, id)
+	if err != nil {
+		respondProjectError(c, err, "failed archive project")
+		return
+	}
+
+	c.JSON(http.StatusOK, project)
+}
+
+func (h *projectHandler) UnarchiveProject(c *gin.Context) {
+	id, ok := uintParam(c, "project_id")
+	if !ok {
+		return
+	}
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	project, err := h.service.UnarchiveProject(actor, id)
+	if err != nil {
+		respondProjectError(c, err, "failed unarchive project")
+		return
+	}
+
+	c.JSON(http.StatusOK, project)
+}
+
+func (h *projectHandler) ListMembers(c *gin.Context) {
+	id, ok := uintParam(c, "project_id")
+	if !ok {
+		return
+	}
+
+	members, err := h.service.ListMembers(id)
+	if err != nil {
+		respondProjectError(c, err, "failed get project members")
+		return
+	}
+
+	c.JSON(http.StatusOK, members)
+}
+
+func (h *projectHandler) AddMember(c *gin.Context) {
+	id, ok := uintParam(c, "project_id")
+	if !ok {
+		return
+	}
+	var req model.ProjectMemberCreate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request format: " + err.Error()})
+		return
+	}
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	member, err := h.service.AddMember(actor, id, &req)
+	if err != nil {
+		respondProjectError(c, err, "failed add project member")
+		return
+	}
+
+	c.JSON(http.StatusCreated, member)
+}
+
+func (h *projectHandler) UpdateMember(c *gin.Context) {
+	id, ok := uintParam(c, "project_id")
+	if !ok {
+		return
+	}
+	memberID, ok := uintParam(c, "project_member_id")
+	if !ok {
+		return
+	}
+	var req model.ProjectMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request format: " + err.Error()})
+		return
+	}
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	member, err := h.service.UpdateMember(actor, id, memberID, &req)
+	if err != nil {
+		respondProjectError(c, err, "failed update project member")
+		return
+	}
+
+	c.JSON(http.StatusOK, member)
+}
+
+func (h *projectHandler) RemoveMember(c *gin.Context) {
+	id, ok := uintParam(c, "project_id")
+	if !ok {
+		return
+	}
+	memberID, ok := uintParam(c, "project_member_id")
+	if !ok {
+		return
+	}
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.RemoveMember(actor, id, memberID); err != nil {
+		respondProjectError(c, err, "failed remove project member")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// respondProjectError はプロジェクト管理のエラーをステータスコードに変えるのだ
+func respondProjectError(c *gin.Context, err error, fallback string) {
+	if respondForbidden(c, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found project"})
+	case errors.Is(err, service.ErrProjectInUse), errors.Is(err, service.ErrAlreadyMember):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidProjectDates), errors.Is(err, service.ErrUnknownUser):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
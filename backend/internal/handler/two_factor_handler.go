@@ -0,0 +1,146 @@
+// internal/handler/two_factor_handler.go
+package handler
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/saku-730/web-specimen/backend/internal/service"
+	"gorm.io/gorm"
+)
+
+type TwoFactorHandler interface {
+	EnrollTOTP(c *gin.Context)
+	ConfirmTOTP(c *gin.Context)
+	DisableTOTP(c *gin.Context)
+	RegenerateRecoveryCodes(c *gin.Context)
+	ResetUserTOTP(c *gin.Context)
+}
+
+type twoFactorHandler struct {
+	service service.TwoFactorService
+}
+
+func NewTwoFactorHandler(s service.TwoFactorService) TwoFactorHandler {
+	return &twoFactorHandler{service: s}
+}
+
+// EnrollTOTP は2段階認証の登録を始めて、認証アプリに読み込ませるURIを返すのだ
+func (h *twoFactorHandler) EnrollTOTP(c *gin.Context) {
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	enroll, err := h.service.EnrollTOTP(actor)
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, enroll)
+}
+
+// ConfirmTOTP は認証アプリのコードで登録を終えて、リカバリーコードを返すのだ
+func (h *twoFactorHandler) ConfirmTOTP(c *gin.Context) {
+	var req model.TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request format: " + err.Error()})
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	codes, err := h.service.ConfirmTOTP(actor, req.Code)
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, codes)
+}
+
+func (h *twoFactorHandler) DisableTOTP(c *gin.Context) {
+	var req model.TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request format: " + err.Error()})
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DisableTOTP(actor, req.Code, clientInfoFromContext(c)); err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *twoFactorHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	var req model.TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request format: " + err.Error()})
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	codes, err := h.service.RegenerateRecoveryCodes(actor, req.Code, clientInfoFromContext(c))
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, codes)
+}
+
+// ResetUserTOTP は管理者が他のユーザーの2段階認証を外すのだ
+func (h *twoFactorHandler) ResetUserTOTP(c *gin.Context) {
+	idStr := c.Param("user_id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
+		return
+	}
+
+	if err := h.service.ResetTOTP(uint(id)); err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// respondTwoFactorError は2段階認証のエラーをステータスコードにするのだ
+func respondTwoFactorError(c *gin.Context, err error) {
+	var locked *service.LoginLockedError
+	if errors.As(err, &locked) {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many failed attempts, try again later"})
+		return
+	}
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found user"})
+	case errors.Is(err, service.ErrInvalidTwoFactorCode), errors.Is(err, service.ErrTOTPNotEnrolled):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrTOTPAlreadyEnabled), errors.Is(err, service.ErrTOTPNotEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server error occured"})
+	}
+}
@@ -0,0 +1,69 @@
+// internal/handler/user_defaults_handler.go
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/saku-730/web-specimen/backend/internal/service"
+)
+
+type UserDefaultsHandler interface {
+	GetDefaults(c *gin.Context)
+	SaveDefaults(c *gin.Context)
+}
+
+type userDefaultsHandler struct {
+	service service.UserDefaultsService
+}
+
+func NewUserDefaultsHandler(s service.UserDefaultsService) UserDefaultsHandler {
+	return &userDefaultsHandler{service: s}
+}
+
+// GetDefaults は自分の作成ページのデフォルト値を返すのだ
+func (h *userDefaultsHandler) GetDefaults(c *gin.Context) {
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	defaults, err := h.service.GetDefaults(int(actor.UserID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed get default values"})
+		return
+	}
+
+	c.JSON(http.StatusOK, defaults)
+}
+
+// SaveDefaults は自分の作成ページのデフォルト値を保存して、名前を埋めたものを返すのだ
+func (h *userDefaultsHandler) SaveDefaults(c *gin.Context) {
+	var req model.DefaultValuesUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request format: " + err.Error()})
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	defaults, err := h.service.SaveDefaults(actor, &req)
+	if err != nil {
+		if respondForbidden(c, err) {
+			return
+		}
+		if errors.Is(err, service.ErrInvalidDefaults) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed save default values"})
+		return
+	}
+
+	c.JSON(http.StatusOK, defaults)
+}
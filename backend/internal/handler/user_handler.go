@@ -0,0 +1,188 @@
+// internal/handler/user_handler.go
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/saku-730/web-specimen/backend/internal/service"
+	"gorm.io/gorm"
+)
+
+type UserHandler interface {
+	ListUsers(c *gin.Context)
+	GetUser(c *gin.Context)
+	CreateUser(c *gin.Context)
+	UpdateUser(c *gin.Context)
+	ChangePassword(c *gin.Context)
+	DeactivateUser(c *gin.Context)
+	ReactivateUser(c *gin.Context)
+}
+
+type userHandler struct {
+	service service.UserService
+}
+
+func NewUserHandler(s service.UserService) UserHandler {
+	return &userHandler{service: s}
+}
+
+// ListUsers はユーザーの一覧をページに分けて返すのだ
+func (h *userHandler) ListUsers(c *gin.Context) {
+	var query model.UserQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid query paramate: " + err.Error()})
+		return
+	}
+
+	response, err := h.service.ListUsers(&query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed get users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetUser は1人のユーザーを返すのだ
+func (h *userHandler) GetUser(c *gin.Context) {
+	id, ok := uintParam(c, "user_id")
+	if !ok {
+		return
+	}
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	user, err := h.service.GetUser(actor, id)
+	if err != nil {
+		respondUserError(c, err, "failed get user")
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// CreateUser はユーザーを作って、201と作ったユーザーを返すのだ
+func (h *userHandler) CreateUser(c *gin.Context) {
+	var req model.UserCreate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request format: " + err.Error()})
+		return
+	}
+
+	user, err := h.service.CreateUser(&req)
+	if err != nil {
+		respondUserError(c, err, "failed create user")
+		return
+	}
+
+	c.Header("Location", fmt.Sprintf("/user/%d", user.UserID))
+	c.JSON(http.StatusCreated, user)
+}
+
+// UpdateUser はユーザーの情報を書き換えるのだ
+func (h *userHandler) UpdateUser(c *gin.Context) {
+	id, ok := uintParam(c, "user_id")
+	if !ok {
+		return
+	}
+	var req model.UserUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request format: " + err.Error()})
+		return
+	}
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	user, err := h.service.UpdateUser(c.Request.Context(), actor, id, &req)
+	if err != nil {
+		respondUserError(c, err, "failed update user")
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// ChangePassword は自分のパスワードを変えるのだ
+func (h *userHandler) ChangePassword(c *gin.Context) {
+	id, ok := uintParam(c, "user_id")
+	if !ok {
+		return
+	}
+	var req model.PasswordChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request format: " + err.Error()})
+		return
+	}
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.ChangePassword(actor, id, &req); err != nil {
+		respondUserError(c, err, "failed change password")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// DeactivateUser はユーザーを無効にするのだ。行は消さないのだ
+func (h *userHandler) DeactivateUser(c *gin.Context) {
+	id, ok := uintParam(c, "user_id")
+	if !ok {
+		return
+	}
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeactivateUser(actor, id); err != nil {
+		respondUserError(c, err, "failed deactivate user")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ReactivateUser は無効にしたユーザーを元に戻すのだ
+func (h *userHandler) ReactivateUser(c *gin.Context) {
+	id, ok := uintParam(c, "user_id")
+	if !ok {
+		return
+	}
+
+	if err := h.service.ReactivateUser(id); err != nil {
+		respondUserError(c, err, "failed reactivate user")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// respondUserError はユーザー管理のエラーをステータスコードに変えるのだ
+func respondUserError(c *gin.Context, err error, fallback string) {
+	if respondForbidden(c, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found user"})
+	case errors.Is(err, service.ErrEmailTaken), errors.Is(err, service.ErrCannotDeactivateSelf), errors.Is(err, service.ErrLastAdmin):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidRole), errors.Is(err, service.ErrWrongPassword):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrSendMail):
+		c.JSON(http.StatusBadGateway, gin.H{"error": "failed send mail"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
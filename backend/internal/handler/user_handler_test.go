@@ -0,0 +1,142 @@
+// backend/internal/handler/user_handler_test.go
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/saku-730/web-specimen/backend/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type mockUserService struct {
+	mock.Mock
+	service.UserService
+}
+
+func (m *mockUserService) UpdateUser(ctx context.Context, actor *model.Actor, id uint, req *model.UserUpdate) (*model.UserInfo, error) {
+	ret := m.Called(actor, id, req)
+	var r0 *model.UserInfo
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.UserInfo)
+	}
+	return r0, ret.Error(1)
+}
+
+func (m *mockUserService) ChangePassword(actor *model.Actor, id uint, req *model.PasswordChangeRequest) error {
+	return m.Called(actor, id, req).Error(0)
+}
+
+func (m *mockUserService) DeactivateUser(actor *model.Actor, id uint) error {
+	return m.Called(actor, id).Error(0)
+}
+
+func TestUpdateUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("自分のメールアドレスを変えると、確かめている途中のアドレスを返すのだ", func(t *testing.T) {
+		mockService := new(mockUserService)
+		old, pending := "old@example.com", "new@example.com"
+		mockService.On("UpdateUser", &model.Actor{UserID: 2}, uint(2), &model.UserUpdate{MailAddress: &pending}).
+			Return(&model.UserInfo{UserID: 2, MailAddress: &old, PendingMailAddress: &pending}, nil)
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Set("userID", 2)
+		c.Params = gin.Params{{Key: "user_id", Value: "2"}}
+		c.Request = httptest.NewRequest(http.MethodPut, "/user/2", strings.NewReader(`{"mail_address":"new@example.com"}`))
+		c.Request.Header.Set("Content-Type", "application/json")
+
+		handler := &userHandler{service: mockService}
+		handler.UpdateUser(c)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var body model.UserInfo
+		json.Unmarshal(w.Body.Bytes(), &body)
+		assert.Equal(t, "old@example.com", *body.MailAddress)
+		assert.Equal(t, "new@example.com", *body.PendingMailAddress)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("他の人の情報を変えようとすると403なのだ", func(t *testing.T) {
+		mockService := new(mockUserService)
+		mockService.On("UpdateUser", &model.Actor{UserID: 2}, uint(3), mock.Anything).
+			Return(nil, fmt.Errorf("%w: requires %s", service.ErrForbidden, model.PermissionManageUser))
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Set("userID", 2)
+		c.Params = gin.Params{{Key: "user_id", Value: "3"}}
+		c.Request = httptest.NewRequest(http.MethodPut, "/user/3", strings.NewReader(`{"display_name":"x"}`))
+		c.Request.Header.Set("Content-Type", "application/json")
+
+		handler := &userHandler{service: mockService}
+		handler.UpdateUser(c)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		mockService.AssertExpectations(t)
+	})
+}
+
+func TestChangePassword(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("今のパスワードが違うと400なのだ", func(t *testing.T) {
+		mockService := new(mockUserService)
+		mockService.On("ChangePassword", &model.Actor{UserID: 2}, uint(2), mock.Anything).Return(service.ErrWrongPassword)
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Set("userID", 2)
+		c.Params = gin.Params{{Key: "user_id", Value: "2"}}
+		c.Request = httptest.NewRequest(http.MethodPut, "/user/2/password", strings.NewReader(`{"old_password":"wrong","new_password":"new-password"}`))
+		c.Request.Header.Set("Content-Type", "application/json")
+
+		handler := &userHandler{service: mockService}
+		handler.ChangePassword(c)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		mockService.AssertExpectations(t)
+	})
+}
+
+func TestDeactivateUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cases := []struct {
+		name string
+		err  error
+		code int
+	}{
+		{"無効にできたら204なのだ", nil, http.StatusNoContent},
+		{"自分を無効にしようとすると409なのだ", service.ErrCannotDeactivateSelf, http.StatusConflict},
+		{"最後の管理者を無効にしようとすると409なのだ", service.ErrLastAdmin, http.StatusConflict},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockService := new(mockUserService)
+			mockService.On("DeactivateUser", &model.Actor{UserID: 1, Role: model.RoleAdmin}, uint(5)).Return(tc.err)
+
+			// 204はルーターを通さないとステータスが書かれないのだ
+			router := gin.New()
+			router.DELETE("/user/:user_id", func(c *gin.Context) {
+				c.Set("userID", 1)
+				c.Set("role", model.RoleAdmin)
+			}, (&userHandler{service: mockService}).DeactivateUser)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/user/5", nil))
+
+			assert.Equal(t, tc.code, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
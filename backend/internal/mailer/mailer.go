@@ -0,0 +1,31 @@
+// internal/mailer/mailer.go
+package mailer
+
+import (
+	"context"
+	"log"
+)
+
+// Message は送るメール1通なのだ。本文はテキストだけなのだ
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer はメールを送るものなのだ。SMTPで送るものと、ログに書くだけのものがあるのだ
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// logMailer はメールを送らないで、ログに書くだけなのだ。SMTPが無い開発環境で使うのだ
+type logMailer struct{}
+
+func NewLogMailer() Mailer {
+	return &logMailer{}
+}
+
+func (m *logMailer) Send(ctx context.Context, msg Message) error {
+	log.Printf("mail to=%s subject=%q\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
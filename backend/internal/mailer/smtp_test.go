@@ -0,0 +1,84 @@
+// backend/internal/mailer/smtp_test.go
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// startSMTPSink は受け取ったメールを返すだけのテスト用のSMTPサーバーなのだ
+func startSMTPSink(t *testing.T) (string, <-chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		reply("220 sink ready")
+
+		var data strings.Builder
+		inData := false
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					received <- data.String()
+					reply("250 queued")
+					continue
+				}
+				data.WriteString(line)
+				continue
+			}
+			switch command := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				reply("250 sink")
+			case command == "DATA":
+				inData = true
+				reply("354 go ahead")
+			case command == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	return listener.Addr().String(), received
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	addr, received := startSMTPSink(t)
+	host, port, _ := net.SplitHostPort(addr)
+
+	mailer := NewSMTPMailer(SMTPConfig{Host: host, Port: port, From: "noreply@example.org"})
+	err := mailer.Send(context.Background(), Message{To: "collector@example.org", Subject: "招待", Body: "line1\nline2"})
+	assert.NoError(t, err)
+
+	mail := <-received
+	assert.Contains(t, mail, "To: collector@example.org\r\n")
+	assert.Contains(t, mail, "Subject: =?utf-8?q?")
+	assert.Contains(t, mail, "line1\r\nline2")
+}
+
+func TestSMTPMailerRejectsHeaderInjection(t *testing.T) {
+	mailer := NewSMTPMailer(SMTPConfig{Host: "127.0.0.1", Port: "1", From: "noreply@example.org"})
+	err := mailer.Send(context.Background(), Message{To: "a@example.org\r\nBcc: b@example.org", Subject: "x"})
+	assert.Error(t, err)
+}
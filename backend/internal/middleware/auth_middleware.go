@@ -10,24 +10,50 @@ import (
 	"github.com/saku-730/web-specimen/backend/internal/model" // modelを参照する
 )
 
+// contextの "authMethod" に入る、どうやって認証したかの値なのだ
+const (
+	AuthMethodJWT    = "jwt"
+	AuthMethodAPIKey = "api_key"
+)
+
 // AuthMiddleware のインターフェースを定義するのだ
 type AuthMiddleware interface {
 	Auth() gin.HandlerFunc
 }
 
+// RevocationChecker はアクセストークンのjtiが無効にされているかを教えてくれるものなのだ
+// service.AuthService がこれを満たしているのだ
+type RevocationChecker interface {
+	IsAccessTokenRevoked(jti string) (bool, error)
+}
+
+// APIKeyAuthenticator はAPIキーから持ち主とスコープを教えてくれるものなのだ
+// service.APIKeyService がこれを満たしているのだ。知らないキーならエラーを返すのだ
+type APIKeyAuthenticator interface {
+	AuthenticateAPIKey(key string) (*model.APIKeyPrincipal, error)
+}
+
 // authMiddleware 構造体が秘密鍵を保管する場所になるのだ
 type authMiddleware struct {
-	jwtSecret []byte
+	jwtSecret  []byte
+	revocation RevocationChecker
+	apiKeys    APIKeyAuthenticator
 }
 
 // NewAuthMiddleware は秘密鍵を受け取って、ミドルウェアのインスタンスを生成するのだ
-func NewAuthMiddleware(secret string) AuthMiddleware {
-	return &authMiddleware{jwtSecret: []byte(secret)}
+func NewAuthMiddleware(secret string, revocation RevocationChecker, apiKeys APIKeyAuthenticator) AuthMiddleware {
+	return &authMiddleware{jwtSecret: []byte(secret), revocation: revocation, apiKeys: apiKeys}
 }
 
 // Auth メソッドが、実際のミドルウェア処理 (gin.HandlerFunc) を返すのだ
+// 'Bearer <JWT>' の他に、スクリプト用に 'ApiKey <key>' か X-API-Key ヘッダーも受け付けるのだ
 func (m *authMiddleware) Auth() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if apiKey := c.GetHeader("X-API-Key"); apiKey != "" {
+			m.authAPIKey(c, apiKey)
+			return
+		}
+
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "認証ヘッダーが必要なのだ"})
@@ -35,6 +61,10 @@ func (m *authMiddleware) Auth() gin.HandlerFunc {
 		}
 
 		parts := strings.Split(authHeader, " ")
+		if len(parts) == 2 && parts[0] == "ApiKey" {
+			m.authAPIKey(c, parts[1])
+			return
+		}
 		if len(parts) != 2 || parts[0] != "Bearer" {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "トークンの形式が 'Bearer <token>' ではないのだ"})
 			return
@@ -53,8 +83,44 @@ func (m *authMiddleware) Auth() gin.HandlerFunc {
 			return
 		}
 
+		// jtiが無いのは無効にできない古いトークンなので、ログインし直してもらうのだ
+		if claims.ID == "" || claims.ExpiresAt == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "トークンが古い形式なのだ。ログインし直してほしいのだ"})
+			return
+		}
+		revoked, err := m.revocation.IsAccessTokenRevoked(claims.ID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed check token revocation"})
+			return
+		}
+		if revoked {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "トークンが無効にされているのだ"})
+			return
+		}
+
 		c.Set("userID", int(claims.UserID))
 		c.Set("userName", claims.UserName)
+		c.Set("role", claims.Role)
+		c.Set("authMethod", AuthMethodJWT)
+		c.Set("jti", claims.ID)
+		c.Set("tokenExpiresAt", claims.ExpiresAt.Time)
 		c.Next()
 	}
 }
+
+// authAPIKey はAPIキーの持ち主をcontextに入れるのだ
+// RequirePermission がスコープも見られるように "scopes" も入れておくのだ
+func (m *authMiddleware) authAPIKey(c *gin.Context, key string) {
+	principal, err := m.apiKeys.AuthenticateAPIKey(key)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "APIキーが無効または期限切れなのだ"})
+		return
+	}
+
+	c.Set("userID", int(principal.UserID))
+	c.Set("userName", principal.UserName)
+	c.Set("role", principal.Role)
+	c.Set("authMethod", AuthMethodAPIKey)
+	c.Set("scopes", principal.Scopes)
+	c.Next()
+}
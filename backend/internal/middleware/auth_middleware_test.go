@@ -0,0 +1,133 @@
+// backend/internal/middleware/auth_middleware_test.go
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRevocation は無効にしたjtiだけを覚えておくテスト用のRevocationCheckerなのだ
+type fakeRevocation map[string]bool
+
+func (f fakeRevocation) IsAccessTokenRevoked(jti string) (bool, error) {
+	return f[jti], nil
+}
+
+// fakeAPIKeys はキーから持ち主を引くだけのテスト用のAPIKeyAuthenticatorなのだ
+type fakeAPIKeys map[string]*model.APIKeyPrincipal
+
+func (f fakeAPIKeys) AuthenticateAPIKey(key string) (*model.APIKeyPrincipal, error) {
+	if principal, ok := f[key]; ok {
+		return principal, nil
+	}
+	return nil, errors.New("invalid api key")
+}
+
+func TestAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	secret := "test-secret"
+
+	sign := func(claims *model.Claims) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+		assert.NoError(t, err)
+		return token
+	}
+	newClaims := func(jti string) *model.Claims {
+		return &model.Claims{
+			UserID: 1,
+			Role:   model.RoleViewer,
+			RegisteredClaims: jwt.RegisteredClaims{
+				ID:        jti,
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			},
+		}
+	}
+	request := func(revocation fakeRevocation, token string) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.GET("/me", NewAuthMiddleware(secret, revocation, fakeAPIKeys{}).Auth(), func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"jti": c.GetString("jti"), "role": c.GetString("role")})
+		})
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("有効なトークンなら通れるのだ", func(t *testing.T) {
+		w := request(fakeRevocation{}, sign(newClaims("abc")))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"jti":"abc","role":"viewer"}`, w.Body.String())
+	})
+
+	t.Run("無効にされたjtiは401なのだ", func(t *testing.T) {
+		w := request(fakeRevocation{"abc": true}, sign(newClaims("abc")))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("jtiの無い古いトークンは401なのだ", func(t *testing.T) {
+		w := request(fakeRevocation{}, sign(newClaims("")))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
+
+func TestAuthAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	apiKeys := fakeAPIKeys{
+		"wsk_good": {UserID: 2, UserName: "logger", Role: model.RoleCollector, Scopes: []string{model.ScopeRead}},
+	}
+
+	// APIキーで認証してから、読み取りと作成のルートを通すルーターなのだ
+	router := gin.New()
+	secure := router.Group("")
+	secure.Use(NewAuthMiddleware("test-secret", fakeRevocation{}, apiKeys).Auth())
+	secure.GET("/search", RequirePermission(model.PermissionReadOccurrence), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user_id": c.GetInt("userID"), "auth_method": c.GetString("authMethod")})
+	})
+	secure.POST("/create", RequirePermission(model.PermissionCreateOccurrence), func(c *gin.Context) {
+		c.Status(http.StatusCreated)
+	})
+	secure.GET("/me/api-keys", RequireInteractiveLogin(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	request := func(method, path string, header, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set(header, value)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("ApiKeyの形式でもX-API-Keyヘッダーでも通れるのだ", func(t *testing.T) {
+		w := request(http.MethodGet, "/search", "Authorization", "ApiKey wsk_good")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"user_id":2,"auth_method":"api_key"}`, w.Body.String())
+
+		w = request(http.MethodGet, "/search", "X-API-Key", "wsk_good")
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("知らないキーは401なのだ", func(t *testing.T) {
+		w := request(http.MethodGet, "/search", "X-API-Key", "wsk_bad")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("役割に権限があってもスコープに無ければ403なのだ", func(t *testing.T) {
+		w := request(http.MethodPost, "/create", "X-API-Key", "wsk_good")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("APIキーではAPIキーの管理はできないのだ", func(t *testing.T) {
+		w := request(http.MethodGet, "/me/api-keys", "X-API-Key", "wsk_good")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
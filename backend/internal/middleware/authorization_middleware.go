@@ -0,0 +1,47 @@
+// internal/middleware/authorization_middleware.go
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+)
+
+// RequirePermission はAuth()の後ろに置いて、contextの役割がpermissionを持っているかを確かめるのだ
+// APIキーで来た時は、キーのスコープにもpermissionが入っていないとだめなのだ
+// 持っていなければ、何の権限が足りなかったのかを403で返すのだ
+func RequirePermission(permission model.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("role")
+		if !model.HasPermission(role, permission) {
+			c.AbortWithStatusJSON(http.StatusForbidden, model.ForbiddenResponse{
+				Error:              "you do not have permission for this operation",
+				RequiredPermission: permission,
+				Role:               role,
+			})
+			return
+		}
+		if c.GetString("authMethod") == AuthMethodAPIKey && !model.ScopesAllow(c.GetStringSlice("scopes"), permission) {
+			c.AbortWithStatusJSON(http.StatusForbidden, model.ForbiddenResponse{
+				Error:              "the api key does not have a scope for this operation",
+				RequiredPermission: permission,
+				Role:               role,
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireInteractiveLogin はAPIキーでは使わせたくないルートに置くのだ
+// APIキーで新しいAPIキーを作ったりログアウトしたりはできないようにするのだ
+func RequireInteractiveLogin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("authMethod") == AuthMethodAPIKey {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "this operation requires a login session, not an api key"})
+			return
+		}
+		c.Next()
+	}
+}
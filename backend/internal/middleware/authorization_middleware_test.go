@@ -0,0 +1,55 @@
+// backend/internal/middleware/authorization_middleware_test.go
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequirePermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// 役割をcontextに入れてから、RequirePermissionを通すだけのルーターなのだ
+	newRouter := func(role string, permission model.Permission) *gin.Engine {
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			c.Set("role", role)
+			c.Next()
+		})
+		router.DELETE("/occurrences/1", RequirePermission(permission), func(c *gin.Context) {
+			c.Status(http.StatusNoContent)
+		})
+		return router
+	}
+
+	t.Run("権限がある役割は通れるのだ", func(t *testing.T) {
+		for _, role := range []string{model.RoleAdmin, model.RoleCurator} {
+			w := httptest.NewRecorder()
+			newRouter(role, model.PermissionDeleteOccurrence).ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/occurrences/1", nil))
+			assert.Equal(t, http.StatusNoContent, w.Code, role)
+		}
+	})
+
+	t.Run("権限が無いと何が足りないかを403で返すのだ", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		newRouter(model.RoleCollector, model.PermissionDeleteOccurrence).ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/occurrences/1", nil))
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		var body model.ForbiddenResponse
+		json.Unmarshal(w.Body.Bytes(), &body)
+		assert.Equal(t, model.PermissionDeleteOccurrence, body.RequiredPermission)
+		assert.Equal(t, model.RoleCollector, body.Role)
+	})
+
+	t.Run("役割の無い古いトークンは読み取りもできないのだ", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		newRouter("", model.PermissionReadOccurrence).ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/occurrences/1", nil))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
@@ -0,0 +1,51 @@
+// internal/model/account_model.go
+package model
+
+import "time"
+
+// InvitationCreate は POST /invitations で受け取るJSONの形なのだ
+type InvitationCreate struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"required"`
+}
+
+// InvitationResponse はまだ受け入れられていない招待の情報なのだ
+type InvitationResponse struct {
+	InvitationID uint      `json:"invitation_id"`
+	Email        string    `json:"email"`
+	Role         string    `json:"role"`
+	InvitedBy    *string   `json:"invited_by"` // 自分で申し込んだ登録ならnullなのだ
+	CreatedAt    time.Time `json:"created_at"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// RegistrationRequest は POST /register で受け取るJSONの形なのだ
+// メールアドレスを確かめるために、まずは招待と同じメールが届くのだ
+type RegistrationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// AcceptInvitationRequest は POST /invitations/accept で受け取るJSONの形なのだ
+type AcceptInvitationRequest struct {
+	Token       string `json:"token" binding:"required"`
+	UserName    string `json:"user_name" binding:"required,max=255"`
+	DisplayName string `json:"display_name" binding:"max=255"` // 空ならuser_nameと同じにするのだ
+	Password    string `json:"password" binding:"required,min=8,max=72"`
+}
+
+// ForgotPasswordRequest は POST /password/forgot で受け取るJSONの形なのだ
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest は POST /password/reset で受け取るJSONの形なのだ
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=8,max=72"`
+}
+
+// ConfirmEmailChangeRequest は POST /email/confirm で受け取るJSONの形なのだ
+// 新しいアドレスに届いたトークンで、メールアドレスの変更を終わらせるのだ
+type ConfirmEmailChangeRequest struct {
+	Token string `json:"token" binding:"required"`
+}
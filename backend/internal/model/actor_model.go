@@ -0,0 +1,9 @@
+// internal/model/actor_model.go
+package model
+
+// Actor は今リクエストを送ってきているユーザーの情報なのだ
+// 認証ミドルウェアがcontextにセットした値から、handlerで組み立ててserviceに渡すのだ
+type Actor struct {
+	UserID uint
+	Role   string // user_roles.role_name なのだ
+}
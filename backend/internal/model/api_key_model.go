@@ -0,0 +1,71 @@
+// internal/model/api_key_model.go
+package model
+
+import "time"
+
+// APIキーに付けられるスコープなのだ
+const (
+	ScopeRead             = "read"
+	ScopeOccurrenceWrite  = "occurrence:write"
+	ScopeAttachmentUpload = "attachment:upload"
+)
+
+// scopePermissions はスコープごとに使える権限の表なのだ
+// APIキーでは、持ち主の役割の権限とスコープの権限の両方にあるものだけが使えるのだ
+var scopePermissions = map[string][]Permission{
+	ScopeRead:             {PermissionReadOccurrence},
+	ScopeOccurrenceWrite:  {PermissionCreateOccurrence, PermissionEditOccurrence},
+	ScopeAttachmentUpload: {PermissionUploadAttachment},
+}
+
+// IsValidScope は知っているスコープかを返すのだ
+func IsValidScope(scope string) bool {
+	_, ok := scopePermissions[scope]
+	return ok
+}
+
+// ScopesAllow はスコープのどれかがその権限を持っているかを返すのだ
+func ScopesAllow(scopes []string, permission Permission) bool {
+	for _, scope := range scopes {
+		for _, p := range scopePermissions[scope] {
+			if p == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// APIKeyCreate は POST /me/api-keys で受け取るJSONの形なのだ
+type APIKeyCreate struct {
+	Name      string     `json:"name" binding:"required"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// APIKeyResponse は一覧で返すAPIキーの情報なのだ。キーそのものは入っていないのだ
+type APIKeyResponse struct {
+	APIKeyID   uint       `json:"api_key_id"`
+	Name       string     `json:"name"`
+	KeyPrefix  string     `json:"key_prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// APIKeyCreatedResponse は作った時だけ返すレスポンスなのだ
+// key はこの時しか見られないので、クライアントに保存してもらうのだ
+type APIKeyCreatedResponse struct {
+	APIKeyResponse
+	Key string `json:"key"`
+}
+
+// APIKeyPrincipal はAPIキーで認証した時の、誰が何をできるかの情報なのだ
+type APIKeyPrincipal struct {
+	UserID   uint
+	UserName string
+	Role     string
+	Scopes   []string
+}
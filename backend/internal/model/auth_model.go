@@ -10,13 +10,43 @@ type LoginRequest struct {
 }
 
 // LoginResponse はログイン成功時にクライアントに返すJSON
+// token は短い時間だけ使えるアクセストークンで、切れたら refresh_token で取り直すのだ
+// 2段階認証が有効なユーザーには、トークンの代わりに challenge_token だけを返すので
+// それと認証アプリのコードを POST /login/2fa に送ってもらうのだ
 type LoginResponse struct {
-	Token string `json:"token"`
+	Token             string `json:"token,omitempty"`
+	TokenType         string `json:"token_type,omitempty"`
+	ExpiresIn         int    `json:"expires_in"` // アクセストークン(2段階目を待っている時はchallenge_token)が使える秒数なのだ
+	RefreshToken      string `json:"refresh_token,omitempty"`
+	TwoFactorRequired bool   `json:"two_factor_required,omitempty"`
+	ChallengeToken    string `json:"challenge_token,omitempty"`
+}
+
+// RefreshRequest は /refresh で受け取るJSONの形なのだ
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// LogoutRequest は /logout で受け取るJSONの形なのだ
+// refresh_token を送ると、そのログインのリフレッシュトークンも全部無効になるのだ
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+	AllSessions  bool   `json:"all_sessions"` // trueなら他の端末のログインも全部無効にするのだ
 }
 
 // Claims はJWTに埋め込む情報の構造体
+// RegisteredClaims.ID (jti) はトークンを無効にする時に使うのだ
 type Claims struct {
 	UserID   int    `json:"user_id"`
 	UserName string `json:"user_name"`
+	Role     string `json:"role"` // user_roles.role_name なのだ
 	jwt.RegisteredClaims
 }
+
+// OIDCLoginStart はOpenID Connectのログインを始める時に、handlerがブラウザに返すものなのだ
+// StateCookie はcookieに入れて、IdPから戻ってきた時に送り返してもらうのだ
+type OIDCLoginStart struct {
+	AuthURL     string
+	StateCookie string
+	MaxAge      int // cookieを持っておく秒数なのだ
+}
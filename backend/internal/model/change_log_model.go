@@ -0,0 +1,43 @@
+// internal/model/change_log_model.go
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ChangeLogResponse は /occurrences/{occurrence_id}/history の1件分なのだ
+type ChangeLogResponse struct {
+	LogID     uint            `json:"log_id"`
+	Operation string          `json:"operation"`
+	TableName string          `json:"table_name"`
+	RowID     *int            `json:"row_id"`
+	UserID    *int            `json:"user_id"`
+	UserName  *string         `json:"user_name"`
+	Date      time.Time       `json:"date"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+}
+
+// RevertQuery はどの時点に戻すかの指定なのだ。log_id か at のどちらか1つだけを指定するのだ
+type RevertQuery struct {
+	LogID *uint      `form:"log_id"`
+	At    *time.Time `form:"at" time_format:"2006-01-02T15:04:05Z07:00"`
+}
+
+// RevertPreview は戻した時に何が変わるかの下見なのだ。適用は別のリクエストでするのだ
+type RevertPreview struct {
+	OccurrenceID uint            `json:"occurrence_id"`
+	Version      int             `json:"version"`       // 今のバージョンなのだ。適用する時はこれをIf-Matchに入れるのだ
+	LogID        uint            `json:"log_id"`        // 戻す先の時点で最後に書かれた変更ログなのだ
+	RevisionDate time.Time       `json:"revision_date"` // そのログが書かれた日時なのだ
+	Changes      []RevertChange  `json:"changes"`
+	Revision     json.RawMessage `json:"revision"` // 戻した後のoccurrence (PUTと同じ形) なのだ
+}
+
+// RevertChange は戻すと変わる項目1つ分なのだ。field は "observation[0].behavior" のような形なのだ
+type RevertChange struct {
+	Field    string          `json:"field"`
+	Current  json.RawMessage `json:"current"`
+	Reverted json.RawMessage `json:"reverted"`
+}
@@ -0,0 +1,23 @@
+// internal/model/entry_template_model.go
+package model
+
+import "time"
+
+// EntryTemplateRequest は POST /templates と PUT /templates/{template_id} で受け取るJSONの形なのだ
+// values は PUT /me/defaults と同じ形で、名前はサーバーがIDから引くのだ
+type EntryTemplateRequest struct {
+	TemplateName string              `json:"template_name" binding:"required,max=255"`
+	ProjectID    *uint               `json:"project_id"` // 入れると、そのプロジェクトのメンバーにも共有するのだ
+	Values       DefaultValuesUpdate `json:"values"`
+}
+
+// EntryTemplateResponse はテンプレート1つの情報なのだ
+type EntryTemplateResponse struct {
+	TemplateID   uint                `json:"template_id"`
+	TemplateName string              `json:"template_name"`
+	UserID       uint                `json:"user_id"`
+	ProjectID    *uint               `json:"project_id"`
+	Values       DefaultValuesUpdate `json:"values"`
+	CreatedAt    time.Time           `json:"created_at"`
+	UpdatedAt    time.Time           `json:"updated_at"`
+}
@@ -0,0 +1,147 @@
+// internal/model/geojson_model.go
+package model
+
+import "time"
+
+// GeoJSONMediaType は RFC 7946 のGeoJSONのContent-Typeなのだ
+const GeoJSONMediaType = "application/geo+json"
+
+// OccurrenceFeature は検索結果の1件をGeoJSONのFeatureにしたものなのだ
+// 座標が無いoccurrenceは geometry が null になるのだ
+type OccurrenceFeature struct {
+	Type       string               `json:"type"`
+	ID         uint                 `json:"id"`
+	Geometry   *PointGeometry       `json:"geometry"`
+	Properties OccurrenceProperties `json:"properties"`
+}
+
+// PointGeometry はGeoJSONのPointなのだ。座標は [経度, 緯度] の順なのだ
+type PointGeometry struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+// OccurrenceProperties はGISのツールで表として読めるように、OccurrenceResult を入れ子にしないで並べたものなのだ
+// どのFeatureにも同じキーがそろうように、値が無いところも null で入れるのだ
+type OccurrenceProperties struct {
+	OccurrenceID uint       `json:"occurrence_id"`
+	UserID       *uint      `json:"user_id"`
+	UserName     string     `json:"user_name"`
+	ProjectID    *uint      `json:"project_id"`
+	ProjectName  *string    `json:"project_name"`
+	IndividualID *int       `json:"individual_id"`
+	Lifestage    *string    `json:"lifestage"`
+	Sex          *string    `json:"sex"`
+	BodyLength   *string    `json:"body_length"`
+	CreatedAt    *time.Time `json:"created_at"`
+	LanguageID   *uint      `json:"language_id"`
+	PlaceName    *string    `json:"place_name"`
+	Note         *string    `json:"note"`
+
+	Georeference
+
+	ClassificationID *uint   `json:"classification_id"`
+	Species          *string `json:"species"`
+	Genus            *string `json:"genus"`
+	Family           *string `json:"family"`
+	Order            *string `json:"order"`
+	Class            *string `json:"class"`
+	Phylum           *string `json:"phylum"`
+	Kingdom          *string `json:"kingdom"`
+	Others           *string `json:"others"`
+
+	ObservationID         *uint      `json:"observation_id"`
+	ObservationUserID     *uint      `json:"observation_user_id"`
+	ObservationUser       *string    `json:"observation_user"`
+	ObservationMethodID   *uint      `json:"observation_method_id"`
+	ObservationMethodName *string    `json:"observation_method_name"`
+	ObservationPageID     *uint      `json:"observation_page_id"`
+	Behavior              *string    `json:"behavior"`
+	ObservedAt            *time.Time `json:"observed_at"`
+
+	SpecimenID            *uint   `json:"specimen_id"`
+	SpecimenUserID        *uint   `json:"specimen_user_id"`
+	SpecimenUser          *string `json:"specimen_user"`
+	SpecimenMethodsID     *uint   `json:"specimen_methods_id"`
+	SpecimenMethodsCommon *string `json:"specimen_methods_common"`
+	SpecimenPageID        *uint   `json:"specimen_page_id"`
+	InstitutionID         *uint   `json:"institution_id"`
+	InstitutionCode       *string `json:"institution_code"`
+	CollectionID          *string `json:"collection_id"`
+
+	IdentificationID     *uint      `json:"identification_id"`
+	IdentificationUserID *uint      `json:"identification_user_id"`
+	IdentificationUser   *string    `json:"identification_user"`
+	IdentifiedAt         *time.Time `json:"identified_at"`
+	SourceInfo           *string    `json:"source_info"`
+}
+
+// NewOccurrenceFeature は検索結果の1件からFeatureを作るのだ
+func NewOccurrenceFeature(result *OccurrenceResult) *OccurrenceFeature {
+	feature := &OccurrenceFeature{
+		Type: "Feature",
+		ID:   result.OccurrenceID,
+		Properties: OccurrenceProperties{
+			OccurrenceID: result.OccurrenceID,
+			UserID:       result.UserID,
+			UserName:     result.UserName,
+			ProjectID:    result.ProjectID,
+			ProjectName:  result.ProjectName,
+			IndividualID: result.IndividualID,
+			Lifestage:    result.Lifestage,
+			Sex:          result.Sex,
+			BodyLength:   result.BodyLength,
+			CreatedAt:    result.CreatedAt,
+			LanguageID:   result.LanguageID,
+			PlaceName:    result.PlaceName,
+			Georeference: result.Georeference,
+			Note:         result.Note,
+		},
+	}
+
+	if result.Latitude != nil && result.Longitude != nil {
+		feature.Geometry = &PointGeometry{Type: "Point", Coordinates: [2]float64{*result.Longitude, *result.Latitude}}
+	}
+
+	props := &feature.Properties
+	if c := result.Classification; c != nil {
+		props.ClassificationID = c.ClassificationID
+		props.Species = c.Species
+		props.Genus = c.Genus
+		props.Family = c.Family
+		props.Order = c.Order
+		props.Class = c.Class
+		props.Phylum = c.Phylum
+		props.Kingdom = c.Kingdom
+		props.Others = c.Others
+	}
+	if o := result.Observation; o != nil {
+		props.ObservationID = o.ObservationID
+		props.ObservationUserID = o.ObservationUserID
+		props.ObservationUser = o.ObservationUser
+		props.ObservationMethodID = o.ObservationMethodID
+		props.ObservationMethodName = o.ObservationMethodName
+		props.ObservationPageID = o.PageID
+		props.Behavior = o.Behavior
+		props.ObservedAt = o.ObservedAt
+	}
+	if s := result.Specimen; s != nil {
+		props.SpecimenID = s.SpecimenID
+		props.SpecimenUserID = s.SpecimenUserID
+		props.SpecimenUser = s.SpecimenUser
+		props.SpecimenMethodsID = s.SpecimenMethodsID
+		props.SpecimenMethodsCommon = s.SpecimenMethodsCommon
+		props.SpecimenPageID = s.PageID
+		props.InstitutionID = s.InstitutionID
+		props.InstitutionCode = s.InstitutionCode
+		props.CollectionID = s.CollectionID
+	}
+	if i := result.Identification; i != nil {
+		props.IdentificationID = i.IdentificationID
+		props.IdentificationUserID = i.IdentificationUserID
+		props.IdentificationUser = i.IdentificationUser
+		props.IdentifiedAt = i.IdentifiedAt
+		props.SourceInfo = i.SourceInfo
+	}
+	return feature
+}
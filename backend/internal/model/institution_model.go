@@ -0,0 +1,42 @@
+// internal/model/institution_model.go
+package model
+
+import "time"
+
+// InstitutionQuery は GET /institution のクエリなのだ。無効にした機関は聞かれた時だけ入れるのだ
+type InstitutionQuery struct {
+	IncludeInactive bool `form:"include_inactive"`
+}
+
+// InstitutionRequest は POST /institution と PUT /institution/{institution_id} で受け取るJSONの形なのだ
+// institution_code は標本ラベルに書く機関のコードで、使われている機関の中でかぶってはいけないのだ
+// country_code は ISO 3166-1 の2文字、grscicoll_id は GRSciColl の機関のUUIDなのだ
+type InstitutionRequest struct {
+	InstitutionCode      string  `json:"institution_code" binding:"required,max=64"`
+	InstitutionName      string  `json:"institution_name" binding:"required,max=255"`
+	Acronym              *string `json:"acronym" binding:"omitempty,max=64"`
+	Address              *string `json:"address"`
+	CountryCode          *string `json:"country_code" binding:"omitempty,iso3166_1_alpha2"`
+	GRSciCollID          *string `json:"grscicoll_id" binding:"omitempty,uuid"`
+	IndexHerbariorumCode *string `json:"index_herbariorum_code" binding:"omitempty,max=64"`
+	ContactName          *string `json:"contact_name" binding:"omitempty,max=255"`
+	ContactEmail         *string `json:"contact_email" binding:"omitempty,email"`
+	URL                  *string `json:"url" binding:"omitempty,url"`
+}
+
+// InstitutionInfo は機関1つの情報なのだ
+type InstitutionInfo struct {
+	InstitutionID        uint       `json:"institution_id"`
+	InstitutionCode      *string    `json:"institution_code"`
+	InstitutionName      *string    `json:"institution_name"`
+	Acronym              *string    `json:"acronym"`
+	Address              *string    `json:"address"`
+	CountryCode          *string    `json:"country_code"`
+	GRSciCollID          *string    `json:"grscicoll_id"`
+	IndexHerbariorumCode *string    `json:"index_herbariorum_code"`
+	ContactName          *string    `json:"contact_name"`
+	ContactEmail         *string    `json:"contact_email"`
+	URL                  *string    `json:"url"`
+	DeactivatedAt        *time.Time `json:"deactivated_at"`
+	SpecimenCount        *int64     `json:"specimen_count,omitempty"` // 1つだけ取った時に、いくつの標本がこの機関にあるかを入れるのだ
+}
@@ -0,0 +1,50 @@
+// internal/model/login_audit_model.go
+package model
+
+import "time"
+
+// login_audits.event に入る値なのだ
+const (
+	LoginEventSuccess     = "success"
+	LoginEventFailure     = "failure"
+	LoginEventLocked      = "locked"       // ロック中に来たので、パスワードは確かめなかった試みなのだ
+	LoginEventUnlock      = "unlock"       // 管理者がロックを解いたのだ
+	LoginEventChallenge   = "challenge"    // パスワードは合っていて、2段階目のコードを待っているのだ
+	LoginEventMailRequest = "mail_request" // 登録やパスワード再設定のメールを頼まれたのだ。detail には何のメールかを入れるのだ
+)
+
+// ClientInfo はログインしてきたクライアントの情報なのだ
+type ClientInfo struct {
+	IPAddress string
+	UserAgent string
+}
+
+// LoginAuditQuery は GET /login-audits の絞り込みとページネーションなのだ
+type LoginAuditQuery struct {
+	UserID    *uint      `form:"user_id"`
+	Email     string     `form:"email"`
+	IPAddress string     `form:"ip_address"`
+	Event     string     `form:"event"`
+	From      *time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To        *time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Page      int        `form:"page"`
+	PerPage   int        `form:"per_page"`
+}
+
+// LoginAuditResponse はログインの記録の一覧なのだ
+type LoginAuditResponse struct {
+	Results  []LoginAuditItem `json:"login_audit_results"`
+	Metadata Metadata         `json:"metadata"`
+}
+
+type LoginAuditItem struct {
+	LoginAuditID uint      `json:"login_audit_id"`
+	UserID       *uint     `json:"user_id"`
+	UserName     *string   `json:"user_name"`
+	Email        string    `json:"email"`
+	IPAddress    string    `json:"ip_address"`
+	UserAgent    *string   `json:"user_agent"`
+	Event        string    `json:"event"`
+	Detail       *string   `json:"detail"`
+	CreatedAt    time.Time `json:"created_at"`
+}
@@ -0,0 +1,34 @@
+// internal/model/method_model.go
+package model
+
+import "time"
+
+// 観察方法 (/observation) と標本作成方法 (/specimen) は同じ形なので、同じモデルを使うのだ
+
+// MethodQuery は GET /observation と GET /specimen のクエリなのだ
+// 使わなくなった方法は聞かれた時だけ入れるのだ
+type MethodQuery struct {
+	IncludeDeprecated bool `form:"include_deprecated"`
+}
+
+// MethodRequest は方法を作ったり名前を変えたりする時に受け取るJSONの形なのだ
+type MethodRequest struct {
+	MethodName string `json:"method_name" binding:"required,max=255"`
+	PageID     *uint  `json:"page_id"`
+}
+
+// MethodMergeRequest は POST /observation/{method_id}/merge で受け取るJSONの形なのだ
+// パスの方法を into_method_id の方法にまとめるのだ
+type MethodMergeRequest struct {
+	IntoMethodID uint `json:"into_method_id" binding:"required"`
+}
+
+// MethodInfo は方法1つの情報なのだ
+type MethodInfo struct {
+	MethodID     uint       `json:"method_id"`
+	MethodName   *string    `json:"method_name"`
+	PageID       *uint      `json:"page_id"`
+	DeprecatedAt *time.Time `json:"deprecated_at"`
+	MergedInto   *uint      `json:"merged_into"`
+	UsageCount   *int64     `json:"usage_count,omitempty"` // 1つだけ取った時に、いくつの記録で使われているかを入れるのだ
+}
@@ -47,8 +47,9 @@ type DropdownSpecimenMethod struct {
 }
 
 type DropdownInstitution struct {
-	InstitutionID   uint   `json:"institution_id"`
-	InstitutionCode string `json:"institution_code"`
+	InstitutionID   uint    `json:"institution_id"`
+	InstitutionCode string  `json:"institution_code"`
+	InstitutionName *string `json:"institution_name"`
 }
 
 // --- Default values for create paga ---
@@ -119,6 +120,7 @@ type OccurrenceCreate struct {
 	Latitude       *float64              `json:"latitude"`
 	Longitude      *float64              `json:"longitude"`
 	PlaceName      *string               `json:"place_name"`
+	Georeference
 	Note           *string               `json:"note"`
 	Classification *ClassificationCreate `json:"classification"`
 	Observation    *ObservationCreate    `json:"observation"`
@@ -126,6 +128,16 @@ type OccurrenceCreate struct {
 	Identification *IdentificationCreate `json:"identification"`
 }
 
+// Georeference は座標をどうやって決めたかの情報なのだ。Darwin Coreの名前に合わせてあるのだ
+// 作成・更新・詳細・検索結果で同じキーになるように、埋め込んで使うのだ
+type Georeference struct {
+	CoordinateUncertaintyInMeters *float64 `json:"coordinate_uncertainty_in_meters" binding:"omitempty,gte=0"`
+	GeoreferenceSource            *string  `json:"georeference_source" binding:"omitempty,oneof=gps map gazetteer"`
+	GeodeticDatum                 *string  `json:"geodetic_datum"` // 入力した時の測地系 (例: "WGS84", "Tokyo") なのだ。座標は変換しないのだ
+	GeoreferencedBy               *string  `json:"georeferenced_by"`
+	GeoreferencedDate             *string  `json:"georeferenced_date" binding:"omitempty,datetime=2006-01-02"`
+}
+
 type ClassificationCreate struct {
 	Species *string `json:"species"`
 	Genus   *string `json:"genus"`
@@ -142,6 +154,7 @@ type ObservationCreate struct {
 	ObservationMethodID *uint       `json:"observation_method_id"`
 	Behavior            *string    `json:"behavior"`
 	ObservedAt          *time.Time `json:"observed_at"`
+	Timezone            *string    `json:"-"` // DBに入っているタイムゾーンなのだ。日時を変えない時だけそのまま使うのだ
 }
 
 type SpecimenCreate struct {
@@ -150,17 +163,62 @@ type SpecimenCreate struct {
 	CreatedAt         *time.Time `json:"created_at"`
 	InstitutionID     *uint       `json:"institution_id"`
 	CollectionID      *string    `json:"collection_id"`
+	// make_specimenに入っている値なのだ。PATCHや戻す時に、変えていないものを書き換えないように持っておくのだ
+	Timezone             *string `json:"-"`
+	MakeSpecimenMethodID *uint   `json:"-"`
 }
 
 type IdentificationCreate struct {
 	IdentificationUserID *uint       `json:"identification_user_id"`
 	IdentifiedAt         *time.Time `json:"identified_at"`
 	SourceInfo           *string    `json:"source_info"`
+	Timezone             *string    `json:"-"` // DBに入っているタイムゾーンなのだ
+}
+
+
+// --- OccurrenceUpdate for PUT /occurrences/{occurrence_id} ---
+// 子レコードはリストで受け取るのだ。IDが無いものは新規作成、リストに無いものは削除になるのだ
+type OccurrenceUpdate struct {
+	UserID          uint                   `json:"user_id" binding:"required"` // 無いと0になって持ち主が消えてしまうのだ
+	ProjectID       *uint                  `json:"project_id"`
+	IndividualID    *int                   `json:"individual_id"`
+	Lifestage       *string                `json:"lifestage"`
+	Sex             *string                `json:"sex"`
+	BodyLength      *string                `json:"body_length"`
+	CreatedAt       *time.Time             `json:"created_at"`
+	LanguageID      *uint                  `json:"language_id"`
+	Latitude        *float64               `json:"latitude"`
+	Longitude       *float64               `json:"longitude"`
+	PlaceName       *string                `json:"place_name"`
+	Georeference
+	Note            *string                `json:"note"`
+	Classification  *ClassificationCreate  `json:"classification"`
+	Observations    []ObservationUpdate    `json:"observation"`
+	Specimens       []SpecimenUpdate       `json:"specimen"`
+	Identifications []IdentificationUpdate `json:"identification"`
+	Timezone        *string                `json:"-"` // DBに入っているタイムゾーンなのだ。created_atを変えない時だけそのまま使うのだ
+}
+
+type ObservationUpdate struct {
+	ObservationID *uint `json:"observation_id"`
+	ObservationCreate
+}
+
+type SpecimenUpdate struct {
+	SpecimenID *uint `json:"specimen_id"`
+	SpecimenCreate
+}
+
+type IdentificationUpdate struct {
+	IdentificationID *uint `json:"identification_id"`
+	IdentificationCreate
 }
 
 
 // --- Occurrence Detail for /occurrence/{occurrence_id}
 type OccurrenceDetailResponse struct {
+	OccurrenceID   uint                    `json:"occurrence_id"`
+	Version        int                     `json:"version"`
 	UserID         uint                    `json:"user_id"`
 	UserName       string                 `json:"user_name"`
 	ProjectID      *uint                    `json:"project_id"`
@@ -174,6 +232,7 @@ type OccurrenceDetailResponse struct {
 	Latitude       *float64               `json:"latitude,omitempty"`
 	Longitude      *float64               `json:"longitude,omitempty"`
 	PlaceName      *string                 `json:"place_name,omitempty"`
+	Georeference
 	Note           *string                `json:"note,omitempty"`
 	Classification *ClassificationDetail  `json:"classification,omitempty"`
 	Observations   []ObservationDetail    `json:"observation"`   // ⬅️ リスト形式
@@ -0,0 +1,103 @@
+// internal/model/project_model.go
+package model
+
+import "time"
+
+// project_members.project_role に入っているプロジェクトの中での役割なのだ
+const (
+	ProjectRoleLead        = "lead"
+	ProjectRoleContributor = "contributor"
+	ProjectRoleObserver    = "observer"
+)
+
+// projectRolePermissions はプロジェクトの中の役割ごとに、そのプロジェクトのoccurrenceに何ができるかの表なのだ
+// 全体の役割 (user_roles) の権限と両方持っている時だけ操作できるのだ
+var projectRolePermissions = map[string][]Permission{
+	ProjectRoleLead: {
+		PermissionReadOccurrence,
+		PermissionCreateOccurrence,
+		PermissionEditOccurrence,
+		PermissionDeleteOccurrence,
+		PermissionUploadAttachment,
+	},
+	ProjectRoleContributor: {
+		PermissionReadOccurrence,
+		PermissionCreateOccurrence,
+		PermissionEditOccurrence,
+		PermissionUploadAttachment,
+	},
+	ProjectRoleObserver: {
+		PermissionReadOccurrence,
+	},
+}
+
+// HasProjectPermission はプロジェクトの中の役割がその権限を持っているかを返すのだ
+func HasProjectPermission(projectRole string, permission Permission) bool {
+	for _, p := range projectRolePermissions[projectRole] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// ProjectScope は検索や一覧で見てもいいプロジェクトの範囲なのだ
+// nilの時は全部のoccurrenceが対象で、プロジェクトに入っていないoccurrenceは UserID が持ち主のものだけが対象なのだ
+type ProjectScope struct {
+	ProjectIDs []uint
+	UserID     uint
+}
+
+// ProjectQuery は GET /project のクエリなのだ。アーカイブしたプロジェクトは聞かれた時だけ入れるのだ
+type ProjectQuery struct {
+	IncludeArchived bool `form:"include_archived"`
+}
+
+// ProjectRequest は POST /project と PUT /project/{project_id} で受け取るJSONの形なのだ
+// 日付は "2024-01-01" の形なのだ。updated_date が無ければ今日にするのだ
+type ProjectRequest struct {
+	ProjectName  string  `json:"project_name" binding:"required"`
+	Description  *string `json:"description"`
+	StartDate    *string `json:"start_date" binding:"omitempty,datetime=2006-01-02"`
+	FinishedDate *string `json:"finished_date" binding:"omitempty,datetime=2006-01-02"`
+	UpdatedDate  *string `json:"updated_date" binding:"omitempty,datetime=2006-01-02"`
+	Note         *string `json:"note"`
+}
+
+// ProjectInfo はプロジェクト1つの情報なのだ
+// project_member には今参加しているメンバーのuser_idが入るのだ
+type ProjectInfo struct {
+	ProjectID     uint       `json:"project_id"`
+	ProjectName   string     `json:"project_name"`
+	Description   *string    `json:"description"`
+	StartDate     *string    `json:"start_date"`
+	FinishedDate  *string    `json:"finished_date"`
+	UpdatedDate   *string    `json:"updated_date"`
+	Note          *string    `json:"note"`
+	ArchivedAt    *time.Time `json:"archived_at"`
+	ProjectMember []uint     `json:"project_member"`
+}
+
+// ProjectMemberRequest は PUT /project/{project_id}/members/{project_member_id} で受け取るJSONの形なのだ
+type ProjectMemberRequest struct {
+	ProjectRole string  `json:"project_role" binding:"required,oneof=lead contributor observer"`
+	JoinDate    *string `json:"join_date" binding:"omitempty,datetime=2006-01-02"`
+	FinishDate  *string `json:"finish_date" binding:"omitempty,datetime=2006-01-02"`
+}
+
+// ProjectMemberCreate は POST /project/{project_id}/members で受け取るJSONの形なのだ
+type ProjectMemberCreate struct {
+	UserID uint `json:"user_id" binding:"required"`
+	ProjectMemberRequest
+}
+
+// ProjectMemberInfo はプロジェクトのメンバー1人の情報なのだ
+type ProjectMemberInfo struct {
+	ProjectMemberID uint    `json:"project_member_id"`
+	UserID          uint    `json:"user_id"`
+	UserName        string  `json:"user_name"`
+	ProjectRole     string  `json:"project_role"`
+	JoinDate        *string `json:"join_date"`
+	FinishDate      *string `json:"finish_date"`
+	Active          bool    `json:"active"` // 今日の時点で参加中かなのだ
+}
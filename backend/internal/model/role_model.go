@@ -0,0 +1,72 @@
+// internal/model/role_model.go
+package model
+
+// user_roles.role_name に入っている役割の名前なのだ
+const (
+	RoleAdmin     = "admin"
+	RoleCurator   = "curator"
+	RoleCollector = "collector"
+	RoleViewer    = "viewer"
+	RoleGuest     = "guest"
+)
+
+// Permission はルートごとに必要になる操作の権限なのだ
+type Permission string
+
+const (
+	PermissionReadOccurrence   Permission = "occurrence:read"
+	PermissionCreateOccurrence Permission = "occurrence:create"
+	PermissionEditOccurrence   Permission = "occurrence:edit"
+	PermissionDeleteOccurrence Permission = "occurrence:delete"
+	PermissionUploadAttachment Permission = "attachment:upload"
+	PermissionManageReference  Permission = "reference:manage" // 観察方法・標本作成方法・機関などのマスタデータなのだ
+	PermissionManageUser       Permission = "user:manage"
+	PermissionManageProject    Permission = "project:manage" // プロジェクトを作ったり消したりするのだ。プロジェクトのleadは自分のプロジェクトだけ変えられるのだ
+)
+
+// rolePermissions はどの役割がどの権限を持っているかの表なのだ
+// adminは全部の権限を持っているので、ここには書かないのだ
+var rolePermissions = map[string][]Permission{
+	RoleCurator: {
+		PermissionReadOccurrence,
+		PermissionCreateOccurrence,
+		PermissionEditOccurrence,
+		PermissionDeleteOccurrence,
+		PermissionUploadAttachment,
+		PermissionManageReference,
+		PermissionManageProject,
+	},
+	RoleCollector: {
+		PermissionReadOccurrence,
+		PermissionCreateOccurrence,
+		PermissionEditOccurrence,
+		PermissionUploadAttachment,
+	},
+	RoleViewer: {
+		PermissionReadOccurrence,
+	},
+	RoleGuest: {
+		PermissionReadOccurrence,
+	},
+}
+
+// HasPermission は役割がその権限を持っているかを返すのだ。知らない役割は何もできないのだ
+func HasPermission(role string, permission Permission) bool {
+	if role == RoleAdmin {
+		return true
+	}
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// ForbiddenResponse は権限が足りない時に返す403の中身なのだ
+type ForbiddenResponse struct {
+	Error              string     `json:"error"`
+	RequiredPermission Permission `json:"required_permission"`
+	Role               string     `json:"role"`
+	ProjectID          *uint      `json:"project_id,omitempty"` // プロジェクトの中の役割が足りない時だけ入るのだ
+}
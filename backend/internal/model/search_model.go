@@ -23,6 +23,20 @@ type SearchQuery struct {
 	// Place
 	PlaceName string `form:"place_name"`
 
+	// Spatial (座標は経度・緯度の順なのだ)
+	BBox      string `form:"bbox"`      // "min_lng,min_lat,max_lng,max_lat"。min_lng > max_lng の時は日付変更線をまたぐのだ
+	Latitude  string `form:"latitude"`  // latitude, longitude, radius の3つそろって、点から radius メートル以内になるのだ
+	Longitude string `form:"longitude"`
+	Radius    string `form:"radius"`
+	Polygon   string `form:"polygon"`   // WKTかGeoJSONのPolygon/MultiPolygonなのだ
+
+	// Georeference
+	MaxUncertainty     string `form:"max_uncertainty"` // 座標の不確かさがこのメートル以下のものだけにするのだ。不確かさが無いものは入らないのだ
+	GeoreferenceSource string `form:"georeference_source" binding:"omitempty,oneof=gps map gazetteer"`
+
+	// Output
+	Format string `form:"format" binding:"omitempty,oneof=json geojson"` // "geojson" の時はページに分けないでGeoJSONのFeatureCollectionを返すのだ
+
 	// Classification
 	Species string `form:"species"`
 	Genus   string `form:"genus"`
@@ -52,6 +66,26 @@ type SearchQuery struct {
 	IdentificationUserID string `form:"identification_user_id"`
 	IdentifiedStart string `form:"identified_start"`
 	IdentifiedEnd   string `form:"identified_end"`
+
+	// Spatial はserviceが上の場所の条件を確かめてから入れるのだ。クエリからは入らないのだ
+	Spatial *SpatialFilter `form:"-"`
+}
+
+// SpatialFilter は確かめ終わった場所の条件なのだ。nilの条件は使わないのだ
+type SpatialFilter struct {
+	BBox           *BoundingBox
+	Circle         *Circle
+	Polygon        *string  // GeoJSONのgeometryなのだ
+	MaxUncertainty *float64 // メートルなのだ
+}
+
+type BoundingBox struct {
+	MinLng, MinLat, MaxLng, MaxLat float64
+}
+
+type Circle struct {
+	Lat, Lng float64
+	Radius   float64 // メートルなのだ
 }
 
 // SearchResponse は検索結果のレスポンス全体の構造なのだ
@@ -70,6 +104,7 @@ type Metadata struct {
 
 // OccurrenceResult は検索結果の各項目の詳細な構造なのだ
 type OccurrenceResult struct {
+	OccurrenceID   uint                  `json:"occurrence_id"`
 	UserID         *uint                   `json:"user_id"`
 	UserName       string                `json:"user_name"`
 	ProjectID      *uint                   `json:"project_id"`
@@ -83,6 +118,7 @@ type OccurrenceResult struct {
 	Latitude       *float64              `json:"latitude,omitempty"`
 	Longitude      *float64              `json:"longitude,omitempty"`
 	PlaceName      *string                `json:"place_name,omitempty"`
+	Georeference
 	Note           *string               `json:"note,omitempty"`
 	Classification *ClassificationResult `json:"classification,omitempty"`
 	Observation    *ObservationResult    `json:"observation,omitempty"`
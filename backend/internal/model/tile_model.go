@@ -0,0 +1,21 @@
+// internal/model/tile_model.go
+package model
+
+// MVTMediaType は Mapbox Vector Tile のContent-Typeなのだ
+const MVTMediaType = "application/vnd.mapbox-vector-tile"
+
+// WebMercatorWorldSize はWebメルカトル (EPSG:3857) の世界全体の1辺の長さ (メートル) なのだ
+const WebMercatorWorldSize = 2 * 20037508.342789244
+
+// TileRequest はSQLで作るタイル1枚の指定なのだ
+// ClusterCell が0より大きい時は、その大きさ (メートル) の格子ごとに点をまとめるのだ
+type TileRequest struct {
+	Z, X, Y     int
+	ClusterCell float64
+}
+
+// Tile は作ったタイルと、そのETagなのだ。点が1つも無い時は Data が空なのだ
+type Tile struct {
+	Data []byte
+	ETag string
+}
@@ -0,0 +1,30 @@
+//internal/model/trash_model.go
+package model
+
+import "time"
+
+// TrashQuery はゴミ箱一覧のページネーション用クエリなのだ
+type TrashQuery struct {
+	Page    int `form:"page"`
+	PerPage int `form:"per_page"`
+}
+
+// TrashResponse はゴミ箱一覧のレスポンス全体の構造なのだ
+type TrashResponse struct {
+	Results  []TrashItem `json:"trash_results"`
+	Metadata Metadata    `json:"metadata"`
+}
+
+// TrashItem はゴミ箱に入っているoccurrenceの概要なのだ
+type TrashItem struct {
+	OccurrenceID uint       `json:"occurrence_id"`
+	UserID       *uint      `json:"user_id"`
+	UserName     string     `json:"user_name"`
+	ProjectID    *uint      `json:"project_id"`
+	ProjectName  *string    `json:"project_name"`
+	Species      *string    `json:"species,omitempty"`
+	PlaceName    *string    `json:"place_name,omitempty"`
+	Note         *string    `json:"note,omitempty"`
+	CreatedAt    *time.Time `json:"created_at"`
+	DeletedAt    time.Time  `json:"deleted_at"`
+}
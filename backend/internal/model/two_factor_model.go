@@ -0,0 +1,25 @@
+// internal/model/two_factor_model.go
+package model
+
+// TOTPEnrollResponse は2段階認証の登録を始めた時に返すのだ
+// provisioning_uri をQRコードにして認証アプリで読み込んでもらうのだ
+type TOTPEnrollResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// TOTPCodeRequest は認証アプリのコードかリカバリーコードを受け取るJSONの形なのだ
+type TOTPCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// RecoveryCodesResponse はリカバリーコードを返すのだ。見られるのはこの時だけなのだ
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// TwoFactorLoginRequest は POST /login/2fa で受け取るJSONの形なのだ
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
@@ -0,0 +1,37 @@
+// internal/model/user_defaults_model.go
+package model
+
+// DefaultValuesUpdate は PUT /me/defaults で受け取るJSONの形なのだ
+// 名前 (project_name や observation_method_name など) は受け取らないで、サーバーがIDから引くのだ
+// PUTなので、送られてこなかった項目は空になるのだ
+type DefaultValuesUpdate struct {
+	ProjectID      *int                    `json:"project_id"`
+	IndividualID   *int                    `json:"individual_id"`
+	Lifestage      *string                 `json:"lifestage"`
+	Sex            *string                 `json:"sex"`
+	LanguageID     *int                    `json:"language_id"`
+	PlaceName      *string                 `json:"place_name"`
+	Note           *string                 `json:"note"`
+	Classification *ClassificationCreate   `json:"classification"`
+	Observation    *ObservationDefaults    `json:"observation"`
+	Specimen       *SpecimenDefaults       `json:"specimen"`
+	Identification *IdentificationDefaults `json:"identification"`
+}
+
+type ObservationDefaults struct {
+	ObservationUserID   *int    `json:"observation_user_id"`
+	ObservationMethodID *int    `json:"observation_method_id"`
+	Behavior            *string `json:"behavior"`
+	ObservedAt          *string `json:"observed_at"`
+}
+
+type SpecimenDefaults struct {
+	SpecimenUserID    *int `json:"specimen_user_id"`
+	SpecimenMethodsID *int `json:"specimen_methods_id"`
+}
+
+type IdentificationDefaults struct {
+	IdentificationUserID *int    `json:"identification_user_id"`
+	IdentifiedAt         *string `json:"identified_at"`
+	SourceInfo           *string `json:"source_info"`
+}
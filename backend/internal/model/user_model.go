@@ -0,0 +1,61 @@
+// internal/model/user_model.go
+package model
+
+import "time"
+
+// UserQuery は GET /user のページネーション用クエリなのだ
+type UserQuery struct {
+	Page               int  `form:"page"`
+	PerPage            int  `form:"per_page"`
+	IncludeDeactivated bool `form:"include_deactivated"`
+}
+
+// UserListResponse はユーザー一覧のレスポンス全体の構造なのだ
+type UserListResponse struct {
+	Results  []UserInfo `json:"user_results"`
+	Metadata Metadata   `json:"metadata"`
+}
+
+// UserInfo はユーザー1人の情報なのだ。パスワードや2段階認証の鍵は入れないのだ
+type UserInfo struct {
+	UserID           uint       `json:"user_id"`
+	UserName         string     `json:"user_name"`
+	DisplayName      string     `json:"display_name"`
+	MailAddress      *string    `json:"mail_address"`
+	RoleID           *int       `json:"role_id"`
+	Role             string     `json:"role"`
+	Timezone         *string    `json:"timezone"`
+	TwoFactorEnabled bool       `json:"two_factor_enabled"`
+	CreatedAt        time.Time  `json:"created_at"`
+	DeactivatedAt    *time.Time `json:"deactivated_at"`
+
+	// PendingMailAddress は確かめるメールを送って、まだ変わっていない新しいアドレスなのだ
+	PendingMailAddress *string `json:"pending_mail_address,omitempty"`
+}
+
+// UserCreate は POST /user で受け取るJSONの形なのだ
+// role_id が無ければviewerにするのだ
+type UserCreate struct {
+	UserName    string  `json:"user_name" binding:"required,max=255"`
+	DisplayName string  `json:"display_name" binding:"max=255"` // 空ならuser_nameと同じにするのだ
+	MailAddress string  `json:"mail_address" binding:"required,email,max=255"`
+	Password    string  `json:"password" binding:"required,min=8,max=72"`
+	RoleID      *int    `json:"role_id"`
+	Timezone    *string `json:"timezone"`
+}
+
+// UserUpdate は PUT /user/{user_id} で受け取るJSONの形なのだ
+// 送られてきた項目だけを書き換えるのだ。role_id を変えられるのは管理者だけなのだ
+// 自分の mail_address を変える時は、新しいアドレスに届くメールで確かめてから変わるのだ
+type UserUpdate struct {
+	DisplayName *string `json:"display_name" binding:"omitempty,min=1,max=255"`
+	MailAddress *string `json:"mail_address" binding:"omitempty,email,max=255"`
+	Timezone    *string `json:"timezone"`
+	RoleID      *int    `json:"role_id"`
+}
+
+// PasswordChangeRequest は PUT /user/{user_id}/password で受け取るJSONの形なのだ
+type PasswordChangeRequest struct {
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=8,max=72"`
+}
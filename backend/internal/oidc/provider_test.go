@@ -0,0 +1,140 @@
+// backend/internal/oidc/provider_test.go
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockIssuer はテスト用のOIDCのIdPなのだ
+// /authorize で覚えたcode_challengeを、/token でcode_verifierと照らし合わせるのだ
+type mockIssuer struct {
+	server    *httptest.Server
+	key       *rsa.PrivateKey
+	challenge string
+	nonce     string
+	audience  string
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	m := &mockIssuer{key: key, audience: "web-specimen"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Discovery{
+			Issuer:                m.server.URL,
+			AuthorizationEndpoint: m.server.URL + "/authorize",
+			TokenEndpoint:         m.server.URL + "/token",
+			JWKSURI:               m.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test-key",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("code") != "good-code" || CodeChallengeS256(r.Form.Get("code_verifier")) != m.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": m.sign(t, m.nonce)})
+	})
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func (m *mockIssuer) sign(t *testing.T, nonce string) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, &IDTokenClaims{
+		Email:         "collector@example.org",
+		EmailVerified: true,
+		Nonce:         nonce,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    m.server.URL,
+			Subject:   "sub-123",
+			Audience:  jwt.ClaimStrings{m.audience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	})
+	token.Header["kid"] = "test-key"
+	signed, err := token.SignedString(m.key)
+	assert.NoError(t, err)
+	return signed
+}
+
+// authorize はブラウザがIdPのログイン画面に行ったことにして、code_challengeとnonceを覚えるのだ
+func (m *mockIssuer) authorize(t *testing.T, authURL string) {
+	u, err := url.Parse(authURL)
+	assert.NoError(t, err)
+	assert.Equal(t, "S256", u.Query().Get("code_challenge_method"))
+	m.challenge = u.Query().Get("code_challenge")
+	m.nonce = u.Query().Get("nonce")
+}
+
+func TestProviderExchange(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("PKCEが合っていればIDトークンの中身が取れるのだ", func(t *testing.T) {
+		issuer := newMockIssuer(t)
+		provider := NewProvider(Config{IssuerURL: issuer.server.URL, ClientID: "web-specimen", RedirectURL: "http://localhost/callback"}, nil)
+
+		authURL, err := provider.AuthCodeURL(ctx, "state", "nonce", "verifier")
+		assert.NoError(t, err)
+		issuer.authorize(t, authURL)
+
+		claims, err := provider.Exchange(ctx, "good-code", "verifier", "nonce")
+		assert.NoError(t, err)
+		assert.Equal(t, "sub-123", claims.Subject)
+		assert.Equal(t, "collector@example.org", claims.Email)
+	})
+
+	t.Run("code_verifierが違うと交換できないのだ", func(t *testing.T) {
+		issuer := newMockIssuer(t)
+		provider := NewProvider(Config{IssuerURL: issuer.server.URL, ClientID: "web-specimen"}, nil)
+
+		authURL, _ := provider.AuthCodeURL(ctx, "state", "nonce", "verifier")
+		issuer.authorize(t, authURL)
+
+		_, err := provider.Exchange(ctx, "good-code", "other-verifier", "nonce")
+		assert.Error(t, err)
+	})
+
+	t.Run("nonceが違うIDトークンは受け付けないのだ", func(t *testing.T) {
+		issuer := newMockIssuer(t)
+		provider := NewProvider(Config{IssuerURL: issuer.server.URL, ClientID: "web-specimen"}, nil)
+
+		_, err := provider.VerifyIDToken(ctx, issuer.sign(t, "other-nonce"), "nonce")
+		assert.ErrorIs(t, err, ErrInvalidIDToken)
+	})
+
+	t.Run("別のクライアント宛てのIDトークンは受け付けないのだ", func(t *testing.T) {
+		issuer := newMockIssuer(t)
+		issuer.audience = "other-client"
+		provider := NewProvider(Config{IssuerURL: issuer.server.URL, ClientID: "web-specimen"}, nil)
+
+		_, err := provider.VerifyIDToken(ctx, issuer.sign(t, "nonce"), "nonce")
+		assert.ErrorIs(t, err, ErrInvalidIDToken)
+	})
+}
@@ -0,0 +1,70 @@
+//internal/repository/api_key_repository.go
+package repository
+
+import (
+	"time"
+
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"gorm.io/gorm"
+)
+
+type APIKeyRepository interface {
+	Create(key *entity.APIKey) error
+	FindByUserID(userID uint) ([]entity.APIKey, error)
+	FindActiveByHash(hash string) (*entity.APIKey, error)
+	Revoke(userID uint, id uint) error
+	TouchLastUsed(id uint) error
+}
+
+type apiKeyRepository struct {
+	db *gorm.DB
+}
+
+func NewAPIKeyRepository(db *gorm.DB) APIKeyRepository {
+	return &apiKeyRepository{db: db}
+}
+
+func (r *apiKeyRepository) Create(key *entity.APIKey) error {
+	return r.db.Omit("User").Create(key).Error
+}
+
+// FindByUserID はユーザーのAPIキーを、無効にしたものも含めて新しい順に取ってくるのだ
+func (r *apiKeyRepository) FindByUserID(userID uint) ([]entity.APIKey, error) {
+	var keys []entity.APIKey
+	err := r.db.Where("user_id = ?", userID).Order("api_key_id DESC").Find(&keys).Error
+	return keys, err
+}
+
+// FindActiveByHash は無効にされていなくて期限も切れていないキーを、役割と一緒に取ってくるのだ
+// 持ち主のユーザーが無効にされていたら、キーも使えないのだ
+func (r *apiKeyRepository) FindActiveByHash(hash string) (*entity.APIKey, error) {
+	var key entity.APIKey
+	err := r.db.Preload("User.UserRole").
+		Joins("JOIN users ON users.user_id = api_keys.user_id AND users.deactivated_at IS NULL").
+		Where("api_keys.key_hash = ? AND api_keys.revoked_at IS NULL", hash).
+		Where("(api_keys.expires_at IS NULL OR api_keys.expires_at > ?)", time.Now()).
+		First(&key).Error
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// Revoke は自分のAPIキーを無効にするのだ。他人のキーや無効にしたキーなら gorm.ErrRecordNotFound なのだ
+func (r *apiKeyRepository) Revoke(userID uint, id uint) error {
+	result := r.db.Model(&entity.APIKey{}).
+		Where("api_key_id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// TouchLastUsed は最後に使われた日時を今にするのだ
+func (r *apiKeyRepository) TouchLastUsed(id uint) error {
+	return r.db.Model(&entity.APIKey{}).Where("api_key_id = ?", id).Update("last_used_at", time.Now()).Error
+}
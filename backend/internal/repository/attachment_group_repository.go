@@ -8,6 +8,9 @@ import (
 
 type AttachmentGroupRepository interface {
 	Create(tx *gorm.DB, group *entity.AttachmentGroup) error
+	FindByOccurrenceID(tx *gorm.DB, occurrenceID uint) ([]entity.AttachmentGroup, error)
+	DeleteByOccurrenceID(tx *gorm.DB, occurrenceID uint) error
+	CountByAttachmentID(tx *gorm.DB, attachmentID uint) (int64, error)
 }
 
 type attachmentGroupRepository struct{}
@@ -19,3 +22,22 @@ func NewAttachmentGroupRepository() AttachmentGroupRepository {
 func (r *attachmentGroupRepository) Create(tx *gorm.DB, group *entity.AttachmentGroup) error {
 	return tx.Create(group).Error
 }
+
+// FindByOccurrenceID はoccurrenceに紐づいている添付ファイルのリンクを全部取ってくるのだ
+func (r *attachmentGroupRepository) FindByOccurrenceID(tx *gorm.DB, occurrenceID uint) ([]entity.AttachmentGroup, error) {
+	var groups []entity.AttachmentGroup
+	err := tx.Where("occurrence_id = ?", occurrenceID).Find(&groups).Error
+	return groups, err
+}
+
+// DeleteByOccurrenceID はoccurrenceと添付ファイルのリンクだけを消すのだ (attachments本体は消さない)
+func (r *attachmentGroupRepository) DeleteByOccurrenceID(tx *gorm.DB, occurrenceID uint) error {
+	return tx.Where("occurrence_id = ?", occurrenceID).Delete(&entity.AttachmentGroup{}).Error
+}
+
+// CountByAttachmentID は添付ファイルがいくつのoccurrenceから使われているかを数えるのだ
+func (r *attachmentGroupRepository) CountByAttachmentID(tx *gorm.DB, attachmentID uint) (int64, error) {
+	var count int64
+	err := tx.Model(&entity.AttachmentGroup{}).Where("attachment_id = ?", attachmentID).Count(&count).Error
+	return count, err
+}
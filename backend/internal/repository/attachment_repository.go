@@ -8,6 +8,8 @@ import (
 
 type AttachmentRepository interface {
 	Create(tx *gorm.DB, attachment *entity.Attachment) error
+	FindByID(tx *gorm.DB, attachmentID uint) (*entity.Attachment, error)
+	Delete(tx *gorm.DB, attachment *entity.Attachment) error
 }
 
 type attachmentRepository struct{}
@@ -19,3 +21,15 @@ func NewAttachmentRepository() AttachmentRepository {
 func (r *attachmentRepository) Create(tx *gorm.DB, attachment *entity.Attachment) error {
 	return tx.Create(attachment).Error
 }
+
+func (r *attachmentRepository) FindByID(tx *gorm.DB, attachmentID uint) (*entity.Attachment, error) {
+	var attachment entity.Attachment
+	if err := tx.First(&attachment, attachmentID).Error; err != nil {
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+func (r *attachmentRepository) Delete(tx *gorm.DB, attachment *entity.Attachment) error {
+	return tx.Delete(attachment).Error
+}
@@ -0,0 +1,126 @@
+// internal/repository/change_log_repository.go
+package repository
+
+import (
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"gorm.io/gorm"
+)
+
+// OccurrenceSnapshot はoccurrenceに関係する行を「テーブル名 → 行ID → 行のJSON」で持っておくものなのだ
+// 変更前と変更後のスナップショットを比べて、change_logsに書く差分を作るのに使うのだ
+type OccurrenceSnapshot map[string]map[uint]string
+
+// snapshotQuery はスナップショットを取る時のテーブル名とSQLの組なのだ
+// どのSQLも id と data (行のJSON) の2列を返して、? にはoccurrence_idが入るのだ
+type snapshotQuery struct {
+	table string
+	query string
+}
+
+// SnapshotTables はスナップショットに入るテーブルを、作られる順 (親が先) に並べたものなのだ
+var SnapshotTables = []string{
+	"classification_json",
+	"place_names_json",
+	"places",
+	"occurrence",
+	"observations",
+	"specimen",
+	"make_specimen",
+	"identifications",
+	"attachment_group",
+}
+
+var snapshotQueries = []snapshotQuery{
+	{"classification_json", `SELECT t.classification_id AS id, to_jsonb(t)::text AS data
+		FROM classification_json t JOIN occurrence o ON o.classification_id = t.classification_id
+		WHERE o.occurrence_id = ?`},
+	{"place_names_json", `SELECT t.place_name_id AS id, to_jsonb(t)::text AS data
+		FROM place_names_json t JOIN places p ON p.place_name_id = t.place_name_id
+		JOIN occurrence o ON o.place_id = p.place_id
+		WHERE o.occurrence_id = ?`},
+	// geographyはそのままだとWKBの16進数になって読めないので、WKTにして入れ直すのだ
+	{"places", `SELECT t.place_id AS id, (to_jsonb(t) || jsonb_build_object('coordinates', ST_AsText(t.coordinates)))::text AS data
+		FROM places t JOIN occurrence o ON o.place_id = t.place_id
+		WHERE o.occurrence_id = ?`},
+	{"occurrence", `SELECT t.occurrence_id AS id, to_jsonb(t)::text AS data
+		FROM occurrence t WHERE t.occurrence_id = ?`},
+	{"observations", `SELECT t.observations_id AS id, to_jsonb(t)::text AS data
+		FROM observations t WHERE t.occurrence_id = ?`},
+	{"specimen", `SELECT t.specimen_id AS id, to_jsonb(t)::text AS data
+		FROM specimen t WHERE t.occurrence_id = ?`},
+	{"make_specimen", `SELECT t.make_specimen_id AS id, to_jsonb(t)::text AS data
+		FROM make_specimen t WHERE t.occurrence_id = ?`},
+	{"identifications", `SELECT t.identification_id AS id, to_jsonb(t)::text AS data
+		FROM identifications t WHERE t.occurrence_id = ?`},
+	{"attachment_group", `SELECT t.attachment_id AS id, to_jsonb(t)::text AS data
+		FROM attachment_group t WHERE t.occurrence_id = ?`},
+}
+
+type ChangeLogRepository interface {
+	Snapshot(tx *gorm.DB, occurrenceID uint) (OccurrenceSnapshot, error)
+	Create(tx *gorm.DB, logs []entity.ChangeLog) error
+	FindByOccurrenceID(occurrenceID uint) ([]entity.ChangeLog, error)
+	Generation() (uint, error)
+	BumpGeneration() error
+}
+
+type changeLogRepository struct {
+	db *gorm.DB
+}
+
+func NewChangeLogRepository(db *gorm.DB) ChangeLogRepository {
+	return &changeLogRepository{db: db}
+}
+
+// Snapshot はトランザクションの中で、occurrenceに関係する行を全部JSONにして取ってくるのだ
+// ゴミ箱に入っているoccurrenceも対象にしたいので、deleted_atは見ないのだ
+func (r *changeLogRepository) Snapshot(tx *gorm.DB, occurrenceID uint) (OccurrenceSnapshot, error) {
+	snapshot := make(OccurrenceSnapshot, len(snapshotQueries))
+	for _, q := range snapshotQueries {
+		var rows []struct {
+			ID   uint
+			Data string
+		}
+		if err := tx.Raw(q.query, occurrenceID).Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+		tableRows := make(map[uint]string, len(rows))
+		for _, row := range rows {
+			tableRows[row.ID] = row.Data
+		}
+		snapshot[q.table] = tableRows
+	}
+	return snapshot, nil
+}
+
+// Create は変更ログをまとめて書き込むのだ。空の時は何もしないのだ
+func (r *changeLogRepository) Create(tx *gorm.DB, logs []entity.ChangeLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	return tx.Omit("User").Create(&logs).Error
+}
+
+// FindByOccurrenceID はoccurrenceの変更ログを古い順に全部取ってくるのだ
+func (r *changeLogRepository) FindByOccurrenceID(occurrenceID uint) ([]entity.ChangeLog, error) {
+	var logs []entity.ChangeLog
+	err := r.db.Preload("User").
+		Where("occurrence_id = ?", occurrenceID).
+		Order("date ASC, log_id ASC").
+		Find(&logs).Error
+	return logs, err
+}
+
+// Generation はoccurrence_generationの今の数を返すのだ
+// コミットされた変更の分だけ増えるので、データが変わったかを安く確かめるのに使えるのだ
+func (r *changeLogRepository) Generation() (uint, error) {
+	var generation uint
+	err := r.db.Raw("SELECT generation FROM occurrence_generation").Scan(&generation).Error
+	return generation, err
+}
+
+// BumpGeneration はoccurrence_generationを1つ上げるのだ。変更をコミットした後に、トランザクションの外で呼ぶのだ
+// この1文だけのトランザクションになるので、行ロックはすぐに外れるのだ
+func (r *changeLogRepository) BumpGeneration() error {
+	return r.db.Exec("UPDATE occurrence_generation SET generation = generation + 1").Error
+}
@@ -0,0 +1,66 @@
+//internal/repository/entry_template_repository.go
+package repository
+
+import (
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"gorm.io/gorm"
+)
+
+type EntryTemplateRepository interface {
+	Create(template *entity.EntryTemplate) error
+	Update(template *entity.EntryTemplate) error
+	Delete(id uint) error
+	FindByID(id uint) (*entity.EntryTemplate, error)
+	FindByName(userID uint, name string) (*entity.EntryTemplate, error)
+	FindVisible(userID uint, projectIDs []uint) ([]entity.EntryTemplate, error)
+}
+
+type entryTemplateRepository struct {
+	db *gorm.DB
+}
+
+func NewEntryTemplateRepository(db *gorm.DB) EntryTemplateRepository {
+	return &entryTemplateRepository{db: db}
+}
+
+func (r *entryTemplateRepository) Create(template *entity.EntryTemplate) error {
+	return r.db.Omit("User", "Project").Create(template).Error
+}
+
+// Update は名前と共有先のプロジェクトと中身だけを書き換えるのだ
+func (r *entryTemplateRepository) Update(template *entity.EntryTemplate) error {
+	return r.db.Model(template).
+		Select("project_id", "template_name", "template_values", "updated_at").
+		Updates(template).Error
+}
+
+func (r *entryTemplateRepository) Delete(id uint) error {
+	return r.db.Delete(&entity.EntryTemplate{}, id).Error
+}
+
+func (r *entryTemplateRepository) FindByID(id uint) (*entity.EntryTemplate, error) {
+	var template entity.EntryTemplate
+	if err := r.db.First(&template, id).Error; err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+func (r *entryTemplateRepository) FindByName(userID uint, name string) (*entity.EntryTemplate, error) {
+	var template entity.EntryTemplate
+	if err := r.db.Where("user_id = ? AND template_name = ?", userID, name).First(&template).Error; err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+// FindVisible は自分のテンプレートと、projectIDs のプロジェクトに共有されたテンプレートを取ってくるのだ
+func (r *entryTemplateRepository) FindVisible(userID uint, projectIDs []uint) ([]entity.EntryTemplate, error) {
+	var templates []entity.EntryTemplate
+	tx := r.db.Where("user_id = ?", userID)
+	if len(projectIDs) > 0 {
+		tx = tx.Or("project_id IN ?", projectIDs)
+	}
+	err := tx.Order("template_name, template_id").Find(&templates).Error
+	return templates, err
+}
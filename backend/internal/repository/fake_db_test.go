@@ -0,0 +1,143 @@
+// internal/repository/fake_db_test.go
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// --- 流れてきたSQLを覚えておくだけの偽物のDBなのだ ---
+// SELECTにはテストで決めた行を返して、INSERT ... RETURNING には連番のIDを返すのだ
+// 書き込みはどこにも保存しないので、テストでは「どんなSQLが流れたか」を確かめるのだ
+
+type recordedStatement struct {
+	query string
+	args  []driver.Value
+}
+
+type fakeRule struct {
+	match   string
+	columns []string
+	rows    [][]driver.Value
+}
+
+type fakeDB struct {
+	mu         sync.Mutex
+	rules      []fakeRule
+	statements []recordedStatement
+	nextID     int64
+}
+
+// on はSQLにmatchが含まれていたら、columnsとrowsを結果として返すようにするのだ
+// 先に登録したものから順に探すので、細かい条件のものを先に登録するのだ
+func (f *fakeDB) on(match string, columns []string, rows ...[]driver.Value) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rules = append(f.rules, fakeRule{match: match, columns: columns, rows: rows})
+}
+
+// executed はSQLにmatchが含まれているステートメントを、流れた順に返すのだ
+func (f *fakeDB) executed(match string) []recordedStatement {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var found []recordedStatement
+	for _, s := range f.statements {
+		if strings.Contains(s.query, match) {
+			found = append(found, s)
+		}
+	}
+	return found
+}
+
+var returningColumn = regexp.MustCompile(`RETURNING "(\w+)"`)
+
+func (f *fakeDB) query(query string, args []driver.NamedValue) (driver.Rows, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record(query, args)
+
+	for _, rule := range f.rules {
+		if strings.Contains(query, rule.match) {
+			return &fakeRows{columns: rule.columns, rows: rule.rows}, nil
+		}
+	}
+	if m := returningColumn.FindStringSubmatch(query); m != nil {
+		f.nextID++
+		return &fakeRows{columns: []string{m[1]}, rows: [][]driver.Value{{1000 + f.nextID}}}, nil
+	}
+	return &fakeRows{}, nil
+}
+
+func (f *fakeDB) exec(query string, args []driver.NamedValue) (driver.Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record(query, args)
+	return driver.RowsAffected(1), nil
+}
+
+func (f *fakeDB) record(query string, args []driver.NamedValue) {
+	values := make([]driver.Value, len(args))
+	for i, a := range args {
+		values[i] = a.Value
+	}
+	f.statements = append(f.statements, recordedStatement{query: query, args: values})
+}
+
+type fakeConnector struct{ db *fakeDB }
+type fakeConn struct{ db *fakeDB }
+type fakeTx struct{}
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) { return fakeConn{db: c.db}, nil }
+func (c fakeConnector) Driver() driver.Driver                        { return nil }
+
+func (fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+func (fakeConn) Close() error              { return nil }
+func (fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+func (c fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.db.query(query, args)
+}
+func (c fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.db.exec(query, args)
+}
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+	next    int
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
+
+func newFakeDB(t *testing.T) (*gorm.DB, *fakeDB) {
+	t.Helper()
+	fake := &fakeDB{}
+	sqlDB := sql.OpenDB(fakeConnector{db: fake})
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, fake
+}
@@ -0,0 +1,114 @@
+// internal/repository/institution_repository.go
+package repository
+
+import (
+	"time"
+
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"gorm.io/gorm"
+)
+
+type InstitutionRepository interface {
+	FindAll(includeInactive bool) ([]entity.InstitutionIDCode, error)
+	FindByID(id uint) (*entity.InstitutionIDCode, error)
+	FindActiveByCode(code string) (*entity.InstitutionIDCode, error)
+	FindByGRSciCollID(grscicollID string) (*entity.InstitutionIDCode, error)
+	Create(institution *entity.InstitutionIDCode) error
+	Update(institution *entity.InstitutionIDCode) error
+	SetDeactivatedAt(id uint, deactivatedAt *time.Time) error
+	CountSpecimens(id uint) (int64, error)
+	FindActiveIDs(ids []uint) ([]uint, error)
+	FindIDsByOccurrenceID(occurrenceID uint) ([]uint, error)
+}
+
+type institutionRepository struct {
+	db *gorm.DB
+}
+
+func NewInstitutionRepository(db *gorm.DB) InstitutionRepository {
+	return &institutionRepository{db: db}
+}
+
+// FindAll は機関をコード順に取ってくるのだ
+func (r *institutionRepository) FindAll(includeInactive bool) ([]entity.InstitutionIDCode, error) {
+	var institutions []entity.InstitutionIDCode
+	tx := r.db.Model(&entity.InstitutionIDCode{})
+	if !includeInactive {
+		tx = tx.Where("deactivated_at IS NULL")
+	}
+	err := tx.Order("institution_code, institution_id").Find(&institutions).Error
+	return institutions, err
+}
+
+func (r *institutionRepository) FindByID(id uint) (*entity.InstitutionIDCode, error) {
+	var institution entity.InstitutionIDCode
+	if err := r.db.First(&institution, id).Error; err != nil {
+		return nil, err
+	}
+	return &institution, nil
+}
+
+// FindActiveByCode は使われている機関の中から、大文字小文字を気にしないで同じコードを探すのだ
+func (r *institutionRepository) FindActiveByCode(code string) (*entity.InstitutionIDCode, error) {
+	var institution entity.InstitutionIDCode
+	err := r.db.Where("deactivated_at IS NULL AND lower(institution_code) = lower(?)", code).
+		First(&institution).Error
+	if err != nil {
+		return nil, err
+	}
+	return &institution, nil
+}
+
+// FindByGRSciCollID は無効にした機関も入れて、同じ GRSciColl のIDを持つ機関を探すのだ
+func (r *institutionRepository) FindByGRSciCollID(grscicollID string) (*entity.InstitutionIDCode, error) {
+	var institution entity.InstitutionIDCode
+	if err := r.db.Where("grscicoll_id = ?", grscicollID).First(&institution).Error; err != nil {
+		return nil, err
+	}
+	return &institution, nil
+}
+
+func (r *institutionRepository) Create(institution *entity.InstitutionIDCode) error {
+	return r.db.Omit("Specimens", "DeactivatedAt").Create(institution).Error
+}
+
+// Update は機関の情報のカラムを書き換えるのだ。deactivated_at はここでは変えないのだ
+func (r *institutionRepository) Update(institution *entity.InstitutionIDCode) error {
+	return r.db.Model(institution).
+		Select("institution_code", "institution_name", "acronym", "address", "country_code",
+			"grscicoll_id", "index_herbariorum_code", "contact_name", "contact_email", "url").
+		Updates(institution).Error
+}
+
+// SetDeactivatedAt は機関を無効にしたり(日時)、元に戻したり(nil)するのだ
+func (r *institutionRepository) SetDeactivatedAt(id uint, deactivatedAt *time.Time) error {
+	return r.db.Model(&entity.InstitutionIDCode{}).Where("institution_id = ?", id).Update("deactivated_at", deactivatedAt).Error
+}
+
+// CountSpecimens は機関に入っている標本を数えるのだ
+func (r *institutionRepository) CountSpecimens(id uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&entity.Specimen{}).Where("institution_id = ?", id).Count(&count).Error
+	return count, err
+}
+
+// FindActiveIDs は ids の中で、あって無効にされていない機関のIDだけを返すのだ
+func (r *institutionRepository) FindActiveIDs(ids []uint) ([]uint, error) {
+	var active []uint
+	if len(ids) == 0 {
+		return active, nil
+	}
+	err := r.db.Model(&entity.InstitutionIDCode{}).
+		Where("institution_id IN ? AND deactivated_at IS NULL", ids).
+		Pluck("institution_id", &active).Error
+	return active, err
+}
+
+// FindIDsByOccurrenceID はoccurrenceの標本に今付いている機関のIDを返すのだ
+func (r *institutionRepository) FindIDsByOccurrenceID(occurrenceID uint) ([]uint, error) {
+	var ids []uint
+	err := r.db.Model(&entity.Specimen{}).
+		Where("occurrence_id = ? AND institution_id IS NOT NULL", occurrenceID).
+		Distinct().Pluck("institution_id", &ids).Error
+	return ids, err
+}
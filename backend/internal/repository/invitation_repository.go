@@ -0,0 +1,73 @@
+//internal/repository/invitation_repository.go
+package repository
+
+import (
+	"time"
+
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"gorm.io/gorm"
+)
+
+type InvitationRepository interface {
+	Create(invitation *entity.Invitation) error
+	FindPending() ([]entity.Invitation, error)
+	FindByTokenID(tokenID string) (*entity.Invitation, error)
+	MarkAccepted(tx *gorm.DB, id uint, userID uint) (bool, error)
+	Revoke(id uint) error
+}
+
+type invitationRepository struct {
+	db *gorm.DB
+}
+
+func NewInvitationRepository(db *gorm.DB) InvitationRepository {
+	return &invitationRepository{db: db}
+}
+
+func (r *invitationRepository) Create(invitation *entity.Invitation) error {
+	return r.db.Omit("UserRole", "Inviter").Create(invitation).Error
+}
+
+// FindPending はまだ受け入れられていなくて、期限も切れていない招待を新しい順に取ってくるのだ
+func (r *invitationRepository) FindPending() ([]entity.Invitation, error) {
+	var invitations []entity.Invitation
+	err := r.db.Preload("UserRole").Preload("Inviter").
+		Where("accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", time.Now()).
+		Order("invitation_id DESC").
+		Find(&invitations).Error
+	return invitations, err
+}
+
+func (r *invitationRepository) FindByTokenID(tokenID string) (*entity.Invitation, error) {
+	var invitation entity.Invitation
+	if err := r.db.Preload("UserRole").Where("token_id = ?", tokenID).First(&invitation).Error; err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// MarkAccepted はまだ使われていない招待だけを受け入れ済みにするのだ
+// 同時に2回受け入れられそうになっても、片方だけがtrueになるのだ
+func (r *invitationRepository) MarkAccepted(tx *gorm.DB, id uint, userID uint) (bool, error) {
+	result := tx.Model(&entity.Invitation{}).
+		Where("invitation_id = ? AND accepted_at IS NULL AND revoked_at IS NULL", id).
+		Updates(map[string]interface{}{"accepted_at": time.Now(), "accepted_user_id": userID})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// Revoke はまだ受け入れられていない招待を取り消すのだ。無ければ gorm.ErrRecordNotFound なのだ
+func (r *invitationRepository) Revoke(id uint) error {
+	result := r.db.Model(&entity.Invitation{}).
+		Where("invitation_id = ? AND accepted_at IS NULL AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+//internal/repository/login_audit_repository.go
+package repository
+
+import (
+	"time"
+
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"gorm.io/gorm"
+)
+
+// FailureStats は続いたログインの失敗の回数と、最後に失敗した日時なのだ
+type FailureStats struct {
+	Count       int64
+	LastFailure *time.Time
+}
+
+type LoginAuditRepository interface {
+	Create(audit *entity.LoginAudit) error
+	UpdateResult(audit *entity.LoginAudit) error
+	Delete(id uint) error
+	AccountFailures(mailAddress string, since time.Time, beforeID uint) (*FailureStats, error)
+	IPFailures(ipAddress string, since time.Time, beforeID uint) (*FailureStats, error)
+	RecentEvents(event, mailAddress, ipAddress string, since time.Time, beforeID uint) (*FailureStats, *FailureStats, error)
+	Search(query *model.LoginAuditQuery) ([]entity.LoginAudit, int64, error)
+}
+
+type loginAuditRepository struct {
+	db *gorm.DB
+}
+
+func NewLoginAuditRepository(db *gorm.DB) LoginAuditRepository {
+	return &loginAuditRepository{db: db}
+}
+
+func (r *loginAuditRepository) Create(audit *entity.LoginAudit) error {
+	return r.db.Omit("User").Create(audit).Error
+}
+
+// UpdateResult は先に入れておいた試みの行に、結果 (誰だったか・成功か失敗か) を書くのだ
+func (r *loginAuditRepository) UpdateResult(audit *entity.LoginAudit) error {
+	return r.db.Model(&entity.LoginAudit{}).Where("login_audit_id = ?", audit.LoginAuditID).Updates(map[string]interface{}{
+		"user_id": audit.UserID,
+		"event":   audit.Event,
+		"detail":  audit.Detail,
+	}).Error
+}
+
+func (r *loginAuditRepository) Delete(id uint) error {
+	return r.db.Delete(&entity.LoginAudit{}, id).Error
+}
+
+// AccountFailures は since より後で、最後の成功かロック解除より後の失敗を数えるのだ
+// beforeID より前に入った行だけを数えるので、自分の試みは数えないで、先に始まった試みは失敗として数えるのだ
+func (r *loginAuditRepository) AccountFailures(mailAddress string, since time.Time, beforeID uint) (*FailureStats, error) {
+	var stats FailureStats
+	err := r.db.Raw(`
+		SELECT count(*) AS count, max(created_at) AS last_failure
+		FROM login_audits
+		WHERE mail_address = ? AND event = ? AND created_at > ? AND login_audit_id < ?
+		  AND created_at > COALESCE((
+			SELECT max(created_at) FROM login_audits
+			WHERE mail_address = ? AND event IN (?, ?)
+		  ), '-infinity'::timestamptz)`,
+		mailAddress, model.LoginEventFailure, since, beforeID,
+		mailAddress, model.LoginEventSuccess, model.LoginEventUnlock,
+	).Scan(&stats).Error
+	return &stats, err
+}
+
+// IPFailures は since より後に、そのIPアドレスから失敗した回数を数えるのだ
+// たくさんのアカウントを順番に試されるのを止めるためなので、成功しても数え直さないのだ
+func (r *loginAuditRepository) IPFailures(ipAddress string, since time.Time, beforeID uint) (*FailureStats, error) {
+	var stats FailureStats
+	err := r.db.Model(&entity.LoginAudit{}).
+		Select("count(*) AS count, max(created_at) AS last_failure").
+		Where("ip_address = ? AND event = ? AND created_at > ? AND login_audit_id < ?", ipAddress, model.LoginEventFailure, since, beforeID).
+		Scan(&stats).Error
+	return &stats, err
+}
+
+// RecentEvents は since より後に入った event の行を、メールアドレスごととIPアドレスごとに数えるのだ
+// 失敗の数え方と同じで、beforeID より前に入った行だけを数えるのだ
+func (r *loginAuditRepository) RecentEvents(event, mailAddress, ipAddress string, since time.Time, beforeID uint) (*FailureStats, *FailureStats, error) {
+	var byAddress, byIP FailureStats
+	err := r.db.Model(&entity.LoginAudit{}).
+		Select("count(*) AS count, max(created_at) AS last_failure").
+		Where("mail_address = ? AND event = ? AND created_at > ? AND login_audit_id < ?", mailAddress, event, since, beforeID).
+		Scan(&byAddress).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	err = r.db.Model(&entity.LoginAudit{}).
+		Select("count(*) AS count, max(created_at) AS last_failure").
+		Where("ip_address = ? AND event = ? AND created_at > ? AND login_audit_id < ?", ipAddress, event, since, beforeID).
+		Scan(&byIP).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	return &byAddress, &byIP, nil
+}
+
+// Search は管理者向けに、ログインの記録を新しい順に絞り込むのだ
+func (r *loginAuditRepository) Search(query *model.LoginAuditQuery) ([]entity.LoginAudit, int64, error) {
+	var audits []entity.LoginAudit
+	var total int64
+
+	tx := r.db.Model(&entity.LoginAudit{})
+	if query.UserID != nil {
+		tx = tx.Where("user_id = ?", *query.UserID)
+	}
+	if query.Email != "" {
+		tx = tx.Where("mail_address = ?", query.Email)
+	}
+	if query.IPAddress != "" {
+		tx = tx.Where("ip_address = ?", query.IPAddress)
+	}
+	if query.Event != "" {
+		tx = tx.Where("event = ?", query.Event)
+	}
+	if query.From != nil {
+		tx = tx.Where("created_at >= ?", *query.From)
+	}
+	if query.To != nil {
+		tx = tx.Where("created_at < ?", *query.To)
+	}
+	if err := tx.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (query.Page - 1) * query.PerPage
+	err := tx.Session(&gorm.Session{}).Limit(query.PerPage).Offset(offset).
+		Preload("User").
+		Order("created_at DESC, login_audit_id DESC").
+		Find(&audits).Error
+
+	return audits, total, err
+}
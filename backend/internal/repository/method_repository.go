@@ -0,0 +1,236 @@
+//internal/repository/method_repository.go
+package repository
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"gorm.io/gorm"
+)
+
+// MethodKind は observation_methods と specimen_methods のテーブルの違いをまとめたものなのだ
+// カラムの名前が少しずつ違うので、ここで吸収するのだ
+type MethodKind struct {
+	Table        string
+	IDColumn     string
+	PageColumn   string
+	References   []MethodReference // 方法のIDを持っているテーブルなのだ。統合する時に付け替えるのだ
+	TemplatePath string            // entry_templates.template_values の中で、方法のIDが入っている場所なのだ
+}
+
+// MethodReference は方法のIDを持っているテーブルとカラムなのだ
+// OccurrenceColumn はoccurrenceの子レコードの時だけ入れるのだ。統合する時に、どのoccurrenceが変わるかを見るのに使うのだ
+type MethodReference struct {
+	Table            string
+	Column           string
+	OccurrenceColumn string
+}
+
+var ObservationMethodKind = MethodKind{
+	Table:      "observation_methods",
+	IDColumn:   "observation_method_id",
+	PageColumn: "pageid",
+	References: []MethodReference{
+		{Table: "observations", Column: "observation_method_id", OccurrenceColumn: "occurrence_id"},
+		{Table: "users_defaults", Column: "observation_method_id"},
+	},
+	TemplatePath: "{observation,observation_method_id}",
+}
+
+var SpecimenMethodKind = MethodKind{
+	Table:      "specimen_methods",
+	IDColumn:   "specimen_methods_id",
+	PageColumn: "page_id",
+	References: []MethodReference{
+		{Table: "specimen", Column: "specimen_method_id", OccurrenceColumn: "occurrence_id"},
+		{Table: "make_specimen", Column: "specimen_method_id", OccurrenceColumn: "occurrence_id"},
+		{Table: "users_defaults", Column: "specimen_method_id"},
+	},
+	TemplatePath: "{specimen,specimen_methods_id}",
+}
+
+type MethodRepository interface {
+	FindAll(includeDeprecated bool) ([]model.MethodInfo, error)
+	FindByID(id uint) (*model.MethodInfo, error)
+	LockByID(tx *gorm.DB, id uint) (*model.MethodInfo, error)
+	FindActiveByName(name string) (*model.MethodInfo, error)
+	Create(name string, pageID *uint) (uint, error)
+	Update(id uint, name string, pageID *uint) error
+	SetDeprecatedAt(id uint, deprecatedAt *time.Time) error
+	CountUsage(id uint) (int64, error)
+	FindMergeableOccurrenceIDs(tx *gorm.DB, id uint) ([]uint, error)
+	Merge(tx *gorm.DB, sourceID uint, targetID uint, occurrenceIDs []uint) error
+	PageExists(pageID uint) (bool, error)
+}
+
+type methodRepository struct {
+	db   *gorm.DB
+	kind MethodKind
+}
+
+func NewMethodRepository(db *gorm.DB, kind MethodKind) MethodRepository {
+	return &methodRepository{db: db, kind: kind}
+}
+
+// selectColumns はどちらのテーブルでも model.MethodInfo に入るように、カラムの名前をそろえるのだ
+func (r *methodRepository) selectColumns() string {
+	return r.kind.IDColumn + " AS method_id, method_common_name AS method_name, " +
+		r.kind.PageColumn + " AS page_id, deprecated_at, merged_into"
+}
+
+// FindAll は方法を名前順に取ってくるのだ
+func (r *methodRepository) FindAll(includeDeprecated bool) ([]model.MethodInfo, error) {
+	var methods []model.MethodInfo
+	tx := r.db.Table(r.kind.Table).Select(r.selectColumns())
+	if !includeDeprecated {
+		tx = tx.Where("deprecated_at IS NULL")
+	}
+	err := tx.Order("method_common_name, " + r.kind.IDColumn).Scan(&methods).Error
+	return methods, err
+}
+
+func (r *methodRepository) FindByID(id uint) (*model.MethodInfo, error) {
+	var methods []model.MethodInfo
+	err := r.db.Table(r.kind.Table).Select(r.selectColumns()).
+		Where(r.kind.IDColumn+" = ?", id).Limit(1).Scan(&methods).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(methods) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &methods[0], nil
+}
+
+// LockByID はトランザクションの中で方法の行をロックしてから取ってくるのだ
+// 統合している間に、他の人が同じ方法を統合したり使わなくしたりできないようにするのだ
+func (r *methodRepository) LockByID(tx *gorm.DB, id uint) (*model.MethodInfo, error) {
+	var methods []model.MethodInfo
+	err := tx.Raw("SELECT "+r.selectColumns()+" FROM "+r.kind.Table+" WHERE "+r.kind.IDColumn+" = ? FOR UPDATE", id).
+		Scan(&methods).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(methods) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &methods[0], nil
+}
+
+// FindMergeableOccurrenceIDs は方法を使っているoccurrenceのIDを、行をロックしてから取ってくるのだ
+// ゴミ箱のoccurrenceも入れるけど、アーカイブしたプロジェクトのoccurrenceは読むだけなので入れないのだ
+func (r *methodRepository) FindMergeableOccurrenceIDs(tx *gorm.DB, id uint) ([]uint, error) {
+	var subqueries []string
+	var args []interface{}
+	for _, ref := range r.kind.References {
+		if ref.OccurrenceColumn == "" {
+			continue
+		}
+		subqueries = append(subqueries, "SELECT "+ref.OccurrenceColumn+" FROM "+ref.Table+" WHERE "+ref.Column+" = ?")
+		args = append(args, id)
+	}
+
+	var ids []uint
+	err := tx.Raw(`SELECT o.occurrence_id FROM occurrence o
+		LEFT JOIN projects p ON p.project_id = o.project_id
+		WHERE p.archived_at IS NULL AND o.occurrence_id IN (`+strings.Join(subqueries, " UNION ")+`)
+		ORDER BY o.occurrence_id
+		FOR UPDATE OF o`, args...).Scan(&ids).Error
+	return ids, err
+}
+
+// FindActiveByName は使われている方法の中から、大文字小文字を気にしないで同じ名前を探すのだ
+func (r *methodRepository) FindActiveByName(name string) (*model.MethodInfo, error) {
+	var methods []model.MethodInfo
+	err := r.db.Table(r.kind.Table).Select(r.selectColumns()).
+		Where("deprecated_at IS NULL AND lower(method_common_name) = lower(?)", name).
+		Limit(1).Scan(&methods).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(methods) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &methods[0], nil
+}
+
+func (r *methodRepository) Create(name string, pageID *uint) (uint, error) {
+	var id uint
+	err := r.db.Raw(
+		"INSERT INTO "+r.kind.Table+" (method_common_name, "+r.kind.PageColumn+") VALUES (?, ?) RETURNING "+r.kind.IDColumn,
+		name, pageID,
+	).Scan(&id).Error
+	return id, err
+}
+
+func (r *methodRepository) Update(id uint, name string, pageID *uint) error {
+	return r.db.Table(r.kind.Table).Where(r.kind.IDColumn+" = ?", id).
+		Updates(map[string]interface{}{"method_common_name": name, r.kind.PageColumn: pageID}).Error
+}
+
+// SetDeprecatedAt は方法を使わないようにしたり(日時)、元に戻したり(nil)するのだ
+func (r *methodRepository) SetDeprecatedAt(id uint, deprecatedAt *time.Time) error {
+	return r.db.Table(r.kind.Table).Where(r.kind.IDColumn+" = ?", id).Update("deprecated_at", deprecatedAt).Error
+}
+
+// CountUsage は方法を使っている記録 (observationsやspecimenなど) の数を数えるのだ
+// デフォルト値やテンプレートは記録ではないので数えないのだ
+func (r *methodRepository) CountUsage(id uint) (int64, error) {
+	var total int64
+	for _, ref := range r.kind.References {
+		if ref.Table == "users_defaults" {
+			continue
+		}
+		var count int64
+		if err := r.db.Table(ref.Table).Where(ref.Column+" = ?", id).Count(&count).Error; err != nil {
+			return 0, err
+		}
+		total += count
+	}
+	return total, nil
+}
+
+// Merge は sourceID を使っている行を targetID に付け替えて、sourceID を統合済みにするのだ
+// occurrenceの子レコードは occurrenceIDs のものだけを付け替えて、そのoccurrenceのバージョンを上げるのだ
+// デフォルト値とテンプレートのJSONの中のIDは全部付け替えるのだ
+func (r *methodRepository) Merge(tx *gorm.DB, sourceID uint, targetID uint, occurrenceIDs []uint) error {
+	for _, ref := range r.kind.References {
+		query := "UPDATE " + ref.Table + " SET " + ref.Column + " = ? WHERE " + ref.Column + " = ?"
+		args := []interface{}{targetID, sourceID}
+		if ref.OccurrenceColumn != "" {
+			if len(occurrenceIDs) == 0 {
+				continue
+			}
+			query += " AND " + ref.OccurrenceColumn + " IN ?"
+			args = append(args, occurrenceIDs)
+		}
+		if err := tx.Exec(query, args...).Error; err != nil {
+			return err
+		}
+	}
+
+	if len(occurrenceIDs) > 0 {
+		if err := tx.Exec("UPDATE occurrence SET version = version + 1 WHERE occurrence_id IN ?", occurrenceIDs).Error; err != nil {
+			return err
+		}
+	}
+
+	err := tx.Exec(
+		"UPDATE entry_templates SET template_values = jsonb_set(template_values, ?::text[], to_jsonb(?::int)) WHERE template_values #>> ?::text[] = ?",
+		r.kind.TemplatePath, targetID, r.kind.TemplatePath, strconv.FormatUint(uint64(sourceID), 10),
+	).Error
+	if err != nil {
+		return err
+	}
+
+	return tx.Table(r.kind.Table).Where(r.kind.IDColumn+" = ?", sourceID).
+		Updates(map[string]interface{}{"deprecated_at": time.Now(), "merged_into": targetID}).Error
+}
+
+func (r *methodRepository) PageExists(pageID uint) (bool, error) {
+	var count int64
+	err := r.db.Table("wiki_pages").Where("page_id = ?", pageID).Count(&count).Error
+	return count > 0, err
+}
@@ -2,18 +2,41 @@
 package repository
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
 	"github.com/saku-730/web-specimen/backend/internal/entity"
 	"github.com/saku-730/web-specimen/backend/internal/model"
 	"gorm.io/gorm"
 	//"fmt"
 )
 
+// ErrChildNotFound は更新しようとした子レコードが、そのoccurrenceのものではなかった時のエラーなのだ
+var ErrChildNotFound = errors.New("child record not found in occurrence")
+
+// ErrVersionConflict は他の人が先にoccurrenceを更新していて、バージョンが合わなかった時のエラーなのだ
+var ErrVersionConflict = errors.New("occurrence version conflict")
+
 // DropdownRepository はドロップダウンリストのデータ取得を定義するインターフェースなのだ
 type OccurrenceRepository interface {
 	GetDropdownLists() (*model.Dropdowns, error)
 	CreateOccurrence(tx *gorm.DB, occurrence *entity.Occurrence, classification *entity.ClassificationJSON, place *entity.Place, placeName *entity.PlaceNamesJSON, observation *entity.Observation, specimen *entity.Specimen, makeSpecimen *entity.MakeSpecimen, identification *entity.Identification) (*entity.Occurrence, error)
-	Search(query *model.SearchQuery) ([]entity.Occurrence, int64, error)
+	Search(query *model.SearchQuery, scope *model.ProjectScope) ([]entity.Occurrence, int64, error)
+	SearchEach(query *model.SearchQuery, scope *model.ProjectScope, batchSize int, fn func(occurrences []entity.Occurrence) error) error
+	SearchTile(query *model.SearchQuery, scope *model.ProjectScope, tile *model.TileRequest) ([]byte, error)
 	FindByID(id uint) (*entity.Occurrence, error)
+	FindOwnership(id uint) (projectID *uint, ownerID *uint, err error)
+	Exists(id uint) (bool, error)
+	UpdateOccurrence(tx *gorm.DB, occurrence *entity.Occurrence, classification *entity.ClassificationJSON, place *entity.Place, placeName *entity.PlaceNamesJSON, observations []entity.Observation, specimens []entity.Specimen, makeSpecimens []entity.MakeSpecimen, identifications []entity.Identification) error
+	BumpVersion(tx *gorm.DB, id uint, expectedVersion int) error
+	SoftDeleteOccurrence(tx *gorm.DB, id uint) error
+	RestoreOccurrence(tx *gorm.DB, id uint) error
+	FindDeleted(page, perPage int, scope *model.ProjectScope) ([]entity.Occurrence, int64, error)
+	FindDeletedBefore(cutoff time.Time) ([]uint, error)
+	PurgeOccurrence(tx *gorm.DB, id uint) error
 }
 
 type occurrenceRepository struct {
@@ -39,7 +62,8 @@ func (r *occurrenceRepository) GetDropdownLists() (*model.Dropdowns, error) {
 		return nil, err
 	}
 // Projects テーブルから取得
-	if err := r.db.Model(&entity.Project{}).Select("project_id, project_name").Find(&projects).Error; err != nil {
+	// アーカイブしたプロジェクトにはもう記録できないので、出さないのだ
+	if err := r.db.Model(&entity.Project{}).Select("project_id, project_name").Where("archived_at IS NULL").Find(&projects).Error; err != nil {
 		return nil, err
 	}
 
@@ -49,17 +73,19 @@ func (r *occurrenceRepository) GetDropdownLists() (*model.Dropdowns, error) {
 	}
 
 	// ObservationMethods テーブルから取得 (カラム名をモデルのフィールド名に合わせるのだ)
-	if err := r.db.Model(&entity.ObservationMethod{}).Select("observation_method_id, method_common_name AS observation_method_name").Find(&obsMethods).Error; err != nil {
+	// 使わなくなった方法は選択肢に出さないのだ。古い記録の詳細にはそのまま出るのだ
+	if err := r.db.Model(&entity.ObservationMethod{}).Select("observation_method_id, method_common_name AS observation_method_name").Where("deprecated_at IS NULL").Find(&obsMethods).Error; err != nil {
 		return nil, err
 	}
 
 	// SpecimenMethods テーブルから取得 (こちらもカラム名を合わせるのだ)
-	if err := r.db.Model(&entity.SpecimenMethod{}).Select("specimen_methods_id, method_common_name AS specimen_methods_common").Find(&specMethods).Error; err != nil {
+	if err := r.db.Model(&entity.SpecimenMethod{}).Select("specimen_methods_id, method_common_name AS specimen_methods_common").Where("deprecated_at IS NULL").Find(&specMethods).Error; err != nil {
 		return nil, err
 	}
 
 	// InstitutionIDCode テーブルから取得
-	if err := r.db.Model(&entity.InstitutionIDCode{}).Select("institution_id, institution_code").Find(&institutions).Error; err != nil {
+	// 無効にした機関は新しい標本に付けられないので、選択肢に出さないのだ
+	if err := r.db.Model(&entity.InstitutionIDCode{}).Select("institution_id, institution_code, institution_name").Where("deactivated_at IS NULL").Order("institution_code").Find(&institutions).Error; err != nil {
 		return nil, err
 	}
 
@@ -123,18 +149,14 @@ func (r *occurrenceRepository) CreateOccurrence(tx *gorm.DB, occurrence *entity.
 	return occurrence, nil
 }
 
-// Searchメソッドを実装
-
-func (r *occurrenceRepository) Search(query *model.SearchQuery) ([]entity.Occurrence, int64, error) {
-	var occurrences []entity.Occurrence
-	var total int64
-
+// searchFilter は検索条件のJOINとWHEREまでを作るのだ。SearchとSearchEachで同じ条件を使うのだ
+func (r *occurrenceRepository) searchFilter(query *model.SearchQuery, scope *model.ProjectScope) *gorm.DB {
 	// ベースとなるクエリ
 	tx := r.db.Model(&entity.Occurrence{}).
 		Joins("LEFT JOIN users ON users.user_id = occurrence.user_id").
 		Joins("LEFT JOIN projects ON projects.project_id = occurrence.project_id").
 		// ここ！ coordinates を ST_AsText() でテキストに変換
-		Joins("LEFT JOIN (SELECT place_id, ST_AsText(coordinates) AS coordinates, place_name_id, accuracy FROM places) AS places ON places.place_id = occurrence.place_id").
+		Joins("LEFT JOIN (SELECT place_id, ST_AsText(coordinates) AS coordinates, place_name_id, accuracy, georeference_source FROM places) AS places ON places.place_id = occurrence.place_id").
 		Joins("LEFT JOIN place_names_json ON place_names_json.place_name_id = places.place_name_id").
 		Joins("LEFT JOIN classification_json ON classification_json.classification_id = occurrence.classification_id").
 		Joins("LEFT JOIN observations ON observations.occurrence_id = occurrence.occurrence_id").
@@ -143,6 +165,7 @@ func (r *occurrenceRepository) Search(query *model.SearchQuery) ([]entity.Occurr
 		Joins("LEFT JOIN identifications ON identifications.occurrence_id = occurrence.occurrence_id")
 
 	// --- WHERE句（動的フィルタリング） ---
+	tx = applyProjectScope(tx, scope)
 	if query.UserID != "" { tx = tx.Where("occurrence.user_id = ?", query.UserID) }
 	if query.OccurrenceID != "" { tx = tx.Where("occurrence.occurrence_id = ?", query.OccurrenceID) }
 	if query.ProjectID != "" { tx = tx.Where("occurrence.project_id = ?", query.ProjectID) }
@@ -153,6 +176,8 @@ func (r *occurrenceRepository) Search(query *model.SearchQuery) ([]entity.Occurr
 	if query.Note != "" { tx = tx.Where("occurrence.note LIKE ?", "%"+query.Note+"%") }
 	if query.CreatedStart != "" && query.CreatedEnd != "" { tx = tx.Where("occurrence.created_at BETWEEN ? AND ?", query.CreatedStart, query.CreatedEnd) }
 	if query.PlaceName != "" { tx = tx.Where("place_names_json.class_place_name ->> 'name' LIKE ?", "%"+query.PlaceName+"%") }
+	tx = applySpatialFilter(tx, query.Spatial)
+	if query.GeoreferenceSource != "" { tx = tx.Where("places.georeference_source = ?", query.GeoreferenceSource) }
 	if query.Species != "" { tx = tx.Where("classification_json.class_classification ->> 'species' LIKE ?", "%"+query.Species+"%") }
 	if query.Genus != "" { tx = tx.Where("classification_json.class_classification ->> 'genus' LIKE ?", "%"+query.Genus+"%") }
 	if query.Family != "" { tx = tx.Where("classification_json.class_classification ->> 'family' LIKE ?", "%"+query.Family+"%") }
@@ -172,6 +197,16 @@ func (r *occurrenceRepository) Search(query *model.SearchQuery) ([]entity.Occurr
 	if query.IdentificationUserID != "" { tx = tx.Where("identifications.user_id = ?", query.IdentificationUserID) }
 	if query.IdentifiedStart != "" && query.IdentifiedEnd != "" { tx = tx.Where("identifications.identificated_at BETWEEN ? AND ?", query.IdentifiedStart, query.IdentifiedEnd) }
 
+	return tx
+}
+
+// Searchメソッドを実装
+func (r *occurrenceRepository) Search(query *model.SearchQuery, scope *model.ProjectScope) ([]entity.Occurrence, int64, error) {
+	var occurrences []entity.Occurrence
+	var total int64
+
+	tx := r.searchFilter(query, scope)
+
 	// --- 件数カウント ---
 	countTx := tx.Session(&gorm.Session{})
 	if err := countTx.Select("COUNT(DISTINCT occurrence.occurrence_id)").Count(&total).Error; err != nil {
@@ -199,6 +234,121 @@ func (r *occurrenceRepository) Search(query *model.SearchQuery) ([]entity.Occurr
 }
 
 
+// SearchEach は条件に合うoccurrenceを、新しい順に batchSize 件ずつ fn に渡すのだ
+// JOINで同じoccurrenceが何行にもなるので、先にIDだけをDISTINCTで取ってから、そのIDの分だけ読み込むのだ
+// 次の回は前の回の一番小さいIDより小さいものから取るので、OFFSETで遅くならないのだ
+func (r *occurrenceRepository) SearchEach(query *model.SearchQuery, scope *model.ProjectScope, batchSize int, fn func(occurrences []entity.Occurrence) error) error {
+	filter := r.searchFilter(query, scope)
+	var lastID uint
+	for {
+		idTx := filter.Session(&gorm.Session{})
+		if lastID != 0 {
+			idTx = idTx.Where("occurrence.occurrence_id < ?", lastID)
+		}
+		var ids []uint
+		err := idTx.Distinct("occurrence.occurrence_id").
+			Order("occurrence.occurrence_id DESC").
+			Limit(batchSize).
+			Pluck("occurrence.occurrence_id", &ids).Error
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		var occurrences []entity.Occurrence
+		err = r.db.
+			Preload("User").
+			Preload("Project").
+			Preload("Place.PlaceNamesJSON").
+			Preload("ClassificationJSON").
+			Preload("Observations.User").
+			Preload("Observations.ObservationMethod").
+			Preload("Specimens.SpecimenMethod").
+			Preload("Specimens.InstitutionIDCode").
+			Preload("MakeSpecimens.User").
+			Preload("Identifications.User").
+			Where("occurrence_id IN ?", ids).
+			Order("occurrence_id DESC").
+			Find(&occurrences).Error
+		if err != nil {
+			return err
+		}
+		if err := fn(occurrences); err != nil {
+			return err
+		}
+
+		lastID = ids[len(ids)-1]
+		if len(ids) < batchSize {
+			return nil
+		}
+	}
+}
+
+
+// tilePointsSQL はタイルの範囲に入る点を、Webメルカトル (EPSG:3857) にして取ってくるCTEなのだ
+// 範囲は点のシンボルが切れないように少し広げて、places.coordinates のgeometryのGiSTインデックスで絞るのだ
+// メルカトルにできない極の近くの点は入れないのだ
+const tilePointsSQL = `WITH bounds AS (SELECT ST_TileEnvelope(?, ?, ?) AS geom),
+points AS (
+	SELECT o.occurrence_id,
+		c.class_classification ->> 'species' AS species,
+		ST_Transform(p.coordinates::geometry, 3857) AS geom
+	FROM occurrence o
+	JOIN places p ON p.place_id = o.place_id
+	LEFT JOIN classification_json c ON c.classification_id = o.classification_id
+	CROSS JOIN bounds
+	WHERE o.occurrence_id IN (?)
+		AND p.coordinates::geometry && ST_Transform(ST_Expand(bounds.geom, ?), 4326)
+		AND ST_Y(p.coordinates::geometry) BETWEEN -85.05 AND 85.05
+)`
+
+// tileLayerSQL は点を1つずつ occurrences レイヤーに入れるのだ
+const tileLayerSQL = tilePointsSQL + `
+SELECT ST_AsMVT(t, 'occurrences', 4096, 'geom') FROM (
+	SELECT points.occurrence_id, points.species, 1 AS point_count,
+		ST_AsMVTGeom(points.geom, bounds.geom, 4096, 64, true) AS geom
+	FROM points CROSS JOIN bounds
+) t`
+
+// tileClusterLayerSQL は格子ごとに点をまとめて、まとめた数を point_count に入れるのだ
+// 1つしか無い格子は、まとめないのと同じように occurrence_id と species も入れるのだ
+const tileClusterLayerSQL = tilePointsSQL + `,
+clusters AS (
+	SELECT count(*) AS point_count,
+		CASE WHEN count(*) = 1 THEN min(occurrence_id) END AS occurrence_id,
+		CASE WHEN count(*) = 1 THEN min(species) END AS species,
+		ST_Centroid(ST_Collect(geom)) AS geom
+	FROM points
+	GROUP BY ST_SnapToGrid(geom, ?)
+)
+SELECT ST_AsMVT(t, 'occurrences', 4096, 'geom') FROM (
+	SELECT clusters.occurrence_id, clusters.species, clusters.point_count,
+		ST_AsMVTGeom(clusters.geom, bounds.geom, 4096, 64, true) AS geom
+	FROM clusters CROSS JOIN bounds
+) t`
+
+// SearchTile は検索と同じ条件に合うoccurrenceの点を、ST_AsMVT でタイル1枚にするのだ
+func (r *occurrenceRepository) SearchTile(query *model.SearchQuery, scope *model.ProjectScope, tile *model.TileRequest) ([]byte, error) {
+	ids := r.searchFilter(query, scope).Select("occurrence.occurrence_id")
+	// タイルの1辺の長さ (メートル) の 64/4096 だけ広げるのだ。ST_AsMVTGeom の buffer と同じ幅なのだ
+	margin := model.WebMercatorWorldSize / math.Exp2(float64(tile.Z)) * 64 / 4096
+
+	var row *sql.Row
+	if tile.ClusterCell > 0 {
+		row = r.db.Raw(tileClusterLayerSQL, tile.Z, tile.X, tile.Y, ids, margin, tile.ClusterCell).Row()
+	} else {
+		row = r.db.Raw(tileLayerSQL, tile.Z, tile.X, tile.Y, ids, margin).Row()
+	}
+	var data []byte
+	if err := row.Scan(&data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+
 func (r *occurrenceRepository) FindByID(id uint) (*entity.Occurrence, error) {
 	var occurrence entity.Occurrence
 
@@ -218,3 +368,503 @@ func (r *occurrenceRepository) FindByID(id uint) (*entity.Occurrence, error) {
 
 	return &occurrence, err
 }
+
+
+// FindOwnership はoccurrenceがどのプロジェクトのもので、誰が持ち主なのかだけを取ってくるのだ
+// 権限の確認に使うので、ゴミ箱に入っているoccurrenceも探すのだ
+func (r *occurrenceRepository) FindOwnership(id uint) (*uint, *uint, error) {
+	var occurrence entity.Occurrence
+	if err := r.db.Unscoped().Select("occurrence_id", "project_id", "user_id").First(&occurrence, id).Error; err != nil {
+		return nil, nil, err
+	}
+	return occurrence.ProjectID, occurrence.UserID, nil
+}
+
+// Exists はゴミ箱に入っていないoccurrenceがあるかを返すのだ
+func (r *occurrenceRepository) Exists(id uint) (bool, error) {
+	var count int64
+	if err := r.db.Model(&entity.Occurrence{}).Where("occurrence_id = ?", id).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// applySpatialFilter は座標で絞り込むのだ。条件は全部ANDでつながるのだ
+// places.coordinates のGiSTインデックスを使えるように、placesを直接見るサブクエリにするのだ
+// bboxとpolygonは地図で見た通りになるようにgeometry (経度・緯度の平面) で、半径はメートルなのでgeographyで比べるのだ
+func applySpatialFilter(tx *gorm.DB, spatial *model.SpatialFilter) *gorm.DB {
+	if spatial == nil {
+		return tx
+	}
+	if b := spatial.BBox; b != nil {
+		if b.MinLng <= b.MaxLng {
+			tx = tx.Where("occurrence.place_id IN (SELECT place_id FROM places WHERE coordinates::geometry && ST_MakeEnvelope(?, ?, ?, ?, 4326))",
+				b.MinLng, b.MinLat, b.MaxLng, b.MaxLat)
+		} else {
+			// 日付変更線をまたぐ時は、東側と西側の2つの四角に分けるのだ
+			tx = tx.Where("occurrence.place_id IN (SELECT place_id FROM places WHERE coordinates::geometry && ST_MakeEnvelope(?, ?, 180, ?, 4326) OR coordinates::geometry && ST_MakeEnvelope(-180, ?, ?, ?, 4326))",
+				b.MinLng, b.MinLat, b.MaxLat, b.MinLat, b.MaxLng, b.MaxLat)
+		}
+	}
+	if c := spatial.Circle; c != nil {
+		tx = tx.Where("occurrence.place_id IN (SELECT place_id FROM places WHERE ST_DWithin(coordinates, ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography, ?))",
+			c.Lng, c.Lat, c.Radius)
+	}
+	if spatial.Polygon != nil {
+		tx = tx.Where("occurrence.place_id IN (SELECT place_id FROM places WHERE ST_Intersects(coordinates::geometry, ST_SetSRID(ST_GeomFromGeoJSON(?), 4326)))",
+			*spatial.Polygon)
+	}
+	if spatial.MaxUncertainty != nil {
+		// 不確かさが分からない (NULL) ものは、条件を満たすか分からないので入れないのだ
+		tx = tx.Where("occurrence.place_id IN (SELECT place_id FROM places WHERE accuracy <= ?)", *spatial.MaxUncertainty)
+	}
+	return tx
+}
+
+// applyProjectScope は見てもいいプロジェクトのoccurrenceだけに絞るのだ
+// プロジェクトに入っていないoccurrenceは、持ち主のものだけ残すのだ
+func applyProjectScope(tx *gorm.DB, scope *model.ProjectScope) *gorm.DB {
+	if scope == nil {
+		return tx
+	}
+	if len(scope.ProjectIDs) == 0 {
+		return tx.Where("(occurrence.project_id IS NULL AND occurrence.user_id = ?)", scope.UserID)
+	}
+	return tx.Where("(occurrence.project_id IN ? OR (occurrence.project_id IS NULL AND occurrence.user_id = ?))", scope.ProjectIDs, scope.UserID)
+}
+
+// UpdateOccurrence はoccurrence本体と、classification・place・子レコードをまとめて書き換えるのだ
+// specimens と makeSpecimens は同じ順番で対応している前提なのだ
+func (r *occurrenceRepository) UpdateOccurrence(tx *gorm.DB, occurrence *entity.Occurrence, classification *entity.ClassificationJSON, place *entity.Place, placeName *entity.PlaceNamesJSON, observations []entity.Observation, specimens []entity.Specimen, makeSpecimens []entity.MakeSpecimen, identifications []entity.Identification) error {
+	id := occurrence.OccurrenceID
+
+	var current entity.Occurrence
+	if err := tx.First(&current, id).Error; err != nil {
+		return err
+	}
+
+	// 1. Classification: このoccurrenceだけが使っていれば中身を書き換えて、
+	//    他のoccurrenceと共有している時や無い時は新しく作るのだ (共有している相手まで書き換わらないようにするためなのだ)
+	occurrence.ClassificationID = nil
+	if classification != nil {
+		shared := true
+		if current.ClassificationID != nil {
+			var err error
+			if shared, err = usedByOtherOccurrences(tx, "classification_id", *current.ClassificationID, id); err != nil {
+				return err
+			}
+		}
+		if !shared {
+			classification.ClassificationID = *current.ClassificationID
+			if err := tx.Model(&entity.ClassificationJSON{}).
+				Where("classification_id = ?", classification.ClassificationID).
+				Update("class_classification", classification.ClassClassification).Error; err != nil {
+				return err
+			}
+		} else {
+			if err := tx.Create(classification).Error; err != nil { return err }
+		}
+		occurrence.ClassificationID = &classification.ClassificationID
+	}
+
+	// 2. Place: こちらもこのoccurrenceだけが使っている時だけ書き換えて、それ以外は新しく作るのだ
+	occurrence.PlaceID = nil
+	if place != nil && placeName != nil {
+		shared := true
+		if current.PlaceID != nil {
+			var err error
+			if shared, err = usedByOtherOccurrences(tx, "place_id", *current.PlaceID, id); err != nil {
+				return err
+			}
+		}
+		if !shared {
+			var currentPlace entity.Place
+			if err := tx.Select("place_id", "place_name_id").First(&currentPlace, *current.PlaceID).Error; err != nil {
+				return err
+			}
+
+			// place_names_json は他のplaceと共有しているかもしれないので、同じように確かめるのだ
+			nameShared := true
+			if currentPlace.PlaceNameID != nil {
+				var count int64
+				if err := tx.Model(&entity.Place{}).
+					Where("place_name_id = ? AND place_id <> ?", *currentPlace.PlaceNameID, currentPlace.PlaceID).
+					Count(&count).Error; err != nil {
+					return err
+				}
+				nameShared = count > 0
+			}
+			if !nameShared {
+				placeName.PlaceNameID = *currentPlace.PlaceNameID
+				if err := tx.Model(&entity.PlaceNamesJSON{}).
+					Where("place_name_id = ?", placeName.PlaceNameID).
+					Update("class_place_name", placeName.ClassPlaceName).Error; err != nil {
+					return err
+				}
+			} else {
+				if err := tx.Create(placeName).Error; err != nil { return err }
+			}
+
+			// nilの*Pointをそのまま渡すとValue()が呼べないので、値かnilにしてから渡すのだ
+			var coordinates interface{}
+			if place.Coordinates != nil {
+				coordinates = *place.Coordinates
+			}
+			place.PlaceID = currentPlace.PlaceID
+			place.PlaceNameID = &placeName.PlaceNameID
+			if err := tx.Model(&entity.Place{}).Where("place_id = ?", place.PlaceID).Updates(map[string]interface{}{
+				"coordinates":         coordinates,
+				"place_name_id":       place.PlaceNameID,
+				"accuracy":            place.Accuracy,
+				"georeference_source": place.GeoreferenceSource,
+				"geodetic_datum":      place.GeodeticDatum,
+				"georeferenced_by":    place.GeoreferencedBy,
+				"georeferenced_date":  place.GeoreferencedDate,
+			}).Error; err != nil {
+				return err
+			}
+		} else {
+			if err := tx.Create(placeName).Error; err != nil { return err }
+			place.PlaceNameID = &placeName.PlaceNameID
+			if err := tx.Create(place).Error; err != nil { return err }
+		}
+		occurrence.PlaceID = &place.PlaceID
+	}
+
+	// 3. Occurrence本体のカラムを書き換える。mapで渡すとnilもちゃんとNULLで更新されるのだ
+	columns := map[string]interface{}{
+		"project_id":        occurrence.ProjectID,
+		"user_id":           occurrence.UserID,
+		"individual_id":     occurrence.IndividualID,
+		"lifestage":         occurrence.Lifestage,
+		"sex":               occurrence.Sex,
+		"body_length":       occurrence.BodyLength,
+		"language_id":       occurrence.LanguageID,
+		"note":              occurrence.Note,
+		"classification_id": occurrence.ClassificationID,
+		"place_id":          occurrence.PlaceID,
+	}
+	// created_at は送られてきた時だけ書き換えるのだ (NOT NULLなので消すことはできない)
+	if occurrence.CreatedAt != nil {
+		columns["created_at"] = occurrence.CreatedAt
+		columns["timezone"] = occurrence.Timezone
+	}
+	if err := tx.Model(&entity.Occurrence{}).Where("occurrence_id = ?", id).Updates(columns).Error; err != nil {
+		return err
+	}
+
+	// 4. 使われなくなったclassificationとplaceを片付けるのだ (他のoccurrenceと共有していたものは残るのだ)
+	if current.ClassificationID != nil && (occurrence.ClassificationID == nil || *occurrence.ClassificationID != *current.ClassificationID) {
+		if err := r.deleteOrphanClassification(tx, *current.ClassificationID); err != nil { return err }
+	}
+	if current.PlaceID != nil && (occurrence.PlaceID == nil || *occurrence.PlaceID != *current.PlaceID) {
+		if err := r.deleteOrphanPlace(tx, *current.PlaceID); err != nil { return err }
+	}
+
+	// 5. 子レコードをリクエストの内容に合わせるのだ
+	if err := r.syncObservations(tx, id, observations); err != nil { return err }
+	if err := r.syncSpecimens(tx, id, specimens, makeSpecimens); err != nil { return err }
+	if err := r.syncIdentifications(tx, id, identifications); err != nil { return err }
+
+	return nil
+}
+
+// usedByOtherOccurrences はid以外のoccurrenceが、columnでvalueの行を使っているかを返すのだ
+// ゴミ箱の中のoccurrenceも戻ってくるかもしれないので、Unscopedで数えるのだ
+func usedByOtherOccurrences(tx *gorm.DB, column string, value uint, id uint) (bool, error) {
+	var count int64
+	if err := tx.Unscoped().Model(&entity.Occurrence{}).Where(column+" = ? AND occurrence_id <> ?", value, id).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// syncObservations はIDの無いobservationを作成、IDのあるものを更新して、リストに無いものを消すのだ
+func (r *occurrenceRepository) syncObservations(tx *gorm.DB, occurrenceID uint, observations []entity.Observation) error {
+	keepIDs := []uint{}
+	for i := range observations {
+		obs := &observations[i]
+		obs.OccurrenceID = &occurrenceID
+
+		if obs.ObservationsID == 0 {
+			if err := tx.Create(obs).Error; err != nil { return err }
+		} else {
+			result := tx.Model(&entity.Observation{}).
+				Where("observations_id = ? AND occurrence_id = ?", obs.ObservationsID, occurrenceID).
+				Updates(map[string]interface{}{
+					"user_id":               obs.UserID,
+					"observation_method_id": obs.ObservationMethodID,
+					"behavior":              obs.Behavior,
+					"observed_at":           obs.ObservedAt,
+					"timezone":              obs.Timezone,
+				})
+			if result.Error != nil { return result.Error }
+			if result.RowsAffected == 0 {
+				return fmt.Errorf("%w: observation_id %d", ErrChildNotFound, obs.ObservationsID)
+			}
+		}
+		keepIDs = append(keepIDs, obs.ObservationsID)
+	}
+
+	return whereNotIn(tx, "occurrence_id = ?", occurrenceID, "observations_id", keepIDs).
+		Delete(&entity.Observation{}).Error
+}
+
+// syncSpecimens はspecimenと、それに対応するmake_specimenを一緒に合わせるのだ
+func (r *occurrenceRepository) syncSpecimens(tx *gorm.DB, occurrenceID uint, specimens []entity.Specimen, makeSpecimens []entity.MakeSpecimen) error {
+	keepIDs := []uint{}
+	for i := range specimens {
+		spec := &specimens[i]
+		makeSpec := &makeSpecimens[i]
+		spec.OccurrenceID = &occurrenceID
+		makeSpec.OccurrenceID = &occurrenceID
+
+		if spec.SpecimenID == 0 {
+			if err := tx.Create(spec).Error; err != nil { return err }
+			makeSpec.SpecimenID = &spec.SpecimenID
+			if err := tx.Create(makeSpec).Error; err != nil { return err }
+		} else {
+			result := tx.Model(&entity.Specimen{}).
+				Where("specimen_id = ? AND occurrence_id = ?", spec.SpecimenID, occurrenceID).
+				Updates(map[string]interface{}{
+					"specimen_method_id": spec.SpecimenMethodID,
+					"institution_id":     spec.InstitutionID,
+					"collection_id":      spec.CollectionID,
+				})
+			if result.Error != nil { return result.Error }
+			if result.RowsAffected == 0 {
+				return fmt.Errorf("%w: specimen_id %d", ErrChildNotFound, spec.SpecimenID)
+			}
+
+			makeSpec.SpecimenID = &spec.SpecimenID
+			result = tx.Model(&entity.MakeSpecimen{}).
+				Where("specimen_id = ? AND occurrence_id = ?", spec.SpecimenID, occurrenceID).
+				Updates(map[string]interface{}{
+					"user_id":            makeSpec.UserID,
+					"specimen_method_id": makeSpec.SpecimenMethodID,
+					"date":               makeSpec.Date,
+					"timezone":           makeSpec.Timezone,
+				})
+			if result.Error != nil { return result.Error }
+			// 古いデータでmake_specimenが無い場合は作っておくのだ
+			if result.RowsAffected == 0 {
+				if err := tx.Create(makeSpec).Error; err != nil { return err }
+			}
+		}
+		keepIDs = append(keepIDs, spec.SpecimenID)
+	}
+
+	// make_specimenがspecimenを参照しているので、先にmake_specimenを消すのだ
+	if len(keepIDs) > 0 {
+		if err := tx.Where("occurrence_id = ? AND (specimen_id IS NULL OR specimen_id NOT IN ?)", occurrenceID, keepIDs).
+			Delete(&entity.MakeSpecimen{}).Error; err != nil {
+			return err
+		}
+	} else {
+		if err := tx.Where("occurrence_id = ?", occurrenceID).Delete(&entity.MakeSpecimen{}).Error; err != nil {
+			return err
+		}
+	}
+
+	return whereNotIn(tx, "occurrence_id = ?", occurrenceID, "specimen_id", keepIDs).
+		Delete(&entity.Specimen{}).Error
+}
+
+// syncIdentifications はIDの無いidentificationを作成、IDのあるものを更新して、リストに無いものを消すのだ
+func (r *occurrenceRepository) syncIdentifications(tx *gorm.DB, occurrenceID uint, identifications []entity.Identification) error {
+	keepIDs := []uint{}
+	for i := range identifications {
+		ident := &identifications[i]
+		ident.OccurrenceID = &occurrenceID
+
+		if ident.IdentificationID == 0 {
+			if err := tx.Create(ident).Error; err != nil { return err }
+		} else {
+			result := tx.Model(&entity.Identification{}).
+				Where("identification_id = ? AND occurrence_id = ?", ident.IdentificationID, occurrenceID).
+				Updates(map[string]interface{}{
+					"user_id":          ident.UserID,
+					"source_info":      ident.SourceInfo,
+					"identificated_at": ident.IdentificatedAt,
+					"timezone":         ident.Timezone,
+				})
+			if result.Error != nil { return result.Error }
+			if result.RowsAffected == 0 {
+				return fmt.Errorf("%w: identification_id %d", ErrChildNotFound, ident.IdentificationID)
+			}
+		}
+		keepIDs = append(keepIDs, ident.IdentificationID)
+	}
+
+	return whereNotIn(tx, "occurrence_id = ?", occurrenceID, "identification_id", keepIDs).
+		Delete(&entity.Identification{}).Error
+}
+
+// whereNotIn は「このoccurrenceの行のうち、keepIDsに入っていないもの」という条件を作るのだ
+// keepIDsが空の時に NOT IN () になってしまうのを防ぐためなのだ
+func whereNotIn(tx *gorm.DB, condition string, value interface{}, idColumn string, keepIDs []uint) *gorm.DB {
+	if len(keepIDs) == 0 {
+		return tx.Where(condition, value)
+	}
+	return tx.Where(condition, value).Where(idColumn+" NOT IN ?", keepIDs)
+}
+
+// BumpVersion はoccurrenceのバージョンを1つ上げるのだ
+// expectedVersion が0でなければ、今のバージョンと一致する時だけ上げるのだ (一致しなければ ErrVersionConflict)
+// UPDATEで行ロックも取れるので、同じトランザクションの後の書き込みが他の人とぶつからなくなるのだ
+func (r *occurrenceRepository) BumpVersion(tx *gorm.DB, id uint, expectedVersion int) error {
+	query := tx.Model(&entity.Occurrence{}).Where("occurrence_id = ?", id)
+	if expectedVersion != 0 {
+		query = query.Where("version = ?", expectedVersion)
+	}
+	result := query.Update("version", gorm.Expr("version + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+
+	// 1行も更新されなかったのは、occurrenceが無いのか、バージョンが違うのかを調べるのだ
+	var count int64
+	if err := tx.Model(&entity.Occurrence{}).Where("occurrence_id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return ErrVersionConflict
+}
+
+// SoftDeleteOccurrence はoccurrenceをゴミ箱に移すのだ (deleted_atに日時が入るだけで、子レコードはそのまま残る)
+func (r *occurrenceRepository) SoftDeleteOccurrence(tx *gorm.DB, id uint) error {
+	result := tx.Delete(&entity.Occurrence{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// RestoreOccurrence はゴミ箱に入っているoccurrenceを元に戻すのだ
+func (r *occurrenceRepository) RestoreOccurrence(tx *gorm.DB, id uint) error {
+	result := tx.Unscoped().Model(&entity.Occurrence{}).
+		Where("occurrence_id = ? AND deleted_at IS NOT NULL", id).
+		Update("deleted_at", nil)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// FindDeleted はゴミ箱の中身を新しく消した順に取ってくるのだ
+func (r *occurrenceRepository) FindDeleted(page, perPage int, scope *model.ProjectScope) ([]entity.Occurrence, int64, error) {
+	var occurrences []entity.Occurrence
+	var total int64
+
+	tx := r.db.Unscoped().Model(&entity.Occurrence{}).Where("occurrence.deleted_at IS NOT NULL")
+	tx = applyProjectScope(tx, scope)
+	if err := tx.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * perPage
+	err := tx.Session(&gorm.Session{}).Limit(perPage).Offset(offset).
+		Preload("User").
+		Preload("Project").
+		Preload("Place.PlaceNamesJSON").
+		Preload("ClassificationJSON").
+		Order("occurrence.deleted_at DESC").
+		Find(&occurrences).Error
+
+	return occurrences, total, err
+}
+
+// FindDeletedBefore は cutoff より前にゴミ箱に入れられたoccurrenceのIDを返すのだ
+func (r *occurrenceRepository) FindDeletedBefore(cutoff time.Time) ([]uint, error) {
+	var ids []uint
+	err := r.db.Unscoped().Model(&entity.Occurrence{}).
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+		Pluck("occurrence_id", &ids).Error
+	return ids, err
+}
+
+// PurgeOccurrence はゴミ箱に入っているoccurrenceと、それにぶら下がっている子レコードを完全に消すのだ
+// attachment_groupのリンクは添付ファイルの後片付けがあるので、service側で先に消しておく必要があるのだ
+func (r *occurrenceRepository) PurgeOccurrence(tx *gorm.DB, id uint) error {
+	var occurrence entity.Occurrence
+	if err := tx.Unscoped().Where("deleted_at IS NOT NULL").First(&occurrence, id).Error; err != nil {
+		return err
+	}
+
+	// 1. 子テーブルを先に消す。外部キー制約があるので、make_specimen → specimen の順番が大事なのだ
+	if err := tx.Where("occurrence_id = ?", id).Delete(&entity.Identification{}).Error; err != nil { return err }
+	if err := tx.Where("occurrence_id = ?", id).Delete(&entity.MakeSpecimen{}).Error; err != nil { return err }
+	if err := tx.Where("occurrence_id = ?", id).Delete(&entity.Specimen{}).Error; err != nil { return err }
+	if err := tx.Where("occurrence_id = ?", id).Delete(&entity.Observation{}).Error; err != nil { return err }
+
+	// 2. Occurrence本体を物理削除する (Unscopedを付けないと論理削除になってしまうのだ)
+	if err := tx.Unscoped().Delete(&occurrence).Error; err != nil { return err }
+
+	// 3. 誰からも参照されなくなったclassificationとplaceを片付けるのだ
+	if occurrence.ClassificationID != nil {
+		if err := r.deleteOrphanClassification(tx, *occurrence.ClassificationID); err != nil { return err }
+	}
+	if occurrence.PlaceID != nil {
+		if err := r.deleteOrphanPlace(tx, *occurrence.PlaceID); err != nil { return err }
+	}
+
+	return nil
+}
+
+// deleteOrphanClassification は他のoccurrenceが使っていない場合だけclassification_jsonを消すのだ
+// ゴミ箱の中のoccurrenceもまだ使っているかもしれないので、Unscopedで数えるのだ
+func (r *occurrenceRepository) deleteOrphanClassification(tx *gorm.DB, classificationID uint) error {
+	var count int64
+	if err := tx.Unscoped().Model(&entity.Occurrence{}).Where("classification_id = ?", classificationID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	return tx.Delete(&entity.ClassificationJSON{}, classificationID).Error
+}
+
+// deleteOrphanPlace は他のoccurrenceが使っていない場合だけplacesを消して、
+// さらにどのplaceからも使われなくなったplace_names_jsonも消すのだ
+func (r *occurrenceRepository) deleteOrphanPlace(tx *gorm.DB, placeID uint) error {
+	var count int64
+	if err := tx.Unscoped().Model(&entity.Occurrence{}).Where("place_id = ?", placeID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	var place entity.Place
+	if err := tx.Select("place_id", "place_name_id").First(&place, placeID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if err := tx.Delete(&entity.Place{}, placeID).Error; err != nil {
+		return err
+	}
+
+	if place.PlaceNameID == nil {
+		return nil
+	}
+	if err := tx.Model(&entity.Place{}).Where("place_name_id = ?", *place.PlaceNameID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	return tx.Delete(&entity.PlaceNamesJSON{}, *place.PlaceNameID).Error
+}
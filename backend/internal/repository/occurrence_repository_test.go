@@ -0,0 +1,218 @@
+// internal/repository/occurrence_repository_test.go
+package repository
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// statementIndex はmatchを含むステートメントが何番目に流れたかを返すのだ。無ければ-1なのだ
+func statementIndex(fake *fakeDB, match string) int {
+	for i, s := range fake.statements {
+		if strings.Contains(s.query, match) {
+			return i
+		}
+	}
+	return -1
+}
+
+// trashedOccurrence はゴミ箱に入っている id 7 のoccurrenceを返すようにするのだ
+// classification 20 と place 30 を使っているのだ
+func trashedOccurrence(fake *fakeDB) {
+	fake.on(`FROM "occurrence" WHERE deleted_at IS NOT NULL`,
+		[]string{"occurrence_id", "classification_id", "place_id", "deleted_at"},
+		[]driver.Value{int64(7), int64(20), int64(30), time.Now()})
+}
+
+func TestPurgeOccurrence(t *testing.T) {
+	t.Run("子レコードを全部消してから、occurrence本体を消すのだ", func(t *testing.T) {
+		db, fake := newFakeDB(t)
+		trashedOccurrence(fake)
+		fake.on(`count(*)`, []string{"count"}, []driver.Value{int64(1)})
+		r := &occurrenceRepository{db: db}
+
+		assert.NoError(t, r.PurgeOccurrence(db, 7))
+
+		for _, table := range []string{"identifications", "make_specimen", "specimen", "observations"} {
+			deletes := fake.executed(`DELETE FROM "` + table + `" WHERE occurrence_id = $1`)
+			if assert.Len(t, deletes, 1, table) {
+				assert.Equal(t, []driver.Value{int64(7)}, deletes[0].args, table)
+			}
+		}
+		// make_specimenがspecimenを参照しているので、先に消さないといけないのだ
+		assert.Less(t, statementIndex(fake, `DELETE FROM "make_specimen"`), statementIndex(fake, `DELETE FROM "specimen"`))
+		assert.Less(t, statementIndex(fake, `DELETE FROM "observations"`), statementIndex(fake, `DELETE FROM "occurrence"`))
+		// 論理削除のUPDATEではなく、本当にDELETEしているのだ
+		assert.Len(t, fake.executed(`DELETE FROM "occurrence"`), 1)
+		assert.Empty(t, fake.executed(`UPDATE "occurrence"`))
+	})
+
+	t.Run("他のoccurrenceがまだ使っているclassificationとplaceは残すのだ", func(t *testing.T) {
+		db, fake := newFakeDB(t)
+		trashedOccurrence(fake)
+		fake.on(`count(*)`, []string{"count"}, []driver.Value{int64(1)})
+		r := &occurrenceRepository{db: db}
+
+		assert.NoError(t, r.PurgeOccurrence(db, 7))
+
+		// ゴミ箱の中のoccurrenceも数えるように、deleted_atで絞っていないのだ
+		counts := fake.executed(`SELECT count(*) FROM "occurrence"`)
+		if assert.Len(t, counts, 2) {
+			assert.NotContains(t, counts[0].query, "deleted_at")
+			assert.Equal(t, []driver.Value{int64(20)}, counts[0].args)
+			assert.Equal(t, []driver.Value{int64(30)}, counts[1].args)
+		}
+		assert.Empty(t, fake.executed(`DELETE FROM "classification_json"`))
+		assert.Empty(t, fake.executed(`DELETE FROM "places"`))
+		assert.Empty(t, fake.executed(`DELETE FROM "place_names_json"`))
+	})
+
+	t.Run("誰も使わなくなったclassificationとplaceは一緒に消すのだ", func(t *testing.T) {
+		db, fake := newFakeDB(t)
+		trashedOccurrence(fake)
+		fake.on(`count(*)`, []string{"count"}, []driver.Value{int64(0)})
+		fake.on(`FROM "places"`, []string{"place_id", "place_name_id"}, []driver.Value{int64(30), int64(40)})
+		r := &occurrenceRepository{db: db}
+
+		assert.NoError(t, r.PurgeOccurrence(db, 7))
+
+		assert.Len(t, fake.executed(`DELETE FROM "classification_json"`), 1)
+		assert.Len(t, fake.executed(`DELETE FROM "places"`), 1)
+		if deletes := fake.executed(`DELETE FROM "place_names_json"`); assert.Len(t, deletes, 1) {
+			assert.Equal(t, []driver.Value{int64(40)}, deletes[0].args)
+		}
+	})
+
+	t.Run("ゴミ箱に入っていないoccurrenceは何も消さないのだ", func(t *testing.T) {
+		db, fake := newFakeDB(t)
+		r := &occurrenceRepository{db: db}
+
+		err := r.PurgeOccurrence(db, 7)
+
+		assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+		assert.Empty(t, fake.executed(`DELETE`))
+	})
+}
+
+func TestSoftDeleteOccurrence(t *testing.T) {
+	t.Run("ゴミ箱に入れたoccurrenceは、詳細でも添付の確認でも見つからなくなるのだ", func(t *testing.T) {
+		db, fake := newFakeDB(t)
+		r := &occurrenceRepository{db: db}
+
+		assert.NoError(t, r.SoftDeleteOccurrence(db, 7))
+		assert.Len(t, fake.executed(`UPDATE "occurrence" SET "deleted_at"=`), 1)
+		assert.Empty(t, fake.executed(`DELETE FROM "occurrence"`))
+
+		_, err := r.FindByID(7)
+		assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+		exists, err := r.Exists(7)
+		assert.NoError(t, err)
+		assert.False(t, exists)
+		reads := append(fake.executed(`SELECT * FROM "occurrence"`), fake.executed(`SELECT count(*) FROM "occurrence"`)...)
+		assert.Len(t, reads, 2)
+		for _, s := range reads {
+			assert.Contains(t, s.query, `"occurrence"."deleted_at" IS NULL`)
+		}
+	})
+}
+
+func TestFindDeletedBefore(t *testing.T) {
+	t.Run("cutoffより前にゴミ箱に入れられたものだけ探すのだ", func(t *testing.T) {
+		db, fake := newFakeDB(t)
+		fake.on(`SELECT "occurrence_id" FROM "occurrence"`, []string{"occurrence_id"}, []driver.Value{int64(3)})
+		r := &occurrenceRepository{db: db}
+		cutoff := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+		ids, err := r.FindDeletedBefore(cutoff)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []uint{3}, ids)
+		if queries := fake.executed(`deleted_at IS NOT NULL AND deleted_at < $1`); assert.Len(t, queries, 1) {
+			assert.Equal(t, []driver.Value{cutoff}, queries[0].args)
+		}
+	})
+}
+
+// putOccurrence は id 7 (classification 20 と place 30 を使っている) にPUTした時と同じ呼び出しをするのだ
+func putOccurrence(t *testing.T, fake *fakeDB, r *occurrenceRepository) (*entity.Occurrence, *entity.Place) {
+	fake.on(`SELECT * FROM "occurrence"`, []string{"occurrence_id", "classification_id", "place_id"},
+		[]driver.Value{int64(7), int64(20), int64(30)})
+	occurrence := &entity.Occurrence{OccurrenceID: 7}
+	place := &entity.Place{}
+	err := r.UpdateOccurrence(r.db, occurrence,
+		&entity.ClassificationJSON{ClassClassification: []byte(`{"species":"Parus minor"}`)},
+		place,
+		&entity.PlaceNamesJSON{ClassPlaceName: []byte(`{"name":"Kyoto"}`)},
+		nil, nil, nil, nil)
+	assert.NoError(t, err)
+	return occurrence, place
+}
+
+func TestUpdateOccurrenceSharedRows(t *testing.T) {
+	t.Run("placeとclassificationを共有している他のoccurrenceは、PUTしても変わらないのだ", func(t *testing.T) {
+		db, fake := newFakeDB(t)
+		fake.on(`count(*)`, []string{"count"}, []driver.Value{int64(1)})
+		r := &occurrenceRepository{db: db}
+
+		occurrence, place := putOccurrence(t, fake, r)
+
+		// 共有している行は書き換えも削除もしないで、このoccurrenceの分を新しく作るのだ
+		for _, table := range []string{"classification_json", "places", "place_names_json"} {
+			assert.Empty(t, fake.executed(`UPDATE "`+table+`"`), table)
+			assert.Empty(t, fake.executed(`DELETE FROM "`+table+`"`), table)
+			assert.Len(t, fake.executed(`INSERT INTO "`+table+`"`), 1, table)
+		}
+		// 共有しているかは自分以外のoccurrenceで数えるのだ
+		if counts := fake.executed(`WHERE place_id = $1 AND occurrence_id <> $2`); assert.Len(t, counts, 1) {
+			assert.Equal(t, []driver.Value{int64(30), int64(7)}, counts[0].args)
+		}
+
+		// このoccurrenceだけが新しい行を指すようになるのだ
+		assert.NotEqual(t, uint(30), *occurrence.PlaceID)
+		assert.Equal(t, place.PlaceID, *occurrence.PlaceID)
+		assert.NotEqual(t, uint(20), *occurrence.ClassificationID)
+		if updates := fake.executed(`UPDATE "occurrence"`); assert.Len(t, updates, 1) {
+			assert.Contains(t, updates[0].args, int64(place.PlaceID))
+			assert.Contains(t, updates[0].args, int64(*occurrence.ClassificationID))
+			assert.NotContains(t, updates[0].args, int64(30))
+		}
+	})
+
+	t.Run("このoccurrenceだけが使っている行は、そのまま書き換えるのだ", func(t *testing.T) {
+		db, fake := newFakeDB(t)
+		fake.on(`count(*)`, []string{"count"}, []driver.Value{int64(0)})
+		fake.on(`FROM "places"`, []string{"place_id", "place_name_id"}, []driver.Value{int64(30), int64(40)})
+		r := &occurrenceRepository{db: db}
+
+		occurrence, _ := putOccurrence(t, fake, r)
+
+		assert.Equal(t, uint(30), *occurrence.PlaceID)
+		assert.Equal(t, uint(20), *occurrence.ClassificationID)
+		for _, table := range []string{"classification_json", "places", "place_names_json"} {
+			assert.Len(t, fake.executed(`UPDATE "`+table+`"`), 1, table)
+			assert.Empty(t, fake.executed(`INSERT INTO "`+table+`"`), table)
+		}
+	})
+
+	t.Run("place名だけ他のplaceと共有していたら、place名は新しく作るのだ", func(t *testing.T) {
+		db, fake := newFakeDB(t)
+		fake.on(`FROM "places" WHERE place_name_id`, []string{"count"}, []driver.Value{int64(1)})
+		fake.on(`count(*)`, []string{"count"}, []driver.Value{int64(0)})
+		fake.on(`FROM "places"`, []string{"place_id", "place_name_id"}, []driver.Value{int64(30), int64(40)})
+		r := &occurrenceRepository{db: db}
+
+		occurrence, place := putOccurrence(t, fake, r)
+
+		assert.Equal(t, uint(30), *occurrence.PlaceID)
+		assert.Empty(t, fake.executed(`UPDATE "place_names_json"`))
+		assert.Len(t, fake.executed(`INSERT INTO "place_names_json"`), 1)
+		assert.NotEqual(t, uint(40), *place.PlaceNameID)
+	})
+}
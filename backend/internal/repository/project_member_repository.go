@@ -0,0 +1,72 @@
+//internal/repository/project_member_repository.go
+package repository
+
+import (
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"gorm.io/gorm"
+)
+
+type ProjectMemberRepository interface {
+	FindActiveByUserID(userID uint) ([]entity.ProjectMember, error)
+	FindByProjectID(projectID uint) ([]entity.ProjectMember, error)
+	FindByID(id uint) (*entity.ProjectMember, error)
+	Create(tx *gorm.DB, member *entity.ProjectMember) error
+	Update(member *entity.ProjectMember) error
+	Delete(id uint) error
+	DeleteByProjectID(tx *gorm.DB, projectID uint) error
+}
+
+type projectMemberRepository struct {
+	db *gorm.DB
+}
+
+func NewProjectMemberRepository(db *gorm.DB) ProjectMemberRepository {
+	return &projectMemberRepository{db: db}
+}
+
+// FindActiveByUserID は今日の時点で参加中のプロジェクトメンバーの行を取ってくるのだ
+// join_day / finish_day が空の時は、その日の制限が無いものとして扱うのだ
+func (r *projectMemberRepository) FindActiveByUserID(userID uint) ([]entity.ProjectMember, error) {
+	var members []entity.ProjectMember
+	err := r.db.
+		Where("user_id = ?", userID).
+		Where("(join_day IS NULL OR join_day <= CURRENT_DATE)").
+		Where("(finish_day IS NULL OR finish_day >= CURRENT_DATE)").
+		Find(&members).Error
+	return members, err
+}
+
+// FindByProjectID はプロジェクトのメンバーを、終わった人も入れてユーザー名と一緒に取ってくるのだ
+func (r *projectMemberRepository) FindByProjectID(projectID uint) ([]entity.ProjectMember, error) {
+	var members []entity.ProjectMember
+	err := r.db.Preload("User").
+		Where("project_id = ?", projectID).
+		Order("project_member_id").
+		Find(&members).Error
+	return members, err
+}
+
+func (r *projectMemberRepository) FindByID(id uint) (*entity.ProjectMember, error) {
+	var member entity.ProjectMember
+	if err := r.db.Preload("User").First(&member, id).Error; err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+func (r *projectMemberRepository) Create(tx *gorm.DB, member *entity.ProjectMember) error {
+	return tx.Omit("Project", "User").Create(member).Error
+}
+
+// Update は役割と参加した日・終わった日だけを書き換えるのだ
+func (r *projectMemberRepository) Update(member *entity.ProjectMember) error {
+	return r.db.Model(member).Select("project_role", "join_day", "finish_day").Updates(member).Error
+}
+
+func (r *projectMemberRepository) Delete(id uint) error {
+	return r.db.Delete(&entity.ProjectMember{}, id).Error
+}
+
+func (r *projectMemberRepository) DeleteByProjectID(tx *gorm.DB, projectID uint) error {
+	return tx.Where("project_id = ?", projectID).Delete(&entity.ProjectMember{}).Error
+}
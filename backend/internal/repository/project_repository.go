@@ -0,0 +1,85 @@
+//internal/repository/project_repository.go
+package repository
+
+import (
+	"time"
+
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ProjectRepository interface {
+	FindAll(includeArchived bool) ([]entity.Project, error)
+	FindByID(id uint) (*entity.Project, error)
+	LockByID(tx *gorm.DB, id uint) (*entity.Project, error)
+	Create(tx *gorm.DB, project *entity.Project) error
+	Update(project *entity.Project) error
+	Delete(tx *gorm.DB, id uint) error
+	SetArchivedAt(id uint, archivedAt *time.Time) error
+	CountOccurrences(tx *gorm.DB, id uint) (int64, error)
+}
+
+type projectRepository struct {
+	db *gorm.DB
+}
+
+func NewProjectRepository(db *gorm.DB) ProjectRepository {
+	return &projectRepository{db: db}
+}
+
+// FindAll はプロジェクトを名前順に取ってくるのだ
+func (r *projectRepository) FindAll(includeArchived bool) ([]entity.Project, error) {
+	var projects []entity.Project
+	tx := r.db.Model(&entity.Project{})
+	if !includeArchived {
+		tx = tx.Where("archived_at IS NULL")
+	}
+	err := tx.Order("project_name, project_id").Find(&projects).Error
+	return projects, err
+}
+
+func (r *projectRepository) FindByID(id uint) (*entity.Project, error) {
+	var project entity.Project
+	if err := r.db.First(&project, id).Error; err != nil {
+		return nil, err
+	}
+	return &project, nil
+}
+
+// LockByID はトランザクションの中でプロジェクトの行をロックしてから取ってくるのだ
+// occurrenceを入れたり移したりする時は外部キーのためにこの行を読むので、ロックが外れるまで待つのだ
+func (r *projectRepository) LockByID(tx *gorm.DB, id uint) (*entity.Project, error) {
+	var project entity.Project
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&project, id).Error; err != nil {
+		return nil, err
+	}
+	return &project, nil
+}
+
+func (r *projectRepository) Create(tx *gorm.DB, project *entity.Project) error {
+	return tx.Omit("Occurrences", "ProjectMembers").Create(project).Error
+}
+
+// Update はプロジェクトの情報のカラムを書き換えるのだ。archived_at はここでは変えないのだ
+func (r *projectRepository) Update(project *entity.Project) error {
+	return r.db.Model(project).
+		Select("project_name", "disscription", "start_day", "finished_day", "updated_day", "note").
+		Updates(project).Error
+}
+
+func (r *projectRepository) Delete(tx *gorm.DB, id uint) error {
+	return tx.Delete(&entity.Project{}, id).Error
+}
+
+// SetArchivedAt はプロジェクトをアーカイブしたり(日時)、元に戻したり(nil)するのだ
+func (r *projectRepository) SetArchivedAt(id uint, archivedAt *time.Time) error {
+	return r.db.Model(&entity.Project{}).Where("project_id = ?", id).Update("archived_at", archivedAt).Error
+}
+
+// CountOccurrences はプロジェクトに入っているoccurrenceを、ゴミ箱の中も入れて数えるのだ
+func (r *projectRepository) CountOccurrences(tx *gorm.DB, id uint) (int64, error) {
+	var count int64
+	err := tx.Unscoped().Model(&entity.Occurrence{}).Where("project_id = ?", id).Count(&count).Error
+	return count, err
+}
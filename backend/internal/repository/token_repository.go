@@ -0,0 +1,112 @@
+//internal/repository/token_repository.go
+package repository
+
+import (
+	"time"
+
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type TokenRepository interface {
+	CreateRefreshToken(token *entity.RefreshToken) error
+	FindRefreshTokenByHash(hash string) (*entity.RefreshToken, error)
+	MarkRefreshTokenUsed(id uint) (bool, error)
+	RevokeFamily(familyID string) error
+	RevokeUserTokens(userID uint) error
+	RevokeAccessToken(jti string, userID *uint, expiresAt time.Time) error
+	IsAccessTokenRevoked(jti string) (bool, error)
+}
+
+type tokenRepository struct {
+	db *gorm.DB
+}
+
+func NewTokenRepository(db *gorm.DB) TokenRepository {
+	return &tokenRepository{db: db}
+}
+
+func (r *tokenRepository) CreateRefreshToken(token *entity.RefreshToken) error {
+	return r.db.Omit("User").Create(token).Error
+}
+
+func (r *tokenRepository) FindRefreshTokenByHash(hash string) (*entity.RefreshToken, error) {
+	var token entity.RefreshToken
+	if err := r.db.Where("token_hash = ?", hash).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// MarkRefreshTokenUsed はリフレッシュトークンを使用済みにするのだ
+// 同時に2回使われても、trueが返るのは先に来た方だけなのだ
+func (r *tokenRepository) MarkRefreshTokenUsed(id uint) (bool, error) {
+	result := r.db.Model(&entity.RefreshToken{}).
+		Where("refresh_token_id = ? AND used_at IS NULL AND revoked_at IS NULL", id).
+		Update("used_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+// RevokeFamily は同じログインから回転してきたトークンを全部無効にするのだ
+// 一緒に発行したアクセストークンも、期限が来る前に使えなくするのだ
+func (r *tokenRepository) RevokeFamily(familyID string) error {
+	return r.revokeRefreshTokens("family_id", familyID)
+}
+
+// RevokeUserTokens はユーザーの全部のログインを無効にするのだ
+func (r *tokenRepository) RevokeUserTokens(userID uint) error {
+	return r.revokeRefreshTokens("user_id", userID)
+}
+
+// revokeRefreshTokens は column = value のトークンをまとめて無効にするのだ
+// アクセストークンの期限は分からないので、安全側に倒してリフレッシュトークンの期限まで無効リストに残すのだ
+func (r *tokenRepository) revokeRefreshTokens(column string, value interface{}) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var tokens []entity.RefreshToken
+		if err := tx.Where(column+" = ? AND revoked_at IS NULL", value).Find(&tokens).Error; err != nil {
+			return err
+		}
+		if len(tokens) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, 0, len(tokens))
+		revokedAccess := []entity.RevokedAccessToken{}
+		for _, token := range tokens {
+			ids = append(ids, token.RefreshTokenID)
+			if token.AccessJTI != nil {
+				userID := token.UserID
+				revokedAccess = append(revokedAccess, entity.RevokedAccessToken{
+					JTI:       *token.AccessJTI,
+					UserID:    &userID,
+					ExpiresAt: token.ExpiresAt,
+				})
+			}
+		}
+
+		if err := tx.Model(&entity.RefreshToken{}).Where("refresh_token_id IN ?", ids).Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+		if len(revokedAccess) == 0 {
+			return nil
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&revokedAccess).Error
+	})
+}
+
+// RevokeAccessToken はアクセストークンのjtiを無効リストに入れるのだ
+// ついでに期限が過ぎてもう要らない行を消しておくのだ
+func (r *tokenRepository) RevokeAccessToken(jti string, userID *uint, expiresAt time.Time) error {
+	if err := r.db.Where("expires_at < ?", time.Now()).Delete(&entity.RevokedAccessToken{}).Error; err != nil {
+		return err
+	}
+	revoked := &entity.RevokedAccessToken{JTI: jti, UserID: userID, ExpiresAt: expiresAt}
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(revoked).Error
+}
+
+func (r *tokenRepository) IsAccessTokenRevoked(jti string) (bool, error) {
+	var count int64
+	err := r.db.Model(&entity.RevokedAccessToken{}).Where("jti = ?", jti).Count(&count).Error
+	return count > 0, err
+}
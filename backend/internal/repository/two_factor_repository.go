@@ -0,0 +1,99 @@
+//internal/repository/two_factor_repository.go
+package repository
+
+import (
+	"time"
+
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"gorm.io/gorm"
+)
+
+type TwoFactorRepository interface {
+	SetPendingSecret(userID uint, encryptedSecret string) error
+	Enable(userID uint, step int64, codeHashes []string) error
+	Disable(userID uint) error
+	ReplaceRecoveryCodes(userID uint, codeHashes []string) error
+	UseStep(userID uint, step int64) (bool, error)
+	UseRecoveryCode(userID uint, codeHash string) (bool, error)
+}
+
+type twoFactorRepository struct {
+	db *gorm.DB
+}
+
+func NewTwoFactorRepository(db *gorm.DB) TwoFactorRepository {
+	return &twoFactorRepository{db: db}
+}
+
+// SetPendingSecret は登録の途中の秘密鍵を入れるのだ。まだ有効にはしないのだ
+func (r *twoFactorRepository) SetPendingSecret(userID uint, encryptedSecret string) error {
+	return r.db.Model(&entity.User{}).Where("user_id = ? AND totp_enabled_at IS NULL", userID).
+		Updates(map[string]interface{}{"totp_secret": encryptedSecret, "totp_last_step": nil}).Error
+}
+
+// Enable は確認のコードが合ったので2段階認証を有効にして、リカバリーコードを入れるのだ
+func (r *twoFactorRepository) Enable(userID uint, step int64, codeHashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&entity.User{}).Where("user_id = ?", userID).
+			Updates(map[string]interface{}{"totp_enabled_at": time.Now(), "totp_last_step": step}).Error
+		if err != nil {
+			return err
+		}
+		return replaceRecoveryCodes(tx, userID, codeHashes)
+	})
+}
+
+// Disable は秘密鍵とリカバリーコードを全部消すのだ
+func (r *twoFactorRepository) Disable(userID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&entity.User{}).Where("user_id = ?", userID).
+			Updates(map[string]interface{}{"totp_secret": nil, "totp_enabled_at": nil, "totp_last_step": nil}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&entity.TOTPRecoveryCode{}).Error
+	})
+}
+
+func (r *twoFactorRepository) ReplaceRecoveryCodes(userID uint, codeHashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodes(tx, userID, codeHashes)
+	})
+}
+
+// UseStep は前に使ったものより新しい30秒のコードの時だけ、そのstepを覚えてtrueを返すのだ
+func (r *twoFactorRepository) UseStep(userID uint, step int64) (bool, error) {
+	result := r.db.Model(&entity.User{}).
+		Where("user_id = ? AND (totp_last_step IS NULL OR totp_last_step < ?)", userID, step).
+		Update("totp_last_step", step)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// UseRecoveryCode はまだ使っていないリカバリーコードの時だけ、使用済みにしてtrueを返すのだ
+func (r *twoFactorRepository) UseRecoveryCode(userID uint, codeHash string) (bool, error) {
+	result := r.db.Model(&entity.TOTPRecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// replaceRecoveryCodes は古いリカバリーコードを消して、新しいものに入れ替えるのだ
+func replaceRecoveryCodes(tx *gorm.DB, userID uint, codeHashes []string) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&entity.TOTPRecoveryCode{}).Error; err != nil {
+		return err
+	}
+	codes := make([]entity.TOTPRecoveryCode, 0, len(codeHashes))
+	for _, hash := range codeHashes {
+		codes = append(codes, entity.TOTPRecoveryCode{UserID: userID, CodeHash: hash})
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+	return tx.Create(&codes).Error
+}
@@ -5,10 +5,13 @@ import (
 	"github.com/saku-730/web-specimen/backend/internal/entity"
 //	"github.com/saku-730/web-specimen/backend/internal/model"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type UserDefaultsRepository interface {
 	FindDefaultsByUserID(userID int) (*entity.UserDefault, error)
+	SaveDefaults(defaults *entity.UserDefault) error
+	ResolveNames(defaults *entity.UserDefault) ([]string, error)
 }
 
 type userDefaultsRepository struct {
@@ -26,3 +29,52 @@ func (r *userDefaultsRepository) FindDefaultsByUserID(userID int) (*entity.UserD
 	}
 	return &defaults, nil
 }
+
+// SaveDefaults はユーザーのデフォルト値を丸ごと書き込むのだ。まだ行が無ければ作るのだ
+func (r *userDefaultsRepository) SaveDefaults(defaults *entity.UserDefault) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		UpdateAll: true,
+	}).Create(defaults).Error
+}
+
+// ResolveNames はIDから今の名前を引いて、defaults の名前のカラムを埋め直すのだ
+// 見つからなかったIDの項目名 (project_id など) を返すのだ
+func (r *userDefaultsRepository) ResolveNames(defaults *entity.UserDefault) ([]string, error) {
+	lookups := []struct {
+		field      string
+		table      string
+		idColumn   string
+		nameColumn string
+		id         *int
+		name       **string
+	}{
+		{"user_id", "users", "user_id", "user_name", &defaults.UserID, &defaults.UserName},
+		{"project_id", "projects", "project_id", "project_name", defaults.ProjectID, &defaults.ProjectName},
+		{"language_id", "languages", "language_id", "language_common", defaults.LanguageID, &defaults.LanguageCommon},
+		{"observation_user_id", "users", "user_id", "user_name", defaults.ObservationUserID, &defaults.ObservationUserName},
+		{"observation_method_id", "observation_methods", "observation_method_id", "method_common_name", defaults.ObservationMethodID, &defaults.ObservationMethodName},
+		{"specimen_user_id", "users", "user_id", "user_name", defaults.SpecimenUserID, &defaults.SpecimenUserName},
+		{"specimen_methods_id", "specimen_methods", "specimen_methods_id", "method_common_name", defaults.SpecimenMethodID, &defaults.SpecimenMethodName},
+		{"identification_user_id", "users", "user_id", "user_name", defaults.IdentificationUserID, &defaults.IdentificationUserName},
+	}
+
+	var missing []string
+	for _, l := range lookups {
+		*l.name = nil
+		if l.id == nil {
+			continue
+		}
+		var rows []struct{ Name *string }
+		err := r.db.Table(l.table).Select(l.nameColumn+" AS name").Where(l.idColumn+" = ?", *l.id).Limit(1).Scan(&rows).Error
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) == 0 {
+			missing = append(missing, l.field)
+			continue
+		}
+		*l.name = rows[0].Name
+	}
+	return missing, nil
+}
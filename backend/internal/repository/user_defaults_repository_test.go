@@ -0,0 +1,50 @@
+// internal/repository/user_defaults_repository_test.go
+package repository
+
+import (
+	"database/sql/driver"
+	"testing"
+
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveNames(t *testing.T) {
+	projectID, languageID := 3, 99
+
+	t.Run("名前はIDからDBで引き直して、送られてきた名前は使わないのだ", func(t *testing.T) {
+		db, fake := newFakeDB(t)
+		fake.on(`FROM "projects"`, []string{"name"}, []driver.Value{"Kyoto survey"})
+		fake.on(`FROM "users"`, []string{"name"}, []driver.Value{"alice"})
+		r := &userDefaultsRepository{db: db}
+		stale := "old project name"
+		defaults := &entity.UserDefault{UserID: 1, ProjectID: &projectID, ProjectName: &stale}
+
+		missing, err := r.ResolveNames(defaults)
+
+		assert.NoError(t, err)
+		assert.Empty(t, missing)
+		assert.Equal(t, "Kyoto survey", *defaults.ProjectName)
+		assert.Equal(t, "alice", *defaults.UserName)
+		if queries := fake.executed(`FROM "projects" WHERE project_id = $1`); assert.Len(t, queries, 1) {
+			assert.Equal(t, int64(projectID), queries[0].args[0])
+		}
+		// IDが無い項目は引かないで、名前も空にするのだ
+		assert.Empty(t, fake.executed(`FROM "languages"`))
+		assert.Nil(t, defaults.LanguageCommon)
+	})
+
+	t.Run("見つからないIDは項目名を返して、名前は空にするのだ", func(t *testing.T) {
+		db, fake := newFakeDB(t)
+		fake.on(`FROM "users"`, []string{"name"}, []driver.Value{"alice"})
+		r := &userDefaultsRepository{db: db}
+		stale := "Japanese"
+		defaults := &entity.UserDefault{UserID: 1, LanguageID: &languageID, LanguageCommon: &stale}
+
+		missing, err := r.ResolveNames(defaults)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"language_id"}, missing)
+		assert.Nil(t, defaults.LanguageCommon)
+	})
+}
@@ -2,12 +2,26 @@
 package repository
 
 import (
+	"time"
+
 	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"github.com/saku-730/web-specimen/backend/internal/model"
 	"gorm.io/gorm"
 )
 
 type UserRepository interface {
 	FindByEmail(email string) (*entity.User, error)
+	FindByID(id uint) (*entity.User, error)
+	FindByOIDCSubject(issuer, subject string) (*entity.User, error)
+	LinkOIDCSubject(userID uint, issuer, subject string) error
+	Create(tx *gorm.DB, user *entity.User) error
+	UpdatePassword(userID uint, passwordHash string) error
+	FindRoleByName(name string) (*entity.UserRole, error)
+	FindRoleByID(id uint) (*entity.UserRole, error)
+	FindAll(page, perPage int, includeDeactivated bool) ([]entity.User, int64, error)
+	Update(tx *gorm.DB, userID uint, columns map[string]interface{}) error
+	SetDeactivatedAt(tx *gorm.DB, userID uint, deactivatedAt *time.Time) error
+	LockActiveAdminIDs(tx *gorm.DB) ([]uint, error)
 }
 
 type userRepository struct {
@@ -20,8 +34,104 @@ func NewUserRepository(db *gorm.DB) UserRepository {
 
 func (r *userRepository) FindByEmail(email string) (*entity.User, error) {
 	var user entity.User
-	if err := r.db.Where("mail_address = ?", email).First(&user).Error; err != nil {
+	// 役割の名前をトークンに入れるので、user_rolesも一緒に取ってくるのだ
+	if err := r.db.Preload("UserRole").Where("mail_address = ?", email).First(&user).Error; err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
+
+// FindByID はトークンを取り直す時に、最新の役割と一緒にユーザーを取ってくるのだ
+func (r *userRepository) FindByID(id uint) (*entity.User, error) {
+	var user entity.User
+	if err := r.db.Preload("UserRole").First(&user, id).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// FindByOIDCSubject はIdPの発行者とsubで、前にOpenID Connectでログインしたユーザーを探すのだ
+func (r *userRepository) FindByOIDCSubject(issuer, subject string) (*entity.User, error) {
+	var user entity.User
+	if err := r.db.Preload("UserRole").Where("oidc_issuer = ? AND oidc_subject = ?", issuer, subject).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// LinkOIDCSubject は今までのユーザーにIdPのsubを結び付けるのだ
+func (r *userRepository) LinkOIDCSubject(userID uint, issuer, subject string) error {
+	return r.db.Model(&entity.User{}).Where("user_id = ?", userID).
+		Updates(map[string]interface{}{"oidc_issuer": issuer, "oidc_subject": subject}).Error
+}
+
+func (r *userRepository) Create(tx *gorm.DB, user *entity.User) error {
+	return tx.Omit("UserRole", "UserDefault").Create(user).Error
+}
+
+func (r *userRepository) UpdatePassword(userID uint, passwordHash string) error {
+	return r.db.Model(&entity.User{}).Where("user_id = ?", userID).Update("password", passwordHash).Error
+}
+
+func (r *userRepository) FindRoleByName(name string) (*entity.UserRole, error) {
+	var role entity.UserRole
+	if err := r.db.Where("role_name = ?", name).First(&role).Error; err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (r *userRepository) FindRoleByID(id uint) (*entity.UserRole, error) {
+	var role entity.UserRole
+	if err := r.db.First(&role, id).Error; err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// FindAll はユーザーの一覧をuser_id順に取ってくるのだ。無効にしたユーザーは聞かれた時だけ入れるのだ
+func (r *userRepository) FindAll(page, perPage int, includeDeactivated bool) ([]entity.User, int64, error) {
+	var users []entity.User
+	var total int64
+
+	tx := r.db.Model(&entity.User{})
+	if !includeDeactivated {
+		tx = tx.Where("deactivated_at IS NULL")
+	}
+	if err := tx.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * perPage
+	err := tx.Session(&gorm.Session{}).Limit(perPage).Offset(offset).
+		Preload("UserRole").
+		Order("user_id").
+		Find(&users).Error
+
+	return users, total, err
+}
+
+// Update は渡されたカラムだけを書き換えるのだ
+func (r *userRepository) Update(tx *gorm.DB, userID uint, columns map[string]interface{}) error {
+	if len(columns) == 0 {
+		return nil
+	}
+	return tx.Model(&entity.User{}).Where("user_id = ?", userID).Updates(columns).Error
+}
+
+// SetDeactivatedAt はユーザーを無効にしたり(日時)、元に戻したり(nil)するのだ
+func (r *userRepository) SetDeactivatedAt(tx *gorm.DB, userID uint, deactivatedAt *time.Time) error {
+	return tx.Model(&entity.User{}).Where("user_id = ?", userID).Update("deactivated_at", deactivatedAt).Error
+}
+
+// LockActiveAdminIDs は有効な管理者のuser_idを、行をロックしてから返すのだ
+// 2人の管理者がお互いを同時に外しても、後の方はロックを待ってから数え直すので、管理者がいなくならないのだ
+func (r *userRepository) LockActiveAdminIDs(tx *gorm.DB) ([]uint, error) {
+	var ids []uint
+	err := tx.Raw(`SELECT users.user_id FROM users
+		JOIN user_roles ON user_roles.role_id = users.role_id
+		WHERE user_roles.role_name = ? AND users.deactivated_at IS NULL
+		ORDER BY users.user_id
+		FOR UPDATE OF users`, model.RoleAdmin).Scan(&ids).Error
+	return ids, err
+}
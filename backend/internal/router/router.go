@@ -6,11 +6,24 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/saku-730/web-specimen/backend/internal/handler"
 	"github.com/saku-730/web-specimen/backend/internal/middleware"
+	"github.com/saku-730/web-specimen/backend/internal/model"
 )
 
 func SetupRouter(
 	authHandler handler.AuthHandler,
 	occHandler handler.OccurrenceHandler,
+	apiKeyHandler handler.APIKeyHandler,
+	oidcHandler handler.OIDCHandler,
+	accountHandler handler.AccountHandler,
+	loginAuditHandler handler.LoginAuditHandler,
+	twoFactorHandler handler.TwoFactorHandler,
+	userHandler handler.UserHandler,
+	userDefaultsHandler handler.UserDefaultsHandler,
+	templateHandler handler.EntryTemplateHandler,
+	projectHandler handler.ProjectHandler,
+	observationMethodHandler handler.MethodHandler,
+	specimenMethodHandler handler.MethodHandler,
+	institutionHandler handler.InstitutionHandler,
 	authMiddleware middleware.AuthMiddleware,
 
 )*gin.Engine {
@@ -20,23 +33,132 @@ func SetupRouter(
 	config := cors.DefaultConfig()
 	config.AllowOrigins = []string{"http://localhost:3000"}
 	config.AllowCredentials = true
-	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization"}
+	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", "X-API-Key", "If-Match", "If-None-Match"}
+	config.ExposeHeaders = []string{"ETag", "Location"}
 	router.Use(cors.New(config))
 
 	//API Version
 	apiV0_0_2 := router.Group("/api/v0_0_2")//router.Group() make gin.RouterGroup
 	{
 		apiV0_0_2.POST("/login", authHandler.Login)
+		apiV0_0_2.POST("/login/2fa", authHandler.VerifyTwoFactor)
+		apiV0_0_2.POST("/refresh", authHandler.Refresh)
+		apiV0_0_2.GET("/oidc/login", oidcHandler.Login)
+		apiV0_0_2.GET("/oidc/callback", oidcHandler.Callback)
+		apiV0_0_2.POST("/register", accountHandler.Register)
+		apiV0_0_2.POST("/invitations/accept", accountHandler.AcceptInvitation)
+		apiV0_0_2.POST("/password/forgot", accountHandler.ForgotPassword)
+		apiV0_0_2.POST("/password/reset", accountHandler.ResetPassword)
+		apiV0_0_2.POST("/email/confirm", accountHandler.ConfirmEmailChange)
 
 		secure := apiV0_0_2.Group("")
 		secure.Use(authMiddleware.Auth())
-		{	// /create page
-			secure.GET("/create", occHandler.GetCreatePage)
-			secure.POST("/create", occHandler.CreateOccurrence)
-			secure.POST("/create/:occurrence_id/attachments", occHandler.AttachFiles)
-			secure.GET("/search", occHandler.SearchPage)
-			secure.GET("/occurrences/:occurrence_id", occHandler.GetOccurrenceDetail)
-			secure.PUT("/occurrences/:occurrence_id", occHandler.UpdateOccurrence)
+		{
+			secure.POST("/logout", middleware.RequireInteractiveLogin(), authHandler.Logout)
+
+			// personal api keys (only from a login session)
+			apiKeys := secure.Group("/me/api-keys")
+			apiKeys.Use(middleware.RequireInteractiveLogin())
+			{
+				apiKeys.GET("", apiKeyHandler.ListAPIKeys)
+				apiKeys.POST("", apiKeyHandler.CreateAPIKey)
+				apiKeys.DELETE("/:api_key_id", apiKeyHandler.RevokeAPIKey)
+			}
+
+			// TOTP two factor authentication (for users who can delete occurrences)
+			totp := secure.Group("/me/2fa")
+			totp.Use(middleware.RequireInteractiveLogin(), middleware.RequirePermission(model.PermissionDeleteOccurrence))
+			{
+				totp.POST("/totp", twoFactorHandler.EnrollTOTP)
+				totp.POST("/totp/confirm", twoFactorHandler.ConfirmTOTP)
+				totp.DELETE("/totp", twoFactorHandler.DisableTOTP)
+				totp.POST("/recovery-codes", twoFactorHandler.RegenerateRecoveryCodes)
+			}
+			secure.DELETE("/users/:user_id/2fa", middleware.RequirePermission(model.PermissionManageUser), twoFactorHandler.ResetUserTOTP)
+
+			// users (list, create, deactivate are admin only. get and update are for yourself too)
+			secure.GET("/user", middleware.RequirePermission(model.PermissionManageUser), userHandler.ListUsers)
+			secure.POST("/user", middleware.RequirePermission(model.PermissionManageUser), userHandler.CreateUser)
+			secure.GET("/user/:user_id", userHandler.GetUser)
+			secure.PUT("/user/:user_id", middleware.RequireInteractiveLogin(), userHandler.UpdateUser)
+			secure.DELETE("/user/:user_id", middleware.RequirePermission(model.PermissionManageUser), userHandler.DeactivateUser)
+			secure.PUT("/user/:user_id/password", middleware.RequireInteractiveLogin(), userHandler.ChangePassword)
+			secure.POST("/user/:user_id/reactivate", middleware.RequirePermission(model.PermissionManageUser), userHandler.ReactivateUser)
+
+			// invitations (admin)
+			secure.GET("/invitations", middleware.RequirePermission(model.PermissionManageUser), accountHandler.ListInvitations)
+			secure.POST("/invitations", middleware.RequirePermission(model.PermissionManageUser), accountHandler.CreateInvitation)
+			secure.DELETE("/invitations/:invitation_id", middleware.RequirePermission(model.PermissionManageUser), accountHandler.RevokeInvitation)
+
+			// login audits and lockout (admin)
+			secure.GET("/login-audits", middleware.RequirePermission(model.PermissionManageUser), loginAuditHandler.SearchLoginAudits)
+			secure.POST("/users/:user_id/unlock", middleware.RequirePermission(model.PermissionManageUser), loginAuditHandler.UnlockUser)
+
+			// defaults for the /create page
+			secure.GET("/me/defaults", middleware.RequirePermission(model.PermissionCreateOccurrence), userDefaultsHandler.GetDefaults)
+			secure.PUT("/me/defaults", middleware.RequirePermission(model.PermissionCreateOccurrence), userDefaultsHandler.SaveDefaults)
+
+			// projects (leads can change their own project, archived projects are read-only)
+			secure.GET("/project", middleware.RequirePermission(model.PermissionReadOccurrence), projectHandler.ListProjects)
+			secure.POST("/project", middleware.RequireInteractiveLogin(), middleware.RequirePermission(model.PermissionManageProject), projectHandler.CreateProject)
+			secure.GET("/project/:project_id", middleware.RequirePermission(model.PermissionReadOccurrence), projectHandler.GetProject)
+			secure.PUT("/project/:project_id", middleware.RequireInteractiveLogin(), projectHandler.UpdateProject)
+			secure.DELETE("/project/:project_id", middleware.RequireInteractiveLogin(), middleware.RequirePermission(model.PermissionManageProject), projectHandler.DeleteProject)
+			secure.POST("/project/:project_id/archive", middleware.RequireInteractiveLogin(), projectHandler.ArchiveProject)
+			secure.POST("/project/:project_id/unarchive", middleware.RequireInteractiveLogin(), projectHandler.UnarchiveProject)
+			secure.GET("/project/:project_id/members", middleware.RequirePermission(model.PermissionReadOccurrence), projectHandler.ListMembers)
+			secure.POST("/project/:project_id/members", middleware.RequireInteractiveLogin(), projectHandler.AddMember)
+			secure.PUT("/project/:project_id/members/:project_member_id", middleware.RequireInteractiveLogin(), projectHandler.UpdateMember)
+			secure.DELETE("/project/:project_id/members/:project_member_id", middleware.RequireInteractiveLogin(), projectHandler.RemoveMember)
+
+			// observation / specimen method vocabularies (DELETE only deprecates, old records keep the method)
+			secure.GET("/observation", middleware.RequirePermission(model.PermissionReadOccurrence), observationMethodHandler.ListMethods)
+			secure.POST("/observation", middleware.RequirePermission(model.PermissionManageReference), observationMethodHandler.CreateMethod)
+			secure.GET("/observation/:method_id", middleware.RequirePermission(model.PermissionReadOccurrence), observationMethodHandler.GetMethod)
+			secure.PUT("/observation/:method_id", middleware.RequirePermission(model.PermissionManageReference), observationMethodHandler.UpdateMethod)
+			secure.DELETE("/observation/:method_id", middleware.RequirePermission(model.PermissionManageReference), observationMethodHandler.DeprecateMethod)
+			secure.POST("/observation/:method_id/restore", middleware.RequirePermission(model.PermissionManageReference), observationMethodHandler.RestoreMethod)
+			secure.POST("/observation/:method_id/merge", middleware.RequirePermission(model.PermissionManageReference), observationMethodHandler.MergeMethod)
+			secure.GET("/specimen", middleware.RequirePermission(model.PermissionReadOccurrence), specimenMethodHandler.ListMethods)
+			secure.POST("/specimen", middleware.RequirePermission(model.PermissionManageReference), specimenMethodHandler.CreateMethod)
+			secure.GET("/specimen/:method_id", middleware.RequirePermission(model.PermissionReadOccurrence), specimenMethodHandler.GetMethod)
+			secure.PUT("/specimen/:method_id", middleware.RequirePermission(model.PermissionManageReference), specimenMethodHandler.UpdateMethod)
+			secure.DELETE("/specimen/:method_id", middleware.RequirePermission(model.PermissionManageReference), specimenMethodHandler.DeprecateMethod)
+			secure.POST("/specimen/:method_id/restore", middleware.RequirePermission(model.PermissionManageReference), specimenMethodHandler.RestoreMethod)
+			secure.POST("/specimen/:method_id/merge", middleware.RequirePermission(model.PermissionManageReference), specimenMethodHandler.MergeMethod)
+
+			// institution registry (DELETE only deactivates, old specimens keep the institution)
+			secure.GET("/institution", middleware.RequirePermission(model.PermissionReadOccurrence), institutionHandler.ListInstitutions)
+			secure.POST("/institution", middleware.RequirePermission(model.PermissionManageReference), institutionHandler.CreateInstitution)
+			secure.GET("/institution/:institution_id", middleware.RequirePermission(model.PermissionReadOccurrence), institutionHandler.GetInstitution)
+			secure.PUT("/institution/:institution_id", middleware.RequirePermission(model.PermissionManageReference), institutionHandler.UpdateInstitution)
+			secure.DELETE("/institution/:institution_id", middleware.RequirePermission(model.PermissionManageReference), institutionHandler.DeactivateInstitution)
+			secure.POST("/institution/:institution_id/reactivate", middleware.RequirePermission(model.PermissionManageReference), institutionHandler.ReactivateInstitution)
+
+			// entry templates for the /create page (GET /create?template=<id>)
+			secure.GET("/templates", middleware.RequirePermission(model.PermissionCreateOccurrence), templateHandler.ListTemplates)
+			secure.POST("/templates", middleware.RequirePermission(model.PermissionCreateOccurrence), templateHandler.CreateTemplate)
+			secure.GET("/templates/:template_id", middleware.RequirePermission(model.PermissionCreateOccurrence), templateHandler.GetTemplate)
+			secure.PUT("/templates/:template_id", middleware.RequirePermission(model.PermissionCreateOccurrence), templateHandler.UpdateTemplate)
+			secure.DELETE("/templates/:template_id", middleware.RequirePermission(model.PermissionCreateOccurrence), templateHandler.DeleteTemplate)
+
+			// /create page
+			secure.GET("/create", middleware.RequirePermission(model.PermissionCreateOccurrence), occHandler.GetCreatePage)
+			secure.POST("/create", middleware.RequirePermission(model.PermissionCreateOccurrence), occHandler.CreateOccurrence)
+			secure.POST("/create/:occurrence_id/attachments", middleware.RequirePermission(model.PermissionUploadAttachment), occHandler.AttachFiles)
+			secure.GET("/search", middleware.RequirePermission(model.PermissionReadOccurrence), occHandler.SearchPage)
+			secure.GET("/tiles/:z/:x/:y", middleware.RequirePermission(model.PermissionReadOccurrence), occHandler.GetTile) // y is "{y}.mvt"
+			secure.GET("/occurrences/:occurrence_id", middleware.RequirePermission(model.PermissionReadOccurrence), occHandler.GetOccurrenceDetail)
+			secure.PUT("/occurrences/:occurrence_id", middleware.RequirePermission(model.PermissionEditOccurrence), occHandler.UpdateOccurrence)
+			secure.PATCH("/occurrences/:occurrence_id", middleware.RequirePermission(model.PermissionEditOccurrence), occHandler.PatchOccurrence)
+			secure.DELETE("/occurrences/:occurrence_id", middleware.RequirePermission(model.PermissionDeleteOccurrence), occHandler.DeleteOccurrence)
+			secure.GET("/occurrences/:occurrence_id/history", middleware.RequirePermission(model.PermissionReadOccurrence), occHandler.GetOccurrenceHistory)
+			secure.GET("/occurrences/:occurrence_id/revert", middleware.RequirePermission(model.PermissionReadOccurrence), occHandler.PreviewRevert)
+			secure.POST("/occurrences/:occurrence_id/revert", middleware.RequirePermission(model.PermissionEditOccurrence), occHandler.ApplyRevert)
+			// trash (soft deleted occurrences)
+			secure.GET("/trash", middleware.RequirePermission(model.PermissionDeleteOccurrence), occHandler.ListTrash)
+			secure.POST("/trash/:occurrence_id/restore", middleware.RequirePermission(model.PermissionDeleteOccurrence), occHandler.RestoreOccurrence)
+			secure.DELETE("/trash/:occurrence_id", middleware.RequirePermission(model.PermissionDeleteOccurrence), occHandler.PurgeOccurrence)
 		}
 
 	}
@@ -0,0 +1,470 @@
+// internal/service/account_service.go
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/saku-730/web-specimen/backend/config"
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"github.com/saku-730/web-specimen/backend/internal/mailer"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/saku-730/web-specimen/backend/internal/repository"
+	"github.com/saku-730/web-specimen/backend/internal/util"
+	"gorm.io/gorm"
+)
+
+// メールで送るトークンの用途なのだ
+const (
+	purposeInvitation    = "invitation"
+	purposePasswordReset = "password_reset"
+	purposeEmailChange   = "email_change"
+)
+
+// ErrInvalidRole は知らない役割が指定された時のエラーなのだ
+var ErrInvalidRole = errors.New("invalid role")
+
+// ErrEmailTaken はそのメールアドレスのユーザーがもういる時のエラーなのだ
+var ErrEmailTaken = errors.New("email address is already registered")
+
+// ErrInvalidAccountToken は招待やパスワード再設定のトークンが使えない時のエラーなのだ
+// 期限切れ、使用済み、取り消し済みのどれなのかは教えないのだ
+var ErrInvalidAccountToken = errors.New("invalid or expired token")
+
+// ErrSelfRegistrationDisabled は自分での登録が許されていない時のエラーなのだ
+var ErrSelfRegistrationDisabled = errors.New("self registration is disabled")
+
+// ErrSendMail はメールを送れなかった時のエラーなのだ
+var ErrSendMail = errors.New("failed send mail")
+
+// ErrMailThrottled は同じアドレスやIPアドレスからメールを頼まれすぎた時のエラーなのだ
+var ErrMailThrottled = errors.New("too many mail requests")
+
+// MailThrottledError はあとどれだけ待てばまたメールを頼めるかを持っているのだ
+type MailThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *MailThrottledError) Error() string {
+	return fmt.Sprintf("%s: retry after %s", ErrMailThrottled.Error(), e.RetryAfter.Round(time.Second))
+}
+
+func (e *MailThrottledError) Is(target error) bool {
+	return target == ErrMailThrottled
+}
+
+type AccountService interface {
+	Invite(ctx context.Context, actor *model.Actor, req *model.InvitationCreate) (*model.InvitationResponse, error)
+	ListInvitations() ([]model.InvitationResponse, error)
+	RevokeInvitation(id uint) error
+	Register(ctx context.Context, req *model.RegistrationRequest, client *model.ClientInfo) error
+	AcceptInvitation(req *model.AcceptInvitationRequest) (*model.LoginResponse, error)
+	ForgotPassword(ctx context.Context, req *model.ForgotPasswordRequest, client *model.ClientInfo) error
+	ResetPassword(req *model.ResetPasswordRequest) error
+	RequestEmailChange(ctx context.Context, user *entity.User, email string) error
+	ConfirmEmailChange(req *model.ConfirmEmailChangeRequest) error
+}
+
+type accountService struct {
+	db               *gorm.DB
+	userRepo         repository.UserRepository
+	invitationRepo   repository.InvitationRepository
+	tokenRepo        repository.TokenRepository
+	authService      AuthService
+	mailer           mailer.Mailer
+	throttle         *mailThrottle
+	tokenSecret      []byte
+	appBaseURL       string
+	invitationTTL    time.Duration
+	passwordResetTTL time.Duration
+	emailChangeTTL   time.Duration
+	selfRegistration bool
+	selfRole         string
+}
+
+func NewAccountService(db *gorm.DB, userRepo repository.UserRepository, invitationRepo repository.InvitationRepository, tokenRepo repository.TokenRepository, loginAuditRepo repository.LoginAuditRepository, authService AuthService, m mailer.Mailer, cfg *configs.Config) AccountService {
+	return &accountService{
+		db:             db,
+		userRepo:       userRepo,
+		invitationRepo: invitationRepo,
+		tokenRepo:      tokenRepo,
+		authService:    authService,
+		mailer:         m,
+		throttle:       newMailThrottle(loginAuditRepo, cfg),
+		// アクセストークンと同じ鍵だと、招待のトークンをアクセストークンとして使えてしまうので鍵を分けるのだ
+		tokenSecret:      []byte("account:" + cfg.JWTSecret),
+		appBaseURL:       strings.TrimSuffix(cfg.AppBaseURL, "/"),
+		invitationTTL:    time.Duration(cfg.InvitationTTLHours) * time.Hour,
+		passwordResetTTL: time.Duration(cfg.PasswordResetTTLMinutes) * time.Minute,
+		emailChangeTTL:   time.Duration(cfg.EmailChangeTTLMinutes) * time.Minute,
+		selfRegistration: cfg.SelfRegistrationEnabled,
+		selfRole:         cfg.SelfRegistrationRole,
+	}
+}
+
+// Invite は管理者がメールアドレスと役割を決めて、招待のメールを送るのだ
+func (s *accountService) Invite(ctx context.Context, actor *model.Actor, req *model.InvitationCreate) (*model.InvitationResponse, error) {
+	role, err := s.userRepo.FindRoleByName(req.Role)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidRole, req.Role)
+		}
+		return nil, err
+	}
+	if err := s.ensureEmailAvailable(req.Email); err != nil {
+		return nil, err
+	}
+
+	invitation, err := s.createInvitation(ctx, req.Email, role, &actor.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if inviter, err := s.userRepo.FindByID(actor.UserID); err == nil {
+		invitation.Inviter = inviter
+	}
+	return toInvitationResponse(invitation), nil
+}
+
+func (s *accountService) ListInvitations() ([]model.InvitationResponse, error) {
+	invitations, err := s.invitationRepo.FindPending()
+	if err != nil {
+		return nil, err
+	}
+
+	results := []model.InvitationResponse{}
+	for i := range invitations {
+		results = append(results, *toInvitationResponse(&invitations[i]))
+	}
+	return results, nil
+}
+
+func (s *accountService) RevokeInvitation(id uint) error {
+	return s.invitationRepo.Revoke(id)
+}
+
+// Register は自分での登録の申し込みなのだ。メールアドレスを確かめるために招待と同じメールを送るのだ
+// もう登録されているアドレスでも、それを知られないようにエラーにはしないのだ
+func (s *accountService) Register(ctx context.Context, req *model.RegistrationRequest, client *model.ClientInfo) error {
+	if !s.selfRegistration {
+		return ErrSelfRegistrationDisabled
+	}
+	// 登録されているかを調べる前に数えるので、待たされたかどうかからも登録されているかは分からないのだ
+	if err := s.checkMailThrottle(req.Email, "register", client); err != nil {
+		return err
+	}
+	if err := s.ensureEmailAvailable(req.Email); err != nil {
+		if errors.Is(err, ErrEmailTaken) {
+			return nil
+		}
+		return err
+	}
+
+	role, err := s.userRepo.FindRoleByName(s.selfRole)
+	if err != nil {
+		return fmt.Errorf("failed find self registration role %q: %w", s.selfRole, err)
+	}
+	_, err = s.createInvitation(ctx, req.Email, role, nil)
+	return err
+}
+
+// AcceptInvitation は招待のトークンでユーザーを作って、そのままログインさせるのだ
+func (s *accountService) AcceptInvitation(req *model.AcceptInvitationRequest) (*model.LoginResponse, error) {
+	claims, err := util.ParsePurposeToken(s.tokenSecret, req.Token, purposeInvitation)
+	if err != nil {
+		return nil, ErrInvalidAccountToken
+	}
+	invitation, err := s.invitationRepo.FindByTokenID(claims.ID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidAccountToken
+		}
+		return nil, err
+	}
+	if invitation.AcceptedAt != nil || invitation.RevokedAt != nil || time.Now().After(invitation.ExpiresAt) {
+		return nil, ErrInvalidAccountToken
+	}
+	if err := s.ensureEmailAvailable(invitation.MailAddress); err != nil {
+		return nil, err
+	}
+
+	passwordHash, err := util.HashPassword(req.Password)
+	if err != nil {
+		return nil, err
+	}
+	displayName := req.DisplayName
+	if displayName == "" {
+		displayName = req.UserName
+	}
+	roleID := int(invitation.RoleID)
+	user := &entity.User{
+		UserName:    req.UserName,
+		DisplayName: displayName,
+		MailAddress: &invitation.MailAddress,
+		Password:    &passwordHash,
+		RoleID:      &roleID,
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.userRepo.Create(tx, user); err != nil {
+			return err
+		}
+		accepted, err := s.invitationRepo.MarkAccepted(tx, invitation.InvitationID, user.UserID)
+		if err != nil {
+			return err
+		}
+		if !accepted {
+			// 同時に同じ招待が使われて、向こうが先に受け入れたのだ
+			return ErrInvalidAccountToken
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	user.UserRole = invitation.UserRole
+	return s.authService.IssueLoginTokens(user)
+}
+
+// ForgotPassword はパスワード再設定のメールを送るのだ
+// 知らないアドレスでも同じように成功を返して、登録されているかを知られないようにするのだ
+func (s *accountService) ForgotPassword(ctx context.Context, req *model.ForgotPasswordRequest, client *model.ClientInfo) error {
+	if err := s.checkMailThrottle(req.Email, "password_reset", client); err != nil {
+		return err
+	}
+	user, err := s.userRepo.FindByEmail(req.Email)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if user.DeactivatedAt != nil {
+		return nil
+	}
+
+	token, err := util.SignPurposeToken(s.tokenSecret, &util.PurposeClaims{
+		Purpose:     purposePasswordReset,
+		Fingerprint: passwordFingerprint(user),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatUint(uint64(user.UserID), 10),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.passwordResetTTL)),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	link := s.appBaseURL + "/reset-password?token=" + url.QueryEscape(token)
+	return s.send(ctx, mailer.Message{
+		To:      req.Email,
+		Subject: "パスワードの再設定",
+		Body: fmt.Sprintf("%s さん\n\n次のリンクから新しいパスワードを設定してください。リンクは%d分間だけ使えます。\n%s\n\n心当たりが無い場合は、このメールを無視してください。\n",
+			user.DisplayName, int(s.passwordResetTTL.Minutes()), link),
+	})
+}
+
+// ResetPassword はトークンを確かめて新しいパスワードにするのだ
+// パスワードが変わるとトークンの指紋も合わなくなるので、同じトークンは一度しか使えないのだ
+func (s *accountService) ResetPassword(req *model.ResetPasswordRequest) error {
+	claims, err := util.ParsePurposeToken(s.tokenSecret, req.Token, purposePasswordReset)
+	if err != nil {
+		return ErrInvalidAccountToken
+	}
+	userID, err := strconv.ParseUint(claims.Subject, 10, 32)
+	if err != nil {
+		return ErrInvalidAccountToken
+	}
+	user, err := s.userRepo.FindByID(uint(userID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidAccountToken
+		}
+		return err
+	}
+	if user.DeactivatedAt != nil || claims.Fingerprint != passwordFingerprint(user) {
+		return ErrInvalidAccountToken
+	}
+
+	passwordHash, err := util.HashPassword(req.Password)
+	if err != nil {
+		return err
+	}
+	if err := s.userRepo.UpdatePassword(user.UserID, passwordHash); err != nil {
+		return err
+	}
+	// 盗まれたパスワードで作られたログインが残らないように、全部ログアウトさせるのだ
+	return s.tokenRepo.RevokeUserTokens(user.UserID)
+}
+
+// RequestEmailChange は新しいアドレスに確かめるメールを送るのだ。アドレスはまだ変えないのだ
+// OpenID Connectは同じメールアドレスのユーザーに結び付けるので、確かめないで変えられると他の人のアカウントを乗っ取れてしまうのだ
+func (s *accountService) RequestEmailChange(ctx context.Context, user *entity.User, email string) error {
+	if err := s.ensureEmailAvailable(email); err != nil {
+		return err
+	}
+
+	token, err := util.SignPurposeToken(s.tokenSecret, &util.PurposeClaims{
+		Purpose:     purposeEmailChange,
+		Fingerprint: emailFingerprint(user),
+		Email:       email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatUint(uint64(user.UserID), 10),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.emailChangeTTL)),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	link := s.appBaseURL + "/confirm-email?token=" + url.QueryEscape(token)
+	return s.send(ctx, mailer.Message{
+		To:      email,
+		Subject: "メールアドレスの確認",
+		Body: fmt.Sprintf("%s さん\n\n次のリンクを開くと、メールアドレスがこのアドレスに変わります。リンクは%d分間だけ使えます。\n%s\n\n心当たりが無い場合は、このメールを無視してください。\n",
+			user.DisplayName, int(s.emailChangeTTL.Minutes()), link),
+	})
+}
+
+// ConfirmEmailChange はトークンを確かめてメールアドレスを変えるのだ
+// アドレスが変わるとトークンの指紋も合わなくなるので、同じトークンは一度しか使えないのだ
+func (s *accountService) ConfirmEmailChange(req *model.ConfirmEmailChangeRequest) error {
+	claims, err := util.ParsePurposeToken(s.tokenSecret, req.Token, purposeEmailChange)
+	if err != nil || claims.Email == "" {
+		return ErrInvalidAccountToken
+	}
+	userID, err := strconv.ParseUint(claims.Subject, 10, 32)
+	if err != nil {
+		return ErrInvalidAccountToken
+	}
+	user, err := s.userRepo.FindByID(uint(userID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidAccountToken
+		}
+		return err
+	}
+	if user.DeactivatedAt != nil || claims.Fingerprint != emailFingerprint(user) {
+		return ErrInvalidAccountToken
+	}
+	// メールを送ってから、他の人が同じアドレスを使い始めたかもしれないのだ
+	if err := s.ensureEmailAvailable(claims.Email); err != nil {
+		return err
+	}
+
+	return s.userRepo.Update(s.db, user.UserID, map[string]interface{}{"mail_address": claims.Email})
+}
+
+func (s *accountService) ensureEmailAvailable(email string) error {
+	_, err := s.userRepo.FindByEmail(email)
+	if err == nil {
+		return ErrEmailTaken
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	return err
+}
+
+// createInvitation は署名付きのトークンをメールで送ってから、招待を保存するのだ
+// 先に保存すると、送れなかった時に誰も受け取っていない招待が残ってしまうのだ
+func (s *accountService) createInvitation(ctx context.Context, email string, role *entity.UserRole, invitedBy *uint) (*entity.Invitation, error) {
+	tokenID, err := util.GenerateRandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	invitation := &entity.Invitation{
+		MailAddress: email,
+		RoleID:      role.RoleID,
+		InvitedBy:   invitedBy,
+		TokenID:     tokenID,
+		ExpiresAt:   time.Now().Add(s.invitationTTL),
+	}
+
+	token, err := util.SignPurposeToken(s.tokenSecret, &util.PurposeClaims{
+		Purpose: purposeInvitation,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
+			ExpiresAt: jwt.NewNumericDate(invitation.ExpiresAt),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	link := s.appBaseURL + "/accept-invitation?token=" + url.QueryEscape(token)
+	err = s.send(ctx, mailer.Message{
+		To:      email,
+		Subject: "web-specimen へのご招待",
+		Body: fmt.Sprintf("web-specimen のアカウントを作るには、次のリンクからユーザー名とパスワードを設定してください。\nリンクは%s まで使えます。\n%s\n",
+			invitation.ExpiresAt.Format("2006-01-02 15:04 MST"), link),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 保存できなかった時は、送ったリンクのトークンが見つからないので使えないだけなのだ
+	if err := s.invitationRepo.Create(invitation); err != nil {
+		return nil, err
+	}
+	invitation.UserRole = *role
+	return invitation, nil
+}
+
+// checkMailThrottle は同じアドレスやIPアドレスから、メールを頼まれすぎていないかを確かめるのだ
+func (s *accountService) checkMailThrottle(email, purpose string, client *model.ClientInfo) error {
+	retryAfter, err := s.throttle.begin(strings.ToLower(strings.TrimSpace(email)), purpose, client)
+	if err != nil {
+		return err
+	}
+	if retryAfter > 0 {
+		return &MailThrottledError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+func (s *accountService) send(ctx context.Context, msg mailer.Message) error {
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		return fmt.Errorf("%w: %v", ErrSendMail, err)
+	}
+	return nil
+}
+
+// passwordFingerprint は今のパスワードのハッシュから作る短い指紋なのだ
+// bcryptのハッシュは設定するたびに変わるので、同じパスワードにし直しても古いトークンは使えなくなるのだ
+func passwordFingerprint(user *entity.User) string {
+	password := ""
+	if user.Password != nil {
+		password = *user.Password
+	}
+	return util.HashToken(password)[:16]
+}
+
+// emailFingerprint は今のメールアドレスから作る短い指紋なのだ
+func emailFingerprint(user *entity.User) string {
+	mailAddress := ""
+	if user.MailAddress != nil {
+		mailAddress = *user.MailAddress
+	}
+	return util.HashToken(mailAddress)[:16]
+}
+
+func toInvitationResponse(invitation *entity.Invitation) *model.InvitationResponse {
+	res := &model.InvitationResponse{
+		InvitationID: invitation.InvitationID,
+		Email:        invitation.MailAddress,
+		Role:         invitation.UserRole.RoleName,
+		CreatedAt:    invitation.CreatedAt,
+		ExpiresAt:    invitation.ExpiresAt,
+	}
+	if invitation.Inviter != nil {
+		res.InvitedBy = &invitation.Inviter.UserName
+	}
+	return res
+}
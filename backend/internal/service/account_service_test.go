@@ -0,0 +1,93 @@
+// internal/service/account_service_test.go
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+func newTestMailThrottle(repo *memoryLoginAuditRepository) *mailThrottle {
+	return &mailThrottle{
+		loginAuditRepo: repo,
+		maxPerAddress:  3,
+		maxPerIP:       10,
+		window:         time.Hour,
+		lockoutBase:    time.Minute,
+		lockoutMax:     time.Hour,
+	}
+}
+
+func TestForgotPasswordThrottle(t *testing.T) {
+	t.Run("同じアドレスに何通も頼まれたら、しばらく送らないのだ", func(t *testing.T) {
+		userRepo := new(mockUserRepository)
+		userRepo.On("FindByEmail", "victim@example.com").Return(nil, gorm.ErrRecordNotFound)
+		s := &accountService{userRepo: userRepo, throttle: newTestMailThrottle(&memoryLoginAuditRepository{})}
+
+		// IPアドレスを変えても、アドレスごとに数えるのだ
+		for _, ip := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"} {
+			assert.NoError(t, s.ForgotPassword(context.Background(), &model.ForgotPasswordRequest{Email: "victim@example.com"}, &model.ClientInfo{IPAddress: ip}))
+		}
+		err := s.ForgotPassword(context.Background(), &model.ForgotPasswordRequest{Email: "Victim@example.com"}, &model.ClientInfo{IPAddress: "192.0.2.4"})
+
+		var throttled *MailThrottledError
+		assert.True(t, errors.As(err, &throttled))
+		assert.Greater(t, throttled.RetryAfter, time.Duration(0))
+		userRepo.AssertNumberOfCalls(t, "FindByEmail", 3)
+	})
+
+	t.Run("同じIPアドレスからたくさんのアドレスに頼まれても止めるのだ", func(t *testing.T) {
+		userRepo := new(mockUserRepository)
+		userRepo.On("FindByEmail", mock.Anything).Return(nil, gorm.ErrRecordNotFound)
+		s := &accountService{userRepo: userRepo, throttle: newTestMailThrottle(&memoryLoginAuditRepository{})}
+		client := &model.ClientInfo{IPAddress: "192.0.2.1"}
+
+		for i := 0; i < 10; i++ {
+			email := string(rune('a'+i)) + "@example.com"
+			assert.NoError(t, s.ForgotPassword(context.Background(), &model.ForgotPasswordRequest{Email: email}, client))
+		}
+		err := s.ForgotPassword(context.Background(), &model.ForgotPasswordRequest{Email: "z@example.com"}, client)
+
+		assert.True(t, errors.Is(err, ErrMailThrottled))
+	})
+}
+
+func TestRegisterThrottle(t *testing.T) {
+	t.Run("登録済みのアドレスでも同じように数えるのだ", func(t *testing.T) {
+		userRepo := new(mockUserRepository)
+		userRepo.On("FindByEmail", "taken@example.com").Return(&entity.User{UserID: 1}, nil)
+		s := &accountService{userRepo: userRepo, selfRegistration: true, throttle: newTestMailThrottle(&memoryLoginAuditRepository{})}
+		client := &model.ClientInfo{IPAddress: "192.0.2.1"}
+
+		for i := 0; i < 3; i++ {
+			assert.NoError(t, s.Register(context.Background(), &model.RegistrationRequest{Email: "taken@example.com"}, client))
+		}
+		err := s.Register(context.Background(), &model.RegistrationRequest{Email: "taken@example.com"}, client)
+
+		assert.True(t, errors.Is(err, ErrMailThrottled))
+	})
+}
+
+func TestInvite(t *testing.T) {
+	t.Run("メールを送れなかったら招待は保存しないのだ", func(t *testing.T) {
+		userRepo := new(mockUserRepository)
+		userRepo.On("FindRoleByName", model.RoleCollector).Return(&entity.UserRole{RoleID: 2, RoleName: model.RoleCollector}, nil)
+		userRepo.On("FindByEmail", "new@example.com").Return(nil, gorm.ErrRecordNotFound)
+		m := new(mockMailer)
+		m.On("Send", "new@example.com").Return(errors.New("connection refused"))
+		invitationRepo := new(mockInvitationRepository)
+		s := &accountService{userRepo: userRepo, invitationRepo: invitationRepo, mailer: m, tokenSecret: []byte("secret"), invitationTTL: time.Hour}
+
+		_, err := s.Invite(context.Background(), &model.Actor{UserID: 1, Role: model.RoleAdmin}, &model.InvitationCreate{Email: "new@example.com", Role: model.RoleCollector})
+
+		assert.True(t, errors.Is(err, ErrSendMail))
+		invitationRepo.AssertNotCalled(t, "Create", mock.Anything)
+	})
+}
@@ -0,0 +1,144 @@
+// internal/service/api_key_service.go
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/saku-730/web-specimen/backend/internal/repository"
+	"github.com/saku-730/web-specimen/backend/internal/util"
+	"gorm.io/gorm"
+)
+
+// apiKeyPrefix は発行するAPIキーの頭に付ける文字なのだ。ログなどに紛れ込んだ時に見つけやすくするためなのだ
+const apiKeyPrefix = "wsk_"
+
+// ErrInvalidScope は知らないスコープが指定された時のエラーなのだ
+var ErrInvalidScope = errors.New("invalid scope")
+
+// ErrInvalidExpiry は期限が過去の日時になっている時のエラーなのだ
+var ErrInvalidExpiry = errors.New("expires_at must be in the future")
+
+// ErrInvalidAPIKey は知らない・無効にされた・期限切れのAPIキーの時のエラーなのだ
+var ErrInvalidAPIKey = errors.New("invalid api key")
+
+type APIKeyService interface {
+	CreateAPIKey(actor *model.Actor, req *model.APIKeyCreate) (*model.APIKeyCreatedResponse, error)
+	ListAPIKeys(actor *model.Actor) ([]model.APIKeyResponse, error)
+	RevokeAPIKey(actor *model.Actor, id uint) error
+	AuthenticateAPIKey(key string) (*model.APIKeyPrincipal, error)
+}
+
+type apiKeyService struct {
+	apiKeyRepo repository.APIKeyRepository
+}
+
+func NewAPIKeyService(apiKeyRepo repository.APIKeyRepository) APIKeyService {
+	return &apiKeyService{apiKeyRepo: apiKeyRepo}
+}
+
+// CreateAPIKey は新しいAPIキーを発行するのだ。キーそのものを返すのはこの時だけなのだ
+func (s *apiKeyService) CreateAPIKey(actor *model.Actor, req *model.APIKeyCreate) (*model.APIKeyCreatedResponse, error) {
+	for _, scope := range req.Scopes {
+		if !model.IsValidScope(scope) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidScope, scope)
+		}
+	}
+	if req.ExpiresAt != nil && req.ExpiresAt.Before(time.Now()) {
+		return nil, ErrInvalidExpiry
+	}
+
+	secret, err := util.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	key := apiKeyPrefix + secret
+
+	scopes, err := json.Marshal(req.Scopes)
+	if err != nil {
+		return nil, err
+	}
+	apiKey := &entity.APIKey{
+		UserID:    actor.UserID,
+		Name:      req.Name,
+		KeyPrefix: key[:len(apiKeyPrefix)+6],
+		KeyHash:   util.HashToken(key),
+		Scopes:    scopes,
+		ExpiresAt: req.ExpiresAt,
+	}
+	if err := s.apiKeyRepo.Create(apiKey); err != nil {
+		return nil, err
+	}
+
+	return &model.APIKeyCreatedResponse{
+		APIKeyResponse: toAPIKeyResponse(apiKey),
+		Key:            key,
+	}, nil
+}
+
+func (s *apiKeyService) ListAPIKeys(actor *model.Actor) ([]model.APIKeyResponse, error) {
+	keys, err := s.apiKeyRepo.FindByUserID(actor.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []model.APIKeyResponse{}
+	for i := range keys {
+		results = append(results, toAPIKeyResponse(&keys[i]))
+	}
+	return results, nil
+}
+
+func (s *apiKeyService) RevokeAPIKey(actor *model.Actor, id uint) error {
+	return s.apiKeyRepo.Revoke(actor.UserID, id)
+}
+
+// AuthenticateAPIKey はミドルウェアから呼ばれて、キーの持ち主とスコープを返すのだ
+func (s *apiKeyService) AuthenticateAPIKey(key string) (*model.APIKeyPrincipal, error) {
+	apiKey, err := s.apiKeyRepo.FindActiveByHash(util.HashToken(key))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+
+	// 最後に使った日時が書けなくても、リクエスト自体は通してあげるのだ
+	if err := s.apiKeyRepo.TouchLastUsed(apiKey.APIKeyID); err != nil {
+		log.Printf("failed update last_used_at of api key %d: %v", apiKey.APIKeyID, err)
+	}
+
+	return &model.APIKeyPrincipal{
+		UserID:   apiKey.UserID,
+		UserName: apiKey.User.UserName,
+		Role:     apiKey.User.UserRole.RoleName,
+		Scopes:   decodeScopes(apiKey.Scopes),
+	}, nil
+}
+
+func toAPIKeyResponse(key *entity.APIKey) model.APIKeyResponse {
+	return model.APIKeyResponse{
+		APIKeyID:   key.APIKeyID,
+		Name:       key.Name,
+		KeyPrefix:  key.KeyPrefix,
+		Scopes:     decodeScopes(key.Scopes),
+		CreatedAt:  key.CreatedAt,
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		RevokedAt:  key.RevokedAt,
+	}
+}
+
+// decodeScopes はjsonbのスコープを読むのだ。壊れていたら何もできないキーとして扱うのだ
+func decodeScopes(raw []byte) []string {
+	scopes := []string{}
+	if err := json.Unmarshal(raw, &scopes); err != nil {
+		return []string{}
+	}
+	return scopes
+}
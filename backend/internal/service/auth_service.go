@@ -3,62 +3,369 @@ package service
 
 import (
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/saku-730/web-specimen/backend/config"
+	"github.com/saku-730/web-specimen/backend/internal/entity"
 	"github.com/saku-730/web-specimen/backend/internal/model"
 	"github.com/saku-730/web-specimen/backend/internal/repository"
 	"github.com/saku-730/web-specimen/backend/internal/util"
+	"gorm.io/gorm"
 )
 
 var ErrInvalidCredentials = errors.New("invalid credentials")
 
+// ErrInvalidRefreshToken は知らない・期限切れ・無効にされたリフレッシュトークンの時のエラーなのだ
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+// ErrRefreshTokenReused は使用済みのリフレッシュトークンがもう一度使われた時のエラーなのだ
+// 盗まれたかもしれないので、同じfamilyのトークンは全部無効にしてあるのだ
+var ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+
+// ErrLoginLocked は失敗が続いたので、しばらくログインを試せない時のエラーなのだ
+var ErrLoginLocked = errors.New("too many failed login attempts")
+
+// ErrInvalidChallenge は2段階目のchallenge_tokenが使えない時のエラーなのだ
+var ErrInvalidChallenge = errors.New("invalid or expired login challenge")
+
+// purposeLoginChallenge はパスワードは合っていて、2段階目を待っているトークンの用途なのだ
+const purposeLoginChallenge = "login_challenge"
+
+// loginChallengeTTL は2段階目のコードを入れるまでに待つ時間なのだ
+const loginChallengeTTL = 5 * time.Minute
+
+// accountFailureWindow はアカウントの失敗を数える期間なのだ。これより古い失敗は忘れるのだ
+const accountFailureWindow = 24 * time.Hour
+
+// LoginLockedError はあとどれだけ待てばログインを試せるかを持っているのだ
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return fmt.Sprintf("%s: retry after %s", ErrLoginLocked.Error(), e.RetryAfter.Round(time.Second))
+}
+
+func (e *LoginLockedError) Is(target error) bool {
+	return target == ErrLoginLocked
+}
+
 type AuthService interface {
-	Login(email, password string) (string, error)
+	Login(email, password string, client *model.ClientInfo) (*model.LoginResponse, error)
+	Refresh(refreshToken string) (*model.LoginResponse, error)
+	Logout(userID uint, accessJTI string, accessExpiresAt time.Time, req *model.LogoutRequest) error
+	IsAccessTokenRevoked(jti string) (bool, error)
+	IssueLoginTokens(user *entity.User) (*model.LoginResponse, error)
+	IssueLoginOrChallenge(user *entity.User) (*model.LoginResponse, error)
+	VerifyTwoFactor(challengeToken, code string, client *model.ClientInfo) (*model.LoginResponse, error)
 }
 
 type authService struct {
-	userRepo  repository.UserRepository
-	jwtSecret []byte
+	userRepo        repository.UserRepository
+	tokenRepo       repository.TokenRepository
+	twoFactor       TwoFactorService
+	jwtSecret       []byte
+	challengeSecret []byte
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+
+	// ログインの失敗が続いた時にロックするのだ
+	throttle *loginThrottle
 }
 
-func NewAuthService(userRepo repository.UserRepository, cfg *configs.Config) AuthService {
+func NewAuthService(userRepo repository.UserRepository, tokenRepo repository.TokenRepository, loginAuditRepo repository.LoginAuditRepository, twoFactor TwoFactorService, cfg *configs.Config) AuthService {
 	return &authService{
 		userRepo:  userRepo,
+		tokenRepo: tokenRepo,
+		twoFactor: twoFactor,
 		jwtSecret: []byte(cfg.JWTSecret), // get secret key from cfg
+		// challenge_tokenをアクセストークンとして使えないように、鍵を分けるのだ
+		challengeSecret: []byte("login-challenge:" + cfg.JWTSecret),
+		accessTokenTTL:  time.Duration(cfg.AccessTokenTTLMinutes) * time.Minute,
+		refreshTokenTTL: time.Duration(cfg.RefreshTokenTTLDays) * 24 * time.Hour,
+
+		throttle: newLoginThrottle(loginAuditRepo, cfg),
 	}
 }
 
-func (s *authService) Login(email, password string) (string, error) {
+func (s *authService) Login(email, password string, client *model.ClientInfo) (*model.LoginResponse, error) {
+	mailAddress := strings.ToLower(strings.TrimSpace(email))
+
+	// 0. 失敗が続いているアカウントやIPアドレスからは、パスワードを確かめる前に断るのだ
+	// 試みは先に失敗として記録しておいて、結果が分かったら書き直すのだ
+	attempt, retryAfter, err := s.throttle.begin(nil, mailAddress, client)
+	if err != nil {
+		return nil, err
+	}
+	if retryAfter > 0 {
+		return nil, &LoginLockedError{RetryAfter: retryAfter}
+	}
+
 	// 1. Repositoryを使ってEntityを取得
 	user, err := s.userRepo.FindByEmail(email)
 	if err != nil {
-		return "", ErrInvalidCredentials
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			s.throttle.abandon(attempt)
+			return nil, err
+		}
+		s.throttle.finish(attempt, nil, model.LoginEventFailure, "unknown_email")
+		return nil, ErrInvalidCredentials
 	}
 
 	// 2. utilを使ってパスワードを検証
-	if !util.CheckPasswordHash(password, *user.Password) {
+	if user.Password == nil || !util.CheckPasswordHash(password, *user.Password) {
 		// パスワードが一致しない場合
-		return "", ErrInvalidCredentials
+		s.throttle.finish(attempt, &user.UserID, model.LoginEventFailure, "wrong_password")
+		return nil, ErrInvalidCredentials
+	}
+
+	// 無効にされたユーザーには、パスワードが合っている時だけそれを教えるのだ
+	if user.DeactivatedAt != nil {
+		s.throttle.finish(attempt, &user.UserID, model.LoginEventFailure, "deactivated")
+		return nil, ErrAccountDeactivated
+	}
+
+	// 3. 2段階認証が有効なら、まだトークンは出さないでコードを待つのだ
+	if user.TOTPEnabledAt != nil {
+		s.throttle.finish(attempt, &user.UserID, model.LoginEventChallenge, "")
+		return s.issueChallenge(user)
+	}
+
+	// 4. 認証成功！新しいfamilyでトークンを発行する
+	s.throttle.finish(attempt, &user.UserID, model.LoginEventSuccess, "")
+	return s.IssueLoginTokens(user)
+}
+
+// VerifyTwoFactor はchallenge_tokenと2段階目のコードを確かめて、やっとトークンを発行するのだ
+// コードの間違いもパスワードの間違いと同じように数えて、続いたらロックするのだ
+func (s *authService) VerifyTwoFactor(challengeToken, code string, client *model.ClientInfo) (*model.LoginResponse, error) {
+	claims, err := util.ParsePurposeToken(s.challengeSecret, challengeToken, purposeLoginChallenge)
+	if err != nil {
+		return nil, ErrInvalidChallenge
 	}
+	userID, err := strconv.ParseUint(claims.Subject, 10, 32)
+	if err != nil {
+		return nil, ErrInvalidChallenge
+	}
+	user, err := s.userRepo.FindByID(uint(userID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidChallenge
+		}
+		return nil, err
+	}
+	// パスワードが変わったり2段階認証が外されたりしたら、前のchallengeは使えないのだ
+	if user.TOTPEnabledAt == nil || user.DeactivatedAt != nil || claims.Fingerprint != passwordFingerprint(user) {
+		return nil, ErrInvalidChallenge
+	}
+
+	if _, err := verifyThrottled(s.throttle, s.twoFactor, user, code, client); err != nil {
+		return nil, err
+	}
+	return s.IssueLoginTokens(user)
+}
 
-	// 3. 認証成功！JWTのClaimsを作成
-	expirationTime := time.Now().Add(24 * time.Hour)
+// verifyThrottled は2段階目のコードを、失敗の回数を数えながら確かめるのだ
+// ログインの時もログインした後も同じ回数を使うので、どこから試しても何度も当てずっぽうはできないのだ
+func verifyThrottled(throttle *loginThrottle, twoFactor TwoFactorService, user *entity.User, code string, client *model.ClientInfo) (string, error) {
+	mailAddress := ""
+	if user.MailAddress != nil {
+		mailAddress = strings.ToLower(*user.MailAddress)
+	}
+	attempt, retryAfter, err := throttle.begin(&user.UserID, mailAddress, client)
+	if err != nil {
+		return "", err
+	}
+	if retryAfter > 0 {
+		return "", &LoginLockedError{RetryAfter: retryAfter}
+	}
+
+	method, err := twoFactor.VerifyCode(user, code)
+	if err != nil {
+		if errors.Is(err, ErrInvalidTwoFactorCode) {
+			throttle.finish(attempt, &user.UserID, model.LoginEventFailure, "wrong_two_factor_code")
+		} else {
+			throttle.abandon(attempt)
+		}
+		return "", err
+	}
+	throttle.finish(attempt, &user.UserID, model.LoginEventSuccess, method)
+	return method, nil
+}
+
+// issueChallenge は2段階目を待っていることを示す、短い間だけ使えるトークンを返すのだ
+func (s *authService) issueChallenge(user *entity.User) (*model.LoginResponse, error) {
+	token, err := util.SignPurposeToken(s.challengeSecret, &util.PurposeClaims{
+		Purpose:     purposeLoginChallenge,
+		Fingerprint: passwordFingerprint(user),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatUint(uint64(user.UserID), 10),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(loginChallengeTTL)),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.LoginResponse{
+		ExpiresIn:         int(loginChallengeTTL.Seconds()),
+		TwoFactorRequired: true,
+		ChallengeToken:    token,
+	}, nil
+}
+
+// IssueLoginTokens は本人確認が済んだユーザーに、新しいfamilyでトークンを発行するのだ
+// パスワード以外のログイン(OpenID Connectなど)からも使うのだ
+func (s *authService) IssueLoginTokens(user *entity.User) (*model.LoginResponse, error) {
+	familyID, err := util.GenerateRandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	return s.issueTokens(user, familyID)
+}
+
+// IssueLoginOrChallenge はパスワード以外で1段階目が済んだユーザーに、2段階認証が有効ならchallengeを返すのだ
+// OpenID Connectからのログインでも、2段階目を飛ばせないようにするのだ
+func (s *authService) IssueLoginOrChallenge(user *entity.User) (*model.LoginResponse, error) {
+	if user.TOTPEnabledAt != nil {
+		return s.issueChallenge(user)
+	}
+	return s.IssueLoginTokens(user)
+}
+
+// Refresh はリフレッシュトークンを使用済みにして、同じfamilyで新しいトークンの組を発行するのだ
+func (s *authService) Refresh(refreshToken string) (*model.LoginResponse, error) {
+	stored, err := s.tokenRepo.FindRefreshTokenByHash(util.HashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+	if stored.RevokedAt != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// 使用済みのトークンがもう一度来たら、誰かが盗んで使っているかもしれないのだ
+	if stored.UsedAt != nil {
+		if err := s.tokenRepo.RevokeFamily(stored.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+	if time.Now().After(stored.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	marked, err := s.tokenRepo.MarkRefreshTokenUsed(stored.RefreshTokenID)
+	if err != nil {
+		return nil, err
+	}
+	if !marked {
+		// 同時に同じトークンが使われて、向こうが先に使用済みにしたのだ
+		if err := s.tokenRepo.RevokeFamily(stored.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	// 役割が変わっているかもしれないので、ユーザーは取り直すのだ
+	user, err := s.userRepo.FindByID(stored.UserID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+	if user.DeactivatedAt != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	return s.issueTokens(user, stored.FamilyID)
+}
+
+// Logout は今のアクセストークンを無効にして、リフレッシュトークンのfamilyも無効にするのだ
+// 他人のリフレッシュトークンを送られても、そのfamilyは消さないのだ
+func (s *authService) Logout(userID uint, accessJTI string, accessExpiresAt time.Time, req *model.LogoutRequest) error {
+	if err := s.tokenRepo.RevokeAccessToken(accessJTI, &userID, accessExpiresAt); err != nil {
+		return err
+	}
+
+	if req.AllSessions {
+		return s.tokenRepo.RevokeUserTokens(userID)
+	}
+
+	if req.RefreshToken == "" {
+		return nil
+	}
+	stored, err := s.tokenRepo.FindRefreshTokenByHash(util.HashToken(req.RefreshToken))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if stored.UserID != userID {
+		return nil
+	}
+	return s.tokenRepo.RevokeFamily(stored.FamilyID)
+}
+
+// IsAccessTokenRevoked はミドルウェアから、jtiが無効にされていないかを聞かれるのだ
+func (s *authService) IsAccessTokenRevoked(jti string) (bool, error) {
+	return s.tokenRepo.IsAccessTokenRevoked(jti)
+}
+
+// issueTokens はアクセストークン(JWT)とリフレッシュトークンを1組発行するのだ
+func (s *authService) issueTokens(user *entity.User, familyID string) (*model.LoginResponse, error) {
+	jti, err := util.GenerateRandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	// 1. JWTのClaimsを作成
+	now := time.Now()
 	claims := &model.Claims{
 		UserID:   int(user.UserID),
 		UserName: user.UserName,
+		Role:     user.UserRole.RoleName,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
+			ID:        jti,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.accessTokenTTL)),
 		},
 	}
 
-	// 4. トークンを生成して返す
+	// 2. トークンを生成する
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	tokenString, err := token.SignedString(s.jwtSecret)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	// 3. リフレッシュトークンはハッシュだけを保存するのだ
+	refreshToken, err := util.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	stored := &entity.RefreshToken{
+		UserID:    user.UserID,
+		TokenHash: util.HashToken(refreshToken),
+		FamilyID:  familyID,
+		AccessJTI: &jti,
+		ExpiresAt: now.Add(s.refreshTokenTTL),
+	}
+	if err := s.tokenRepo.CreateRefreshToken(stored); err != nil {
+		return nil, err
 	}
 
-	return tokenString, nil
+	return &model.LoginResponse{
+		Token:        tokenString,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(s.accessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+	}, nil
 }
@@ -0,0 +1,284 @@
+// internal/service/entry_template_service.go
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/saku-730/web-specimen/backend/internal/repository"
+	"gorm.io/gorm"
+)
+
+// ErrTemplateNameTaken は同じ名前のテンプレートを自分がもう持っている時のエラーなのだ
+var ErrTemplateNameTaken = errors.New("template name is already used")
+
+type EntryTemplateService interface {
+	ListTemplates(actor *model.Actor) ([]model.EntryTemplateResponse, error)
+	GetTemplate(actor *model.Actor, id uint) (*model.EntryTemplateResponse, error)
+	CreateTemplate(actor *model.Actor, req *model.EntryTemplateRequest) (*model.EntryTemplateResponse, error)
+	UpdateTemplate(actor *model.Actor, id uint, req *model.EntryTemplateRequest) (*model.EntryTemplateResponse, error)
+	DeleteTemplate(actor *model.Actor, id uint) error
+	TemplateDefaultValues(actor *model.Actor, id uint) (*model.DefaultValues, error)
+}
+
+type entryTemplateService struct {
+	templateRepo      repository.EntryTemplateRepository
+	defaultsRepo      repository.UserDefaultsRepository
+	projectMemberRepo repository.ProjectMemberRepository
+	projectRepo       repository.ProjectRepository
+}
+
+func NewEntryTemplateService(
+	templateRepo repository.EntryTemplateRepository,
+	defaultsRepo repository.UserDefaultsRepository,
+	projectMemberRepo repository.ProjectMemberRepository,
+	projectRepo repository.ProjectRepository,
+) EntryTemplateService {
+	return &entryTemplateService{
+		templateRepo:      templateRepo,
+		defaultsRepo:      defaultsRepo,
+		projectMemberRepo: projectMemberRepo,
+		projectRepo:       projectRepo,
+	}
+}
+
+// ListTemplates は自分のテンプレートと、参加中のプロジェクトに共有されたテンプレートを返すのだ
+func (s *entryTemplateService) ListTemplates(actor *model.Actor) ([]model.EntryTemplateResponse, error) {
+	projectIDs, err := s.activeProjectIDs(actor, "")
+	if err != nil {
+		return nil, err
+	}
+	templates, err := s.templateRepo.FindVisible(actor.UserID, projectIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []model.EntryTemplateResponse{}
+	for i := range templates {
+		response, err := toEntryTemplateResponse(&templates[i])
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, *response)
+	}
+	return results, nil
+}
+
+func (s *entryTemplateService) GetTemplate(actor *model.Actor, id uint) (*model.EntryTemplateResponse, error) {
+	template, err := s.findVisible(actor, id)
+	if err != nil {
+		return nil, err
+	}
+	return toEntryTemplateResponse(template)
+}
+
+// CreateTemplate はテンプレートを作るのだ。中のIDが全部あるかを先に確かめるのだ
+func (s *entryTemplateService) CreateTemplate(actor *model.Actor, req *model.EntryTemplateRequest) (*model.EntryTemplateResponse, error) {
+	if err := s.validate(actor, actor.UserID, 0, req); err != nil {
+		return nil, err
+	}
+	values, err := json.Marshal(req.Values)
+	if err != nil {
+		return nil, err
+	}
+
+	template := &entity.EntryTemplate{
+		UserID:         actor.UserID,
+		ProjectID:      req.ProjectID,
+		TemplateName:   req.TemplateName,
+		TemplateValues: values,
+	}
+	if err := s.templateRepo.Create(template); err != nil {
+		return nil, err
+	}
+	return toEntryTemplateResponse(template)
+}
+
+// UpdateTemplate はテンプレートを丸ごと置き換えるのだ。書き換えられるのは作った人だけなのだ
+func (s *entryTemplateService) UpdateTemplate(actor *model.Actor, id uint, req *model.EntryTemplateRequest) (*model.EntryTemplateResponse, error) {
+	template, err := s.findOwned(actor, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.validate(actor, template.UserID, template.TemplateID, req); err != nil {
+		return nil, err
+	}
+	values, err := json.Marshal(req.Values)
+	if err != nil {
+		return nil, err
+	}
+
+	template.ProjectID = req.ProjectID
+	template.TemplateName = req.TemplateName
+	template.TemplateValues = values
+	if err := s.templateRepo.Update(template); err != nil {
+		return nil, err
+	}
+	return toEntryTemplateResponse(template)
+}
+
+func (s *entryTemplateService) DeleteTemplate(actor *model.Actor, id uint) error {
+	template, err := s.findOwned(actor, id)
+	if err != nil {
+		return err
+	}
+	return s.templateRepo.Delete(template.TemplateID)
+}
+
+// TemplateDefaultValues はテンプレートから作成ページのデフォルト値を組み立てるのだ
+// 名前はIDから今の名前を引くので、テンプレートを作った後に名前が変わっても大丈夫なのだ
+func (s *entryTemplateService) TemplateDefaultValues(actor *model.Actor, id uint) (*model.DefaultValues, error) {
+	template, err := s.findVisible(actor, id)
+	if err != nil {
+		return nil, err
+	}
+	var values model.DefaultValuesUpdate
+	if err := json.Unmarshal(template.TemplateValues, &values); err != nil {
+		return nil, err
+	}
+
+	defaults := defaultsFromUpdate(int(actor.UserID), &values)
+	// 後から消されたIDは、名前が空になるだけにするのだ
+	if _, err := s.defaultsRepo.ResolveNames(defaults); err != nil {
+		return nil, err
+	}
+	return toDefaultValues(defaults), nil
+}
+
+// validate は名前がかぶっていないか、共有先のプロジェクトと作成ページに入れるプロジェクトに記録できるか、中のIDが全部あるかを確かめるのだ
+func (s *entryTemplateService) validate(actor *model.Actor, ownerID uint, selfID uint, req *model.EntryTemplateRequest) error {
+	existing, err := s.templateRepo.FindByName(ownerID, req.TemplateName)
+	if err == nil && existing.TemplateID != selfID {
+		return ErrTemplateNameTaken
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	if req.ProjectID != nil {
+		if err := s.authorizeProject(actor, *req.ProjectID); err != nil {
+			return err
+		}
+	}
+	if req.Values.ProjectID != nil {
+		if err := s.authorizeProject(actor, uint(*req.Values.ProjectID)); err != nil {
+			return err
+		}
+	}
+
+	missing, err := s.defaultsRepo.ResolveNames(defaultsFromUpdate(int(ownerID), &req.Values))
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: not found %s", ErrInvalidDefaults, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// authorizeProject はそのプロジェクトにoccurrenceを記録できるかを確かめるのだ
+// アーカイブしたプロジェクトには、管理者でも記録できないのだ。無いプロジェクトは後でIDの確認に引っかかるのだ
+func (s *entryTemplateService) authorizeProject(actor *model.Actor, projectID uint) error {
+	project, err := s.projectRepo.FindByID(projectID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if project != nil && project.ArchivedAt != nil {
+		return &ProjectArchivedError{ProjectID: projectID}
+	}
+	if bypassProjectScope(actor) {
+		return nil
+	}
+
+	projectIDs, err := s.activeProjectIDs(actor, model.PermissionCreateOccurrence)
+	if err != nil {
+		return err
+	}
+	if !containsID(projectIDs, projectID) {
+		return &ProjectForbiddenError{ProjectID: projectID, Permission: model.PermissionCreateOccurrence}
+	}
+	return nil
+}
+
+// findVisible は自分のテンプレートか、参加中のプロジェクトに共有されたテンプレートだけを返すのだ
+func (s *entryTemplateService) findVisible(actor *model.Actor, id uint) (*entity.EntryTemplate, error) {
+	template, err := s.templateRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if template.UserID == actor.UserID || bypassProjectScope(actor) {
+		return template, nil
+	}
+	if template.ProjectID != nil {
+		projectIDs, err := s.activeProjectIDs(actor, "")
+		if err != nil {
+			return nil, err
+		}
+		if containsID(projectIDs, *template.ProjectID) {
+			return template, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: template %d is not shared with you", ErrForbidden, id)
+}
+
+// findOwned は自分のテンプレートだけを返すのだ。管理者は誰のでも触れるのだ
+func (s *entryTemplateService) findOwned(actor *model.Actor, id uint) (*entity.EntryTemplate, error) {
+	template, err := s.templateRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if template.UserID != actor.UserID && !bypassProjectScope(actor) {
+		return nil, fmt.Errorf("%w: only the owner can change template %d", ErrForbidden, id)
+	}
+	return template, nil
+}
+
+// activeProjectIDs は参加中のプロジェクトのIDを返すのだ
+// permission が空でなければ、その権限がある役割のプロジェクトだけにするのだ
+func (s *entryTemplateService) activeProjectIDs(actor *model.Actor, permission model.Permission) ([]uint, error) {
+	members, err := s.projectMemberRepo.FindActiveByUserID(actor.UserID)
+	if err != nil {
+		return nil, err
+	}
+	var ids []uint
+	for _, member := range members {
+		if member.ProjectID == nil {
+			continue
+		}
+		if permission != "" && !model.HasProjectPermission(member.ProjectRole, permission) {
+			continue
+		}
+		ids = append(ids, *member.ProjectID)
+	}
+	return ids, nil
+}
+
+func containsID(ids []uint, id uint) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+func toEntryTemplateResponse(template *entity.EntryTemplate) (*model.EntryTemplateResponse, error) {
+	response := &model.EntryTemplateResponse{
+		TemplateID:   template.TemplateID,
+		TemplateName: template.TemplateName,
+		UserID:       template.UserID,
+		ProjectID:    template.ProjectID,
+		CreatedAt:    template.CreatedAt,
+		UpdatedAt:    template.UpdatedAt,
+	}
+	if len(template.TemplateValues) > 0 {
+		if err := json.Unmarshal(template.TemplateValues, &response.Values); err != nil {
+			return nil, err
+		}
+	}
+	return response, nil
+}
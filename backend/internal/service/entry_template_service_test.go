@@ -0,0 +1,129 @@
+// internal/service/entry_template_service_test.go
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+func intPtr(v int) *int { return &v }
+
+func TestEntryTemplateVisibility(t *testing.T) {
+	member := &model.Actor{UserID: 1, Role: model.RoleCollector}
+	memberships := []entity.ProjectMember{
+		{ProjectID: uintPtr(3), ProjectRole: model.ProjectRoleObserver},
+	}
+
+	t.Run("参加中のプロジェクトに共有されたテンプレートは見られるのだ", func(t *testing.T) {
+		templateRepo := new(mockEntryTemplateRepository)
+		templateRepo.On("FindByID", uint(7)).Return(&entity.EntryTemplate{TemplateID: 7, UserID: 2, ProjectID: uintPtr(3)}, nil)
+		memberRepo := new(mockProjectMemberRepository)
+		memberRepo.On("FindActiveByUserID", uint(1)).Return(memberships, nil)
+		s := &entryTemplateService{templateRepo: templateRepo, projectMemberRepo: memberRepo}
+
+		template, err := s.GetTemplate(member, 7)
+
+		assert.NoError(t, err)
+		assert.Equal(t, uint(7), template.TemplateID)
+	})
+
+	t.Run("参加していないプロジェクトや、共有されていない他の人のテンプレートは見られないのだ", func(t *testing.T) {
+		for _, template := range []*entity.EntryTemplate{
+			{TemplateID: 7, UserID: 2, ProjectID: uintPtr(4)},
+			{TemplateID: 7, UserID: 2},
+		} {
+			templateRepo := new(mockEntryTemplateRepository)
+			templateRepo.On("FindByID", uint(7)).Return(template, nil)
+			memberRepo := new(mockProjectMemberRepository)
+			memberRepo.On("FindActiveByUserID", uint(1)).Return(memberships, nil)
+			s := &entryTemplateService{templateRepo: templateRepo, projectMemberRepo: memberRepo}
+
+			_, err := s.GetTemplate(member, 7)
+
+			assert.True(t, errors.Is(err, ErrForbidden))
+		}
+	})
+
+	t.Run("共有されていても、書き換えられるのは作った人だけなのだ", func(t *testing.T) {
+		templateRepo := new(mockEntryTemplateRepository)
+		templateRepo.On("FindByID", uint(7)).Return(&entity.EntryTemplate{TemplateID: 7, UserID: 2, ProjectID: uintPtr(3)}, nil)
+		s := &entryTemplateService{templateRepo: templateRepo}
+
+		assert.True(t, errors.Is(s.DeleteTemplate(member, 7), ErrForbidden))
+		templateRepo.AssertNotCalled(t, "Delete", mock.Anything)
+	})
+
+	t.Run("一覧には参加中のプロジェクトの分も入れるのだ", func(t *testing.T) {
+		templateRepo := new(mockEntryTemplateRepository)
+		templateRepo.On("FindVisible", uint(1), []uint{3}).Return([]entity.EntryTemplate{{TemplateID: 7, UserID: 2, ProjectID: uintPtr(3)}}, nil)
+		memberRepo := new(mockProjectMemberRepository)
+		memberRepo.On("FindActiveByUserID", uint(1)).Return(memberships, nil)
+		s := &entryTemplateService{templateRepo: templateRepo, projectMemberRepo: memberRepo}
+
+		templates, err := s.ListTemplates(member)
+
+		assert.NoError(t, err)
+		assert.Len(t, templates, 1)
+		templateRepo.AssertExpectations(t)
+	})
+}
+
+func TestCreateTemplateProjects(t *testing.T) {
+	collector := &model.Actor{UserID: 1, Role: model.RoleCollector}
+	newService := func(projects map[uint]*entity.Project) (*entryTemplateService, *mockEntryTemplateRepository) {
+		templateRepo := new(mockEntryTemplateRepository)
+		templateRepo.On("FindByName", mock.Anything, mock.Anything).Return(nil, gorm.ErrRecordNotFound)
+		templateRepo.On("Create", mock.Anything).Return(nil)
+		projectRepo := new(mockProjectRepository)
+		for id, project := range projects {
+			projectRepo.On("FindByID", id).Return(project, nil)
+		}
+		memberRepo := new(mockProjectMemberRepository)
+		memberRepo.On("FindActiveByUserID", uint(1)).Return([]entity.ProjectMember{
+			{ProjectID: uintPtr(3), ProjectRole: model.ProjectRoleContributor},
+			{ProjectID: uintPtr(5), ProjectRole: model.ProjectRoleObserver},
+		}, nil)
+		defaultsRepo := new(mockUserDefaultsRepository)
+		defaultsRepo.On("ResolveNames", mock.Anything).Return([]string{}, nil)
+		return &entryTemplateService{templateRepo: templateRepo, defaultsRepo: defaultsRepo, projectMemberRepo: memberRepo, projectRepo: projectRepo}, templateRepo
+	}
+
+	t.Run("記録できるプロジェクトなら作れるのだ", func(t *testing.T) {
+		s, templateRepo := newService(map[uint]*entity.Project{3: {ProjectID: 3}})
+
+		_, err := s.CreateTemplate(collector, &model.EntryTemplateRequest{TemplateName: "pitfall", Values: model.DefaultValuesUpdate{ProjectID: intPtr(3)}})
+
+		assert.NoError(t, err)
+		templateRepo.AssertCalled(t, "Create", "pitfall")
+	})
+
+	t.Run("作成ページに入れるプロジェクトも、記録できるか確かめるのだ", func(t *testing.T) {
+		// 4には入っていないし、5では見るだけなのだ
+		for _, projectID := range []int{4, 5} {
+			s, templateRepo := newService(map[uint]*entity.Project{uint(projectID): {ProjectID: uint(projectID)}})
+
+			_, err := s.CreateTemplate(collector, &model.EntryTemplateRequest{TemplateName: "pitfall", Values: model.DefaultValuesUpdate{ProjectID: intPtr(projectID)}})
+
+			var forbidden *ProjectForbiddenError
+			assert.True(t, errors.As(err, &forbidden), "project %d", projectID)
+			templateRepo.AssertNotCalled(t, "Create", mock.Anything)
+		}
+	})
+
+	t.Run("アーカイブしたプロジェクトは管理者でも入れられないのだ", func(t *testing.T) {
+		archivedAt := time.Now()
+		s, templateRepo := newService(map[uint]*entity.Project{3: {ProjectID: 3, ArchivedAt: &archivedAt}})
+
+		_, err := s.CreateTemplate(&model.Actor{UserID: 9, Role: model.RoleAdmin}, &model.EntryTemplateRequest{TemplateName: "pitfall", Values: model.DefaultValuesUpdate{ProjectID: intPtr(3)}})
+
+		assert.True(t, errors.Is(err, ErrProjectArchived))
+		templateRepo.AssertNotCalled(t, "Create", mock.Anything)
+	})
+}
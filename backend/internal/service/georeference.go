@@ -0,0 +1,79 @@
+// internal/service/georeference.go
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+)
+
+// ErrInvalidGeoreference は座標の不確かさや決め方の情報が正しくない時のエラーなのだ
+var ErrInvalidGeoreference = errors.New("invalid georeference")
+
+// georeferenceSources は georeference_source に入れていい値なのだ。DBのCHECKと同じにしておくのだ
+var georeferenceSources = []string{"gps", "map", "gazetteer"}
+
+// hasGeoreference は座標の決め方の情報が何か一つでも入っているかを返すのだ
+func hasGeoreference(georef *model.Georeference) bool {
+	return georef.CoordinateUncertaintyInMeters != nil ||
+		blankToNil(georef.GeoreferenceSource) != nil ||
+		blankToNil(georef.GeodeticDatum) != nil ||
+		blankToNil(georef.GeoreferencedBy) != nil ||
+		blankToNil(georef.GeoreferencedDate) != nil
+}
+
+// applyGeoreference はリクエストの georeference を確かめてplaceに入れるのだ
+// PATCHはbindingを通らないので、ここでもう一度確かめるのだ
+func applyGeoreference(place *entity.Place, georef *model.Georeference) error {
+	if u := georef.CoordinateUncertaintyInMeters; u != nil {
+		if *u < 0 || math.IsNaN(*u) || math.IsInf(*u, 0) {
+			return fmt.Errorf("%w: coordinate_uncertainty_in_meters must not be negative", ErrInvalidGeoreference)
+		}
+	}
+	source := blankToNil(georef.GeoreferenceSource)
+	if source != nil && !containsString(georeferenceSources, *source) {
+		return fmt.Errorf("%w: georeference_source must be one of gps, map, gazetteer", ErrInvalidGeoreference)
+	}
+	var date *time.Time
+	if value := blankToNil(georef.GeoreferencedDate); value != nil {
+		parsed, err := time.Parse(dateLayout, *value)
+		if err != nil {
+			return fmt.Errorf("%w: georeferenced_date must be YYYY-MM-DD", ErrInvalidGeoreference)
+		}
+		date = &parsed
+	}
+
+	place.Accuracy = georef.CoordinateUncertaintyInMeters
+	place.GeoreferenceSource = source
+	place.GeodeticDatum = blankToNil(georef.GeodeticDatum)
+	place.GeoreferencedBy = blankToNil(georef.GeoreferencedBy)
+	place.GeoreferencedDate = date
+	return nil
+}
+
+// georeferenceFromPlace はplaceの georeference をレスポンスの形にするのだ
+func georeferenceFromPlace(place *entity.Place) model.Georeference {
+	if place == nil {
+		return model.Georeference{}
+	}
+	return model.Georeference{
+		CoordinateUncertaintyInMeters: place.Accuracy,
+		GeoreferenceSource:            place.GeoreferenceSource,
+		GeodeticDatum:                 place.GeodeticDatum,
+		GeoreferencedBy:               place.GeoreferencedBy,
+		GeoreferencedDate:             formatDate(place.GeoreferencedDate),
+	}
+}
+
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
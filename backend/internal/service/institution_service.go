@@ -0,0 +1,241 @@
+// internal/service/institution_service.go
+package service
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/saku-730/web-specimen/backend/internal/repository"
+	"gorm.io/gorm"
+)
+
+// ErrInstitutionCodeTaken は使われている機関に同じコードがもうある時のエラーなのだ
+var ErrInstitutionCodeTaken = errors.New("institution code is already used")
+
+// ErrGRSciCollIDTaken は同じ GRSciColl のIDを持つ機関がもうある時のエラーなのだ
+var ErrGRSciCollIDTaken = errors.New("grscicoll_id is already registered")
+
+// ErrInactiveInstitution は標本の institution_id が無い機関か、無効にした機関の時のエラーなのだ
+var ErrInactiveInstitution = errors.New("institution does not exist or is deactivated")
+
+type InstitutionService interface {
+	ListInstitutions(query *model.InstitutionQuery) ([]model.InstitutionInfo, error)
+	GetInstitution(id uint) (*model.InstitutionInfo, error)
+	CreateInstitution(req *model.InstitutionRequest) (*model.InstitutionInfo, error)
+	UpdateInstitution(id uint, req *model.InstitutionRequest) (*model.InstitutionInfo, error)
+	DeactivateInstitution(id uint) error
+	ReactivateInstitution(id uint) (*model.InstitutionInfo, error)
+}
+
+type institutionService struct {
+	institutionRepo repository.InstitutionRepository
+}
+
+func NewInstitutionService(institutionRepo repository.InstitutionRepository) InstitutionService {
+	return &institutionService{institutionRepo: institutionRepo}
+}
+
+func (s *institutionService) ListInstitutions(query *model.InstitutionQuery) ([]model.InstitutionInfo, error) {
+	institutions, err := s.institutionRepo.FindAll(query.IncludeInactive)
+	if err != nil {
+		return nil, err
+	}
+	response := []model.InstitutionInfo{}
+	for i := range institutions {
+		response = append(response, *toInstitutionInfo(&institutions[i]))
+	}
+	return response, nil
+}
+
+// GetInstitution は機関を1つ、入っている標本の数と一緒に返すのだ
+func (s *institutionService) GetInstitution(id uint) (*model.InstitutionInfo, error) {
+	institution, err := s.institutionRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	count, err := s.institutionRepo.CountSpecimens(institution.InstitutionID)
+	if err != nil {
+		return nil, err
+	}
+	info := toInstitutionInfo(institution)
+	info.SpecimenCount = &count
+	return info, nil
+}
+
+func (s *institutionService) CreateInstitution(req *model.InstitutionRequest) (*model.InstitutionInfo, error) {
+	institution := &entity.InstitutionIDCode{}
+	applyInstitutionRequest(institution, req)
+	if err := s.validate(institution); err != nil {
+		return nil, err
+	}
+	if err := s.institutionRepo.Create(institution); err != nil {
+		return nil, err
+	}
+	return s.GetInstitution(institution.InstitutionID)
+}
+
+// UpdateInstitution は機関の情報を全部書き換えるのだ。標本に付いている institution_id はそのままなのだ
+func (s *institutionService) UpdateInstitution(id uint, req *model.InstitutionRequest) (*model.InstitutionInfo, error) {
+	institution, err := s.institutionRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	applyInstitutionRequest(institution, req)
+	if err := s.validate(institution); err != nil {
+		return nil, err
+	}
+	if err := s.institutionRepo.Update(institution); err != nil {
+		return nil, err
+	}
+	return s.GetInstitution(institution.InstitutionID)
+}
+
+// DeactivateInstitution は機関を消さないで、新しい標本に付けられないようにするのだ
+// 今までの標本にはそのまま出るのだ
+func (s *institutionService) DeactivateInstitution(id uint) error {
+	institution, err := s.institutionRepo.FindByID(id)
+	if err != nil {
+		return err
+	}
+	if institution.DeactivatedAt != nil {
+		return nil
+	}
+	now := time.Now()
+	return s.institutionRepo.SetDeactivatedAt(institution.InstitutionID, &now)
+}
+
+// ReactivateInstitution は無効にした機関をまた使えるようにするのだ
+// その間に同じコードの機関が作られていたら戻せないのだ
+func (s *institutionService) ReactivateInstitution(id uint) (*model.InstitutionInfo, error) {
+	institution, err := s.institutionRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if institution.DeactivatedAt != nil {
+		if err := s.ensureCodeAvailable(institution); err != nil {
+			return nil, err
+		}
+		if err := s.institutionRepo.SetDeactivatedAt(institution.InstitutionID, nil); err != nil {
+			return nil, err
+		}
+	}
+	return s.GetInstitution(institution.InstitutionID)
+}
+
+// validate はコードと GRSciColl のIDが他の機関とかぶっていないかを確かめるのだ
+func (s *institutionService) validate(institution *entity.InstitutionIDCode) error {
+	if err := s.ensureCodeAvailable(institution); err != nil {
+		return err
+	}
+	if institution.GRSciCollID == nil {
+		return nil
+	}
+	existing, err := s.institutionRepo.FindByGRSciCollID(*institution.GRSciCollID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if existing.InstitutionID != institution.InstitutionID {
+		return ErrGRSciCollIDTaken
+	}
+	return nil
+}
+
+func (s *institutionService) ensureCodeAvailable(institution *entity.InstitutionIDCode) error {
+	if institution.InstitutionCode == nil {
+		return nil
+	}
+	existing, err := s.institutionRepo.FindActiveByCode(*institution.InstitutionCode)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if existing.InstitutionID != institution.InstitutionID {
+		return ErrInstitutionCodeTaken
+	}
+	return nil
+}
+
+// applyInstitutionRequest はリクエストの値をentityに入れるのだ。空の文字列はnilにするのだ
+func applyInstitutionRequest(institution *entity.InstitutionIDCode, req *model.InstitutionRequest) {
+	code := strings.TrimSpace(req.InstitutionCode)
+	name := strings.TrimSpace(req.InstitutionName)
+	institution.InstitutionCode = &code
+	institution.InstitutionName = &name
+	institution.Acronym = blankToNil(req.Acronym)
+	institution.Address = blankToNil(req.Address)
+	institution.CountryCode = blankToNil(req.CountryCode)
+	if institution.CountryCode != nil {
+		upper := strings.ToUpper(*institution.CountryCode)
+		institution.CountryCode = &upper
+	}
+	institution.GRSciCollID = blankToNil(req.GRSciCollID)
+	if institution.GRSciCollID != nil {
+		lower := strings.ToLower(*institution.GRSciCollID)
+		institution.GRSciCollID = &lower
+	}
+	institution.IndexHerbariorumCode = blankToNil(req.IndexHerbariorumCode)
+	institution.ContactName = blankToNil(req.ContactName)
+	institution.ContactEmail = blankToNil(req.ContactEmail)
+	institution.URL = blankToNil(req.URL)
+}
+
+func blankToNil(value *string) *string {
+	if value == nil {
+		return nil
+	}
+	trimmed := strings.TrimSpace(*value)
+	if trimmed == "" {
+		return nil
+	}
+	return &trimmed
+}
+
+func toInstitutionInfo(institution *entity.InstitutionIDCode) *model.InstitutionInfo {
+	return &model.InstitutionInfo{
+		InstitutionID:        institution.InstitutionID,
+		InstitutionCode:      institution.InstitutionCode,
+		InstitutionName:      institution.InstitutionName,
+		Acronym:              institution.Acronym,
+		Address:              institution.Address,
+		CountryCode:          institution.CountryCode,
+		GRSciCollID:          institution.GRSciCollID,
+		IndexHerbariorumCode: institution.IndexHerbariorumCode,
+		ContactName:          institution.ContactName,
+		ContactEmail:         institution.ContactEmail,
+		URL:                  institution.URL,
+		DeactivatedAt:        institution.DeactivatedAt,
+	}
+}
+
+// checkInstitutionsActive は標本の institution_id が全部、使われている機関を指しているかを確かめるのだ
+// allowed に入っているIDは、無効にした機関でもいいのだ。更新で元から付いていた機関を外さなくても保存できるようにするのだ
+func checkInstitutionsActive(repo repository.InstitutionRepository, specimens []entity.Specimen, allowed []uint) error {
+	var ids []uint
+	for _, spec := range specimens {
+		if spec.InstitutionID == nil || containsID(allowed, *spec.InstitutionID) || containsID(ids, *spec.InstitutionID) {
+			continue
+		}
+		ids = append(ids, *spec.InstitutionID)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	active, err := repo.FindActiveIDs(ids)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if !containsID(active, id) {
+			return ErrInactiveInstitution
+		}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+// internal/service/institution_service_test.go
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+func TestCheckInstitutionsActive(t *testing.T) {
+	specimens := []entity.Specimen{
+		{InstitutionID: uintPtr(1)},
+		{InstitutionID: uintPtr(2)},
+		{InstitutionID: uintPtr(2)},
+		{InstitutionID: nil},
+	}
+
+	t.Run("全部使われている機関ならいいのだ", func(t *testing.T) {
+		repo := new(mockInstitutionRepository)
+		repo.On("FindActiveIDs", []uint{1, 2}).Return([]uint{1, 2}, nil)
+
+		assert.NoError(t, checkInstitutionsActive(repo, specimens, nil))
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("無効にした機関や無い機関は付けられないのだ", func(t *testing.T) {
+		repo := new(mockInstitutionRepository)
+		repo.On("FindActiveIDs", []uint{1, 2}).Return([]uint{1}, nil)
+
+		assert.True(t, errors.Is(checkInstitutionsActive(repo, specimens, nil), ErrInactiveInstitution))
+	})
+
+	t.Run("元から付いていた機関は、無効になっていてもそのまま保存できるのだ", func(t *testing.T) {
+		repo := new(mockInstitutionRepository)
+		repo.On("FindActiveIDs", []uint{1}).Return([]uint{1}, nil)
+
+		assert.NoError(t, checkInstitutionsActive(repo, specimens, []uint{2}))
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("機関が付いていなければDBは見ないのだ", func(t *testing.T) {
+		repo := new(mockInstitutionRepository)
+
+		assert.NoError(t, checkInstitutionsActive(repo, []entity.Specimen{{}}, nil))
+		repo.AssertNotCalled(t, "FindActiveIDs", mock.Anything)
+	})
+}
+
+func TestInstitutionUniqueness(t *testing.T) {
+	request := func(code string, grscicollID *string) *model.InstitutionRequest {
+		return &model.InstitutionRequest{InstitutionCode: code, InstitutionName: "Kyoto University Museum", GRSciCollID: grscicollID}
+	}
+
+	t.Run("使われている機関と同じコードでは作れないのだ", func(t *testing.T) {
+		repo := new(mockInstitutionRepository)
+		repo.On("FindActiveByCode", "KUM").Return(&entity.InstitutionIDCode{InstitutionID: 7}, nil)
+		s := &institutionService{institutionRepo: repo}
+
+		_, err := s.CreateInstitution(request(" KUM ", nil))
+
+		assert.True(t, errors.Is(err, ErrInstitutionCodeTaken))
+		repo.AssertNotCalled(t, "Create", mock.Anything)
+	})
+
+	t.Run("無効にした機関と同じコードなら作れるのだ", func(t *testing.T) {
+		repo := new(mockInstitutionRepository)
+		repo.On("FindActiveByCode", "KUM").Return(nil, gorm.ErrRecordNotFound)
+		repo.On("Create", mock.Anything).Run(func(args mock.Arguments) {
+			args.Get(0).(*entity.InstitutionIDCode).InstitutionID = 8
+		}).Return(nil)
+		repo.On("FindByID", uint(8)).Return(&entity.InstitutionIDCode{InstitutionID: 8}, nil)
+		repo.On("CountSpecimens", uint(8)).Return(int64(0), nil)
+		s := &institutionService{institutionRepo: repo}
+
+		info, err := s.CreateInstitution(request("KUM", nil))
+
+		assert.NoError(t, err)
+		assert.Equal(t, uint(8), info.InstitutionID)
+	})
+
+	t.Run("自分のコードのまま更新するのはいいのだ", func(t *testing.T) {
+		repo := new(mockInstitutionRepository)
+		repo.On("FindByID", uint(7)).Return(&entity.InstitutionIDCode{InstitutionID: 7}, nil)
+		repo.On("FindActiveByCode", "KUM").Return(&entity.InstitutionIDCode{InstitutionID: 7}, nil)
+		repo.On("Update", mock.Anything).Return(nil)
+		repo.On("CountSpecimens", uint(7)).Return(int64(3), nil)
+		s := &institutionService{institutionRepo: repo}
+
+		_, err := s.UpdateInstitution(7, request("KUM", nil))
+		assert.NoError(t, err)
+	})
+
+	t.Run("GRSciCollのIDは小文字にしてから、他の機関とかぶっていないか確かめるのだ", func(t *testing.T) {
+		repo := new(mockInstitutionRepository)
+		repo.On("FindActiveByCode", "KUM").Return(nil, gorm.ErrRecordNotFound)
+		repo.On("FindByGRSciCollID", "0a1b2c3d-0000-4000-8000-00000000abcd").Return(&entity.InstitutionIDCode{InstitutionID: 7}, nil)
+		s := &institutionService{institutionRepo: repo}
+
+		_, err := s.CreateInstitution(request("KUM", stringPtr("0A1B2C3D-0000-4000-8000-00000000ABCD")))
+
+		assert.True(t, errors.Is(err, ErrGRSciCollIDTaken))
+		repo.AssertExpectations(t)
+		repo.AssertNotCalled(t, "Create", mock.Anything)
+	})
+}
+
+func TestReactivateInstitution(t *testing.T) {
+	deactivatedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	code := "KUM"
+
+	t.Run("その間に同じコードの機関が作られていたら戻せないのだ", func(t *testing.T) {
+		repo := new(mockInstitutionRepository)
+		repo.On("FindByID", uint(7)).Return(&entity.InstitutionIDCode{InstitutionID: 7, InstitutionCode: &code, DeactivatedAt: &deactivatedAt}, nil)
+		repo.On("FindActiveByCode", "KUM").Return(&entity.InstitutionIDCode{InstitutionID: 8}, nil)
+		s := &institutionService{institutionRepo: repo}
+
+		_, err := s.ReactivateInstitution(7)
+
+		assert.True(t, errors.Is(err, ErrInstitutionCodeTaken))
+		repo.AssertNotCalled(t, "SetDeactivatedAt", mock.Anything, mock.Anything)
+	})
+
+	t.Run("コードが空いていれば戻すのだ", func(t *testing.T) {
+		repo := new(mockInstitutionRepository)
+		repo.On("FindByID", uint(7)).Return(&entity.InstitutionIDCode{InstitutionID: 7, InstitutionCode: &code, DeactivatedAt: &deactivatedAt}, nil)
+		repo.On("FindActiveByCode", "KUM").Return(nil, gorm.ErrRecordNotFound)
+		repo.On("SetDeactivatedAt", uint(7), (*time.Time)(nil)).Return(nil)
+		repo.On("CountSpecimens", uint(7)).Return(int64(0), nil)
+		s := &institutionService{institutionRepo: repo}
+
+		_, err := s.ReactivateInstitution(7)
+
+		assert.NoError(t, err)
+		repo.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,97 @@
+// internal/service/login_audit_service.go
+package service
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/saku-730/web-specimen/backend/internal/repository"
+)
+
+// LoginAuditService は管理者がログインの記録を見たり、ロックを解いたりするためのものなのだ
+type LoginAuditService interface {
+	SearchLoginAudits(query *model.LoginAuditQuery) (*model.LoginAuditResponse, error)
+	UnlockAccount(actor *model.Actor, userID uint, client *model.ClientInfo) error
+}
+
+type loginAuditService struct {
+	userRepo       repository.UserRepository
+	loginAuditRepo repository.LoginAuditRepository
+}
+
+func NewLoginAuditService(userRepo repository.UserRepository, loginAuditRepo repository.LoginAuditRepository) LoginAuditService {
+	return &loginAuditService{userRepo: userRepo, loginAuditRepo: loginAuditRepo}
+}
+
+func (s *loginAuditService) SearchLoginAudits(query *model.LoginAuditQuery) (*model.LoginAuditResponse, error) {
+	if query.Page <= 0 { query.Page = 1 }
+	query.PerPage = clampPerPage(query.PerPage, 50)
+	query.Email = strings.ToLower(strings.TrimSpace(query.Email))
+
+	audits, total, err := s.loginAuditRepo.Search(query)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []model.LoginAuditItem{}
+	for _, audit := range audits {
+		item := model.LoginAuditItem{
+			LoginAuditID: audit.LoginAuditID,
+			UserID:       audit.UserID,
+			Email:        audit.MailAddress,
+			IPAddress:    audit.IPAddress,
+			UserAgent:    audit.UserAgent,
+			Event:        audit.Event,
+			Detail:       audit.Detail,
+			CreatedAt:    audit.CreatedAt,
+		}
+		if audit.User != nil {
+			item.UserName = &audit.User.UserName
+		}
+		results = append(results, item)
+	}
+
+	totalPages := 0
+	if total > 0 {
+		totalPages = int(math.Ceil(float64(total) / float64(query.PerPage)))
+	}
+
+	return &model.LoginAuditResponse{
+		Results: results,
+		Metadata: model.Metadata{
+			TotalResults: int(total),
+			CurrentPage:  query.Page,
+			PerPage:      query.PerPage,
+			TotalPages:   totalPages,
+		},
+	}, nil
+}
+
+// UnlockAccount はアカウントの失敗を数え直すように、unlockの記録を入れるのだ
+// IPアドレスのロックは解かないので、そちらは時間が経つのを待ってもらうのだ
+// 記録のIPアドレスとUser-Agentは、ロックを解いた管理者のものなのだ
+func (s *loginAuditService) UnlockAccount(actor *model.Actor, userID uint, client *model.ClientInfo) error {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return err
+	}
+	if user.MailAddress == nil {
+		return nil
+	}
+
+	detail := "unlocked by user " + strconv.FormatUint(uint64(actor.UserID), 10)
+	audit := &entity.LoginAudit{
+		UserID:      &user.UserID,
+		MailAddress: strings.ToLower(*user.MailAddress),
+		IPAddress:   client.IPAddress,
+		Event:       model.LoginEventUnlock,
+		Detail:      &detail,
+	}
+	if client.UserAgent != "" {
+		audit.UserAgent = &client.UserAgent
+	}
+	return s.loginAuditRepo.Create(audit)
+}
@@ -0,0 +1,188 @@
+// internal/service/login_throttle.go
+package service
+
+import (
+	"log"
+	"time"
+
+	"github.com/saku-730/web-specimen/backend/config"
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/saku-730/web-specimen/backend/internal/repository"
+	"github.com/saku-730/web-specimen/backend/internal/util"
+)
+
+// attemptInProgress は結果が決まる前の試みの行の detail なのだ
+// 結果を書く前に止まっても、失敗として数えられるだけなのだ
+const attemptInProgress = "in_progress"
+
+// loginThrottle はlogin_auditsの失敗の回数で、パスワードや2段階目のコードを何度も試されるのを止めるのだ
+// ログインと、ログインした後でコードを聞くところ (2段階認証をやめる時など) の両方で使うのだ
+type loginThrottle struct {
+	loginAuditRepo repository.LoginAuditRepository
+
+	maxAccountFailures int
+	maxIPFailures      int
+	ipFailureWindow    time.Duration
+	lockoutBase        time.Duration
+	lockoutMax         time.Duration
+}
+
+func newLoginThrottle(loginAuditRepo repository.LoginAuditRepository, cfg *configs.Config) *loginThrottle {
+	return &loginThrottle{
+		loginAuditRepo:     loginAuditRepo,
+		maxAccountFailures: cfg.LoginMaxAccountFailures,
+		maxIPFailures:      cfg.LoginMaxIPFailures,
+		ipFailureWindow:    time.Duration(cfg.LoginIPWindowMinutes) * time.Minute,
+		lockoutBase:        time.Duration(cfg.LoginLockoutBaseSeconds) * time.Second,
+		lockoutMax:         time.Duration(cfg.LoginLockoutMaxMinutes) * time.Minute,
+	}
+}
+
+// begin は確かめる前に、失敗として試みの行を入れてから失敗の回数を数えるのだ
+// 同時にたくさん試されても、先に入った試みは失敗として数えられるので、しきい値より多くは通らないのだ
+// ロック中なら行をlockedにして、あとどれだけ待つかを返すのだ
+func (t *loginThrottle) begin(userID *uint, mailAddress string, client *model.ClientInfo) (*entity.LoginAudit, time.Duration, error) {
+	detail := attemptInProgress
+	audit := &entity.LoginAudit{
+		UserID:      userID,
+		MailAddress: mailAddress,
+		IPAddress:   client.IPAddress,
+		Event:       model.LoginEventFailure,
+		Detail:      &detail,
+	}
+	if client.UserAgent != "" {
+		audit.UserAgent = &client.UserAgent
+	}
+	if err := t.loginAuditRepo.Create(audit); err != nil {
+		return nil, 0, err
+	}
+
+	retryAfter, err := t.lockedFor(mailAddress, client.IPAddress, audit.LoginAuditID)
+	if err != nil {
+		t.abandon(audit)
+		return nil, 0, err
+	}
+	if retryAfter > 0 {
+		t.finish(audit, userID, model.LoginEventLocked, "locked")
+	}
+	return audit, retryAfter, nil
+}
+
+// finish は試みの行に結果を書くのだ
+// 書けなくても止めないで、ログにだけ残すのだ。その時は失敗のまま数えられるのだ
+func (t *loginThrottle) finish(audit *entity.LoginAudit, userID *uint, event, detail string) {
+	audit.UserID = userID
+	audit.Event = event
+	audit.Detail = nil
+	if detail != "" {
+		audit.Detail = &detail
+	}
+	if err := t.loginAuditRepo.UpdateResult(audit); err != nil {
+		log.Printf("failed record login audit for %s: %v", audit.MailAddress, err)
+	}
+}
+
+// abandon はコードの間違いではないエラーで止まった試みの行を消すのだ
+func (t *loginThrottle) abandon(audit *entity.LoginAudit) {
+	if err := t.loginAuditRepo.Delete(audit.LoginAuditID); err != nil {
+		log.Printf("failed remove login audit for %s: %v", audit.MailAddress, err)
+	}
+}
+
+// lockedFor はアカウントとIPアドレスの失敗の回数から、あとどれだけ待たせるかを返すのだ
+// 失敗するたびに待つ時間は倍になっていくのだ
+func (t *loginThrottle) lockedFor(mailAddress, ipAddress string, beforeID uint) (time.Duration, error) {
+	now := time.Now()
+
+	account, err := t.loginAuditRepo.AccountFailures(mailAddress, now.Add(-accountFailureWindow), beforeID)
+	if err != nil {
+		return 0, err
+	}
+	ip, err := t.loginAuditRepo.IPFailures(ipAddress, now.Add(-t.ipFailureWindow), beforeID)
+	if err != nil {
+		return 0, err
+	}
+
+	wait := remainingLockout(account, t.maxAccountFailures, t.lockoutBase, t.lockoutMax, now)
+	if ipWait := remainingLockout(ip, t.maxIPFailures, t.lockoutBase, t.lockoutMax, now); ipWait > wait {
+		wait = ipWait
+	}
+	return wait, nil
+}
+
+// remainingLockout は回数がしきい値を超えていたら、最後の行からあとどれだけ待たせるかを返すのだ
+func remainingLockout(stats *repository.FailureStats, threshold int, base, max time.Duration, now time.Time) time.Duration {
+	lockout := util.LockoutDuration(int(stats.Count), threshold, base, max)
+	if lockout == 0 || stats.LastFailure == nil {
+		return 0
+	}
+	until := stats.LastFailure.Add(lockout)
+	if now.Before(until) {
+		return until.Sub(now)
+	}
+	return 0
+}
+
+// mailThrottle は登録やパスワード再設定のメールを、同じアドレスやIPアドレスに何通も送らせないのだ
+// ログインしないで頼めるので、他の人のアドレスにメールを送り付けるのに使われないようにするのだ
+// 頼まれるたびにlogin_auditsに行を入れて、ログインの失敗と同じように待つ時間を倍にしていくのだ
+type mailThrottle struct {
+	loginAuditRepo repository.LoginAuditRepository
+
+	maxPerAddress int
+	maxPerIP      int
+	window        time.Duration
+	lockoutBase   time.Duration
+	lockoutMax    time.Duration
+}
+
+func newMailThrottle(loginAuditRepo repository.LoginAuditRepository, cfg *configs.Config) *mailThrottle {
+	return &mailThrottle{
+		loginAuditRepo: loginAuditRepo,
+		maxPerAddress:  cfg.MailMaxPerAddress,
+		maxPerIP:       cfg.MailMaxPerIP,
+		window:         time.Duration(cfg.MailWindowMinutes) * time.Minute,
+		lockoutBase:    time.Duration(cfg.LoginLockoutBaseSeconds) * time.Second,
+		lockoutMax:     time.Duration(cfg.LoginLockoutMaxMinutes) * time.Minute,
+	}
+}
+
+// begin はメールを送る前に、頼まれたことを記録してから数えるのだ
+// ログインと同じで、先に行を入れるので同時にたくさん頼まれてもしきい値より多くは通らないのだ
+// 待たせる時は行をlockedにして、待たされた分は数えないのだ
+func (t *mailThrottle) begin(mailAddress, purpose string, client *model.ClientInfo) (time.Duration, error) {
+	audit := &entity.LoginAudit{
+		MailAddress: mailAddress,
+		IPAddress:   client.IPAddress,
+		Event:       model.LoginEventMailRequest,
+		Detail:      &purpose,
+	}
+	if client.UserAgent != "" {
+		audit.UserAgent = &client.UserAgent
+	}
+	if err := t.loginAuditRepo.Create(audit); err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	byAddress, byIP, err := t.loginAuditRepo.RecentEvents(model.LoginEventMailRequest, mailAddress, client.IPAddress, now.Add(-t.window), audit.LoginAuditID)
+	if err != nil {
+		if err := t.loginAuditRepo.Delete(audit.LoginAuditID); err != nil {
+			log.Printf("failed remove mail request audit for %s: %v", mailAddress, err)
+		}
+		return 0, err
+	}
+
+	wait := remainingLockout(byAddress, t.maxPerAddress, t.lockoutBase, t.lockoutMax, now)
+	if ipWait := remainingLockout(byIP, t.maxPerIP, t.lockoutBase, t.lockoutMax, now); ipWait > wait {
+		wait = ipWait
+	}
+	if wait > 0 {
+		audit.Event = model.LoginEventLocked
+		if err := t.loginAuditRepo.UpdateResult(audit); err != nil {
+			log.Printf("failed record mail request audit for %s: %v", mailAddress, err)
+		}
+	}
+	return wait, nil
+}
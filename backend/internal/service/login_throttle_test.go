@@ -0,0 +1,161 @@
+// internal/service/login_throttle_test.go
+package service
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/saku-730/web-specimen/backend/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryLoginAuditRepository はlogin_auditsをメモリに持つ偽物なのだ。数え方はSQLと同じにしてあるのだ
+type memoryLoginAuditRepository struct {
+	repository.LoginAuditRepository
+	mu     sync.Mutex
+	audits []entity.LoginAudit
+}
+
+func (r *memoryLoginAuditRepository) Create(audit *entity.LoginAudit) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	audit.LoginAuditID = uint(len(r.audits) + 1)
+	audit.CreatedAt = time.Now()
+	r.audits = append(r.audits, *audit)
+	return nil
+}
+
+func (r *memoryLoginAuditRepository) UpdateResult(audit *entity.LoginAudit) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	row := &r.audits[audit.LoginAuditID-1]
+	row.UserID, row.Event, row.Detail = audit.UserID, audit.Event, audit.Detail
+	return nil
+}
+
+func (r *memoryLoginAuditRepository) Delete(id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.audits[id-1].Event = "deleted"
+	return nil
+}
+
+func (r *memoryLoginAuditRepository) AccountFailures(mailAddress string, since time.Time, beforeID uint) (*repository.FailureStats, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var reset time.Time
+	for _, a := range r.audits {
+		if a.MailAddress == mailAddress && (a.Event == model.LoginEventSuccess || a.Event == model.LoginEventUnlock) && a.CreatedAt.After(reset) {
+			reset = a.CreatedAt
+		}
+	}
+	return r.count(func(a entity.LoginAudit) bool {
+		return a.MailAddress == mailAddress && a.CreatedAt.After(since) && a.CreatedAt.After(reset) && a.LoginAuditID < beforeID
+	}), nil
+}
+
+func (r *memoryLoginAuditRepository) IPFailures(ipAddress string, since time.Time, beforeID uint) (*repository.FailureStats, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.count(func(a entity.LoginAudit) bool {
+		return a.IPAddress == ipAddress && a.CreatedAt.After(since) && a.LoginAuditID < beforeID
+	}), nil
+}
+
+func (r *memoryLoginAuditRepository) RecentEvents(event, mailAddress, ipAddress string, since time.Time, beforeID uint) (*repository.FailureStats, *repository.FailureStats, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	byAddress, byIP := &repository.FailureStats{}, &repository.FailureStats{}
+	for _, a := range r.audits {
+		if a.Event != event || !a.CreatedAt.After(since) || a.LoginAuditID >= beforeID {
+			continue
+		}
+		created := a.CreatedAt
+		if a.MailAddress == mailAddress {
+			byAddress.Count++
+			byAddress.LastFailure = &created
+		}
+		if a.IPAddress == ipAddress {
+			byIP.Count++
+			byIP.LastFailure = &created
+		}
+	}
+	return byAddress, byIP, nil
+}
+
+func (r *memoryLoginAuditRepository) count(match func(a entity.LoginAudit) bool) *repository.FailureStats {
+	stats := &repository.FailureStats{}
+	for _, a := range r.audits {
+		if a.Event == model.LoginEventFailure && match(a) {
+			stats.Count++
+			created := a.CreatedAt
+			stats.LastFailure = &created
+		}
+	}
+	return stats
+}
+
+func newTestThrottle(repo repository.LoginAuditRepository) *loginThrottle {
+	return &loginThrottle{
+		loginAuditRepo:     repo,
+		maxAccountFailures: 3,
+		maxIPFailures:      100,
+		ipFailureWindow:    time.Hour,
+		lockoutBase:        time.Minute,
+		lockoutMax:         time.Hour,
+	}
+}
+
+func TestLoginThrottle(t *testing.T) {
+	client := &model.ClientInfo{IPAddress: "192.0.2.1"}
+
+	t.Run("結果が出る前の試みも失敗として数えるのだ", func(t *testing.T) {
+		repo := &memoryLoginAuditRepository{}
+		throttle := newTestThrottle(repo)
+
+		// 同時に来た3回が、まだパスワードを確かめている途中なのだ
+		for i := 0; i < 3; i++ {
+			_, retryAfter, err := throttle.begin(nil, "a@example.com", client)
+			assert.NoError(t, err)
+			assert.Zero(t, retryAfter)
+		}
+
+		attempt, retryAfter, err := throttle.begin(nil, "a@example.com", client)
+		assert.NoError(t, err)
+		assert.Greater(t, retryAfter, time.Duration(0))
+		assert.Equal(t, model.LoginEventLocked, repo.audits[attempt.LoginAuditID-1].Event)
+	})
+
+	t.Run("成功したら数え直すのだ", func(t *testing.T) {
+		repo := &memoryLoginAuditRepository{}
+		throttle := newTestThrottle(repo)
+
+		for i := 0; i < 2; i++ {
+			attempt, _, _ := throttle.begin(nil, "b@example.com", client)
+			throttle.finish(attempt, nil, model.LoginEventFailure, "wrong_password")
+		}
+		attempt, _, _ := throttle.begin(nil, "b@example.com", client)
+		throttle.finish(attempt, uintPtr(1), model.LoginEventSuccess, "")
+		time.Sleep(time.Millisecond)
+
+		_, retryAfter, err := throttle.begin(nil, "b@example.com", client)
+		assert.NoError(t, err)
+		assert.Zero(t, retryAfter)
+	})
+
+	t.Run("コードの間違いではないエラーは数えないのだ", func(t *testing.T) {
+		repo := &memoryLoginAuditRepository{}
+		throttle := newTestThrottle(repo)
+
+		for i := 0; i < 5; i++ {
+			attempt, _, _ := throttle.begin(nil, "c@example.com", client)
+			throttle.abandon(attempt)
+		}
+		_, retryAfter, err := throttle.begin(nil, "c@example.com", client)
+		assert.NoError(t, err)
+		assert.Zero(t, retryAfter)
+	})
+}
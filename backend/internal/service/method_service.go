@@ -0,0 +1,240 @@
+// internal/service/method_service.go
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/saku-730/web-specimen/backend/internal/repository"
+	"gorm.io/gorm"
+)
+
+// ErrMethodNameTaken は使われている方法に同じ名前がもうある時のエラーなのだ
+var ErrMethodNameTaken = errors.New("method name is already used")
+
+// ErrMethodMerged は統合した後の方法を変えようとした時のエラーなのだ
+var ErrMethodMerged = errors.New("method was merged into another method")
+
+// ErrInvalidMerge は自分自身や、使わなくなった方法にまとめようとした時のエラーなのだ
+var ErrInvalidMerge = errors.New("cannot merge into this method")
+
+// ErrUnknownPage は page_id のwikiページが無い時のエラーなのだ
+var ErrUnknownPage = errors.New("wiki page does not exist")
+
+// MethodService は観察方法と標本作成方法の両方で使うのだ。どちらかはリポジトリで決まるのだ
+type MethodService interface {
+	ListMethods(query *model.MethodQuery) ([]model.MethodInfo, error)
+	GetMethod(id uint) (*model.MethodInfo, error)
+	CreateMethod(req *model.MethodRequest) (*model.MethodInfo, error)
+	UpdateMethod(id uint, req *model.MethodRequest) (*model.MethodInfo, error)
+	DeprecateMethod(id uint) error
+	RestoreMethod(id uint) (*model.MethodInfo, error)
+	MergeMethod(actor *model.Actor, id uint, req *model.MethodMergeRequest) (*model.MethodInfo, error)
+}
+
+type methodService struct {
+	db            *gorm.DB
+	methodRepo    repository.MethodRepository
+	changeLogRepo repository.ChangeLogRepository
+}
+
+func NewMethodService(db *gorm.DB, methodRepo repository.MethodRepository, changeLogRepo repository.ChangeLogRepository) MethodService {
+	return &methodService{db: db, methodRepo: methodRepo, changeLogRepo: changeLogRepo}
+}
+
+func (s *methodService) ListMethods(query *model.MethodQuery) ([]model.MethodInfo, error) {
+	methods, err := s.methodRepo.FindAll(query.IncludeDeprecated)
+	if err != nil {
+		return nil, err
+	}
+	if methods == nil {
+		methods = []model.MethodInfo{}
+	}
+	return methods, nil
+}
+
+// GetMethod は方法を1つ、使っている記録の数と一緒に返すのだ
+func (s *methodService) GetMethod(id uint) (*model.MethodInfo, error) {
+	method, err := s.methodRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	count, err := s.methodRepo.CountUsage(method.MethodID)
+	if err != nil {
+		return nil, err
+	}
+	method.UsageCount = &count
+	return method, nil
+}
+
+func (s *methodService) CreateMethod(req *model.MethodRequest) (*model.MethodInfo, error) {
+	if err := s.validate(0, req); err != nil {
+		return nil, err
+	}
+	id, err := s.methodRepo.Create(req.MethodName, req.PageID)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetMethod(id)
+}
+
+// UpdateMethod は方法の名前とwikiページを変えるのだ。古い記録にも新しい名前で出るのだ
+func (s *methodService) UpdateMethod(id uint, req *model.MethodRequest) (*model.MethodInfo, error) {
+	method, err := s.methodRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if method.MergedInto != nil {
+		return nil, ErrMethodMerged
+	}
+	if err := s.validate(method.MethodID, req); err != nil {
+		return nil, err
+	}
+	if err := s.methodRepo.Update(method.MethodID, req.MethodName, req.PageID); err != nil {
+		return nil, err
+	}
+	return s.GetMethod(method.MethodID)
+}
+
+// DeprecateMethod は方法を消さないで、作成ページの選択肢に出さないようにするのだ
+// 古い記録にはそのまま出るのだ
+func (s *methodService) DeprecateMethod(id uint) error {
+	method, err := s.methodRepo.FindByID(id)
+	if err != nil {
+		return err
+	}
+	if method.DeprecatedAt != nil {
+		return nil
+	}
+	now := time.Now()
+	return s.methodRepo.SetDeprecatedAt(method.MethodID, &now)
+}
+
+// RestoreMethod は使わなくした方法をまた選べるようにするのだ。統合した方法は戻せないのだ
+func (s *methodService) RestoreMethod(id uint) (*model.MethodInfo, error) {
+	method, err := s.methodRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if method.MergedInto != nil {
+		return nil, ErrMethodMerged
+	}
+	if method.DeprecatedAt != nil {
+		if err := s.ensureNameAvailable(method.MethodID, method.MethodName); err != nil {
+			return nil, err
+		}
+		if err := s.methodRepo.SetDeprecatedAt(method.MethodID, nil); err != nil {
+			return nil, err
+		}
+	}
+	return s.GetMethod(method.MethodID)
+}
+
+// MergeMethod はパスの方法を使っている記録を into_method_id に付け替えて、パスの方法は統合済みにするのだ
+// 付け替えは1つのトランザクションでやるので、途中で止まっても半分だけ付け替わることは無いのだ
+// 付け替えたoccurrenceは普通の編集と同じように、バージョンを上げてchange_logsにも書くのだ
+// アーカイブしたプロジェクトの記録は読むだけなので、統合済みの方法のまま残すのだ
+func (s *methodService) MergeMethod(actor *model.Actor, id uint, req *model.MethodMergeRequest) (*model.MethodInfo, error) {
+	var targetID uint
+	err := writeOccurrences(s.db, s.changeLogRepo, func(tx *gorm.DB) error {
+		source, target, err := s.lockMergePair(tx, id, req.IntoMethodID)
+		if err != nil {
+			return err
+		}
+		if source.MergedInto != nil {
+			return ErrMethodMerged
+		}
+		if target.MethodID == source.MethodID || target.DeprecatedAt != nil {
+			return ErrInvalidMerge
+		}
+		targetID = target.MethodID
+
+		occurrenceIDs, err := s.methodRepo.FindMergeableOccurrenceIDs(tx, source.MethodID)
+		if err != nil {
+			return err
+		}
+		before := make(map[uint]repository.OccurrenceSnapshot, len(occurrenceIDs))
+		for _, occurrenceID := range occurrenceIDs {
+			if before[occurrenceID], err = s.changeLogRepo.Snapshot(tx, occurrenceID); err != nil {
+				return err
+			}
+		}
+
+		if err := s.methodRepo.Merge(tx, source.MethodID, target.MethodID, occurrenceIDs); err != nil {
+			return err
+		}
+		// コミットした後にoccurrence_generationも上がるので、方法で絞り込んだ地図タイルのキャッシュも捨ててもらえるのだ
+		for _, occurrenceID := range occurrenceIDs {
+			if err := recordOccurrenceChanges(tx, s.changeLogRepo, actor, occurrenceID, before[occurrenceID]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetMethod(targetID)
+}
+
+// lockMergePair は統合する2つの方法をIDの小さい順にロックするのだ
+// 逆向きの統合が同時に来ても、同じ順番でロックするのでデッドロックしないのだ
+func (s *methodService) lockMergePair(tx *gorm.DB, sourceID, targetID uint) (*model.MethodInfo, *model.MethodInfo, error) {
+	lockTarget := func() (*model.MethodInfo, error) {
+		target, err := s.methodRepo.LockByID(tx, targetID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidMerge
+		}
+		return target, err
+	}
+
+	if targetID < sourceID {
+		target, err := lockTarget()
+		if err != nil {
+			return nil, nil, err
+		}
+		source, err := s.methodRepo.LockByID(tx, sourceID)
+		return source, target, err
+	}
+	source, err := s.methodRepo.LockByID(tx, sourceID)
+	if err != nil {
+		return nil, nil, err
+	}
+	target, err := lockTarget()
+	return source, target, err
+}
+
+// validate は名前がかぶっていないかと、wikiページがあるかを確かめるのだ
+func (s *methodService) validate(selfID uint, req *model.MethodRequest) error {
+	if err := s.ensureNameAvailable(selfID, &req.MethodName); err != nil {
+		return err
+	}
+	if req.PageID != nil {
+		exists, err := s.methodRepo.PageExists(*req.PageID)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrUnknownPage
+		}
+	}
+	return nil
+}
+
+func (s *methodService) ensureNameAvailable(selfID uint, name *string) error {
+	if name == nil {
+		return nil
+	}
+	existing, err := s.methodRepo.FindActiveByName(*name)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if existing.MethodID != selfID {
+		return ErrMethodNameTaken
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+// internal/service/method_service_test.go
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/saku-730/web-specimen/backend/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestMergeMethod(t *testing.T) {
+	actor := &model.Actor{UserID: 1, Role: model.RoleAdmin}
+	deprecatedAt := time.Now()
+
+	t.Run("付け替えたoccurrenceごとにchange_logsを書くのだ", func(t *testing.T) {
+		methodRepo := new(mockMethodRepository)
+		methodRepo.On("LockByID", uint(3)).Return(&model.MethodInfo{MethodID: 3}, nil)
+		methodRepo.On("LockByID", uint(7)).Return(&model.MethodInfo{MethodID: 7}, nil)
+		methodRepo.On("FindMergeableOccurrenceIDs", uint(7)).Return([]uint{5}, nil)
+		methodRepo.On("Merge", uint(7), uint(3), []uint{5}).Return(nil)
+		methodRepo.On("FindByID", uint(3)).Return(&model.MethodInfo{MethodID: 3}, nil)
+		methodRepo.On("CountUsage", uint(3)).Return(int64(1), nil)
+		changeLogRepo := new(mockChangeLogRepository)
+		changeLogRepo.On("Snapshot", uint(5)).Return(repository.OccurrenceSnapshot{"observations": {11: `{"observation_method_id":7}`}}, nil).Once()
+		changeLogRepo.On("Snapshot", uint(5)).Return(repository.OccurrenceSnapshot{"observations": {11: `{"observation_method_id":3}`}}, nil).Once()
+		changeLogRepo.On("Create", mock.Anything).Return(nil)
+		changeLogRepo.On("BumpGeneration").Return(nil)
+		s := &methodService{db: newTestDB(t), methodRepo: methodRepo, changeLogRepo: changeLogRepo}
+
+		method, err := s.MergeMethod(actor, 7, &model.MethodMergeRequest{IntoMethodID: 3})
+
+		assert.NoError(t, err)
+		assert.Equal(t, uint(3), method.MethodID)
+		methodRepo.AssertExpectations(t)
+		changeLogRepo.AssertExpectations(t)
+		logs := changeLogRepo.Calls[2].Arguments.Get(0).([]entity.ChangeLog)
+		assert.Len(t, logs, 1)
+		assert.Equal(t, "observations", *logs[0].ChangedTable)
+	})
+
+	cases := []struct {
+		name   string
+		source *model.MethodInfo
+		target *model.MethodInfo
+		want   error
+	}{
+		{"使わなくした方法にはまとめられないのだ", &model.MethodInfo{MethodID: 7}, &model.MethodInfo{MethodID: 3, DeprecatedAt: &deprecatedAt}, ErrInvalidMerge},
+		{"自分自身にはまとめられないのだ", &model.MethodInfo{MethodID: 3}, &model.MethodInfo{MethodID: 3}, ErrInvalidMerge},
+		{"もう統合した方法はまとめられないのだ", &model.MethodInfo{MethodID: 7, MergedInto: uintPtr(4)}, &model.MethodInfo{MethodID: 3}, ErrMethodMerged},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			methodRepo := new(mockMethodRepository)
+			methodRepo.On("LockByID", tc.source.MethodID).Return(tc.source, nil)
+			methodRepo.On("LockByID", tc.target.MethodID).Return(tc.target, nil)
+			s := &methodService{db: newTestDB(t), methodRepo: methodRepo, changeLogRepo: new(mockChangeLogRepository)}
+
+			_, err := s.MergeMethod(actor, tc.source.MethodID, &model.MethodMergeRequest{IntoMethodID: tc.target.MethodID})
+
+			assert.True(t, errors.Is(err, tc.want))
+			methodRepo.AssertNotCalled(t, "Merge", mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestDeprecateMethod(t *testing.T) {
+	t.Run("もう使わなくした方法はそのままにするのだ", func(t *testing.T) {
+		deprecatedAt := time.Now()
+		methodRepo := new(mockMethodRepository)
+		methodRepo.On("FindByID", uint(3)).Return(&model.MethodInfo{MethodID: 3, DeprecatedAt: &deprecatedAt}, nil)
+		s := &methodService{methodRepo: methodRepo}
+
+		assert.NoError(t, s.DeprecateMethod(3))
+		methodRepo.AssertNotCalled(t, "SetDeprecatedAt", mock.Anything, mock.Anything)
+	})
+
+	t.Run("使っている方法は使わなくした日時を入れるのだ", func(t *testing.T) {
+		methodRepo := new(mockMethodRepository)
+		methodRepo.On("FindByID", uint(3)).Return(&model.MethodInfo{MethodID: 3}, nil)
+		methodRepo.On("SetDeprecatedAt", uint(3), mock.AnythingOfType("*time.Time")).Return(nil)
+		s := &methodService{methodRepo: methodRepo}
+
+		assert.NoError(t, s.DeprecateMethod(3))
+		methodRepo.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,567 @@
+// internal/service/mock_repository_test.go
+package service
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"github.com/saku-730/web-specimen/backend/internal/mailer"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/saku-730/web-specimen/backend/internal/repository"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// --- トランザクションだけできる偽物のDBなのだ ---
+// リポジトリは全部モックにするので、DBにはBeginとCommitしか来ないのだ
+
+type fakeDriver struct{}
+type fakeConn struct{}
+type fakeTx struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return fakeConn{}, nil }
+func (fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("no queries in service tests")
+}
+func (fakeConn) Close() error              { return nil }
+func (fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+func (fakeTx) Commit() error               { return nil }
+func (fakeTx) Rollback() error             { return nil }
+
+var registerFakeDriver sync.Once
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	registerFakeDriver.Do(func() { sql.Register("service-test", fakeDriver{}) })
+	sqlDB, err := sql.Open("service-test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// --- リポジトリのモックなのだ ---
+// インターフェースを埋め込んでおくので、テストで使うメソッドだけ書けばいいのだ
+
+type mockOccurrenceRepository struct {
+	mock.Mock
+	repository.OccurrenceRepository
+}
+
+func (m *mockOccurrenceRepository) FindOwnership(id uint) (*uint, *uint, error) {
+	ret := m.Called(id)
+	var projectID, ownerID *uint
+	if ret.Get(0) != nil {
+		projectID = ret.Get(0).(*uint)
+	}
+	if ret.Get(1) != nil {
+		ownerID = ret.Get(1).(*uint)
+	}
+	return projectID, ownerID, ret.Error(2)
+}
+
+func (m *mockOccurrenceRepository) FindByID(id uint) (*entity.Occurrence, error) {
+	ret := m.Called(id)
+	var r0 *entity.Occurrence
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*entity.Occurrence)
+	}
+	return r0, ret.Error(1)
+}
+
+func (m *mockOccurrenceRepository) BumpVersion(tx *gorm.DB, id uint, expectedVersion int) error {
+	return m.Called(id, expectedVersion).Error(0)
+}
+
+func (m *mockOccurrenceRepository) UpdateOccurrence(tx *gorm.DB, occurrence *entity.Occurrence, classification *entity.ClassificationJSON, place *entity.Place, placeName *entity.PlaceNamesJSON, observations []entity.Observation, specimens []entity.Specimen, makeSpecimens []entity.MakeSpecimen, identifications []entity.Identification) error {
+	return m.Called(occurrence, observations, makeSpecimens, identifications).Error(0)
+}
+
+type mockInstitutionRepository struct {
+	mock.Mock
+	repository.InstitutionRepository
+}
+
+func (m *mockInstitutionRepository) FindIDsByOccurrenceID(occurrenceID uint) ([]uint, error) {
+	ret := m.Called(occurrenceID)
+	var r0 []uint
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]uint)
+	}
+	return r0, ret.Error(1)
+}
+
+type mockChangeLogRepository struct {
+	mock.Mock
+	repository.ChangeLogRepository
+}
+
+func (m *mockChangeLogRepository) Snapshot(tx *gorm.DB, occurrenceID uint) (repository.OccurrenceSnapshot, error) {
+	ret := m.Called(occurrenceID)
+	var r0 repository.OccurrenceSnapshot
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(repository.OccurrenceSnapshot)
+	}
+	return r0, ret.Error(1)
+}
+
+func (m *mockChangeLogRepository) Create(tx *gorm.DB, logs []entity.ChangeLog) error {
+	return m.Called(logs).Error(0)
+}
+
+type mockProjectRepository struct {
+	mock.Mock
+	repository.ProjectRepository
+}
+
+func (m *mockProjectRepository) FindByID(id uint) (*entity.Project, error) {
+	ret := m.Called(id)
+	var r0 *entity.Project
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*entity.Project)
+	}
+	return r0, ret.Error(1)
+}
+
+type mockProjectMemberRepository struct {
+	mock.Mock
+	repository.ProjectMemberRepository
+}
+
+func (m *mockProjectMemberRepository) FindActiveByUserID(userID uint) ([]entity.ProjectMember, error) {
+	ret := m.Called(userID)
+	var r0 []entity.ProjectMember
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]entity.ProjectMember)
+	}
+	return r0, ret.Error(1)
+}
+
+func uintPtr(v uint) *uint { return &v }
+
+type mockUserRepository struct {
+	mock.Mock
+	repository.UserRepository
+}
+
+func (m *mockUserRepository) FindByID(id uint) (*entity.User, error) {
+	ret := m.Called(id)
+	var r0 *entity.User
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*entity.User)
+	}
+	return r0, ret.Error(1)
+}
+
+type mockTwoFactorRepository struct {
+	mock.Mock
+	repository.TwoFactorRepository
+}
+
+func (m *mockTwoFactorRepository) Disable(userID uint) error {
+	return m.Called(userID).Error(0)
+}
+
+func (m *mockTwoFactorRepository) UseStep(userID uint, step int64) (bool, error) {
+	ret := m.Called(userID, step)
+	return ret.Bool(0), ret.Error(1)
+}
+
+func (m *mockTwoFactorRepository) UseRecoveryCode(userID uint, codeHash string) (bool, error) {
+	ret := m.Called(userID, codeHash)
+	return ret.Bool(0), ret.Error(1)
+}
+
+func (m *mockUserRepository) FindByEmail(email string) (*entity.User, error) {
+	ret := m.Called(email)
+	var r0 *entity.User
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*entity.User)
+	}
+	return r0, ret.Error(1)
+}
+
+func (m *mockUserRepository) FindRoleByID(id uint) (*entity.UserRole, error) {
+	ret := m.Called(id)
+	var r0 *entity.UserRole
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*entity.UserRole)
+	}
+	return r0, ret.Error(1)
+}
+
+func (m *mockUserRepository) Update(tx *gorm.DB, userID uint, columns map[string]interface{}) error {
+	return m.Called(userID, columns).Error(0)
+}
+
+func (m *mockUserRepository) UpdatePassword(userID uint, passwordHash string) error {
+	return m.Called(userID, passwordHash).Error(0)
+}
+
+func (m *mockUserRepository) SetDeactivatedAt(tx *gorm.DB, userID uint, deactivatedAt *time.Time) error {
+	return m.Called(userID, deactivatedAt).Error(0)
+}
+
+func (m *mockUserRepository) LockActiveAdminIDs(tx *gorm.DB) ([]uint, error) {
+	ret := m.Called()
+	var r0 []uint
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]uint)
+	}
+	return r0, ret.Error(1)
+}
+
+type mockTokenRepository struct {
+	mock.Mock
+	repository.TokenRepository
+}
+
+func (m *mockTokenRepository) RevokeUserTokens(userID uint) error {
+	return m.Called(userID).Error(0)
+}
+
+// mockAccountService はメールを送る代わりに、呼ばれたことだけを覚えておくのだ
+type mockAccountService struct {
+	mock.Mock
+	AccountService
+}
+
+func (m *mockAccountService) RequestEmailChange(ctx context.Context, user *entity.User, email string) error {
+	return m.Called(user.UserID, email).Error(0)
+}
+
+func (m *mockChangeLogRepository) FindByOccurrenceID(occurrenceID uint) ([]entity.ChangeLog, error) {
+	ret := m.Called(occurrenceID)
+	var r0 []entity.ChangeLog
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]entity.ChangeLog)
+	}
+	return r0, ret.Error(1)
+}
+
+func (m *mockChangeLogRepository) BumpGeneration() error {
+	return m.Called().Error(0)
+}
+
+type mockMethodRepository struct {
+	mock.Mock
+	repository.MethodRepository
+}
+
+func (m *mockMethodRepository) FindByID(id uint) (*model.MethodInfo, error) {
+	ret := m.Called(id)
+	var r0 *model.MethodInfo
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.MethodInfo)
+	}
+	return r0, ret.Error(1)
+}
+
+func (m *mockMethodRepository) LockByID(tx *gorm.DB, id uint) (*model.MethodInfo, error) {
+	ret := m.Called(id)
+	var r0 *model.MethodInfo
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.MethodInfo)
+	}
+	return r0, ret.Error(1)
+}
+
+func (m *mockMethodRepository) SetDeprecatedAt(id uint, deprecatedAt *time.Time) error {
+	return m.Called(id, deprecatedAt).Error(0)
+}
+
+func (m *mockMethodRepository) CountUsage(id uint) (int64, error) {
+	ret := m.Called(id)
+	return ret.Get(0).(int64), ret.Error(1)
+}
+
+func (m *mockMethodRepository) FindMergeableOccurrenceIDs(tx *gorm.DB, id uint) ([]uint, error) {
+	ret := m.Called(id)
+	var r0 []uint
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]uint)
+	}
+	return r0, ret.Error(1)
+}
+
+func (m *mockMethodRepository) Merge(tx *gorm.DB, sourceID uint, targetID uint, occurrenceIDs []uint) error {
+	return m.Called(sourceID, targetID, occurrenceIDs).Error(0)
+}
+
+func (m *mockUserRepository) FindRoleByName(name string) (*entity.UserRole, error) {
+	ret := m.Called(name)
+	var r0 *entity.UserRole
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*entity.UserRole)
+	}
+	return r0, ret.Error(1)
+}
+
+type mockInvitationRepository struct {
+	mock.Mock
+	repository.InvitationRepository
+}
+
+func (m *mockInvitationRepository) Create(invitation *entity.Invitation) error {
+	return m.Called(invitation.MailAddress).Error(0)
+}
+
+// mockMailer は送ったメールを覚えておくだけなのだ
+type mockMailer struct {
+	mock.Mock
+}
+
+func (m *mockMailer) Send(ctx context.Context, msg mailer.Message) error {
+	return m.Called(msg.To).Error(0)
+}
+
+func (m *mockProjectRepository) LockByID(tx *gorm.DB, id uint) (*entity.Project, error) {
+	ret := m.Called(id)
+	var r0 *entity.Project
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*entity.Project)
+	}
+	return r0, ret.Error(1)
+}
+
+func (m *mockProjectRepository) CountOccurrences(tx *gorm.DB, id uint) (int64, error) {
+	ret := m.Called(id)
+	return ret.Get(0).(int64), ret.Error(1)
+}
+
+func (m *mockProjectRepository) SetArchivedAt(id uint, archivedAt *time.Time) error {
+	return m.Called(id, archivedAt).Error(0)
+}
+
+func (m *mockProjectRepository) Delete(tx *gorm.DB, id uint) error {
+	return m.Called(id).Error(0)
+}
+
+func (m *mockProjectMemberRepository) FindByProjectID(projectID uint) ([]entity.ProjectMember, error) {
+	ret := m.Called(projectID)
+	var r0 []entity.ProjectMember
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]entity.ProjectMember)
+	}
+	return r0, ret.Error(1)
+}
+
+func (m *mockProjectMemberRepository) DeleteByProjectID(tx *gorm.DB, projectID uint) error {
+	return m.Called(projectID).Error(0)
+}
+
+type mockEntryTemplateRepository struct {
+	mock.Mock
+	repository.EntryTemplateRepository
+}
+
+func (m *mockEntryTemplateRepository) Create(template *entity.EntryTemplate) error {
+	return m.Called(template.TemplateName).Error(0)
+}
+
+func (m *mockEntryTemplateRepository) FindByID(id uint) (*entity.EntryTemplate, error) {
+	ret := m.Called(id)
+	var r0 *entity.EntryTemplate
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*entity.EntryTemplate)
+	}
+	return r0, ret.Error(1)
+}
+
+func (m *mockEntryTemplateRepository) FindByName(userID uint, name string) (*entity.EntryTemplate, error) {
+	ret := m.Called(userID, name)
+	var r0 *entity.EntryTemplate
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*entity.EntryTemplate)
+	}
+	return r0, ret.Error(1)
+}
+
+func (m *mockEntryTemplateRepository) FindVisible(userID uint, projectIDs []uint) ([]entity.EntryTemplate, error) {
+	ret := m.Called(userID, projectIDs)
+	var r0 []entity.EntryTemplate
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]entity.EntryTemplate)
+	}
+	return r0, ret.Error(1)
+}
+
+type mockUserDefaultsRepository struct {
+	mock.Mock
+	repository.UserDefaultsRepository
+}
+
+func (m *mockUserDefaultsRepository) ResolveNames(defaults *entity.UserDefault) ([]string, error) {
+	ret := m.Called(defaults.ProjectID)
+	var r0 []string
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]string)
+	}
+	return r0, ret.Error(1)
+}
+
+func (m *mockOccurrenceRepository) PurgeOccurrence(tx *gorm.DB, id uint) error {
+	return m.Called(id).Error(0)
+}
+
+type mockAttachmentRepository struct {
+	mock.Mock
+	repository.AttachmentRepository
+}
+
+func (m *mockAttachmentRepository) Create(tx *gorm.DB, attachment *entity.Attachment) error {
+	return m.Called(attachment).Error(0)
+}
+
+func (m *mockAttachmentRepository) FindByID(tx *gorm.DB, attachmentID uint) (*entity.Attachment, error) {
+	ret := m.Called(attachmentID)
+	var r0 *entity.Attachment
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*entity.Attachment)
+	}
+	return r0, ret.Error(1)
+}
+
+func (m *mockAttachmentRepository) Delete(tx *gorm.DB, attachment *entity.Attachment) error {
+	return m.Called(attachment.AttachmentID).Error(0)
+}
+
+type mockAttachmentGroupRepository struct {
+	mock.Mock
+	repository.AttachmentGroupRepository
+}
+
+func (m *mockAttachmentGroupRepository) Create(tx *gorm.DB, group *entity.AttachmentGroup) error {
+	return m.Called(group).Error(0)
+}
+
+func (m *mockAttachmentGroupRepository) FindByOccurrenceID(tx *gorm.DB, occurrenceID uint) ([]entity.AttachmentGroup, error) {
+	ret := m.Called(occurrenceID)
+	var r0 []entity.AttachmentGroup
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]entity.AttachmentGroup)
+	}
+	return r0, ret.Error(1)
+}
+
+func (m *mockAttachmentGroupRepository) DeleteByOccurrenceID(tx *gorm.DB, occurrenceID uint) error {
+	return m.Called(occurrenceID).Error(0)
+}
+
+func (m *mockAttachmentGroupRepository) CountByAttachmentID(tx *gorm.DB, attachmentID uint) (int64, error) {
+	ret := m.Called(attachmentID)
+	return ret.Get(0).(int64), ret.Error(1)
+}
+
+func (m *mockOccurrenceRepository) Exists(id uint) (bool, error) {
+	ret := m.Called(id)
+	return ret.Bool(0), ret.Error(1)
+}
+
+func (m *mockOccurrenceRepository) SoftDeleteOccurrence(tx *gorm.DB, id uint) error {
+	return m.Called(id).Error(0)
+}
+
+func (m *mockOccurrenceRepository) RestoreOccurrence(tx *gorm.DB, id uint) error {
+	return m.Called(id).Error(0)
+}
+
+func (m *mockOccurrenceRepository) FindDeleted(page, perPage int, scope *model.ProjectScope) ([]entity.Occurrence, int64, error) {
+	ret := m.Called(page, perPage, scope)
+	var r0 []entity.Occurrence
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]entity.Occurrence)
+	}
+	return r0, ret.Get(1).(int64), ret.Error(2)
+}
+
+func (m *mockOccurrenceRepository) FindDeletedBefore(cutoff time.Time) ([]uint, error) {
+	ret := m.Called(cutoff)
+	var r0 []uint
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]uint)
+	}
+	return r0, ret.Error(1)
+}
+
+type mockFileExtensionRepository struct {
+	mock.Mock
+	repository.FileExtensionRepository
+}
+
+func (m *mockFileExtensionRepository) FindByText(tx *gorm.DB, extText string) (*entity.FileExtension, error) {
+	ret := m.Called(extText)
+	var r0 *entity.FileExtension
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*entity.FileExtension)
+	}
+	return r0, ret.Error(1)
+}
+
+func (m *mockUserDefaultsRepository) SaveDefaults(defaults *entity.UserDefault) error {
+	return m.Called(defaults).Error(0)
+}
+
+func (m *mockInstitutionRepository) FindByID(id uint) (*entity.InstitutionIDCode, error) {
+	ret := m.Called(id)
+	var r0 *entity.InstitutionIDCode
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*entity.InstitutionIDCode)
+	}
+	return r0, ret.Error(1)
+}
+
+func (m *mockInstitutionRepository) FindActiveByCode(code string) (*entity.InstitutionIDCode, error) {
+	ret := m.Called(code)
+	var r0 *entity.InstitutionIDCode
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*entity.InstitutionIDCode)
+	}
+	return r0, ret.Error(1)
+}
+
+func (m *mockInstitutionRepository) FindByGRSciCollID(grscicollID string) (*entity.InstitutionIDCode, error) {
+	ret := m.Called(grscicollID)
+	var r0 *entity.InstitutionIDCode
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*entity.InstitutionIDCode)
+	}
+	return r0, ret.Error(1)
+}
+
+func (m *mockInstitutionRepository) Create(institution *entity.InstitutionIDCode) error {
+	return m.Called(institution).Error(0)
+}
+
+func (m *mockInstitutionRepository) Update(institution *entity.InstitutionIDCode) error {
+	return m.Called(institution).Error(0)
+}
+
+func (m *mockInstitutionRepository) SetDeactivatedAt(id uint, deactivatedAt *time.Time) error {
+	return m.Called(id, deactivatedAt).Error(0)
+}
+
+func (m *mockInstitutionRepository) CountSpecimens(id uint) (int64, error) {
+	ret := m.Called(id)
+	return ret.Get(0).(int64), ret.Error(1)
+}
+
+func (m *mockInstitutionRepository) FindActiveIDs(ids []uint) ([]uint, error) {
+	ret := m.Called(ids)
+	var r0 []uint
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]uint)
+	}
+	return r0, ret.Error(1)
+}
@@ -0,0 +1,177 @@
+// internal/service/occurrence_audit.go
+package service
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/saku-730/web-specimen/backend/internal/repository"
+	"gorm.io/gorm"
+)
+
+// change_logs.type に入れる操作の種類なのだ
+const (
+	changeTypeCreate = "create"
+	changeTypeUpdate = "update"
+	changeTypeDelete = "delete"
+)
+
+// auditOccurrence はfnの前後でoccurrenceのスナップショットを取って、変わった行をchange_logsに書くのだ
+// fnと同じトランザクションで書くので、どちらかが失敗したら両方ロールバックされるのだ
+func (s *occurrenceService) auditOccurrence(tx *gorm.DB, actor *model.Actor, occurrenceID uint, fn func() error) error {
+	before, err := s.changeLogRepo.Snapshot(tx, occurrenceID)
+	if err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	return s.recordChanges(tx, actor, occurrenceID, before)
+}
+
+// recordChanges は今のスナップショットを取って、beforeとの差分をchange_logsに書くのだ
+// 作成の時はbeforeに空のスナップショットを渡せばいいのだ
+func (s *occurrenceService) recordChanges(tx *gorm.DB, actor *model.Actor, occurrenceID uint, before repository.OccurrenceSnapshot) error {
+	return recordOccurrenceChanges(tx, s.changeLogRepo, actor, occurrenceID, before)
+}
+
+// recordOccurrenceChanges は差分をchange_logsに書くのだ
+// 方法の統合のように、occurrenceServiceの外でoccurrenceを書き換える時もこれを通すのだ
+func recordOccurrenceChanges(tx *gorm.DB, changeLogRepo repository.ChangeLogRepository, actor *model.Actor, occurrenceID uint, before repository.OccurrenceSnapshot) error {
+	after, err := changeLogRepo.Snapshot(tx, occurrenceID)
+	if err != nil {
+		return err
+	}
+	logs := buildChangeLogs(actor, occurrenceID, before, after)
+	if len(logs) == 0 {
+		return nil
+	}
+	return changeLogRepo.Create(tx, logs)
+}
+
+// writeOccurrences はoccurrenceを書き換えるfnをトランザクションで実行して、コミットできたらoccurrence_generationを上げるのだ
+// カウンターの行は1つしか無いので、トランザクションの中で上げると、全部の書き込みがその行ロックで1つずつしか進めなくなるのだ
+// コミットの後に上げるので、地図タイルのキャッシュが新しい数を見た時には、変更はもう見えるようになっているのだ
+func writeOccurrences(db *gorm.DB, changeLogRepo repository.ChangeLogRepository, fn func(tx *gorm.DB) error) error {
+	if err := db.Transaction(fn); err != nil {
+		return err
+	}
+	// 変更はもうコミットされているので、失敗してもエラーにはしないのだ。キャッシュは次の変更の時に捨てられるのだ
+	if err := changeLogRepo.BumpGeneration(); err != nil {
+		log.Printf("failed bump occurrence generation: %v", err)
+	}
+	return nil
+}
+
+// buildChangeLogs は2つのスナップショットを比べて、変わった行ごとにChangeLogを作るのだ
+// 親テーブルが先、同じテーブルの中では行IDの小さい順に並べるので、履歴の順番がいつも同じになるのだ
+func buildChangeLogs(actor *model.Actor, occurrenceID uint, before, after repository.OccurrenceSnapshot) []entity.ChangeLog {
+	var userID *int
+	if actor != nil {
+		id := int(actor.UserID)
+		userID = &id
+	}
+
+	var logs []entity.ChangeLog
+	for _, table := range repository.SnapshotTables {
+		beforeRows := before[table]
+		afterRows := after[table]
+
+		rowIDs := make([]uint, 0, len(beforeRows)+len(afterRows))
+		for id := range beforeRows {
+			rowIDs = append(rowIDs, id)
+		}
+		for id := range afterRows {
+			if _, ok := beforeRows[id]; !ok {
+				rowIDs = append(rowIDs, id)
+			}
+		}
+		sort.Slice(rowIDs, func(i, j int) bool { return rowIDs[i] < rowIDs[j] })
+
+		for _, rowID := range rowIDs {
+			beforeValue, hadBefore := beforeRows[rowID]
+			afterValue, hasAfter := afterRows[rowID]
+
+			var changeType string
+			switch {
+			case !hadBefore:
+				changeType = changeTypeCreate
+			case !hasAfter:
+				changeType = changeTypeDelete
+			case beforeValue != afterValue:
+				changeType = changeTypeUpdate
+			default:
+				continue // 変わっていない行は書かないのだ
+			}
+
+			tableName := table
+			changedID := int(rowID)
+			occID := occurrenceID
+			changeLog := entity.ChangeLog{
+				Type:         &changeType,
+				ChangedID:    &changedID,
+				UserID:       userID,
+				ChangedTable: &tableName,
+				OccurrenceID: &occID,
+			}
+			if hadBefore {
+				v := beforeValue
+				changeLog.BeforeValue = &v
+			}
+			if hasAfter {
+				v := afterValue
+				changeLog.AfterValue = &v
+			}
+			logs = append(logs, changeLog)
+		}
+	}
+	return logs
+}
+
+// GetOccurrenceHistory はoccurrenceの変更履歴を古い順に返すのだ
+// 完全に消されたoccurrenceはどのプロジェクトのものか分からないので、履歴を見られるのはadminだけなのだ
+func (s *occurrenceService) GetOccurrenceHistory(actor *model.Actor, id uint) ([]model.ChangeLogResponse, error) {
+	if err := s.authorizeOccurrence(actor, id, model.PermissionReadOccurrence); err != nil {
+		return nil, err
+	}
+
+	logs, err := s.changeLogRepo.FindByOccurrenceID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	history := []model.ChangeLogResponse{}
+	for _, l := range logs {
+		item := model.ChangeLogResponse{
+			LogID:  l.LogID,
+			RowID:  l.ChangedID,
+			UserID: l.UserID,
+			Date:   l.Date,
+			Before: rawJSON(l.BeforeValue),
+			After:  rawJSON(l.AfterValue),
+		}
+		if l.Type != nil {
+			item.Operation = *l.Type
+		}
+		if l.ChangedTable != nil {
+			item.TableName = *l.ChangedTable
+		}
+		if l.UserID != nil {
+			name := l.User.UserName
+			item.UserName = &name
+		}
+		history = append(history, item)
+	}
+	return history, nil
+}
+
+// rawJSON はDBに入っているJSON文字列をそのままレスポンスに埋め込むためのものなのだ。nilならnullになるのだ
+func rawJSON(value *string) json.RawMessage {
+	if value == nil {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(*value)
+}
@@ -0,0 +1,73 @@
+// internal/service/occurrence_audit_test.go
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/saku-730/web-specimen/backend/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+func TestRecordOccurrenceChanges(t *testing.T) {
+	actor := &model.Actor{UserID: 1}
+	before := repository.OccurrenceSnapshot{"occurrence": {5: `{"note":"a"}`}}
+
+	t.Run("変わった時は履歴を書くけど、トランザクションの中ではタイルのキャッシュの数を上げないのだ", func(t *testing.T) {
+		changeLogRepo := new(mockChangeLogRepository)
+		changeLogRepo.On("Snapshot", uint(5)).Return(repository.OccurrenceSnapshot{"occurrence": {5: `{"note":"b"}`}}, nil)
+		changeLogRepo.On("Create", mock.Anything).Return(nil)
+
+		assert.NoError(t, recordOccurrenceChanges(nil, changeLogRepo, actor, 5, before))
+		changeLogRepo.AssertExpectations(t)
+		changeLogRepo.AssertNotCalled(t, "BumpGeneration")
+	})
+
+	t.Run("何も変わっていなければ履歴を書かないのだ", func(t *testing.T) {
+		changeLogRepo := new(mockChangeLogRepository)
+		changeLogRepo.On("Snapshot", uint(5)).Return(before, nil)
+
+		assert.NoError(t, recordOccurrenceChanges(nil, changeLogRepo, actor, 5, before))
+		changeLogRepo.AssertNotCalled(t, "Create", mock.Anything)
+	})
+}
+
+func TestWriteOccurrences(t *testing.T) {
+	t.Run("コミットが終わってから、タイルのキャッシュの数を上げるのだ", func(t *testing.T) {
+		changeLogRepo := new(mockChangeLogRepository)
+		changeLogRepo.On("BumpGeneration").Return(nil)
+
+		err := writeOccurrences(newTestDB(t), changeLogRepo, func(tx *gorm.DB) error {
+			changeLogRepo.AssertNotCalled(t, "BumpGeneration")
+			return nil
+		})
+
+		assert.NoError(t, err)
+		changeLogRepo.AssertNumberOfCalls(t, "BumpGeneration", 1)
+	})
+
+	t.Run("ロールバックした時は上げないのだ", func(t *testing.T) {
+		changeLogRepo := new(mockChangeLogRepository)
+
+		err := writeOccurrences(newTestDB(t), changeLogRepo, func(tx *gorm.DB) error {
+			return ErrVersionConflict
+		})
+
+		assert.True(t, errors.Is(err, ErrVersionConflict))
+		changeLogRepo.AssertNotCalled(t, "BumpGeneration")
+	})
+
+	t.Run("上げるのに失敗しても、コミットした変更は成功として返すのだ", func(t *testing.T) {
+		changeLogRepo := new(mockChangeLogRepository)
+		changeLogRepo.On("BumpGeneration").Return(errors.New("db down"))
+
+		err := writeOccurrences(newTestDB(t), changeLogRepo, func(tx *gorm.DB) error {
+			return nil
+		})
+
+		assert.NoError(t, err)
+	})
+}
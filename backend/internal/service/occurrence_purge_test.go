@@ -0,0 +1,100 @@
+// internal/service/occurrence_purge_test.go
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"github.com/saku-730/web-specimen/backend/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// purgeFixture はoccurrence 5 に添付ファイルが2つ付いている状態を作るのだ
+// attachment 1 は他のoccurrenceも使っていて、attachment 2 はこのoccurrenceだけが使っているのだ
+type purgeFixture struct {
+	service       *occurrenceService
+	occRepo       *mockOccurrenceRepository
+	changeLogRepo *mockChangeLogRepository
+	sharedPath    string
+	ownPath       string
+}
+
+func newPurgeFixture(t *testing.T) *purgeFixture {
+	uploadDir := t.TempDir()
+	t.Setenv("UPLOAD_DIR", uploadDir)
+	f := &purgeFixture{
+		sharedPath: filepath.Join(uploadDir, "shared.jpg"),
+		ownPath:    filepath.Join(uploadDir, "own.jpg"),
+	}
+	for _, path := range []string{f.sharedPath, f.ownPath} {
+		if err := os.WriteFile(path, []byte("jpeg"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f.occRepo = new(mockOccurrenceRepository)
+
+	groupRepo := new(mockAttachmentGroupRepository)
+	groupRepo.On("FindByOccurrenceID", uint(5)).Return([]entity.AttachmentGroup{
+		{OccurrenceID: 5, AttachmentID: 1},
+		{OccurrenceID: 5, AttachmentID: 2},
+	}, nil)
+	groupRepo.On("DeleteByOccurrenceID", uint(5)).Return(nil)
+	groupRepo.On("CountByAttachmentID", uint(1)).Return(int64(1), nil)
+	groupRepo.On("CountByAttachmentID", uint(2)).Return(int64(0), nil)
+
+	attachmentRepo := new(mockAttachmentRepository)
+	attachmentRepo.On("FindByID", uint(2)).Return(&entity.Attachment{AttachmentID: 2, FilePath: f.ownPath}, nil)
+	attachmentRepo.On("Delete", uint(2)).Return(nil)
+
+	f.changeLogRepo = new(mockChangeLogRepository)
+	f.changeLogRepo.On("Snapshot", uint(5)).Return(repository.OccurrenceSnapshot{"occurrence": {5: `{"note":"a"}`}}, nil).Once()
+	f.changeLogRepo.On("Snapshot", uint(5)).Return(repository.OccurrenceSnapshot{}, nil).Once()
+	f.changeLogRepo.On("BumpGeneration").Return(nil)
+
+	f.service = &occurrenceService{
+		db:                  newTestDB(t),
+		occRepo:             f.occRepo,
+		attachmentRepo:      attachmentRepo,
+		attachmentGroupRepo: groupRepo,
+		changeLogRepo:       f.changeLogRepo,
+	}
+	return f
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestPurgeOccurrenceFiles(t *testing.T) {
+	t.Run("コミットが終わってから、誰も使わなくなったファイルだけ消すのだ", func(t *testing.T) {
+		f := newPurgeFixture(t)
+		f.occRepo.On("PurgeOccurrence", uint(5)).Return(nil)
+		// 履歴を書くのがトランザクションの最後なので、この時はまだファイルが残っていないといけないのだ
+		f.changeLogRepo.On("Create", mock.Anything).Run(func(mock.Arguments) {
+			assert.True(t, fileExists(f.ownPath), "file removed before commit")
+		}).Return(nil)
+
+		assert.NoError(t, f.service.PurgeOccurrence(nil, 5))
+
+		assert.False(t, fileExists(f.ownPath))
+		assert.True(t, fileExists(f.sharedPath))
+		f.changeLogRepo.AssertCalled(t, "Create", mock.Anything)
+	})
+
+	t.Run("ロールバックした時はファイルを消さないのだ", func(t *testing.T) {
+		f := newPurgeFixture(t)
+		f.occRepo.On("PurgeOccurrence", uint(5)).Return(nil)
+		f.changeLogRepo.On("Create", mock.Anything).Return(errors.New("insert failed"))
+
+		assert.Error(t, f.service.PurgeOccurrence(nil, 5))
+
+		assert.True(t, fileExists(f.ownPath))
+		assert.True(t, fileExists(f.sharedPath))
+	})
+}
@@ -0,0 +1,503 @@
+// internal/service/occurrence_revert.go
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/saku-730/web-specimen/backend/internal/repository"
+)
+
+// ErrInvalidRevertTarget は log_id と at の指定がおかしい時のエラーなのだ
+var ErrInvalidRevertTarget = errors.New("specify exactly one of log_id or at")
+
+// ErrRevisionNotFound は指定された時点のoccurrenceが変更ログから作れない時のエラーなのだ
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// revision は変更ログから組み立て直した、ある時点のoccurrenceなのだ
+type revision struct {
+	logID          uint
+	date           time.Time
+	req            *model.OccurrenceUpdate
+	classification *entity.ClassificationJSON
+}
+
+// PreviewRevert は指定した時点に戻すと何が変わるかを返すのだ。DBは何も変えないのだ
+func (s *occurrenceService) PreviewRevert(actor *model.Actor, id uint, query *model.RevertQuery) (*model.RevertPreview, error) {
+	if err := s.authorizeOccurrence(actor, id, model.PermissionReadOccurrence); err != nil {
+		return nil, err
+	}
+
+	occ, err := s.occRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	rev, err := s.buildRevision(id, query)
+	if err != nil {
+		return nil, err
+	}
+
+	currentDocument, err := updateDocument(occurrenceToUpdate(occ), occ.ClassificationJSON)
+	if err != nil {
+		return nil, err
+	}
+	revisionDocument, err := updateDocument(rev.req, rev.classification)
+	if err != nil {
+		return nil, err
+	}
+	revisionJSON, err := json.Marshal(revisionDocument)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.RevertPreview{
+		OccurrenceID: id,
+		Version:      occ.Version,
+		LogID:        rev.logID,
+		RevisionDate: rev.date,
+		Changes:      diffDocuments(currentDocument, revisionDocument),
+		Revision:     revisionJSON,
+	}, nil
+}
+
+// ApplyRevert は指定した時点の状態を、新しい変更としてoccurrenceに書き込むのだ
+// 普通の更新と同じ処理を通るので、戻したこと自体もchange_logsに残るのだ
+func (s *occurrenceService) ApplyRevert(actor *model.Actor, id uint, expectedVersion int, query *model.RevertQuery) (*model.OccurrenceDetailResponse, error) {
+	// バージョンや履歴のことを教える前に、編集できるかを確かめるのだ
+	if err := s.authorizeOccurrence(actor, id, model.PermissionEditOccurrence); err != nil {
+		return nil, err
+	}
+
+	occ, err := s.occRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if expectedVersion != 0 && expectedVersion != occ.Version {
+		return nil, ErrVersionConflict
+	}
+	// 戻す内容は読み込んだ時点の子レコードを元に作るので、書き込む時もそのバージョンのままか確認するのだ
+	expectedVersion = occ.Version
+
+	rev, err := s.buildRevision(id, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.updateOccurrence(actor, id, expectedVersion, rev.req, rev.classification)
+}
+
+// buildRevision は変更ログを古い順に当てていって、指定した時点のoccurrenceを組み立て直すのだ
+// 添付ファイルはディスクから消えているかもしれないので、戻す対象にはしないのだ
+func (s *occurrenceService) buildRevision(id uint, query *model.RevertQuery) (*revision, error) {
+	if (query.LogID == nil) == (query.At == nil) {
+		return nil, ErrInvalidRevertTarget
+	}
+
+	logs, err := s.changeLogRepo.FindByOccurrenceID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if query.LogID != nil {
+		found := false
+		for _, l := range logs {
+			if l.LogID == *query.LogID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: log_id %d is not a change of occurrence %d", ErrRevisionNotFound, *query.LogID, id)
+		}
+	}
+
+	// --- 1. 指定した時点までのログを当てて、その時の行を作り直す ---
+	state := make(repository.OccurrenceSnapshot)
+	var last *entity.ChangeLog
+	for i, l := range logs {
+		if query.LogID != nil && l.LogID > *query.LogID {
+			continue
+		}
+		if query.At != nil && l.Date.After(*query.At) {
+			continue
+		}
+		if l.ChangedTable == nil || l.ChangedID == nil {
+			continue
+		}
+
+		rows, ok := state[*l.ChangedTable]
+		if !ok {
+			rows = make(map[uint]string)
+			state[*l.ChangedTable] = rows
+		}
+		rowID := uint(*l.ChangedID)
+		if l.AfterValue == nil {
+			delete(rows, rowID)
+		} else {
+			rows[rowID] = *l.AfterValue
+		}
+		last = &logs[i]
+	}
+	if last == nil {
+		return nil, fmt.Errorf("%w: no change was recorded before that point", ErrRevisionNotFound)
+	}
+
+	// --- 2. 作り直した行をentityにして、PUTと同じ形のリクエストにする ---
+	occ, err := revisionToEntity(state, id)
+	if err != nil {
+		return nil, err
+	}
+	req := occurrenceToUpdate(occ)
+	if req.UserID == 0 {
+		return nil, fmt.Errorf("%w: occurrence had no user at that point", ErrRevisionNotFound)
+	}
+
+	// --- 3. 今はもう無い子レコードは、IDを外して新しく作り直してもらうのだ ---
+	current, err := s.changeLogRepo.Snapshot(s.db, id)
+	if err != nil {
+		return nil, err
+	}
+	for i := range req.Observations {
+		if _, ok := current["observations"][*req.Observations[i].ObservationID]; !ok {
+			req.Observations[i].ObservationID = nil
+		}
+	}
+	for i := range req.Specimens {
+		if _, ok := current["specimen"][*req.Specimens[i].SpecimenID]; !ok {
+			req.Specimens[i].SpecimenID = nil
+		}
+	}
+	for i := range req.Identifications {
+		if _, ok := current["identifications"][*req.Identifications[i].IdentificationID]; !ok {
+			req.Identifications[i].IdentificationID = nil
+		}
+	}
+
+	return &revision{
+		logID:          last.LogID,
+		date:           last.Date,
+		req:            req,
+		classification: occ.ClassificationJSON,
+	}, nil
+}
+
+// revisionTime はto_jsonbが書いた日時 (timestamptz や date) をどれでも読めるようにした型なのだ
+type revisionTime struct {
+	time.Time
+}
+
+func (t *revisionTime) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	if parsed, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		// DBから読んだ時と同じように、ローカルのタイムゾーンにそろえておくのだ
+		// 記録した時のタイムゾーンは、行のtimezoneカラムからそのまま戻すのだ
+		t.Time = parsed.Local()
+		return nil
+	}
+	parsed, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return fmt.Errorf("unsupported time format: %s", value)
+	}
+	t.Time = parsed
+	return nil
+}
+
+func (t *revisionTime) ptr() *time.Time {
+	if t == nil {
+		return nil
+	}
+	v := t.Time
+	return &v
+}
+
+// 以下はchange_logsに入っている行のJSONを読むための構造体なのだ。JSONのキーはDBのカラム名なのだ
+type occurrenceRevisionRow struct {
+	ProjectID        *uint         `json:"project_id"`
+	UserID           *uint         `json:"user_id"`
+	IndividualID     *int          `json:"individual_id"`
+	Lifestage        *string       `json:"lifestage"`
+	Sex              *string       `json:"sex"`
+	ClassificationID *uint         `json:"classification_id"`
+	PlaceID          *uint         `json:"place_id"`
+	BodyLength       *string       `json:"body_length"`
+	LanguageID       *uint         `json:"language_id"`
+	Note             *string       `json:"note"`
+	CreatedAt        *revisionTime `json:"created_at"`
+	Timezone         *string       `json:"timezone"`
+}
+
+type classificationRevisionRow struct {
+	ClassClassification json.RawMessage `json:"class_classification"`
+}
+
+type placeRevisionRow struct {
+	Coordinates        *string  `json:"coordinates"` // ST_AsTextのWKT ("POINT(lng lat)") なのだ
+	PlaceNameID        *uint    `json:"place_name_id"`
+	Accuracy           *float64 `json:"accuracy"`
+	GeoreferenceSource *string  `json:"georeference_source"`
+	GeodeticDatum      *string  `json:"geodetic_datum"`
+	GeoreferencedBy    *string  `json:"georeferenced_by"`
+	GeoreferencedDate  *string  `json:"georeferenced_date"` // dateはjsonbで "YYYY-MM-DD" になっているのだ
+}
+
+type placeNameRevisionRow struct {
+	ClassPlaceName json.RawMessage `json:"class_place_name"`
+}
+
+type observationRevisionRow struct {
+	UserID              *uint         `json:"user_id"`
+	ObservationMethodID *uint         `json:"observation_method_id"`
+	Behavior            *string       `json:"behavior"`
+	ObservedAt          *revisionTime `json:"observed_at"`
+	Timezone            *string       `json:"timezone"`
+}
+
+type specimenRevisionRow struct {
+	SpecimenMethodID *uint   `json:"specimen_method_id"`
+	InstitutionID    *uint   `json:"institution_id"`
+	CollectionID     *string `json:"collection_id"`
+}
+
+type makeSpecimenRevisionRow struct {
+	UserID           *uint         `json:"user_id"`
+	SpecimenID       *uint         `json:"specimen_id"`
+	SpecimenMethodID *uint         `json:"specimen_method_id"`
+	Date             *revisionTime `json:"date"`
+	Timezone         *string       `json:"timezone"`
+}
+
+type identificationRevisionRow struct {
+	UserID          *uint         `json:"user_id"`
+	SourceInfo      *string       `json:"source_info"`
+	IdentificatedAt *revisionTime `json:"identificated_at"`
+	Timezone        *string       `json:"timezone"`
+}
+
+// revisionToEntity は組み立て直した行から、occurrenceToUpdateに渡せるentityを作るのだ
+// タイムゾーンとmake_specimenの作成方法も行から入れておくので、戻した時にその時の値がそのまま書かれるのだ
+func revisionToEntity(state repository.OccurrenceSnapshot, id uint) (*entity.Occurrence, error) {
+	occData, ok := state["occurrence"][id]
+	if !ok {
+		return nil, fmt.Errorf("%w: occurrence did not exist at that point", ErrRevisionNotFound)
+	}
+	var occRow occurrenceRevisionRow
+	if err := json.Unmarshal([]byte(occData), &occRow); err != nil {
+		return nil, err
+	}
+
+	occ := &entity.Occurrence{
+		OccurrenceID: id,
+		ProjectID:    occRow.ProjectID,
+		UserID:       occRow.UserID,
+		IndividualID: occRow.IndividualID,
+		Lifestage:    occRow.Lifestage,
+		Sex:          occRow.Sex,
+		BodyLength:   occRow.BodyLength,
+		LanguageID:   occRow.LanguageID,
+		Note:         occRow.Note,
+		CreatedAt:    occRow.CreatedAt.ptr(),
+		Timezone:     occRow.Timezone,
+	}
+
+	if occRow.ClassificationID != nil {
+		if data, ok := state["classification_json"][*occRow.ClassificationID]; ok {
+			var row classificationRevisionRow
+			if err := json.Unmarshal([]byte(data), &row); err != nil {
+				return nil, err
+			}
+			occ.ClassificationJSON = &entity.ClassificationJSON{ClassClassification: []byte(row.ClassClassification)}
+		}
+	}
+
+	if occRow.PlaceID != nil {
+		if data, ok := state["places"][*occRow.PlaceID]; ok {
+			var row placeRevisionRow
+			if err := json.Unmarshal([]byte(data), &row); err != nil {
+				return nil, err
+			}
+			place := &entity.Place{
+				PlaceID:            *occRow.PlaceID,
+				PlaceNameID:        row.PlaceNameID,
+				Accuracy:           row.Accuracy,
+				GeoreferenceSource: row.GeoreferenceSource,
+				GeodeticDatum:      row.GeodeticDatum,
+				GeoreferencedBy:    row.GeoreferencedBy,
+			}
+			if row.GeoreferencedDate != nil {
+				if date, err := time.Parse(dateLayout, *row.GeoreferencedDate); err == nil {
+					place.GeoreferencedDate = &date
+				}
+			}
+			if row.Coordinates != nil {
+				var lng, lat float64
+				if _, err := fmt.Sscanf(*row.Coordinates, "POINT(%g %g)", &lng, &lat); err == nil {
+					place.Coordinates = &entity.Point{Lat: &lat, Lng: &lng}
+				}
+			}
+			if row.PlaceNameID != nil {
+				if nameData, ok := state["place_names_json"][*row.PlaceNameID]; ok {
+					var nameRow placeNameRevisionRow
+					if err := json.Unmarshal([]byte(nameData), &nameRow); err != nil {
+						return nil, err
+					}
+					place.PlaceNamesJSON = &entity.PlaceNamesJSON{ClassPlaceName: []byte(nameRow.ClassPlaceName)}
+				}
+			}
+			occ.Place = place
+		}
+	}
+
+	for _, rowID := range sortedRowIDs(state["observations"]) {
+		var row observationRevisionRow
+		if err := json.Unmarshal([]byte(state["observations"][rowID]), &row); err != nil {
+			return nil, err
+		}
+		occ.Observations = append(occ.Observations, entity.Observation{
+			ObservationsID:      rowID,
+			UserID:              row.UserID,
+			ObservationMethodID: row.ObservationMethodID,
+			Behavior:            row.Behavior,
+			ObservedAt:          row.ObservedAt.ptr(),
+			Timezone:            row.Timezone,
+		})
+	}
+
+	for _, rowID := range sortedRowIDs(state["specimen"]) {
+		var row specimenRevisionRow
+		if err := json.Unmarshal([]byte(state["specimen"][rowID]), &row); err != nil {
+			return nil, err
+		}
+		occ.Specimens = append(occ.Specimens, entity.Specimen{
+			SpecimenID:       rowID,
+			SpecimenMethodID: row.SpecimenMethodID,
+			InstitutionID:    row.InstitutionID,
+			CollectionID:     row.CollectionID,
+		})
+	}
+
+	for _, rowID := range sortedRowIDs(state["make_specimen"]) {
+		var row makeSpecimenRevisionRow
+		if err := json.Unmarshal([]byte(state["make_specimen"][rowID]), &row); err != nil {
+			return nil, err
+		}
+		occ.MakeSpecimens = append(occ.MakeSpecimens, entity.MakeSpecimen{
+			MakeSpecimenID:   rowID,
+			UserID:           row.UserID,
+			SpecimenID:       row.SpecimenID,
+			SpecimenMethodID: row.SpecimenMethodID,
+			Date:             row.Date.ptr(),
+			Timezone:         row.Timezone,
+		})
+	}
+
+	for _, rowID := range sortedRowIDs(state["identifications"]) {
+		var row identificationRevisionRow
+		if err := json.Unmarshal([]byte(state["identifications"][rowID]), &row); err != nil {
+			return nil, err
+		}
+		occ.Identifications = append(occ.Identifications, entity.Identification{
+			IdentificationID: rowID,
+			UserID:           row.UserID,
+			SourceInfo:       row.SourceInfo,
+			IdentificatedAt:  row.IdentificatedAt.ptr(),
+			Timezone:         row.Timezone,
+		})
+	}
+
+	return occ, nil
+}
+
+func sortedRowIDs(rows map[uint]string) []uint {
+	ids := make([]uint, 0, len(rows))
+	for id := range rows {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// diffDocuments は2つのドキュメントを項目ごとにばらして、値が違う項目だけを返すのだ
+func diffDocuments(current, reverted map[string]json.RawMessage) []model.RevertChange {
+	currentFields := map[string]json.RawMessage{}
+	revertedFields := map[string]json.RawMessage{}
+	for key, value := range current {
+		flattenJSON(key, value, currentFields)
+	}
+	for key, value := range reverted {
+		flattenJSON(key, value, revertedFields)
+	}
+
+	fields := make([]string, 0, len(currentFields)+len(revertedFields))
+	for field := range currentFields {
+		fields = append(fields, field)
+	}
+	for field := range revertedFields {
+		if _, ok := currentFields[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	changes := []model.RevertChange{}
+	for _, field := range fields {
+		before, ok := currentFields[field]
+		if !ok {
+			before = json.RawMessage("null")
+		}
+		after, ok := revertedFields[field]
+		if !ok {
+			after = json.RawMessage("null")
+		}
+		if bytes.Equal(before, after) {
+			continue
+		}
+		changes = append(changes, model.RevertChange{Field: field, Current: before, Reverted: after})
+	}
+	return changes
+}
+
+// flattenJSON はオブジェクトと配列を "a.b[0].c" のようなパスにばらして out に入れるのだ
+// 値は一度デコードしてから書き直すので、キーの順番や空白の違いは差分にならないのだ
+func flattenJSON(path string, raw json.RawMessage, out map[string]json.RawMessage) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		out[path] = raw
+		return
+	}
+	flattenValue(path, value, out)
+}
+
+func flattenValue(path string, value interface{}, out map[string]json.RawMessage) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			flattenValue(path+"."+key, child, out)
+		}
+	case []interface{}:
+		for i, child := range v {
+			flattenValue(fmt.Sprintf("%s[%d]", path, i), child, out)
+		}
+	default:
+		if v == nil {
+			// nullは「項目が無い」のと同じに扱うのだ
+			return
+		}
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return
+		}
+		out[path] = encoded
+	}
+}
@@ -0,0 +1,69 @@
+// internal/service/occurrence_revert_test.go
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/saku-730/web-specimen/backend/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// changeLog は行をafter_valueに入れた変更ログを作るのだ
+func changeLog(logID uint, table string, rowID int, after string) entity.ChangeLog {
+	return entity.ChangeLog{LogID: logID, ChangedTable: &table, ChangedID: &rowID, AfterValue: &after}
+}
+
+func TestApplyRevert(t *testing.T) {
+	t.Run("編集できない人には、バージョンも履歴も見せないのだ", func(t *testing.T) {
+		occRepo := new(mockOccurrenceRepository)
+		occRepo.On("FindOwnership", uint(5)).Return(nil, uintPtr(2), nil)
+		changeLogRepo := new(mockChangeLogRepository)
+		s := &occurrenceService{occRepo: occRepo, changeLogRepo: changeLogRepo}
+
+		logID := uint(1)
+		_, err := s.ApplyRevert(&model.Actor{UserID: 1, Role: model.RoleCollector}, 5, 99, &model.RevertQuery{LogID: &logID})
+
+		assert.True(t, errors.Is(err, ErrForbidden))
+		occRepo.AssertNotCalled(t, "FindByID", uint(5))
+		changeLogRepo.AssertNotCalled(t, "FindByOccurrenceID", uint(5))
+	})
+
+	t.Run("タイムゾーンとmake_specimenの作成方法は、その時の行から戻すのだ", func(t *testing.T) {
+		occRepo := new(mockOccurrenceRepository)
+		occRepo.On("UpdateOccurrence", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+		s := newPatchTestService(t, occRepo)
+		changeLogRepo := new(mockChangeLogRepository)
+		changeLogRepo.On("FindByOccurrenceID", uint(5)).Return([]entity.ChangeLog{
+			changeLog(1, "occurrence", 5, `{"user_id":1,"note":"first","created_at":"2024-04-30T16:00:00+00:00","timezone":"+09:00"}`),
+			changeLog(2, "observations", 11, `{"observed_at":"2024-04-30T16:00:00+00:00","timezone":"+09:00"}`),
+			changeLog(3, "specimen", 21, `{"specimen_method_id":2}`),
+			changeLog(4, "make_specimen", 31, `{"specimen_id":21,"specimen_method_id":5,"date":"2024-04-30T16:00:00+00:00","timezone":"-03:00"}`),
+		}, nil)
+		changeLogRepo.On("Snapshot", uint(5)).Return(repository.OccurrenceSnapshot{
+			"observations": {11: "{}"},
+			"specimen":     {21: "{}"},
+		}, nil)
+		changeLogRepo.On("Create", mock.Anything).Return(nil)
+		changeLogRepo.On("BumpGeneration").Return(nil)
+		s.changeLogRepo = changeLogRepo
+
+		logID := uint(4)
+		_, err := s.ApplyRevert(&model.Actor{UserID: 1, Role: model.RoleCollector}, 5, 3, &model.RevertQuery{LogID: &logID})
+		assert.NoError(t, err)
+
+		args := updateOccurrenceArgs(occRepo)
+		occurrence := args.Get(0).(*entity.Occurrence)
+		observations := args.Get(1).([]entity.Observation)
+		makeSpecimens := args.Get(2).([]entity.MakeSpecimen)
+
+		assert.Equal(t, "first", *occurrence.Note)
+		assert.Equal(t, "+09:00", *occurrence.Timezone)
+		assert.Equal(t, "+09:00", *observations[0].Timezone)
+		assert.Equal(t, "-03:00", *makeSpecimens[0].Timezone)
+		assert.Equal(t, uint(5), *makeSpecimens[0].SpecimenMethodID)
+	})
+}
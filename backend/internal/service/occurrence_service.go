@@ -13,20 +13,43 @@ import (
 	"io"
 	"strings"
 	"math"
+	"log"
 
 	"github.com/saku-730/web-specimen/backend/internal/entity"
 	"github.com/saku-730/web-specimen/backend/internal/model"
 	"github.com/saku-730/web-specimen/backend/internal/repository"
+	"github.com/saku-730/web-specimen/backend/internal/util"
 )
 
+// ErrChildNotFound は更新リクエストの子レコードIDが、そのoccurrenceのものではない時のエラーなのだ
+var ErrChildNotFound = repository.ErrChildNotFound
+
+// ErrVersionConflict はIf-Matchのバージョンが今のoccurrenceと合わない時のエラーなのだ
+var ErrVersionConflict = repository.ErrVersionConflict
+
+// ErrInvalidPatch はmerge patchの中身がoccurrenceとして成り立たない時のエラーなのだ
+var ErrInvalidPatch = errors.New("invalid merge patch")
+
 // OccurrenceServiceのインターフェース。役割をはっきり分けたのだ。
 type OccurrenceService interface {
 	PrepareCreatePage() (*model.Dropdowns, error)
 	GetDefaultValues(userID int) (*model.DefaultValues, error)
-	CreateOccurrence(req *model.OccurrenceCreate)(*entity.Occurrence, error)
-	AttachFiles (occurrenceID uint, userID uint, files []*multipart.FileHeader) ([]string, error)
-	Search(query *model.SearchQuery) (*model.SearchResponse, error)
-	GetOccurrenceDetail(id uint) (*model.OccurrenceDetailResponse, error)
+	CreateOccurrence(actor *model.Actor, req *model.OccurrenceCreate)(*entity.Occurrence, error)
+	AttachFiles (actor *model.Actor, occurrenceID uint, files []*multipart.FileHeader) ([]string, error)
+	Search(actor *model.Actor, query *model.SearchQuery) (*model.SearchResponse, error)
+	SearchEach(actor *model.Actor, query *model.SearchQuery, fn func(result *model.OccurrenceResult) error) error
+	GetTile(actor *model.Actor, query *model.SearchQuery, z, x, y int) (*model.Tile, error)
+	GetOccurrenceDetail(actor *model.Actor, id uint) (*model.OccurrenceDetailResponse, error)
+	UpdateOccurrence(actor *model.Actor, id uint, expectedVersion int, req *model.OccurrenceUpdate) (*model.OccurrenceDetailResponse, error)
+	PatchOccurrence(actor *model.Actor, id uint, expectedVersion int, patch []byte) (*model.OccurrenceDetailResponse, error)
+	DeleteOccurrence(actor *model.Actor, id uint, expectedVersion int) error
+	ListTrash(actor *model.Actor, query *model.TrashQuery) (*model.TrashResponse, error)
+	RestoreOccurrence(actor *model.Actor, id uint) error
+	PurgeOccurrence(actor *model.Actor, id uint) error
+	PurgeExpiredTrash(retention time.Duration) (int, error)
+	GetOccurrenceHistory(actor *model.Actor, id uint) ([]model.ChangeLogResponse, error)
+	PreviewRevert(actor *model.Actor, id uint, query *model.RevertQuery) (*model.RevertPreview, error)
+	ApplyRevert(actor *model.Actor, id uint, expectedVersion int, query *model.RevertQuery) (*model.OccurrenceDetailResponse, error)
 }
 
 // occurrenceService構造体。必要なリポジトリを全部持たせるのだ。
@@ -37,6 +60,11 @@ type occurrenceService struct {
 	attachmentRepo    repository.AttachmentRepository
 	attachmentGroupRepo repository.AttachmentGroupRepository
 	fileExtRepo	repository.FileExtensionRepository
+	changeLogRepo	repository.ChangeLogRepository
+	projectMemberRepo	repository.ProjectMemberRepository
+	projectRepo	repository.ProjectRepository
+	institutionRepo	repository.InstitutionRepository
+	tileCache	*tileCache
 }
 
 // NewOccurrenceService は、必要なリポジトリを全部引数で受け取るのだ！
@@ -47,6 +75,10 @@ func NewOccurrenceService(
 	attRepo repository.AttachmentRepository, 
 	attGroupRepo repository.AttachmentGroupRepository,
 	fileExtRepo	repository.FileExtensionRepository,
+	changeLogRepo	repository.ChangeLogRepository,
+	projectMemberRepo	repository.ProjectMemberRepository,
+	projectRepo	repository.ProjectRepository,
+	institutionRepo	repository.InstitutionRepository,
 ) OccurrenceService {
 	return &occurrenceService{
 		db:	      db,
@@ -55,6 +87,11 @@ func NewOccurrenceService(
 		attachmentRepo: attRepo,
 		attachmentGroupRepo: attGroupRepo,
 		fileExtRepo: fileExtRepo,
+		changeLogRepo: changeLogRepo,
+		projectMemberRepo: projectMemberRepo,
+		projectRepo: projectRepo,
+		institutionRepo: institutionRepo,
+		tileCache: newTileCache(),
 	}
 }
 
@@ -63,61 +100,9 @@ func (s *occurrenceService) PrepareCreatePage() (*model.Dropdowns, error) {
 	return s.occRepo.GetDropdownLists()
 }
 
-// GetDefaultValues は、DBから取得したフラットなデータをネストされたモデルに組み立てるのだ！
+// GetDefaultValues は作成ページに出すユーザーのデフォルト値を返すのだ
 func (s *occurrenceService) GetDefaultValues(userID int) (*model.DefaultValues, error) {
-	// 1. リポジトリからフラットなentity(部品)を取得
-	entity, err := s.defaultsRepo.FindDefaultsByUserID(userID)
-	if err != nil {
-		// もしユーザーのデフォルト設定がDBに無かったら、空っぽのデフォルト値を返す
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return &model.DefaultValues{UserID: userID}, nil // userIDだけセットして返す
-		}
-		return nil, err // それ以外のDBエラー
-	}
-
-	response := &model.DefaultValues{
-		UserID:         entity.UserID,
-		UserName:       entity.UserName, // ポインタ型なのでデリファレンスするのだ ProjectID:      entity.ProjectID, ProjectName:    entity.ProjectName,
-		IndividualID:   entity.IndividualID,
-		Lifestage:      entity.Lifestage,
-		Sex:            entity.Sex,
-		LanguageID:     entity.LanguageID,
-		LanguageCommon: entity.LanguageCommon,
-		PlaceName:      entity.PlaceName,
-		Note:           entity.Note,
-		Classification: model.Classification{
-			Species: entity.ClassificationSpecies,
-			Genus:   entity.ClassificationGenus,
-			Family:  entity.ClassificationFamily,
-			Order:   entity.ClassificationOrder,
-			Class:   entity.ClassificationClass,
-			Phylum:  entity.ClassificationPhylum,
-			Kingdom: entity.ClassificationKingdom,
-			Others:  entity.ClassificationOthers,
-		},
-		Observation: model.Observation{
-			ObservationUserID:     entity.ObservationUserID,
-			ObservationUser:       entity.ObservationUserName,
-			ObservationMethodID:   entity.ObservationMethodID,
-			ObservationMethodName: entity.ObservationMethodName,
-			Behavior:              entity.ObservationBehavior,
-			ObservedAt:            entity.ObservationObservedAt,
-		},
-		Specimen: model.Specimen{
-			SpecimenUserID:          entity.SpecimenUserID,
-			SpecimenUser:            entity.SpecimenUserName,
-			SpecimenMethodsID:       entity.SpecimenMethodID,
-			SpecimenMethodsCommon: entity.SpecimenMethodName,
-		},
-		Identification: model.Identification{
-			IdentificationUserID: entity.IdentificationUserID,
-			IdentificationUser:   entity.IdentificationUserName,
-			IdentifiedAt:         entity.IdentificationIdentifiedAt,
-			SourceInfo:           entity.IdentificationSourceInfo,
-		},
-	}
-
-	return response, nil
+	return loadDefaultValues(s.defaultsRepo, userID)
 }
 
 func formatTimezone(t *time.Time) *string {
@@ -136,10 +121,100 @@ func formatTimezone(t *time.Time) *string {
 	return &timezoneStr // 文字列へのポインタを返す
 }
 
+// timezoneFor はDBに入っていたタイムゾーンを持ってきていればそれを、無ければ日時から作るのだ
+func timezoneFor(t *time.Time, stored *string) *string {
+	if stored != nil {
+		return stored
+	}
+	return formatTimezone(t)
+}
 
+// buildClassification は分類のリクエストをclassification_jsonのentityに変換するのだ
+func buildClassification(req *model.ClassificationCreate) *entity.ClassificationJSON {
+	if req == nil {
+		return nil
+	}
+	classMap := map[string]interface{}{
+		"species": req.Species, "genus": req.Genus, "family": req.Family, 
+		"order": req.Order, "class": req.Class, "phylum": req.Phylum, 
+		"kingdom": req.Kingdom, "others": req.Others,
+	}
+	classJSON, _ := json.Marshal(classMap)
+	return &entity.ClassificationJSON{ClassClassification: classJSON}
+}
+
+// buildPlace は場所に関する情報が何か一つでもあればplaceとplace_names_jsonのentityを作るのだ
+// 座標の決め方 (georeference) だけが送られてきた時も、消えないようにplaceを作るのだ
+func buildPlace(placeNameReq *string, latitude *float64, longitude *float64, georef *model.Georeference) (*entity.Place, *entity.PlaceNamesJSON, error) {
+	if !((placeNameReq != nil && *placeNameReq != "") ||
+		(latitude != nil && *latitude != 0) ||
+		(longitude != nil && *longitude != 0) ||
+		hasGeoreference(georef)) {
+		return nil, nil, nil
+	}
+
+	var name string
+	if placeNameReq != nil {
+		name = *placeNameReq
+	}
+	placeNameMap := map[string]interface{}{"name": name}
+	placeNameJSON, _ := json.Marshal(placeNameMap)
+	placeName := &entity.PlaceNamesJSON{ClassPlaceName: placeNameJSON}
+
+	place := &entity.Place{}
+	// 緯度と経度は両方そろっている時だけ座標にするのだ (片方だけだとPoint.Valueが作れない)
+	if latitude != nil && longitude != nil {
+		place.Coordinates = &entity.Point{Lat: latitude, Lng: longitude}
+	}
+	if err := applyGeoreference(place, georef); err != nil {
+		return nil, nil, err
+	}
+	return place, placeName, nil
+}
 
+func buildObservation(req *model.ObservationCreate) *entity.Observation {
+	return &entity.Observation{
+		UserID:              req.ObservationUserID,
+		ObservationMethodID: req.ObservationMethodID,
+		Behavior:            req.Behavior,
+		ObservedAt:          req.ObservedAt,
+		Timezone:            timezoneFor(req.ObservedAt, req.Timezone), // formatTimezone内でnilチェック済み
+	}
+}
 
-func (s *occurrenceService) CreateOccurrence(req *model.OccurrenceCreate) (*entity.Occurrence, error) {
+func buildSpecimen(req *model.SpecimenCreate) (*entity.Specimen, *entity.MakeSpecimen) {
+	specimen := &entity.Specimen{
+		SpecimenMethodID: req.SpecimenMethodsID,
+		InstitutionID:    req.InstitutionID,
+		CollectionID:     req.CollectionID,
+	}
+	makeSpecimen := &entity.MakeSpecimen{
+		UserID:           req.SpecimenUserID,
+		SpecimenMethodID: req.SpecimenMethodsID,
+		Date:             req.CreatedAt,
+		Timezone:         timezoneFor(req.CreatedAt, req.Timezone), // formatTimezone内でnilチェック済み
+	}
+	// make_specimenの方の作成方法が持ってきてあれば、標本の作成方法で上書きしないのだ
+	if req.MakeSpecimenMethodID != nil {
+		makeSpecimen.SpecimenMethodID = req.MakeSpecimenMethodID
+	}
+	return specimen, makeSpecimen
+}
+
+func buildIdentification(req *model.IdentificationCreate) *entity.Identification {
+	return &entity.Identification{
+		UserID:          req.IdentificationUserID,
+		SourceInfo:      req.SourceInfo,
+		IdentificatedAt: req.IdentifiedAt,
+		Timezone:        timezoneFor(req.IdentifiedAt, req.Timezone), // formatTimezone内でnilチェック済み
+	}
+}
+
+
+
+
+
+func (s *occurrenceService) CreateOccurrence(actor *model.Actor, req *model.OccurrenceCreate) (*entity.Occurrence, error) {
     // --- 1. リクエストDTOを各Entityオブジェクトに変換 ---
 
 	// まず、nilになる可能性のある変数をすべてnilで宣言しておくのだ。これが安全の基本！
@@ -153,66 +228,28 @@ func (s *occurrenceService) CreateOccurrence(req *model.OccurrenceCreate) (*enti
 
 
 	// 1. Classification: フロントエンドからデータが送られてきた場合のみ、entityを作成する。
-	if req.Classification != nil {
-		classMap := map[string]interface{}{
-			"species": req.Classification.Species, "genus": req.Classification.Genus, "family": req.Classification.Family, 
-			"order": req.Classification.Order, "class": req.Classification.Class, "phylum": req.Classification.Phylum, 
-			"kingdom": req.Classification.Kingdom, "others": req.Classification.Others,
-		}
-		classJSON, _ := json.Marshal(classMap)
-		classification = &entity.ClassificationJSON{ClassClassification: classJSON}
-	}
+	classification = buildClassification(req.Classification)
 
 	// 2. Place: 場所に関する情報が何か一つでも送られてきた場合のみ、entityを作成する。
-	if (req.PlaceName != nil && *req.PlaceName != "") || 
-	   (req.Latitude != nil && *req.Latitude != 0) || 
-	   (req.Longitude != nil && *req.Longitude != 0) {
-		
-		var name string
-		if req.PlaceName != nil {
-			name = *req.PlaceName
-		}
-		placeNameMap := map[string]interface{}{"name": name}
-		placeNameJSON, _ := json.Marshal(placeNameMap)
-		placeName = &entity.PlaceNamesJSON{ClassPlaceName: placeNameJSON}
-
-		place = &entity.Place{Coordinates: &entity.Point{Lat: req.Latitude, Lng: req.Longitude}}
+	var err error
+	place, placeName, err = buildPlace(req.PlaceName, req.Latitude, req.Longitude, &req.Georeference)
+	if err != nil {
+		return nil, err
 	}
 
 	// 3. Observation: データが送られてきた場合のみ、entityを作成する。
 	if req.Observation != nil {
-		observation = &entity.Observation{
-			UserID:              req.Observation.ObservationUserID,
-			ObservationMethodID: req.Observation.ObservationMethodID,
-			Behavior:            req.Observation.Behavior,
-			ObservedAt:          req.Observation.ObservedAt,
-			Timezone:            formatTimezone(req.Observation.ObservedAt), // formatTimezone内でnilチェック済み
-		}
+		observation = buildObservation(req.Observation)
 	}
 	
 	// 4. Specimen: データが送られてきた場合のみ、entityを作成する。
 	if req.Specimen != nil {
-		specimen = &entity.Specimen{
-			SpecimenMethodID: req.Specimen.SpecimenMethodsID,
-			InstitutionID:    req.Specimen.InstitutionID,
-			CollectionID:     req.Specimen.CollectionID,
-		}
-		makeSpecimen = &entity.MakeSpecimen{
-			UserID:           req.Specimen.SpecimenUserID,
-			SpecimenMethodID: req.Specimen.SpecimenMethodsID,
-			Date:             req.Specimen.CreatedAt,
-			Timezone:         formatTimezone(req.Specimen.CreatedAt), // formatTimezone内でnilチェック済み
-		}
+		specimen, makeSpecimen = buildSpecimen(req.Specimen)
 	}
 
 	// 5. Identification: データが送られてきた場合のみ、entityを作成する。
 	if req.Identification != nil {
-		identification = &entity.Identification{
-			UserID:          req.Identification.IdentificationUserID,
-			SourceInfo:      req.Identification.SourceInfo,
-			IdentificatedAt: req.Identification.IdentifiedAt,
-			Timezone:        formatTimezone(req.Identification.IdentifiedAt), // formatTimezone内でnilチェック済み
-		}
+		identification = buildIdentification(req.Identification)
 	}
 
     // 6. 最後に、必須項目とトップレベルの任意項目でoccurrenceを作る。
@@ -230,13 +267,28 @@ func (s *occurrenceService) CreateOccurrence(req *model.OccurrenceCreate) (*enti
 		Timezone:     formatTimezone(req.CreatedAt), // CreatedAtは必須と仮定
 	}
 	
+	// プロジェクトに記録していいかを先に確かめるのだ
+	if err := s.authorizeProject(actor, req.ProjectID, &req.UserID, model.PermissionCreateOccurrence); err != nil {
+		return nil, err
+	}
+	// 新しい標本には、無効にした機関は付けられないのだ
+	if specimen != nil {
+		if err := checkInstitutionsActive(s.institutionRepo, []entity.Specimen{*specimen}, nil); err != nil {
+			return nil, err
+		}
+	}
+
 	var createdOccurrence *entity.Occurrence
 
 	// --- 2. トランザクションを開始してRepositoryを呼び出す ---
-	err := s.db.Transaction(func(tx *gorm.DB) error {
+	err = writeOccurrences(s.db, s.changeLogRepo, func(tx *gorm.DB) error {
 		var err error
 		createdOccurrence, err = s.occRepo.CreateOccurrence(tx, occurrence, classification, place, placeName, observation, specimen, makeSpecimen, identification)
-		return err
+		if err != nil {
+			return err
+		}
+		// 作る前は何も無いので、作った行が全部createとして記録されるのだ
+		return s.recordChanges(tx, actor, createdOccurrence.OccurrenceID, repository.OccurrenceSnapshot{})
 	})
 
 	if err != nil {
@@ -249,7 +301,19 @@ func (s *occurrenceService) CreateOccurrence(req *model.OccurrenceCreate) (*enti
 
 
 
-func (s *occurrenceService) AttachFiles(occurrenceID uint, userID uint, files []*multipart.FileHeader) ([]string, error) {
+func (s *occurrenceService) AttachFiles(actor *model.Actor, occurrenceID uint, files []*multipart.FileHeader) ([]string, error) {
+	if err := s.authorizeOccurrence(actor, occurrenceID, model.PermissionUploadAttachment); err != nil {
+		return nil, err
+	}
+	// 権限の確認はゴミ箱の中も探すので、ゴミ箱に入っていたらここで見つからないことにするのだ
+	exists, err := s.occRepo.Exists(occurrenceID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, gorm.ErrRecordNotFound
+	}
+
 	//prepare dir
 	uploadDir := os.Getenv("UPLOAD_DIR")
 	if err := os.MkdirAll(uploadDir, os.ModePerm); err != nil {
@@ -259,70 +323,78 @@ func (s *occurrenceService) AttachFiles(occurrenceID uint, userID uint, files []
 	var savedFileNames []string
 
 	// --- save file and file info to database ---
-	err := s.db.Transaction(func(tx *gorm.DB) error {
-		for _, fileHeader := range files {
-			// --- ファイルをサーバーに保存 ---
-			// 衝突を避けるためにユニークなファイル名を生成
-			uniqueFileName := fmt.Sprintf("%d-%s", time.Now().UnixNano(), fileHeader.Filename)
-			destPath := filepath.Join(uploadDir, uniqueFileName)
+	userID := actor.UserID
+	err = writeOccurrences(s.db, s.changeLogRepo, func(tx *gorm.DB) error {
+		return s.auditOccurrence(tx, actor, occurrenceID, func() error {
+			// 添付ファイルも詳細の一部なので、バージョンを上げてETagが変わるようにするのだ
+			// 行ロックも取れるので、同時にゴミ箱に入れられたらここで見つからなくなるのだ
+			if err := s.occRepo.BumpVersion(tx, occurrenceID, 0); err != nil {
+				return err
+			}
+			for _, fileHeader := range files {
+				// --- ファイルをサーバーに保存 ---
+				// 衝突を避けるためにユニークなファイル名を生成
+				uniqueFileName := fmt.Sprintf("%d-%s", time.Now().UnixNano(), fileHeader.Filename)
+				destPath := filepath.Join(uploadDir, uniqueFileName)
 			
-			src, err := fileHeader.Open()
-			if err != nil { return err }
-			defer src.Close()
+				src, err := fileHeader.Open()
+				if err != nil { return err }
+				defer src.Close()
 
-			dst, err := os.Create(destPath)
-			if err != nil { return err }
-			defer dst.Close()
+				dst, err := os.Create(destPath)
+				if err != nil { return err }
+				defer dst.Close()
 
-			if _, err := io.Copy(dst, src); err != nil { return err }
+				if _, err := io.Copy(dst, src); err != nil { return err }
 
-			ext := filepath.Ext(fileHeader.Filename)
-			// unified to lowercase
-			ext = strings.ToLower(ext)
+				ext := filepath.Ext(fileHeader.Filename)
+				// unified to lowercase
+				ext = strings.ToLower(ext)
 
-			var extensionID *uint
+				var extensionID *uint
 	
-			if ext != "" {
-				fileExtEntity, err := s.fileExtRepo.FindByText(tx, ext)
-				// gorm.ErrRecordNotFound の場合は、見つからなかっただけなので処理を続ける
-				// それ以外のDBエラーの場合は、トランザクションを失敗させる
-				if err != nil && err != gorm.ErrRecordNotFound {
-					return err
-				}
-				// もし見つかったら、IDをセットする
-				if fileExtEntity != nil {
-					extensionID = &fileExtEntity.ExtensionID
+				if ext != "" {
+					fileExtEntity, err := s.fileExtRepo.FindByText(tx, ext)
+					// gorm.ErrRecordNotFound の場合は、見つからなかっただけなので処理を続ける
+					// それ以外のDBエラーの場合は、トランザクションを失敗させる
+					if err != nil && err != gorm.ErrRecordNotFound {
+						return err
+					}
+					// もし見つかったら、IDをセットする
+					if fileExtEntity != nil {
+						extensionID = &fileExtEntity.ExtensionID
+					}
 				}
-			}
 		
-			now := time.Now()
-			// --- save to database ---
-			//attachment table
-			attachment := &entity.Attachment{
-				FilePath:         destPath,
-				OriginalFilename: &fileHeader.Filename,
-				ExtensionID:      extensionID, 
-				UserID:           &userID,
-				Uploaded:         &now,
-			}
-			//Repository 
-			if err := s.attachmentRepo.Create(tx, attachment); err != nil {
-				return err
-			}
+				now := time.Now()
+				// --- save to database ---
+				//attachment table
+				attachment := &entity.Attachment{
+					FilePath:         destPath,
+					OriginalFilename: &fileHeader.Filename,
+					ExtensionID:      extensionID, 
+					UserID:           &userID,
+					Uploaded:         &now,
+				}
+				//Repository 
+				if err := s.attachmentRepo.Create(tx, attachment); err != nil {
+					return err
+				}
 
-			//attachment group table
-			group := &entity.AttachmentGroup{
-				OccurrenceID: occurrenceID,
-				AttachmentID: attachment.AttachmentID,
-			}
-			//Repository 
-			if err := s.attachmentGroupRepo.Create(tx, group); err != nil {
-				return err
-			}
+				//attachment group table
+				group := &entity.AttachmentGroup{
+					OccurrenceID: occurrenceID,
+					AttachmentID: attachment.AttachmentID,
+				}
+				//Repository 
+				if err := s.attachmentGroupRepo.Create(tx, group); err != nil {
+					return err
+				}
 			
-			savedFileNames = append(savedFileNames, uniqueFileName)
-		}
-		return nil
+				savedFileNames = append(savedFileNames, uniqueFileName)
+			}
+			return nil
+		})
 	})
 
 
@@ -335,118 +407,25 @@ func (s *occurrenceService) AttachFiles(occurrenceID uint, userID uint, files []
 
 
 // Searchメソッドを実装
-func (s *occurrenceService) Search(query *model.SearchQuery) (*model.SearchResponse, error) {
+func (s *occurrenceService) Search(actor *model.Actor, query *model.SearchQuery) (*model.SearchResponse, error) {
 	// ページネーションのデフォルト値を設定
 	if query.Page <= 0 { query.Page = 1 }
-	if query.PerPage <= 0 { query.PerPage = 30 }
+	query.PerPage = clampPerPage(query.PerPage, 30)
 
-	occurrences, total, err := s.occRepo.Search(query)
+	scope, err := s.prepareSearch(actor, query)
+	if err != nil {
+		return nil, err
+	}
+
+	occurrences, total, err := s.occRepo.Search(query, scope)
 	if err != nil {
 		return nil, err
 	}
 
 	// --- entityからレスポンス用のmodelに変換する ---
 	var results []model.OccurrenceResult
-	for _, occ := range occurrences {
-		result := model.OccurrenceResult{
-			UserID:       occ.UserID,
-			UserName:     occ.User.UserName,
-			ProjectID:    occ.ProjectID,
-			ProjectName:  occ.Project.ProjectName,
-			IndividualID: occ.IndividualID,
-			Lifestage:    occ.Lifestage,
-			Sex:          occ.Sex,
-			BodyLength:   occ.BodyLength,
-			CreatedAt:    occ.CreatedAt,
-			LanguageID:   occ.LanguageID,
-			Note:         occ.Note,
-		}
-
-		if occ.Place != nil && occ.Place.Coordinates != nil {
-			result.Latitude = occ.Place.Coordinates.Lat
-			result.Longitude = occ.Place.Coordinates.Lng
-		}
-
-		if occ.Place != nil && occ.Place.PlaceNamesJSON != nil {
-			var placeNameData map[string]string
-			if err := json.Unmarshal(occ.Place.PlaceNamesJSON.ClassPlaceName, &placeNameData); err == nil {
-				name := placeNameData["name"]
-				result.PlaceName = &name
-			}
-		}
-
-		if occ.ClassificationJSON != nil {
-			var classData map[string]string
-			if err := json.Unmarshal(occ.ClassificationJSON.ClassClassification, &classData); err == nil {
-				species := classData["species"]
-				genus := classData["genus"]
-				family := classData["family"]
-				order := classData["order"]
-				class := classData["class"]
-				phylum := classData["phylum"]
-				kingdom := classData["kingdom"]
-				others := classData["others"]
-
-
-				result.Classification = &model.ClassificationResult{
-					ClassificationID: &occ.ClassificationJSON.ClassificationID,
-					Species:          &species,
-					Genus:            &genus,
-					Family:           &family,
-					Order:            &order,
-					Class:            &class,
-					Phylum:           &phylum,
-					Kingdom:          &kingdom,
-					Others:           &others,
-				}
-			}
-		}
-
-		if len(occ.Observations) > 0 {
-			obs := occ.Observations[0] // 代表して最初の1件を取得
-			result.Observation = &model.ObservationResult{
-				ObservationID:         &obs.ObservationsID,
-				ObservationUserID:     obs.UserID,
-				ObservationUser:       &obs.User.UserName,
-				ObservationMethodID:   obs.ObservationMethodID,
-				ObservationMethodName: obs.ObservationMethod.MethodCommonName,
-				PageID:                obs.ObservationMethod.PageID,
-				Behavior:              obs.Behavior,
-				ObservedAt:            obs.ObservedAt,
-			}
-		}
-
-		if len(occ.Specimens) > 0 && len(occ.MakeSpecimens) > 0 {
-			spec := occ.Specimens[0]         // 代表して最初の標本を取得
-			makeSpec := occ.MakeSpecimens[0] // 代表して最初の標本作成記録を取得
-
-			result.Specimen = &model.SpecimenResult{
-				SpecimenID:            &spec.SpecimenID,
-				SpecimenUserID:        makeSpec.UserID,
-				SpecimenUser:          &makeSpec.User.UserName, 
-				SpecimenMethodsID:     spec.SpecimenMethodID,
-				SpecimenMethodsCommon: spec.SpecimenMethod.MethodCommonName, 
-				PageID:                spec.SpecimenMethod.PageID,
-				InstitutionID:         spec.InstitutionID,
-				InstitutionCode:       spec.InstitutionIDCode.InstitutionCode,
-				CollectionID:          spec.CollectionID,
-			}
-		}
-
-		// Identification の情報をマッピングするのだ
-		if len(occ.Identifications) > 0 {
-			ident := occ.Identifications[0] // 代表して最初の同定記録を取得
-			
-			result.Identification = &model.IdentificationResult{
-				IdentificationID:     &ident.IdentificationID,
-				IdentificationUserID: ident.UserID,
-				IdentificationUser:   &ident.User.UserName, 
-				IdentifiedAt:         ident.IdentificatedAt,
-				SourceInfo:           ident.SourceInfo,
-			}
-		}
-
-		results = append(results, result)
+	for i := range occurrences {
+		results = append(results, *toOccurrenceResult(&occurrences[i]))
 	}
 
 	// メタデータを計算
@@ -469,7 +448,154 @@ func (s *occurrenceService) Search(query *model.SearchQuery) (*model.SearchRespo
 	return response, nil
 }
 
-func (s *occurrenceService) GetOccurrenceDetail(id uint) (*model.OccurrenceDetailResponse, error) {
+// SearchEach はページに分けないで、条件に合うoccurrenceを全部1件ずつ fn に渡すのだ
+// データベースからは少しずつ読むので、件数が多くても全部をメモリに載せないのだ
+func (s *occurrenceService) SearchEach(actor *model.Actor, query *model.SearchQuery, fn func(result *model.OccurrenceResult) error) error {
+	scope, err := s.prepareSearch(actor, query)
+	if err != nil {
+		return err
+	}
+
+	return s.occRepo.SearchEach(query, scope, searchBatchSize, func(occurrences []entity.Occurrence) error {
+		for i := range occurrences {
+			if err := fn(toOccurrenceResult(&occurrences[i])); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// searchBatchSize はSearchEachで1回にデータベースから読む件数なのだ
+const searchBatchSize = 500
+
+// prepareSearch は場所の条件を確かめて、見てもいいプロジェクトの範囲を返すのだ
+func (s *occurrenceService) prepareSearch(actor *model.Actor, query *model.SearchQuery) (*model.ProjectScope, error) {
+	spatial, err := parseSpatialFilter(query)
+	if err != nil {
+		return nil, err
+	}
+	query.Spatial = spatial
+
+	// 見てもいいプロジェクトのoccurrenceだけを検索するのだ
+	return s.projectScope(actor, model.PermissionReadOccurrence)
+}
+
+// toOccurrenceResult は検索結果の1件をレスポンスの形にするのだ
+func toOccurrenceResult(occ *entity.Occurrence) *model.OccurrenceResult {
+	result := &model.OccurrenceResult{
+		OccurrenceID: occ.OccurrenceID,
+		UserID:       occ.UserID,
+		UserName:     occ.User.UserName,
+		ProjectID:    occ.ProjectID,
+		ProjectName:  occ.Project.ProjectName,
+		IndividualID: occ.IndividualID,
+		Lifestage:    occ.Lifestage,
+		Sex:          occ.Sex,
+		BodyLength:   occ.BodyLength,
+		CreatedAt:    occ.CreatedAt,
+		LanguageID:   occ.LanguageID,
+		Note:         occ.Note,
+	}
+
+	if occ.Place != nil && occ.Place.Coordinates != nil {
+		result.Latitude = occ.Place.Coordinates.Lat
+		result.Longitude = occ.Place.Coordinates.Lng
+	}
+	result.Georeference = georeferenceFromPlace(occ.Place)
+
+	if occ.Place != nil && occ.Place.PlaceNamesJSON != nil {
+		var placeNameData map[string]string
+		if err := json.Unmarshal(occ.Place.PlaceNamesJSON.ClassPlaceName, &placeNameData); err == nil {
+			name := placeNameData["name"]
+			result.PlaceName = &name
+		}
+	}
+
+	if occ.ClassificationJSON != nil {
+		var classData map[string]string
+		if err := json.Unmarshal(occ.ClassificationJSON.ClassClassification, &classData); err == nil {
+			species := classData["species"]
+			genus := classData["genus"]
+			family := classData["family"]
+			order := classData["order"]
+			class := classData["class"]
+			phylum := classData["phylum"]
+			kingdom := classData["kingdom"]
+			others := classData["others"]
+
+
+			result.Classification = &model.ClassificationResult{
+				ClassificationID: &occ.ClassificationJSON.ClassificationID,
+				Species:          &species,
+				Genus:            &genus,
+				Family:           &family,
+				Order:            &order,
+				Class:            &class,
+				Phylum:           &phylum,
+				Kingdom:          &kingdom,
+				Others:           &others,
+			}
+		}
+	}
+
+	if len(occ.Observations) > 0 {
+		obs := occ.Observations[0] // 代表して最初の1件を取得
+		result.Observation = &model.ObservationResult{
+			ObservationID:         &obs.ObservationsID,
+			ObservationUserID:     obs.UserID,
+			ObservationUser:       &obs.User.UserName,
+			ObservationMethodID:   obs.ObservationMethodID,
+			ObservationMethodName: obs.ObservationMethod.MethodCommonName,
+			PageID:                obs.ObservationMethod.PageID,
+			Behavior:              obs.Behavior,
+			ObservedAt:            obs.ObservedAt,
+		}
+	}
+
+	if len(occ.Specimens) > 0 && len(occ.MakeSpecimens) > 0 {
+		spec := occ.Specimens[0]         // 代表して最初の標本を取得
+		makeSpec := occ.MakeSpecimens[0] // 代表して最初の標本作成記録を取得
+
+		result.Specimen = &model.SpecimenResult{
+			SpecimenID:            &spec.SpecimenID,
+			SpecimenUserID:        makeSpec.UserID,
+			SpecimenUser:          &makeSpec.User.UserName, 
+			SpecimenMethodsID:     spec.SpecimenMethodID,
+			SpecimenMethodsCommon: spec.SpecimenMethod.MethodCommonName, 
+			PageID:                spec.SpecimenMethod.PageID,
+			InstitutionID:         spec.InstitutionID,
+			InstitutionCode:       spec.InstitutionIDCode.InstitutionCode,
+			CollectionID:          spec.CollectionID,
+		}
+	}
+
+	// Identification の情報をマッピングするのだ
+	if len(occ.Identifications) > 0 {
+		ident := occ.Identifications[0] // 代表して最初の同定記録を取得
+		
+		result.Identification = &model.IdentificationResult{
+			IdentificationID:     &ident.IdentificationID,
+			IdentificationUserID: ident.UserID,
+			IdentificationUser:   &ident.User.UserName, 
+			IdentifiedAt:         ident.IdentificatedAt,
+			SourceInfo:           ident.SourceInfo,
+		}
+	}
+
+	return result
+}
+
+// GetOccurrenceDetail はプロジェクトの権限を確かめてから、occurrenceの詳細を返すのだ
+func (s *occurrenceService) GetOccurrenceDetail(actor *model.Actor, id uint) (*model.OccurrenceDetailResponse, error) {
+	if err := s.authorizeOccurrence(actor, id, model.PermissionReadOccurrence); err != nil {
+		return nil, err
+	}
+	return s.getOccurrenceDetail(id)
+}
+
+// getOccurrenceDetail は権限を確かめずに詳細を作るのだ。権限を確かめ終わった後の処理から使うのだ
+func (s *occurrenceService) getOccurrenceDetail(id uint) (*model.OccurrenceDetailResponse, error) {
 	occ, err := s.occRepo.FindByID(id)
 	if err != nil {
 		return nil, err
@@ -477,6 +603,8 @@ func (s *occurrenceService) GetOccurrenceDetail(id uint) (*model.OccurrenceDetai
 
 	// --- entityからレスポンス用のmodelに変換する ---
 	response := &model.OccurrenceDetailResponse{
+		OccurrenceID: occ.OccurrenceID,
+		Version:      occ.Version,
 		UserID:       *occ.UserID,
 		UserName:     occ.User.UserName,
 		ProjectID:    occ.ProjectID,
@@ -494,6 +622,7 @@ func (s *occurrenceService) GetOccurrenceDetail(id uint) (*model.OccurrenceDetai
 		response.Latitude = occ.Place.Coordinates.Lat
 		response.Longitude = occ.Place.Coordinates.Lng
 	}
+	response.Georeference = georeferenceFromPlace(occ.Place)
 	if occ.Place != nil && occ.Place.PlaceNamesJSON != nil {
 		var placeNameData map[string]string
 		if err := json.Unmarshal(occ.Place.PlaceNamesJSON.ClassPlaceName, &placeNameData); err == nil {
@@ -591,3 +720,531 @@ func (s *occurrenceService) GetOccurrenceDetail(id uint) (*model.OccurrenceDetai
 
 	return response, nil
 }
+
+
+// UpdateOccurrence はPUTの内容でoccurrenceを丸ごと置き換えるのだ
+// 子レコードはIDが無ければ新規作成、リクエストに無いものは削除するのだ
+// expectedVersion はIf-Matchで送られてきたバージョンで、0ならバージョンを確認しないのだ
+func (s *occurrenceService) UpdateOccurrence(actor *model.Actor, id uint, expectedVersion int, req *model.OccurrenceUpdate) (*model.OccurrenceDetailResponse, error) {
+	return s.updateOccurrence(actor, id, expectedVersion, req, buildClassification(req.Classification))
+}
+
+// updateOccurrence はPUTとPATCHで共通の更新処理なのだ
+// classification だけは、PATCHでjsonbの知らないキーも残せるように、entityのまま受け取るのだ
+func (s *occurrenceService) updateOccurrence(actor *model.Actor, id uint, expectedVersion int, req *model.OccurrenceUpdate, classification *entity.ClassificationJSON) (*model.OccurrenceDetailResponse, error) {
+	// --- 1. リクエストDTOを各Entityオブジェクトに変換 ---
+	place, placeName, err := buildPlace(req.PlaceName, req.Latitude, req.Longitude, &req.Georeference)
+	if err != nil {
+		return nil, err
+	}
+
+	observations := []entity.Observation{}
+	for _, obsReq := range req.Observations {
+		obs := buildObservation(&obsReq.ObservationCreate)
+		if obsReq.ObservationID != nil {
+			obs.ObservationsID = *obsReq.ObservationID
+		}
+		observations = append(observations, *obs)
+	}
+
+	specimens := []entity.Specimen{}
+	makeSpecimens := []entity.MakeSpecimen{}
+	for _, specReq := range req.Specimens {
+		spec, makeSpec := buildSpecimen(&specReq.SpecimenCreate)
+		if specReq.SpecimenID != nil {
+			spec.SpecimenID = *specReq.SpecimenID
+		}
+		specimens = append(specimens, *spec)
+		makeSpecimens = append(makeSpecimens, *makeSpec)
+	}
+
+	identifications := []entity.Identification{}
+	for _, identReq := range req.Identifications {
+		ident := buildIdentification(&identReq.IdentificationCreate)
+		if identReq.IdentificationID != nil {
+			ident.IdentificationID = *identReq.IdentificationID
+		}
+		identifications = append(identifications, *ident)
+	}
+
+	occurrence := &entity.Occurrence{
+		OccurrenceID: id,
+		ProjectID:    req.ProjectID,
+		UserID:       &req.UserID,
+		IndividualID: req.IndividualID,
+		Lifestage:    req.Lifestage,
+		Sex:          req.Sex,
+		BodyLength:   req.BodyLength,
+		LanguageID:   req.LanguageID,
+		Note:         req.Note,
+		CreatedAt:    req.CreatedAt,
+		Timezone:     timezoneFor(req.CreatedAt, req.Timezone),
+	}
+
+	// 今のプロジェクトで編集できて、別のプロジェクトに移す時はそっちにも記録できないといけないのだ
+	// プロジェクトに入っていないoccurrenceは、持ち主を他の人に変えることもできないのだ
+	currentProjectID, currentOwnerID, err := s.occRepo.FindOwnership(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorizeProject(actor, currentProjectID, currentOwnerID, model.PermissionEditOccurrence); err != nil {
+		return nil, err
+	}
+	if !sameID(currentProjectID, req.ProjectID) || req.ProjectID == nil {
+		if err := s.authorizeProject(actor, req.ProjectID, &req.UserID, model.PermissionCreateOccurrence); err != nil {
+			return nil, err
+		}
+	}
+
+	// 元から付いていた機関は無効になっていてもそのまま保存できるけど、新しく付ける機関は使われているものだけなのだ
+	currentInstitutionIDs, err := s.institutionRepo.FindIDsByOccurrenceID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkInstitutionsActive(s.institutionRepo, specimens, currentInstitutionIDs); err != nil {
+		return nil, err
+	}
+
+	// --- 2. トランザクションの中で全部書き換える ---
+	err = writeOccurrences(s.db, s.changeLogRepo, func(tx *gorm.DB) error {
+		// 先にバージョンを上げておくと、他の人の更新とぶつかった時にここで止まるのだ
+		return s.auditOccurrence(tx, actor, id, func() error {
+			if err := s.occRepo.BumpVersion(tx, id, expectedVersion); err != nil {
+				return err
+			}
+			return s.occRepo.UpdateOccurrence(tx, occurrence, classification, place, placeName, observations, specimens, makeSpecimens, identifications)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 更新後の状態を詳細レスポンスの形で返すのだ
+	return s.getOccurrenceDetail(id)
+}
+
+// sameID は2つのIDが同じかを比べるのだ (両方nilも同じなのだ)
+func sameID(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+
+// PatchOccurrence は RFC 7396 (JSON Merge Patch) でoccurrenceの一部だけを書き換えるのだ
+// 今の状態をPUTと同じ形のJSONにしてからpatchを当てて、あとはPUTと同じ処理に流すのだ
+func (s *occurrenceService) PatchOccurrence(actor *model.Actor, id uint, expectedVersion int, patch []byte) (*model.OccurrenceDetailResponse, error) {
+	// バージョンや今の中身のことを教える前に、編集できるかを確かめるのだ
+	if err := s.authorizeOccurrence(actor, id, model.PermissionEditOccurrence); err != nil {
+		return nil, err
+	}
+
+	occ, err := s.occRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if expectedVersion != 0 && expectedVersion != occ.Version {
+		return nil, ErrVersionConflict
+	}
+	// patchは読み込んだ時点の状態に当てるので、書き込む時もそのバージョンのままか確認するのだ
+	expectedVersion = occ.Version
+
+	// --- 1. 今の状態をJSONのドキュメントにする ---
+	stored := occurrenceToUpdate(occ)
+	document, err := updateDocument(stored, occ.ClassificationJSON)
+	if err != nil {
+		return nil, err
+	}
+	current, err := json.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+
+	// --- 2. patchを当てる ---
+	merged, err := util.MergePatch(current, patch)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	var mergedDocument map[string]json.RawMessage
+	if err := json.Unmarshal(merged, &mergedDocument); err != nil {
+		// patchがオブジェクトじゃないと、ドキュメント全体が置き換わってしまうのだ
+		return nil, fmt.Errorf("%w: patch must be a JSON object", ErrInvalidPatch)
+	}
+	var req model.OccurrenceUpdate
+	if err := json.Unmarshal(merged, &req); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	if req.UserID == 0 {
+		return nil, fmt.Errorf("%w: user_id cannot be cleared", ErrInvalidPatch)
+	}
+	carryStoredValues(&req, stored)
+
+	// --- 3. classificationはマージ後のjsonbをそのまま保存する ---
+	var classification *entity.ClassificationJSON
+	if raw, ok := mergedDocument["classification"]; ok && string(raw) != "null" {
+		var classMap map[string]interface{}
+		if err := json.Unmarshal(raw, &classMap); err != nil {
+			return nil, fmt.Errorf("%w: classification must be an object", ErrInvalidPatch)
+		}
+		classification = &entity.ClassificationJSON{ClassClassification: []byte(raw)}
+	}
+
+	return s.updateOccurrence(actor, id, expectedVersion, &req, classification)
+}
+
+// updateDocument はPUTの形のリクエストを、キーごとのJSONドキュメントにするのだ
+// classificationはjsonbの中身をそのまま使うのだ。そうすれば知らないキーも消えずに残るのだ
+func updateDocument(req *model.OccurrenceUpdate, classification *entity.ClassificationJSON) (map[string]json.RawMessage, error) {
+	raw, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var document map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &document); err != nil {
+		return nil, err
+	}
+	if classification != nil && len(classification.ClassClassification) > 0 {
+		document["classification"] = json.RawMessage(classification.ClassClassification)
+	}
+	return document, nil
+}
+
+// carryStoredValues はJSONに出さないDBの値 (タイムゾーンなど) を、patchを当てた後のリクエストに戻すのだ
+// patchで日時を変えたレコードだけは、送られてきた日時からタイムゾーンを作り直すのだ
+func carryStoredValues(req, stored *model.OccurrenceUpdate) {
+	if sameTimestamp(req.CreatedAt, stored.CreatedAt) {
+		req.Timezone = stored.Timezone
+	}
+
+	observations := map[uint]model.ObservationCreate{}
+	for _, obs := range stored.Observations {
+		observations[*obs.ObservationID] = obs.ObservationCreate
+	}
+	for i := range req.Observations {
+		obs := &req.Observations[i]
+		if obs.ObservationID == nil {
+			continue
+		}
+		if prev, ok := observations[*obs.ObservationID]; ok && sameTimestamp(obs.ObservedAt, prev.ObservedAt) {
+			obs.Timezone = prev.Timezone
+		}
+	}
+
+	specimens := map[uint]model.SpecimenCreate{}
+	for _, spec := range stored.Specimens {
+		specimens[*spec.SpecimenID] = spec.SpecimenCreate
+	}
+	for i := range req.Specimens {
+		spec := &req.Specimens[i]
+		if spec.SpecimenID == nil {
+			continue
+		}
+		prev, ok := specimens[*spec.SpecimenID]
+		if !ok {
+			continue
+		}
+		if sameTimestamp(spec.CreatedAt, prev.CreatedAt) {
+			spec.Timezone = prev.Timezone
+		}
+		if sameID(spec.SpecimenMethodsID, prev.SpecimenMethodsID) {
+			spec.MakeSpecimenMethodID = prev.MakeSpecimenMethodID
+		}
+	}
+
+	identifications := map[uint]model.IdentificationCreate{}
+	for _, ident := range stored.Identifications {
+		identifications[*ident.IdentificationID] = ident.IdentificationCreate
+	}
+	for i := range req.Identifications {
+		ident := &req.Identifications[i]
+		if ident.IdentificationID == nil {
+			continue
+		}
+		if prev, ok := identifications[*ident.IdentificationID]; ok && sameTimestamp(ident.IdentifiedAt, prev.IdentifiedAt) {
+			ident.Timezone = prev.Timezone
+		}
+	}
+}
+
+// sameTimestamp は2つの日時が、同じ時刻で同じオフセットかを比べるのだ
+// patchで触っていない日時は、今の状態をドキュメントにした時のままなので、これで見分けられるのだ
+func sameTimestamp(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	_, offsetA := a.Zone()
+	_, offsetB := b.Zone()
+	return a.Equal(*b) && offsetA == offsetB
+}
+
+// occurrenceToUpdate はDBから取ってきたoccurrenceを、PUTのリクエストと同じ形に変換するのだ
+// タイムゾーンとmake_specimenの作成方法は、JSONには出さないでリクエストの中に持っておくのだ
+func occurrenceToUpdate(occ *entity.Occurrence) *model.OccurrenceUpdate {
+	req := &model.OccurrenceUpdate{
+		ProjectID:       occ.ProjectID,
+		IndividualID:    occ.IndividualID,
+		Lifestage:       occ.Lifestage,
+		Sex:             occ.Sex,
+		BodyLength:      occ.BodyLength,
+		CreatedAt:       occ.CreatedAt,
+		LanguageID:      occ.LanguageID,
+		Note:            occ.Note,
+		Timezone:        occ.Timezone,
+		Observations:    []model.ObservationUpdate{},
+		Specimens:       []model.SpecimenUpdate{},
+		Identifications: []model.IdentificationUpdate{},
+	}
+	if occ.UserID != nil {
+		req.UserID = *occ.UserID
+	}
+
+	if occ.Place != nil {
+		if occ.Place.Coordinates != nil {
+			req.Latitude = occ.Place.Coordinates.Lat
+			req.Longitude = occ.Place.Coordinates.Lng
+		}
+		req.Georeference = georeferenceFromPlace(occ.Place)
+		if occ.Place.PlaceNamesJSON != nil {
+			var placeNameData map[string]string
+			if err := json.Unmarshal(occ.Place.PlaceNamesJSON.ClassPlaceName, &placeNameData); err == nil {
+				name := placeNameData["name"]
+				req.PlaceName = &name
+			}
+		}
+	}
+
+	if occ.ClassificationJSON != nil {
+		var classData model.ClassificationCreate
+		if err := json.Unmarshal(occ.ClassificationJSON.ClassClassification, &classData); err == nil {
+			req.Classification = &classData
+		}
+	}
+
+	for _, obs := range occ.Observations {
+		id := obs.ObservationsID
+		req.Observations = append(req.Observations, model.ObservationUpdate{
+			ObservationID: &id,
+			ObservationCreate: model.ObservationCreate{
+				ObservationUserID:   obs.UserID,
+				ObservationMethodID: obs.ObservationMethodID,
+				Behavior:            obs.Behavior,
+				ObservedAt:          obs.ObservedAt,
+				Timezone:            obs.Timezone,
+			},
+		})
+	}
+
+	for _, spec := range occ.Specimens {
+		id := spec.SpecimenID
+		specReq := model.SpecimenUpdate{
+			SpecimenID: &id,
+			SpecimenCreate: model.SpecimenCreate{
+				SpecimenMethodsID: spec.SpecimenMethodID,
+				InstitutionID:     spec.InstitutionID,
+				CollectionID:      spec.CollectionID,
+			},
+		}
+		// 標本を作った人と日付はmake_specimenの方に入っているのだ
+		for _, ms := range occ.MakeSpecimens {
+			if ms.SpecimenID != nil && *ms.SpecimenID == spec.SpecimenID {
+				specReq.SpecimenUserID = ms.UserID
+				specReq.CreatedAt = ms.Date
+				specReq.Timezone = ms.Timezone
+				specReq.MakeSpecimenMethodID = ms.SpecimenMethodID
+				break
+			}
+		}
+		req.Specimens = append(req.Specimens, specReq)
+	}
+
+	for _, ident := range occ.Identifications {
+		id := ident.IdentificationID
+		req.Identifications = append(req.Identifications, model.IdentificationUpdate{
+			IdentificationID: &id,
+			IdentificationCreate: model.IdentificationCreate{
+				IdentificationUserID: ident.UserID,
+				IdentifiedAt:         ident.IdentificatedAt,
+				SourceInfo:           ident.SourceInfo,
+				Timezone:             ident.Timezone,
+			},
+		})
+	}
+
+	return req
+}
+
+
+// DeleteOccurrence はoccurrenceをゴミ箱に移すのだ。子レコードや添付ファイルは PurgeOccurrence まで残るのだ
+func (s *occurrenceService) DeleteOccurrence(actor *model.Actor, id uint, expectedVersion int) error {
+	if err := s.authorizeOccurrence(actor, id, model.PermissionDeleteOccurrence); err != nil {
+		return err
+	}
+	return writeOccurrences(s.db, s.changeLogRepo, func(tx *gorm.DB) error {
+		return s.auditOccurrence(tx, actor, id, func() error {
+			if err := s.occRepo.BumpVersion(tx, id, expectedVersion); err != nil {
+				return err
+			}
+			return s.occRepo.SoftDeleteOccurrence(tx, id)
+		})
+	})
+}
+
+// ListTrash はゴミ箱に入っているoccurrenceの一覧を返すのだ
+func (s *occurrenceService) ListTrash(actor *model.Actor, query *model.TrashQuery) (*model.TrashResponse, error) {
+	if query.Page <= 0 { query.Page = 1 }
+	query.PerPage = clampPerPage(query.PerPage, 30)
+
+	// ゴミ箱は、消したり戻したりできるプロジェクトの分だけ見せるのだ
+	scope, err := s.projectScope(actor, model.PermissionDeleteOccurrence)
+	if err != nil {
+		return nil, err
+	}
+
+	occurrences, total, err := s.occRepo.FindDeleted(query.Page, query.PerPage, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []model.TrashItem{}
+	for _, occ := range occurrences {
+		item := model.TrashItem{
+			OccurrenceID: occ.OccurrenceID,
+			UserID:       occ.UserID,
+			UserName:     occ.User.UserName,
+			ProjectID:    occ.ProjectID,
+			ProjectName:  occ.Project.ProjectName,
+			Note:         occ.Note,
+			CreatedAt:    occ.CreatedAt,
+			DeletedAt:    occ.DeletedAt.Time,
+		}
+		if occ.Place != nil && occ.Place.PlaceNamesJSON != nil {
+			var placeNameData map[string]string
+			if err := json.Unmarshal(occ.Place.PlaceNamesJSON.ClassPlaceName, &placeNameData); err == nil {
+				name := placeNameData["name"]
+				item.PlaceName = &name
+			}
+		}
+		if occ.ClassificationJSON != nil {
+			var classData map[string]string
+			if err := json.Unmarshal(occ.ClassificationJSON.ClassClassification, &classData); err == nil {
+				species := classData["species"]
+				item.Species = &species
+			}
+		}
+		results = append(results, item)
+	}
+
+	totalPages := 0
+	if total > 0 {
+		totalPages = int(math.Ceil(float64(total) / float64(query.PerPage)))
+	}
+
+	return &model.TrashResponse{
+		Results: results,
+		Metadata: model.Metadata{
+			TotalResults: int(total),
+			CurrentPage:  query.Page,
+			PerPage:      query.PerPage,
+			TotalPages:   totalPages,
+		},
+	}, nil
+}
+
+// RestoreOccurrence はゴミ箱からoccurrenceを元に戻すのだ
+func (s *occurrenceService) RestoreOccurrence(actor *model.Actor, id uint) error {
+	if err := s.authorizeOccurrence(actor, id, model.PermissionDeleteOccurrence); err != nil {
+		return err
+	}
+	return writeOccurrences(s.db, s.changeLogRepo, func(tx *gorm.DB) error {
+		return s.auditOccurrence(tx, actor, id, func() error {
+			return s.occRepo.RestoreOccurrence(tx, id)
+		})
+	})
+}
+
+// PurgeOccurrence はゴミ箱に入っているoccurrenceと子レコードを1つのトランザクションで完全に消して、
+// 他のoccurrenceから使われなくなった添付ファイルもディスクから消すのだ
+// actorがnilの時はシステムによる削除として、user_idが空の履歴になるのだ
+func (s *occurrenceService) PurgeOccurrence(actor *model.Actor, id uint) error {
+	if err := s.authorizeOccurrence(actor, id, model.PermissionDeleteOccurrence); err != nil {
+		return err
+	}
+
+	var removeFilePaths []string
+
+	err := writeOccurrences(s.db, s.changeLogRepo, func(tx *gorm.DB) error {
+		// 消す前に全部の行を覚えておいて、最後にまとめてdeleteとして記録するのだ
+		before, err := s.changeLogRepo.Snapshot(tx, id)
+		if err != nil {
+			return err
+		}
+
+		// 1. 添付ファイルのリンクを覚えておいてから消す
+		groups, err := s.attachmentGroupRepo.FindByOccurrenceID(tx, id)
+		if err != nil {
+			return err
+		}
+		if err := s.attachmentGroupRepo.DeleteByOccurrenceID(tx, id); err != nil {
+			return err
+		}
+
+		// 2. occurrence本体と子レコードを消す (ゴミ箱に無ければ gorm.ErrRecordNotFound が返るのだ)
+		if err := s.occRepo.PurgeOccurrence(tx, id); err != nil {
+			return err
+		}
+
+		// 3. 他のoccurrenceがまだ使っている添付ファイルはそのまま残すのだ
+		for _, group := range groups {
+			count, err := s.attachmentGroupRepo.CountByAttachmentID(tx, group.AttachmentID)
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				continue
+			}
+
+			attachment, err := s.attachmentRepo.FindByID(tx, group.AttachmentID)
+			if err != nil {
+				return err
+			}
+			if err := s.attachmentRepo.Delete(tx, attachment); err != nil {
+				return err
+			}
+			removeFilePaths = append(removeFilePaths, attachment.FilePath)
+		}
+		return s.recordChanges(tx, actor, id, before)
+	})
+	if err != nil {
+		return err
+	}
+
+	// コミットが成功してからファイルを消すのだ。ロールバックされたのにファイルだけ消えるのを防ぐためなのだ
+	for _, path := range removeFilePaths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("failed remove attachment file %s: %v", path, err)
+		}
+	}
+
+	return nil
+}
+
+// PurgeExpiredTrash は retention より長くゴミ箱に入っているoccurrenceを完全に消すのだ
+// 消した件数を返すのだ
+func (s *occurrenceService) PurgeExpiredTrash(retention time.Duration) (int, error) {
+	ids, err := s.occRepo.FindDeletedBefore(time.Now().Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, id := range ids {
+		// 1件ずつ別のトランザクションにして、途中で失敗してもそれまでの分は消えるようにするのだ
+		if err := s.PurgeOccurrence(nil, id); err != nil {
+			return purged, fmt.Errorf("failed purge occurrence %d: %w", id, err)
+		}
+		purged++
+	}
+	return purged, nil
+}
@@ -0,0 +1,194 @@
+// internal/service/occurrence_service_test.go
+package service
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/saku-730/web-specimen/backend/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+// storedOccurrence はサーバーのタイムゾーン (UTC) とは違うタイムゾーンで記録されたoccurrenceなのだ
+// DBから読んだ日時はサーバーのタイムゾーンになっているので、日時からはもう元のタイムゾーンが分からないのだ
+func storedOccurrence() *entity.Occurrence {
+	at := time.Date(2024, 5, 1, 1, 0, 0, 0, time.UTC)
+	owner, specimenMethod, makeMethod := uint(1), uint(2), uint(5)
+	specimenID := uint(21)
+	return &entity.Occurrence{
+		OccurrenceID: 5,
+		Version:      3,
+		UserID:       &owner,
+		CreatedAt:    &at,
+		Timezone:     stringPtr("+09:00"),
+		Observations: []entity.Observation{
+			{ObservationsID: 11, ObservedAt: &at, Timezone: stringPtr("+09:00")},
+		},
+		Specimens: []entity.Specimen{
+			{SpecimenID: specimenID, SpecimenMethodID: &specimenMethod},
+		},
+		MakeSpecimens: []entity.MakeSpecimen{
+			{MakeSpecimenID: 31, SpecimenID: &specimenID, SpecimenMethodID: &makeMethod, Date: &at, CreatedAt: &at, Timezone: stringPtr("+09:00")},
+		},
+		Identifications: []entity.Identification{
+			{IdentificationID: 41, IdentificatedAt: &at, Timezone: stringPtr("-05:00")},
+		},
+	}
+}
+
+func newPatchTestService(t *testing.T, occRepo *mockOccurrenceRepository) *occurrenceService {
+	occRepo.On("FindByID", uint(5)).Return(storedOccurrence(), nil)
+	occRepo.On("FindOwnership", uint(5)).Return(nil, uintPtr(1), nil)
+	occRepo.On("BumpVersion", uint(5), 3).Return(nil)
+	institutionRepo := new(mockInstitutionRepository)
+	institutionRepo.On("FindIDsByOccurrenceID", uint(5)).Return([]uint{}, nil)
+	changeLogRepo := new(mockChangeLogRepository)
+	changeLogRepo.On("Snapshot", uint(5)).Return(repository.OccurrenceSnapshot{}, nil)
+	changeLogRepo.On("Create", mock.Anything).Return(nil)
+	changeLogRepo.On("BumpGeneration").Return(nil)
+	return &occurrenceService{db: newTestDB(t), occRepo: occRepo, institutionRepo: institutionRepo, changeLogRepo: changeLogRepo}
+}
+
+// updateOccurrenceArgs はリポジトリのUpdateOccurrenceに渡されたentityを取り出すのだ
+func updateOccurrenceArgs(occRepo *mockOccurrenceRepository) mock.Arguments {
+	for _, call := range occRepo.Calls {
+		if call.Method == "UpdateOccurrence" {
+			return call.Arguments
+		}
+	}
+	return nil
+}
+
+func TestPatchOccurrenceKeepsStoredValues(t *testing.T) {
+	owner := &model.Actor{UserID: 1, Role: model.RoleCollector}
+
+	t.Run("noteだけ変えても、タイムゾーンとmake_specimenの作成方法は変わらないのだ", func(t *testing.T) {
+		occRepo := new(mockOccurrenceRepository)
+		occRepo.On("UpdateOccurrence", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+		s := newPatchTestService(t, occRepo)
+
+		_, err := s.PatchOccurrence(owner, 5, 3, []byte(`{"note":"updated"}`))
+		assert.NoError(t, err)
+
+		args := updateOccurrenceArgs(occRepo)
+		occurrence := args.Get(0).(*entity.Occurrence)
+		observations := args.Get(1).([]entity.Observation)
+		makeSpecimens := args.Get(2).([]entity.MakeSpecimen)
+		identifications := args.Get(3).([]entity.Identification)
+
+		assert.Equal(t, "updated", *occurrence.Note)
+		assert.Equal(t, "+09:00", *occurrence.Timezone)
+		assert.Equal(t, "+09:00", *observations[0].Timezone)
+		assert.Equal(t, "+09:00", *makeSpecimens[0].Timezone)
+		assert.Equal(t, uint(5), *makeSpecimens[0].SpecimenMethodID)
+		assert.Equal(t, "-05:00", *identifications[0].Timezone)
+	})
+
+	t.Run("patchで日時を変えたレコードだけタイムゾーンを作り直すのだ", func(t *testing.T) {
+		occRepo := new(mockOccurrenceRepository)
+		occRepo.On("UpdateOccurrence", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+		s := newPatchTestService(t, occRepo)
+
+		_, err := s.PatchOccurrence(owner, 5, 3, []byte(`{"observation":[{"observation_id":11,"observed_at":"2024-05-02T10:00:00+02:00"}]}`))
+		assert.NoError(t, err)
+
+		args := updateOccurrenceArgs(occRepo)
+		occurrence := args.Get(0).(*entity.Occurrence)
+		observations := args.Get(1).([]entity.Observation)
+
+		assert.Equal(t, "+02:00", *observations[0].Timezone)
+		assert.Equal(t, "+09:00", *occurrence.Timezone)
+	})
+}
+
+func TestPatchOccurrenceAuthorization(t *testing.T) {
+	t.Run("編集できない人には、バージョンが違っても412ではなく403を返すのだ", func(t *testing.T) {
+		occRepo := new(mockOccurrenceRepository)
+		occRepo.On("FindOwnership", uint(5)).Return(nil, uintPtr(2), nil)
+		s := &occurrenceService{occRepo: occRepo}
+
+		_, err := s.PatchOccurrence(&model.Actor{UserID: 1, Role: model.RoleCollector}, 5, 99, []byte(`{"note":"x"}`))
+
+		assert.True(t, errors.Is(err, ErrForbidden))
+		assert.False(t, errors.Is(err, ErrVersionConflict))
+		occRepo.AssertNotCalled(t, "FindByID", uint(5))
+	})
+
+	t.Run("編集できる人には、バージョンが違えば412を返すのだ", func(t *testing.T) {
+		occRepo := new(mockOccurrenceRepository)
+		s := newPatchTestService(t, occRepo)
+
+		_, err := s.PatchOccurrence(&model.Actor{UserID: 1, Role: model.RoleCollector}, 5, 99, []byte(`{"note":"x"}`))
+
+		assert.True(t, errors.Is(err, ErrVersionConflict))
+		occRepo.AssertNotCalled(t, "UpdateOccurrence", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+// uploadFiles はmultipartのフォームを作って、サーバーが受け取った時と同じFileHeaderにするのだ
+func uploadFiles(t *testing.T, names ...string) []*multipart.FileHeader {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, name := range names {
+		part, err := writer.CreateFormFile("upload_files", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write([]byte("jpeg"))
+	}
+	writer.Close()
+	form, err := multipart.NewReader(&body, writer.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return form.File["upload_files"]
+}
+
+func TestAttachFiles(t *testing.T) {
+	owner := &model.Actor{UserID: 1, Role: model.RoleCollector}
+
+	t.Run("添付したらバージョンを上げて、ETagが変わるようにするのだ", func(t *testing.T) {
+		t.Setenv("UPLOAD_DIR", t.TempDir())
+		occRepo := new(mockOccurrenceRepository)
+		occRepo.On("Exists", uint(5)).Return(true, nil)
+		occRepo.On("BumpVersion", uint(5), 0).Return(nil)
+		s := newTrashTestService(t, occRepo)
+		fileExtRepo := new(mockFileExtensionRepository)
+		fileExtRepo.On("FindByText", ".jpg").Return(&entity.FileExtension{ExtensionID: 2}, nil)
+		attachmentRepo := new(mockAttachmentRepository)
+		attachmentRepo.On("Create", mock.Anything).Return(nil)
+		groupRepo := new(mockAttachmentGroupRepository)
+		groupRepo.On("Create", mock.Anything).Return(nil)
+		s.fileExtRepo, s.attachmentRepo, s.attachmentGroupRepo = fileExtRepo, attachmentRepo, groupRepo
+
+		names, err := s.AttachFiles(owner, 5, uploadFiles(t, "photo.jpg"))
+
+		assert.NoError(t, err)
+		assert.Len(t, names, 1)
+		occRepo.AssertExpectations(t)
+		groupRepo.AssertNumberOfCalls(t, "Create", 1)
+	})
+
+	t.Run("その間にゴミ箱に入れられていたら、何も保存しないのだ", func(t *testing.T) {
+		uploadDir := t.TempDir()
+		t.Setenv("UPLOAD_DIR", uploadDir)
+		occRepo := new(mockOccurrenceRepository)
+		occRepo.On("Exists", uint(5)).Return(true, nil)
+		occRepo.On("BumpVersion", uint(5), 0).Return(gorm.ErrRecordNotFound)
+		s := newTrashTestService(t, occRepo)
+
+		_, err := s.AttachFiles(owner, 5, uploadFiles(t, "photo.jpg"))
+
+		assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+		entries, _ := os.ReadDir(uploadDir)
+		assert.Empty(t, entries)
+	})
+}
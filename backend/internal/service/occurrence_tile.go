@@ -0,0 +1,120 @@
+// internal/service/occurrence_tile.go
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/saku-730/web-specimen/backend/internal/util"
+)
+
+// ErrInvalidTile は z/x/y がタイルの範囲に入っていない時のエラーなのだ
+var ErrInvalidTile = errors.New("invalid tile coordinates")
+
+const (
+	tileMaxZoom = 22
+	// tileClusterMaxZoom より小さいズームでは、点をまとめてから送るのだ
+	tileClusterMaxZoom = 12
+	// tileClusterCells はタイルの1辺をいくつの格子に分けて点をまとめるかなのだ
+	tileClusterCells = 64
+	// tileCacheBytes はタイルのキャッシュに使うメモリの上限なのだ
+	tileCacheBytes = 64 << 20
+)
+
+// tileCache は作ったタイルを、occurrence_generationの数と一緒に覚えておくのだ
+// occurrenceや方法の統合を書いてコミットした後にこの数が上がるので、数が変わったら全部捨てて作り直すのだ
+// 数はデータベースにあるので、別のサーバーで変わった時も気づけるのだ
+type tileCache struct {
+	mu         sync.Mutex
+	generation uint
+	tiles      *util.ByteCache
+}
+
+func newTileCache() *tileCache {
+	return &tileCache{tiles: util.NewByteCache(tileCacheBytes)}
+}
+
+// get は generation が覚えているものと違ったら、キャッシュを空にしてから探すのだ
+func (c *tileCache) get(generation uint, key string) ([]byte, bool) {
+	c.mu.Lock()
+	if generation != c.generation {
+		c.tiles.Clear()
+		c.generation = generation
+	}
+	c.mu.Unlock()
+	return c.tiles.Get(key)
+}
+
+// add は作っている間にデータが変わっていたら、古いタイルなので入れないのだ
+func (c *tileCache) add(generation uint, key string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+	c.tiles.Add(key, data)
+}
+
+// GetTile は検索と同じ条件で、z/x/y のタイルに入るoccurrenceを Mapbox Vector Tile にして返すのだ
+// ページには分けないで、ズームが小さい時は点をまとめるのだ
+func (s *occurrenceService) GetTile(actor *model.Actor, query *model.SearchQuery, z, x, y int) (*model.Tile, error) {
+	if z < 0 || z > tileMaxZoom || x < 0 || y < 0 || x >= 1<<z || y >= 1<<z {
+		return nil, ErrInvalidTile
+	}
+	scope, err := s.prepareSearch(actor, query)
+	if err != nil {
+		return nil, err
+	}
+
+	generation, err := s.changeLogRepo.Generation()
+	if err != nil {
+		return nil, err
+	}
+	key, err := tileCacheKey(query, scope, z, x, y)
+	if err != nil {
+		return nil, err
+	}
+	tile := &model.Tile{ETag: fmt.Sprintf("\"%d-%s\"", generation, key[:16])}
+	if data, ok := s.tileCache.get(generation, key); ok {
+		tile.Data = data
+		return tile, nil
+	}
+
+	request := &model.TileRequest{Z: z, X: x, Y: y}
+	if z < tileClusterMaxZoom {
+		request.ClusterCell = model.WebMercatorWorldSize / math.Exp2(float64(z)) / tileClusterCells
+	}
+	data, err := s.occRepo.SearchTile(query, scope, request)
+	if err != nil {
+		return nil, err
+	}
+	s.tileCache.add(generation, key, data)
+	tile.Data = data
+	return tile, nil
+}
+
+// tileCacheKey は検索の条件と見てもいいプロジェクトの範囲とタイルの位置から、キャッシュのキーを作るのだ
+// 見られるプロジェクトが違う人には別のタイルになるのだ
+func tileCacheKey(query *model.SearchQuery, scope *model.ProjectScope, z, x, y int) (string, error) {
+	filter := *query
+	// ページと出力の形はタイルには関係ないので、キーに入れないのだ
+	filter.Page, filter.PerPage, filter.Format = 0, 0, ""
+	encoded, err := json.Marshal(struct {
+		Query *model.SearchQuery
+		Scope *model.ProjectScope
+		Z     int
+		X     int
+		Y     int
+	}{&filter, scope, z, x, y})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:]), nil
+}
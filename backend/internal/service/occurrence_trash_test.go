@@ -0,0 +1,202 @@
+// internal/service/occurrence_trash_test.go
+package service
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/saku-730/web-specimen/backend/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+// newTrashTestService はプロジェクトに入っていない、user 1 のoccurrence 5 を扱うサービスを作るのだ
+func newTrashTestService(t *testing.T, occRepo *mockOccurrenceRepository) *occurrenceService {
+	occRepo.On("FindOwnership", uint(5)).Return(nil, uintPtr(1), nil)
+	changeLogRepo := new(mockChangeLogRepository)
+	changeLogRepo.On("Snapshot", uint(5)).Return(repository.OccurrenceSnapshot{}, nil)
+	changeLogRepo.On("BumpGeneration").Return(nil)
+	return &occurrenceService{db: newTestDB(t), occRepo: occRepo, changeLogRepo: changeLogRepo}
+}
+
+func TestDeleteOccurrence(t *testing.T) {
+	owner := &model.Actor{UserID: 1, Role: model.RoleCollector}
+
+	t.Run("ゴミ箱に入れるだけで、完全には消さないのだ", func(t *testing.T) {
+		occRepo := new(mockOccurrenceRepository)
+		occRepo.On("BumpVersion", uint(5), 3).Return(nil)
+		occRepo.On("SoftDeleteOccurrence", uint(5)).Return(nil)
+		s := newTrashTestService(t, occRepo)
+
+		assert.NoError(t, s.DeleteOccurrence(owner, 5, 3))
+		occRepo.AssertExpectations(t)
+		occRepo.AssertNotCalled(t, "PurgeOccurrence", uint(5))
+	})
+
+	t.Run("バージョンが違ったらゴミ箱に入れないのだ", func(t *testing.T) {
+		occRepo := new(mockOccurrenceRepository)
+		occRepo.On("BumpVersion", uint(5), 2).Return(ErrVersionConflict)
+		s := newTrashTestService(t, occRepo)
+
+		assert.True(t, errors.Is(s.DeleteOccurrence(owner, 5, 2), ErrVersionConflict))
+		occRepo.AssertNotCalled(t, "SoftDeleteOccurrence", uint(5))
+	})
+
+	t.Run("ゴミ箱の中のoccurrenceは詳細に出てこないし、ファイルも付けられないのだ", func(t *testing.T) {
+		uploadDir := t.TempDir()
+		t.Setenv("UPLOAD_DIR", uploadDir)
+		occRepo := new(mockOccurrenceRepository)
+		occRepo.On("FindByID", uint(5)).Return(nil, gorm.ErrRecordNotFound)
+		occRepo.On("Exists", uint(5)).Return(false, nil)
+		s := newTrashTestService(t, occRepo)
+
+		_, err := s.GetOccurrenceDetail(owner, 5)
+		assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+
+		_, err = s.AttachFiles(owner, 5, nil)
+		assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+		entries, _ := os.ReadDir(uploadDir)
+		assert.Empty(t, entries)
+	})
+}
+
+func TestRestoreOccurrence(t *testing.T) {
+	owner := &model.Actor{UserID: 1, Role: model.RoleCollector}
+
+	t.Run("ゴミ箱から元に戻すのだ", func(t *testing.T) {
+		occRepo := new(mockOccurrenceRepository)
+		occRepo.On("RestoreOccurrence", uint(5)).Return(nil)
+		s := newTrashTestService(t, occRepo)
+
+		assert.NoError(t, s.RestoreOccurrence(owner, 5))
+		occRepo.AssertExpectations(t)
+	})
+
+	t.Run("ゴミ箱に入っていなければ見つからないのだ", func(t *testing.T) {
+		occRepo := new(mockOccurrenceRepository)
+		occRepo.On("RestoreOccurrence", uint(5)).Return(gorm.ErrRecordNotFound)
+		s := newTrashTestService(t, occRepo)
+
+		assert.True(t, errors.Is(s.RestoreOccurrence(owner, 5), gorm.ErrRecordNotFound))
+	})
+
+	t.Run("observerは戻せないのだ", func(t *testing.T) {
+		occRepo := new(mockOccurrenceRepository)
+		occRepo.On("FindOwnership", uint(6)).Return(uintPtr(3), uintPtr(2), nil)
+		projectRepo := new(mockProjectRepository)
+		projectRepo.On("FindByID", uint(3)).Return(&entity.Project{ProjectID: 3}, nil)
+		memberRepo := new(mockProjectMemberRepository)
+		memberRepo.On("FindActiveByUserID", uint(1)).Return([]entity.ProjectMember{
+			{ProjectID: uintPtr(3), ProjectRole: model.ProjectRoleObserver},
+		}, nil)
+		s := &occurrenceService{db: newTestDB(t), occRepo: occRepo, projectRepo: projectRepo, projectMemberRepo: memberRepo}
+
+		assert.True(t, errors.Is(s.RestoreOccurrence(owner, 6), ErrForbidden))
+		occRepo.AssertNotCalled(t, "RestoreOccurrence", uint(6))
+	})
+}
+
+func TestListTrash(t *testing.T) {
+	deletedAt := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	trashed := []entity.Occurrence{
+		{OccurrenceID: 5, ProjectID: uintPtr(3), DeletedAt: gorm.DeletedAt{Time: deletedAt, Valid: true}},
+	}
+
+	t.Run("消したり戻したりできるプロジェクトの分だけ見せるのだ", func(t *testing.T) {
+		memberRepo := new(mockProjectMemberRepository)
+		memberRepo.On("FindActiveByUserID", uint(1)).Return([]entity.ProjectMember{
+			{ProjectID: uintPtr(3), ProjectRole: model.ProjectRoleLead},
+			{ProjectID: uintPtr(4), ProjectRole: model.ProjectRoleContributor},
+		}, nil)
+		occRepo := new(mockOccurrenceRepository)
+		scope := &model.ProjectScope{ProjectIDs: []uint{3}, UserID: 1}
+		occRepo.On("FindDeleted", 1, 30, scope).Return(trashed, int64(1), nil)
+		s := &occurrenceService{occRepo: occRepo, projectMemberRepo: memberRepo}
+
+		res, err := s.ListTrash(&model.Actor{UserID: 1, Role: model.RoleCollector}, &model.TrashQuery{})
+		assert.NoError(t, err)
+		occRepo.AssertExpectations(t)
+		if assert.Len(t, res.Results, 1) {
+			assert.Equal(t, uint(5), res.Results[0].OccurrenceID)
+			assert.Equal(t, deletedAt, res.Results[0].DeletedAt)
+		}
+		assert.Equal(t, 1, res.Metadata.TotalPages)
+	})
+
+	t.Run("管理者は全部見られるのだ", func(t *testing.T) {
+		occRepo := new(mockOccurrenceRepository)
+		occRepo.On("FindDeleted", 2, 10, (*model.ProjectScope)(nil)).Return(trashed, int64(11), nil)
+		s := &occurrenceService{occRepo: occRepo}
+
+		res, err := s.ListTrash(&model.Actor{UserID: 9, Role: model.RoleAdmin}, &model.TrashQuery{Page: 2, PerPage: 10})
+		assert.NoError(t, err)
+		occRepo.AssertExpectations(t)
+		assert.Equal(t, 2, res.Metadata.TotalPages)
+	})
+}
+
+func TestPurgeOccurrenceNotInTrash(t *testing.T) {
+	t.Run("ゴミ箱に入っていないoccurrenceは消さないし、ファイルも残すのだ", func(t *testing.T) {
+		f := newPurgeFixture(t)
+		f.occRepo.On("PurgeOccurrence", uint(5)).Return(gorm.ErrRecordNotFound)
+
+		err := f.service.PurgeOccurrence(nil, 5)
+
+		assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+		assert.True(t, fileExists(f.ownPath))
+		f.changeLogRepo.AssertNotCalled(t, "Create", mock.Anything)
+	})
+}
+
+func TestPurgeExpiredTrash(t *testing.T) {
+	retention := 30 * 24 * time.Hour
+
+	newService := func(t *testing.T, occRepo *mockOccurrenceRepository) *occurrenceService {
+		groupRepo := new(mockAttachmentGroupRepository)
+		groupRepo.On("FindByOccurrenceID", mock.Anything).Return([]entity.AttachmentGroup{}, nil)
+		groupRepo.On("DeleteByOccurrenceID", mock.Anything).Return(nil)
+		changeLogRepo := new(mockChangeLogRepository)
+		changeLogRepo.On("Snapshot", mock.Anything).Return(repository.OccurrenceSnapshot{}, nil)
+		changeLogRepo.On("BumpGeneration").Return(nil)
+		return &occurrenceService{db: newTestDB(t), occRepo: occRepo, attachmentGroupRepo: groupRepo, changeLogRepo: changeLogRepo}
+	}
+
+	t.Run("保存期間より前にゴミ箱に入ったものだけ消すのだ", func(t *testing.T) {
+		var cutoff time.Time
+		occRepo := new(mockOccurrenceRepository)
+		occRepo.On("FindDeletedBefore", mock.Anything).Run(func(args mock.Arguments) {
+			cutoff = args.Get(0).(time.Time)
+		}).Return([]uint{3, 4}, nil)
+		occRepo.On("PurgeOccurrence", uint(3)).Return(nil)
+		occRepo.On("PurgeOccurrence", uint(4)).Return(nil)
+		s := newService(t, occRepo)
+
+		before := time.Now().Add(-retention)
+		purged, err := s.PurgeExpiredTrash(retention)
+		after := time.Now().Add(-retention)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, purged)
+		assert.False(t, cutoff.Before(before))
+		assert.False(t, cutoff.After(after))
+		occRepo.AssertNumberOfCalls(t, "PurgeOccurrence", 2)
+	})
+
+	t.Run("途中で失敗したら、それまでに消した数を返すのだ", func(t *testing.T) {
+		occRepo := new(mockOccurrenceRepository)
+		occRepo.On("FindDeletedBefore", mock.Anything).Return([]uint{3, 4}, nil)
+		occRepo.On("PurgeOccurrence", uint(3)).Return(nil)
+		occRepo.On("PurgeOccurrence", uint(4)).Return(errors.New("db down"))
+		s := newService(t, occRepo)
+
+		purged, err := s.PurgeExpiredTrash(retention)
+
+		assert.Error(t, err)
+		assert.Equal(t, 1, purged)
+	})
+}
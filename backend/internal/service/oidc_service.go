@@ -0,0 +1,226 @@
+// internal/service/oidc_service.go
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/saku-730/web-specimen/backend/config"
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/saku-730/web-specimen/backend/internal/oidc"
+	"github.com/saku-730/web-specimen/backend/internal/repository"
+	"github.com/saku-730/web-specimen/backend/internal/util"
+	"gorm.io/gorm"
+)
+
+// oidcStateTTL はIdPのログイン画面に行ってから戻ってくるまでに待つ時間なのだ
+const oidcStateTTL = 10 * time.Minute
+
+// ErrOIDCDisabled はOIDC_ISSUER_URLが設定されていない時のエラーなのだ
+var ErrOIDCDisabled = errors.New("oidc login is not configured")
+
+// ErrOIDCInvalidState はstateがcookieと合わない・期限切れの時のエラーなのだ
+var ErrOIDCInvalidState = errors.New("invalid oidc state")
+
+// ErrOIDCNoAccount はIdPのユーザーに対応するアカウントが無くて、自動で作らない設定の時のエラーなのだ
+var ErrOIDCNoAccount = errors.New("no account for this oidc identity")
+
+// ErrOIDCAccountConflict は同じメールアドレスのアカウントが、別のIdPのユーザーに結び付いている時のエラーなのだ
+var ErrOIDCAccountConflict = errors.New("account is linked to another oidc identity")
+
+type OIDCService interface {
+	Enabled() bool
+	BeginLogin(ctx context.Context) (*model.OIDCLoginStart, error)
+	CompleteLogin(ctx context.Context, code, state, stateCookie string) (*model.LoginResponse, error)
+}
+
+// oidcStateClaims はcookieに入れて持っておく、ログイン途中の情報なのだ
+// アプリの秘密鍵で署名するので、ブラウザに書き換えられる心配は無いのだ
+type oidcStateClaims struct {
+	State        string `json:"state"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+	jwt.RegisteredClaims
+}
+
+type oidcService struct {
+	db          *gorm.DB
+	provider    *oidc.Provider
+	userRepo    repository.UserRepository
+	authService AuthService
+	stateSecret []byte
+	autoCreate  bool
+	defaultRole string
+}
+
+// NewOIDCService はproviderがnilならOpenID Connectのログインを使わない設定になるのだ
+func NewOIDCService(db *gorm.DB, provider *oidc.Provider, userRepo repository.UserRepository, authService AuthService, cfg *configs.Config) OIDCService {
+	return &oidcService{
+		db:          db,
+		provider:    provider,
+		userRepo:    userRepo,
+		authService: authService,
+		// stateのクッキーもJWTなので、アクセストークンとして通ってしまわないように鍵を分けるのだ
+		stateSecret: []byte("oidc-state:" + cfg.JWTSecret),
+		autoCreate:  cfg.OIDCAutoCreateUsers,
+		defaultRole: cfg.OIDCDefaultRole,
+	}
+}
+
+func (s *oidcService) Enabled() bool {
+	return s.provider != nil
+}
+
+// BeginLogin はstate、nonce、PKCEのcode_verifierを作って、IdPに送るURLと一緒に返すのだ
+func (s *oidcService) BeginLogin(ctx context.Context) (*model.OIDCLoginStart, error) {
+	if s.provider == nil {
+		return nil, ErrOIDCDisabled
+	}
+
+	state, err := util.GenerateRandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := util.GenerateRandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	codeVerifier, err := util.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	authURL, err := s.provider.AuthCodeURL(ctx, state, nonce, codeVerifier)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &oidcStateClaims{
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(oidcStateTTL)),
+		},
+	}
+	stateCookie, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.stateSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.OIDCLoginStart{
+		AuthURL:     authURL,
+		StateCookie: stateCookie,
+		MaxAge:      int(oidcStateTTL.Seconds()),
+	}, nil
+}
+
+// CompleteLogin はIdPから戻ってきた認可コードを交換して、アプリのトークンを発行するのだ
+func (s *oidcService) CompleteLogin(ctx context.Context, code, state, stateCookie string) (*model.LoginResponse, error) {
+	if s.provider == nil {
+		return nil, ErrOIDCDisabled
+	}
+
+	stored := &oidcStateClaims{}
+	_, err := jwt.ParseWithClaims(stateCookie, stored, func(token *jwt.Token) (interface{}, error) {
+		return s.stateSecret, nil
+	}, jwt.WithValidMethods([]string{"HS256"}), jwt.WithExpirationRequired())
+	if err != nil || stored.State == "" || stored.State != state {
+		return nil, ErrOIDCInvalidState
+	}
+
+	claims, err := s.provider.Exchange(ctx, code, stored.CodeVerifier, stored.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.findOrCreateUser(claims)
+	if err != nil {
+		return nil, err
+	}
+	// 2段階認証が有効なユーザーは、パスワードでログインした時と同じchallengeを返すのだ
+	return s.authService.IssueLoginOrChallenge(user)
+}
+
+// findOrCreateUser はIdPのユーザーをentity.Userに結び付けるのだ
+// subで見つからなければ確認済みのメールアドレスで探して、それも無ければ設定次第で作るのだ
+func (s *oidcService) findOrCreateUser(claims *oidc.IDTokenClaims) (*entity.User, error) {
+	issuer := s.provider.Issuer()
+
+	user, err := s.userRepo.FindByOIDCSubject(issuer, claims.Subject)
+	if err == nil {
+		if user.DeactivatedAt != nil {
+			return nil, ErrAccountDeactivated
+		}
+		return user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	// 確認されていないメールアドレスで結び付けると、他人のアカウントを乗っ取れてしまうのだ
+	if claims.Email != "" && claims.EmailVerified {
+		user, err := s.userRepo.FindByEmail(claims.Email)
+		if err == nil {
+			if user.OIDCSubject != nil {
+				return nil, ErrOIDCAccountConflict
+			}
+			if user.DeactivatedAt != nil {
+				return nil, ErrAccountDeactivated
+			}
+			if err := s.userRepo.LinkOIDCSubject(user.UserID, issuer, claims.Subject); err != nil {
+				return nil, err
+			}
+			return user, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+
+	if !s.autoCreate {
+		return nil, ErrOIDCNoAccount
+	}
+	return s.createUser(issuer, claims)
+}
+
+func (s *oidcService) createUser(issuer string, claims *oidc.IDTokenClaims) (*entity.User, error) {
+	role, err := s.userRepo.FindRoleByName(s.defaultRole)
+	if err != nil {
+		return nil, fmt.Errorf("failed find default role %q: %w", s.defaultRole, err)
+	}
+	roleID := int(role.RoleID)
+
+	userName := claims.PreferredUsername
+	if userName == "" && claims.Email != "" {
+		userName = strings.SplitN(claims.Email, "@", 2)[0]
+	}
+	if userName == "" {
+		userName = claims.Subject
+	}
+	displayName := claims.Name
+	if displayName == "" {
+		displayName = userName
+	}
+
+	user := &entity.User{
+		UserName:    userName,
+		DisplayName: displayName,
+		RoleID:      &roleID,
+		OIDCIssuer:  &issuer,
+		OIDCSubject: &claims.Subject,
+	}
+	if claims.Email != "" && claims.EmailVerified {
+		user.MailAddress = &claims.Email
+	}
+	if err := s.userRepo.Create(s.db, user); err != nil {
+		return nil, err
+	}
+	user.UserRole = *role
+	return user, nil
+}
@@ -0,0 +1,16 @@
+// internal/service/pagination.go
+package service
+
+// maxPerPage は1ページに返す件数の上限なのだ。大きすぎる per_page でDBとメモリを使い切らないようにするのだ
+const maxPerPage = 200
+
+// clampPerPage は per_page が無い時は defaultPerPage に、大きすぎる時は maxPerPage にするのだ
+func clampPerPage(perPage, defaultPerPage int) int {
+	if perPage <= 0 {
+		return defaultPerPage
+	}
+	if perPage > maxPerPage {
+		return maxPerPage
+	}
+	return perPage
+}
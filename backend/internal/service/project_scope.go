@@ -0,0 +1,126 @@
+// internal/service/project_scope.go
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"gorm.io/gorm"
+)
+
+// ErrForbidden はプロジェクトの中の役割が足りなくて操作できない時のエラーなのだ
+var ErrForbidden = errors.New("forbidden")
+
+// ProjectForbiddenError はどのプロジェクトのどの権限が足りなかったかを持っているエラーなのだ
+// errors.Is(err, ErrForbidden) で判定できるのだ
+type ProjectForbiddenError struct {
+	ProjectID  uint
+	Permission model.Permission
+}
+
+func (e *ProjectForbiddenError) Error() string {
+	return fmt.Sprintf("forbidden: %s is not allowed in project %d", e.Permission, e.ProjectID)
+}
+
+func (e *ProjectForbiddenError) Is(target error) bool {
+	return target == ErrForbidden
+}
+
+// ErrProjectArchived はアーカイブしたプロジェクトのoccurrenceを変えようとした時のエラーなのだ
+var ErrProjectArchived = errors.New("project is archived")
+
+// ProjectArchivedError はどのプロジェクトがアーカイブされていたかを持っているエラーなのだ
+// 読むだけになっているので、errors.Is(err, ErrForbidden) でも判定できるのだ
+type ProjectArchivedError struct {
+	ProjectID uint
+}
+
+func (e *ProjectArchivedError) Error() string {
+	return fmt.Sprintf("forbidden: project %d is archived and read-only", e.ProjectID)
+}
+
+func (e *ProjectArchivedError) Is(target error) bool {
+	return target == ErrForbidden || target == ErrProjectArchived
+}
+
+// ErrNotOwner はプロジェクトに入っていない他の人のoccurrenceを触ろうとした時のエラーなのだ
+// errors.Is(err, ErrForbidden) でも判定できるのだ
+var ErrNotOwner = fmt.Errorf("%w: occurrence outside a project belongs to another user", ErrForbidden)
+
+// bypassProjectScope はプロジェクトの権限を確認しなくていいかを返すのだ
+// actorがnilなのはシステム (ゴミ箱の自動削除など) からの呼び出しなのだ
+func bypassProjectScope(actor *model.Actor) bool {
+	return actor == nil || actor.Role == model.RoleAdmin
+}
+
+// authorizeProject はactorがそのプロジェクトでpermissionの操作をしていいかを確かめるのだ
+// プロジェクトに入っていないoccurrence (projectIDがnil) は、持ち主 (ownerID) と管理者しか触れないのだ
+// アーカイブしたプロジェクトは、管理者でも読むことしかできないのだ
+func (s *occurrenceService) authorizeProject(actor *model.Actor, projectID *uint, ownerID *uint, permission model.Permission) error {
+	if actor == nil {
+		return nil
+	}
+	if projectID == nil {
+		if bypassProjectScope(actor) || (ownerID != nil && *ownerID == actor.UserID) {
+			return nil
+		}
+		return ErrNotOwner
+	}
+	if permission != model.PermissionReadOccurrence {
+		project, err := s.projectRepo.FindByID(*projectID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if project != nil && project.ArchivedAt != nil {
+			return &ProjectArchivedError{ProjectID: *projectID}
+		}
+	}
+	if bypassProjectScope(actor) {
+		return nil
+	}
+
+	members, err := s.projectMemberRepo.FindActiveByUserID(actor.UserID)
+	if err != nil {
+		return err
+	}
+	for _, member := range members {
+		if member.ProjectID != nil && *member.ProjectID == *projectID && model.HasProjectPermission(member.ProjectRole, permission) {
+			return nil
+		}
+	}
+	return &ProjectForbiddenError{ProjectID: *projectID, Permission: permission}
+}
+
+// authorizeOccurrence はoccurrenceが入っているプロジェクトで、permissionの操作をしていいかを確かめるのだ
+// occurrenceが無い時は gorm.ErrRecordNotFound が返るのだ
+func (s *occurrenceService) authorizeOccurrence(actor *model.Actor, id uint, permission model.Permission) error {
+	// 管理者でもアーカイブを確かめるので、読む時だけ先に通すのだ
+	if actor == nil || (bypassProjectScope(actor) && permission == model.PermissionReadOccurrence) {
+		return nil
+	}
+	projectID, ownerID, err := s.occRepo.FindOwnership(id)
+	if err != nil {
+		return err
+	}
+	return s.authorizeProject(actor, projectID, ownerID, permission)
+}
+
+// projectScope はactorがpermissionの操作をしていいプロジェクトの一覧を作るのだ。nilなら全部なのだ
+func (s *occurrenceService) projectScope(actor *model.Actor, permission model.Permission) (*model.ProjectScope, error) {
+	if bypassProjectScope(actor) {
+		return nil, nil
+	}
+
+	members, err := s.projectMemberRepo.FindActiveByUserID(actor.UserID)
+	if err != nil {
+		return nil, err
+	}
+	scope := &model.ProjectScope{ProjectIDs: []uint{}, UserID: actor.UserID}
+	for _, member := range members {
+		if member.ProjectID != nil && model.HasProjectPermission(member.ProjectRole, permission) {
+			scope.ProjectIDs = append(scope.ProjectIDs, *member.ProjectID)
+		}
+	}
+	return scope, nil
+}
@@ -0,0 +1,87 @@
+// internal/service/project_scope_test.go
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNullProjectOccurrenceOwnership(t *testing.T) {
+	member := &model.Actor{UserID: 1, Role: model.RoleCollector}
+
+	t.Run("プロジェクトに入っていない他の人のoccurrenceは編集できないのだ", func(t *testing.T) {
+		occRepo := new(mockOccurrenceRepository)
+		memberRepo := new(mockProjectMemberRepository)
+		occRepo.On("FindOwnership", uint(5)).Return(nil, uintPtr(2), nil)
+		s := &occurrenceService{db: newTestDB(t), occRepo: occRepo, projectMemberRepo: memberRepo}
+
+		_, err := s.UpdateOccurrence(member, 5, 0, &model.OccurrenceUpdate{UserID: 1})
+
+		assert.True(t, errors.Is(err, ErrForbidden))
+		assert.True(t, errors.Is(err, ErrNotOwner))
+		occRepo.AssertExpectations(t)
+		// プロジェクトが無いので、メンバーかどうかは見ないのだ
+		memberRepo.AssertNotCalled(t, "FindActiveByUserID", uint(1))
+	})
+
+	t.Run("持ち主と管理者は触れるのだ", func(t *testing.T) {
+		occRepo := new(mockOccurrenceRepository)
+		occRepo.On("FindOwnership", uint(5)).Return(nil, uintPtr(1), nil)
+		s := &occurrenceService{occRepo: occRepo}
+
+		assert.NoError(t, s.authorizeOccurrence(member, 5, model.PermissionEditOccurrence))
+		assert.NoError(t, s.authorizeProject(&model.Actor{UserID: 9, Role: model.RoleAdmin}, nil, uintPtr(1), model.PermissionDeleteOccurrence))
+	})
+
+	t.Run("持ち主でも他の人のものにはできないのだ", func(t *testing.T) {
+		s := &occurrenceService{}
+		err := s.authorizeProject(member, nil, uintPtr(2), model.PermissionCreateOccurrence)
+		assert.True(t, errors.Is(err, ErrNotOwner))
+	})
+
+	t.Run("検索の範囲にはactorのIDが入るのだ", func(t *testing.T) {
+		memberRepo := new(mockProjectMemberRepository)
+		memberRepo.On("FindActiveByUserID", uint(1)).Return([]entity.ProjectMember{
+			{ProjectID: uintPtr(3), ProjectRole: model.ProjectRoleObserver},
+		}, nil)
+		s := &occurrenceService{projectMemberRepo: memberRepo}
+
+		scope, err := s.projectScope(member, model.PermissionReadOccurrence)
+		assert.NoError(t, err)
+		assert.Equal(t, &model.ProjectScope{ProjectIDs: []uint{3}, UserID: 1}, scope)
+	})
+}
+
+func TestArchivedProjectReadOnly(t *testing.T) {
+	archivedAt := time.Now()
+	member := &model.Actor{UserID: 1, Role: model.RoleCollector}
+	newService := func() *occurrenceService {
+		projectRepo := new(mockProjectRepository)
+		projectRepo.On("FindByID", uint(3)).Return(&entity.Project{ProjectID: 3, ArchivedAt: &archivedAt}, nil)
+		memberRepo := new(mockProjectMemberRepository)
+		memberRepo.On("FindActiveByUserID", uint(1)).Return([]entity.ProjectMember{
+			{ProjectID: uintPtr(3), ProjectRole: model.ProjectRoleLead},
+		}, nil)
+		return &occurrenceService{projectRepo: projectRepo, projectMemberRepo: memberRepo}
+	}
+
+	t.Run("アーカイブしたプロジェクトのoccurrenceも読めるのだ", func(t *testing.T) {
+		assert.NoError(t, newService().authorizeProject(member, uintPtr(3), uintPtr(1), model.PermissionReadOccurrence))
+	})
+
+	t.Run("leadでも管理者でも編集や記録はできないのだ", func(t *testing.T) {
+		s := newService()
+		for _, actor := range []*model.Actor{member, {UserID: 9, Role: model.RoleAdmin}} {
+			for _, permission := range []model.Permission{model.PermissionCreateOccurrence, model.PermissionEditOccurrence, model.PermissionDeleteOccurrence} {
+				err := s.authorizeProject(actor, uintPtr(3), uintPtr(1), permission)
+				assert.True(t, errors.Is(err, ErrProjectArchived), "%s %s", actor.Role, permission)
+				assert.True(t, errors.Is(err, ErrForbidden))
+			}
+		}
+	})
+}
@@ -0,0 +1,450 @@
+// internal/service/project_service.go
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/saku-730/web-specimen/backend/internal/repository"
+	"gorm.io/gorm"
+)
+
+// ErrProjectInUse はoccurrenceが入っているプロジェクトを消そうとした時のエラーなのだ
+var ErrProjectInUse = errors.New("project has occurrences, archive it instead")
+
+// ErrAlreadyMember はもうメンバーになっているユーザーを足そうとした時のエラーなのだ
+var ErrAlreadyMember = errors.New("user is already a member of this project")
+
+// ErrInvalidProjectDates は終わりの日が始まりの日より前になっている時のエラーなのだ
+var ErrInvalidProjectDates = errors.New("finish date is before start date")
+
+// ErrUnknownUser はメンバーに足そうとしたユーザーがいない時のエラーなのだ
+var ErrUnknownUser = errors.New("user does not exist")
+
+const dateLayout = "2006-01-02"
+
+type ProjectService interface {
+	ListProjects(query *model.ProjectQuery) ([]model.ProjectInfo, error)
+	GetProject(id uint) (*model.ProjectInfo, error)
+	CreateProject(actor *model.Actor, req *model.ProjectRequest) (*model.ProjectInfo, error)
+	UpdateProject(actor *model.Actor, id uint, req *model.ProjectRequest) (*model.ProjectInfo, error)
+	DeleteProject(id uint) error
+	ArchiveProject(actor *model.Actor, id uint) (*model.ProjectInfo, error)
+	UnarchiveProject(actor *model.Actor, id uint) (*model.ProjectInfo, error)
+	ListMembers(id uint) ([]model.ProjectMemberInfo, error)
+	AddMember(actor *model.Actor, id uint, req *model.ProjectMemberCreate) (*model.ProjectMemberInfo, error)
+	UpdateMember(actor *model.Actor, id uint, memberID uint, req *model.ProjectMemberRequest) (*model.ProjectMemberInfo, error)
+	RemoveMember(actor *model.Actor, id uint, memberID uint) error
+}
+
+type projectService struct {
+	db                *gorm.DB
+	projectRepo       repository.ProjectRepository
+	projectMemberRepo repository.ProjectMemberRepository
+	userRepo          repository.UserRepository
+}
+
+func NewProjectService(
+	db *gorm.DB,
+	projectRepo repository.ProjectRepository,
+	projectMemberRepo repository.ProjectMemberRepository,
+	userRepo repository.UserRepository,
+) ProjectService {
+	return &projectService{
+		db:                db,
+		projectRepo:       projectRepo,
+		projectMemberRepo: projectMemberRepo,
+		userRepo:          userRepo,
+	}
+}
+
+func (s *projectService) ListProjects(query *model.ProjectQuery) ([]model.ProjectInfo, error) {
+	projects, err := s.projectRepo.FindAll(query.IncludeArchived)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []model.ProjectInfo{}
+	for i := range projects {
+		info, err := s.toProjectInfo(&projects[i])
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, *info)
+	}
+	return results, nil
+}
+
+func (s *projectService) GetProject(id uint) (*model.ProjectInfo, error) {
+	project, err := s.projectRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.toProjectInfo(project)
+}
+
+// CreateProject はプロジェクトを作って、作った人を今日からのleadにするのだ
+func (s *projectService) CreateProject(actor *model.Actor, req *model.ProjectRequest) (*model.ProjectInfo, error) {
+	project := &entity.Project{}
+	if err := applyProjectRequest(project, req); err != nil {
+		return nil, err
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.projectRepo.Create(tx, project); err != nil {
+			return err
+		}
+		today := truncateToDate(time.Now())
+		userID := int(actor.UserID)
+		return s.projectMemberRepo.Create(tx, &entity.ProjectMember{
+			ProjectID:   &project.ProjectID,
+			UserID:      &userID,
+			JoinDay:     &today,
+			ProjectRole: model.ProjectRoleLead,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.toProjectInfo(project)
+}
+
+// UpdateProject はプロジェクトの情報を丸ごと置き換えるのだ
+func (s *projectService) UpdateProject(actor *model.Actor, id uint, req *model.ProjectRequest) (*model.ProjectInfo, error) {
+	project, err := s.findManageable(actor, id)
+	if err != nil {
+		return nil, err
+	}
+	if project.ArchivedAt != nil {
+		return nil, &ProjectArchivedError{ProjectID: project.ProjectID}
+	}
+	if err := applyProjectRequest(project, req); err != nil {
+		return nil, err
+	}
+	if err := s.projectRepo.Update(project); err != nil {
+		return nil, err
+	}
+	return s.toProjectInfo(project)
+}
+
+// DeleteProject はoccurrenceが1つも無いプロジェクトだけを消すのだ
+// 記録が入っているプロジェクトは、消さないでアーカイブしてもらうのだ
+func (s *projectService) DeleteProject(id uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		// 先にプロジェクトの行をロックするので、数えてから消すまでの間にoccurrenceは入ってこないのだ
+		project, err := s.projectRepo.LockByID(tx, id)
+		if err != nil {
+			return err
+		}
+		count, err := s.projectRepo.CountOccurrences(tx, project.ProjectID)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrProjectInUse
+		}
+
+		if err := s.projectMemberRepo.DeleteByProjectID(tx, project.ProjectID); err != nil {
+			return err
+		}
+		return s.projectRepo.Delete(tx, project.ProjectID)
+	})
+}
+
+// ArchiveProject はプロジェクトをアーカイブして、中のoccurrenceを読むだけにするのだ
+func (s *projectService) ArchiveProject(actor *model.Actor, id uint) (*model.ProjectInfo, error) {
+	project, err := s.findManageable(actor, id)
+	if err != nil {
+		return nil, err
+	}
+	if project.ArchivedAt == nil {
+		now := time.Now()
+		if err := s.projectRepo.SetArchivedAt(project.ProjectID, &now); err != nil {
+			return nil, err
+		}
+		project.ArchivedAt = &now
+	}
+	return s.toProjectInfo(project)
+}
+
+func (s *projectService) UnarchiveProject(actor *model.Actor, id uint) (*model.ProjectInfo, error) {
+	project, err := s.findManageable(actor, id)
+	if err != nil {
+		return nil, err
+	}
+	if project.ArchivedAt != nil {
+		if err := s.projectRepo.SetArchivedAt(project.ProjectID, nil); err != nil {
+			return nil, err
+		}
+		project.ArchivedAt = nil
+	}
+	return s.toProjectInfo(project)
+}
+
+// ListMembers はプロジェクトのメンバーを、もう終わった人も入れて返すのだ
+func (s *projectService) ListMembers(id uint) ([]model.ProjectMemberInfo, error) {
+	if _, err := s.projectRepo.FindByID(id); err != nil {
+		return nil, err
+	}
+	members, err := s.projectMemberRepo.FindByProjectID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []model.ProjectMemberInfo{}
+	for i := range members {
+		results = append(results, *toProjectMemberInfo(&members[i]))
+	}
+	return results, nil
+}
+
+// AddMember はユーザーをプロジェクトのメンバーにするのだ。同じユーザーは1行だけなのだ
+func (s *projectService) AddMember(actor *model.Actor, id uint, req *model.ProjectMemberCreate) (*model.ProjectMemberInfo, error) {
+	project, err := s.findEditable(actor, id)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.userRepo.FindByID(req.UserID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUnknownUser
+		}
+		return nil, err
+	}
+	members, err := s.projectMemberRepo.FindByProjectID(project.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range members {
+		if m.UserID != nil && uint(*m.UserID) == req.UserID {
+			return nil, ErrAlreadyMember
+		}
+	}
+
+	userID := int(req.UserID)
+	member := &entity.ProjectMember{ProjectID: &project.ProjectID, UserID: &userID}
+	if err := applyProjectMemberRequest(member, &req.ProjectMemberRequest); err != nil {
+		return nil, err
+	}
+	if err := s.projectMemberRepo.Create(s.db, member); err != nil {
+		return nil, err
+	}
+
+	created, err := s.projectMemberRepo.FindByID(member.ProjectMemberID)
+	if err != nil {
+		return nil, err
+	}
+	return toProjectMemberInfo(created), nil
+}
+
+// UpdateMember はメンバーの役割と参加した日・終わった日を変えるのだ
+// 抜けてもらう時は、消さないで finish_date を入れるのがおすすめなのだ
+func (s *projectService) UpdateMember(actor *model.Actor, id uint, memberID uint, req *model.ProjectMemberRequest) (*model.ProjectMemberInfo, error) {
+	project, err := s.findEditable(actor, id)
+	if err != nil {
+		return nil, err
+	}
+	member, err := s.findMember(project.ProjectID, memberID)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyProjectMemberRequest(member, req); err != nil {
+		return nil, err
+	}
+	if err := s.projectMemberRepo.Update(member); err != nil {
+		return nil, err
+	}
+	return toProjectMemberInfo(member), nil
+}
+
+func (s *projectService) RemoveMember(actor *model.Actor, id uint, memberID uint) error {
+	project, err := s.findEditable(actor, id)
+	if err != nil {
+		return err
+	}
+	member, err := s.findMember(project.ProjectID, memberID)
+	if err != nil {
+		return err
+	}
+	return s.projectMemberRepo.Delete(member.ProjectMemberID)
+}
+
+// findManageable はプロジェクトを変えていい人か確かめてから、プロジェクトを返すのだ
+// project:manage を持っている人か、そのプロジェクトのleadだけなのだ
+func (s *projectService) findManageable(actor *model.Actor, id uint) (*entity.Project, error) {
+	project, err := s.projectRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if model.HasPermission(actor.Role, model.PermissionManageProject) {
+		return project, nil
+	}
+
+	members, err := s.projectMemberRepo.FindActiveByUserID(actor.UserID)
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range members {
+		if member.ProjectID != nil && *member.ProjectID == project.ProjectID && member.ProjectRole == model.ProjectRoleLead {
+			return project, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: only %s or the project lead can manage project %d", ErrForbidden, model.PermissionManageProject, project.ProjectID)
+}
+
+// findEditable はfindManageableに加えて、アーカイブされていないかも確かめるのだ
+func (s *projectService) findEditable(actor *model.Actor, id uint) (*entity.Project, error) {
+	project, err := s.findManageable(actor, id)
+	if err != nil {
+		return nil, err
+	}
+	if project.ArchivedAt != nil {
+		return nil, &ProjectArchivedError{ProjectID: project.ProjectID}
+	}
+	return project, nil
+}
+
+// findMember はそのプロジェクトのメンバーの行だけを返すのだ
+func (s *projectService) findMember(projectID uint, memberID uint) (*entity.ProjectMember, error) {
+	member, err := s.projectMemberRepo.FindByID(memberID)
+	if err != nil {
+		return nil, err
+	}
+	if member.ProjectID == nil || *member.ProjectID != projectID {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return member, nil
+}
+
+func (s *projectService) toProjectInfo(project *entity.Project) (*model.ProjectInfo, error) {
+	members, err := s.projectMemberRepo.FindByProjectID(project.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &model.ProjectInfo{
+		ProjectID:     project.ProjectID,
+		Description:   project.Disscription,
+		StartDate:     formatDate(project.StartDay),
+		FinishedDate:  formatDate(project.FinishedDay),
+		UpdatedDate:   formatDate(project.UpdatedDay),
+		Note:          project.Note,
+		ArchivedAt:    project.ArchivedAt,
+		ProjectMember: []uint{},
+	}
+	if project.ProjectName != nil {
+		info.ProjectName = *project.ProjectName
+	}
+	for i := range members {
+		if members[i].UserID != nil && memberActive(&members[i], time.Now()) {
+			info.ProjectMember = append(info.ProjectMember, uint(*members[i].UserID))
+		}
+	}
+	return info, nil
+}
+
+func toProjectMemberInfo(member *entity.ProjectMember) *model.ProjectMemberInfo {
+	info := &model.ProjectMemberInfo{
+		ProjectMemberID: member.ProjectMemberID,
+		UserName:        member.User.UserName,
+		ProjectRole:     member.ProjectRole,
+		JoinDate:        formatDate(member.JoinDay),
+		FinishDate:      formatDate(member.FinishDay),
+		Active:          memberActive(member, time.Now()),
+	}
+	if member.UserID != nil {
+		info.UserID = uint(*member.UserID)
+	}
+	return info
+}
+
+// applyProjectRequest はリクエストの値をプロジェクトのentityに入れるのだ
+func applyProjectRequest(project *entity.Project, req *model.ProjectRequest) error {
+	startDay, err := parseDate(req.StartDate)
+	if err != nil {
+		return err
+	}
+	finishedDay, err := parseDate(req.FinishedDate)
+	if err != nil {
+		return err
+	}
+	if startDay != nil && finishedDay != nil && finishedDay.Before(*startDay) {
+		return ErrInvalidProjectDates
+	}
+	updatedDay, err := parseDate(req.UpdatedDate)
+	if err != nil {
+		return err
+	}
+	if updatedDay == nil {
+		today := truncateToDate(time.Now())
+		updatedDay = &today
+	}
+
+	name := req.ProjectName
+	project.ProjectName = &name
+	project.Disscription = req.Description
+	project.StartDay = startDay
+	project.FinishedDay = finishedDay
+	project.UpdatedDay = updatedDay
+	project.Note = req.Note
+	return nil
+}
+
+// applyProjectMemberRequest はリクエストの値をメンバーのentityに入れるのだ
+func applyProjectMemberRequest(member *entity.ProjectMember, req *model.ProjectMemberRequest) error {
+	joinDay, err := parseDate(req.JoinDate)
+	if err != nil {
+		return err
+	}
+	finishDay, err := parseDate(req.FinishDate)
+	if err != nil {
+		return err
+	}
+	if joinDay != nil && finishDay != nil && finishDay.Before(*joinDay) {
+		return ErrInvalidProjectDates
+	}
+
+	member.ProjectRole = req.ProjectRole
+	member.JoinDay = joinDay
+	member.FinishDay = finishDay
+	return nil
+}
+
+// memberActive はFindActiveByUserIDと同じように、その日に参加中かを返すのだ
+func memberActive(member *entity.ProjectMember, now time.Time) bool {
+	today := truncateToDate(now)
+	if member.JoinDay != nil && member.JoinDay.After(today) {
+		return false
+	}
+	if member.FinishDay != nil && member.FinishDay.Before(today) {
+		return false
+	}
+	return true
+}
+
+// parseDate は "2024-01-01" の形の日付を読むのだ。nilならnilのままなのだ
+func parseDate(value *string) (*time.Time, error) {
+	if value == nil || *value == "" {
+		return nil, nil
+	}
+	parsed, err := time.Parse(dateLayout, *value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidProjectDates, err.Error())
+	}
+	return &parsed, nil
+}
+
+func formatDate(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	formatted := t.Format(dateLayout)
+	return &formatted
+}
+
+// truncateToDate は時刻を落として、その日の0時(UTC)にするのだ
+func truncateToDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,93 @@
+// internal/service/project_service_test.go
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestArchiveProjectPermission(t *testing.T) {
+	collector := &model.Actor{UserID: 1, Role: model.RoleCollector}
+
+	t.Run("プロジェクトのleadはアーカイブできるのだ", func(t *testing.T) {
+		projectRepo := new(mockProjectRepository)
+		projectRepo.On("FindByID", uint(3)).Return(&entity.Project{ProjectID: 3}, nil)
+		projectRepo.On("SetArchivedAt", uint(3), mock.AnythingOfType("*time.Time")).Return(nil)
+		memberRepo := new(mockProjectMemberRepository)
+		memberRepo.On("FindActiveByUserID", uint(1)).Return([]entity.ProjectMember{
+			{ProjectID: uintPtr(3), ProjectRole: model.ProjectRoleLead},
+		}, nil)
+		memberRepo.On("FindByProjectID", uint(3)).Return([]entity.ProjectMember{}, nil)
+		s := &projectService{projectRepo: projectRepo, projectMemberRepo: memberRepo}
+
+		info, err := s.ArchiveProject(collector, 3)
+
+		assert.NoError(t, err)
+		assert.NotNil(t, info.ArchivedAt)
+		projectRepo.AssertExpectations(t)
+	})
+
+	t.Run("lead以外のメンバーや、他のプロジェクトのleadはアーカイブできないのだ", func(t *testing.T) {
+		projectRepo := new(mockProjectRepository)
+		projectRepo.On("FindByID", uint(3)).Return(&entity.Project{ProjectID: 3}, nil)
+		memberRepo := new(mockProjectMemberRepository)
+		memberRepo.On("FindActiveByUserID", uint(1)).Return([]entity.ProjectMember{
+			{ProjectID: uintPtr(3), ProjectRole: model.ProjectRoleContributor},
+			{ProjectID: uintPtr(4), ProjectRole: model.ProjectRoleLead},
+		}, nil)
+		s := &projectService{projectRepo: projectRepo, projectMemberRepo: memberRepo}
+
+		_, err := s.ArchiveProject(collector, 3)
+
+		assert.True(t, errors.Is(err, ErrForbidden))
+		projectRepo.AssertNotCalled(t, "SetArchivedAt", mock.Anything, mock.Anything)
+	})
+
+	t.Run("project:manageを持っている人はメンバーでなくてもいいのだ", func(t *testing.T) {
+		projectRepo := new(mockProjectRepository)
+		projectRepo.On("FindByID", uint(3)).Return(&entity.Project{ProjectID: 3}, nil)
+		memberRepo := new(mockProjectMemberRepository)
+		s := &projectService{projectRepo: projectRepo, projectMemberRepo: memberRepo}
+
+		project, err := s.findManageable(&model.Actor{UserID: 9, Role: model.RoleAdmin}, 3)
+
+		assert.NoError(t, err)
+		assert.Equal(t, uint(3), project.ProjectID)
+		memberRepo.AssertNotCalled(t, "FindActiveByUserID", mock.Anything)
+	})
+}
+
+func TestDeleteProject(t *testing.T) {
+	t.Run("occurrenceが入っているプロジェクトは消さないのだ", func(t *testing.T) {
+		projectRepo := new(mockProjectRepository)
+		projectRepo.On("LockByID", uint(3)).Return(&entity.Project{ProjectID: 3}, nil)
+		projectRepo.On("CountOccurrences", uint(3)).Return(int64(2), nil)
+		memberRepo := new(mockProjectMemberRepository)
+		s := &projectService{db: newTestDB(t), projectRepo: projectRepo, projectMemberRepo: memberRepo}
+
+		err := s.DeleteProject(3)
+
+		assert.True(t, errors.Is(err, ErrProjectInUse))
+		projectRepo.AssertNotCalled(t, "Delete", mock.Anything)
+		memberRepo.AssertNotCalled(t, "DeleteByProjectID", mock.Anything)
+	})
+
+	t.Run("空のプロジェクトはメンバーと一緒に消すのだ", func(t *testing.T) {
+		projectRepo := new(mockProjectRepository)
+		projectRepo.On("LockByID", uint(3)).Return(&entity.Project{ProjectID: 3}, nil)
+		projectRepo.On("CountOccurrences", uint(3)).Return(int64(0), nil)
+		projectRepo.On("Delete", uint(3)).Return(nil)
+		memberRepo := new(mockProjectMemberRepository)
+		memberRepo.On("DeleteByProjectID", uint(3)).Return(nil)
+		s := &projectService{db: newTestDB(t), projectRepo: projectRepo, projectMemberRepo: memberRepo}
+
+		assert.NoError(t, s.DeleteProject(3))
+		projectRepo.AssertExpectations(t)
+		memberRepo.AssertExpectations(t)
+	})
+}
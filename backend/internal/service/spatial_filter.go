@@ -0,0 +1,104 @@
+// internal/service/spatial_filter.go
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/saku-730/web-specimen/backend/internal/util"
+)
+
+// ErrInvalidSpatialFilter は bbox, latitude/longitude/radius, polygon, max_uncertainty のどれかが読めなかった時のエラーなのだ
+var ErrInvalidSpatialFilter = errors.New("invalid spatial filter")
+
+// maxSearchRadius は地球の半周より遠くは意味が無いので、半径の上限にするのだ
+const maxSearchRadius = 20037508.0
+
+// parseSpatialFilter は検索クエリの場所の条件を確かめて、SQLに渡せる形にするのだ
+// 場所の条件が1つも無い時はnilを返すのだ
+func parseSpatialFilter(query *model.SearchQuery) (*model.SpatialFilter, error) {
+	var filter model.SpatialFilter
+	used := false
+
+	if query.BBox != "" {
+		values, err := parseFloats(query.BBox, 4)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bbox must be min_lng,min_lat,max_lng,max_lat", ErrInvalidSpatialFilter)
+		}
+		bbox := &model.BoundingBox{MinLng: values[0], MinLat: values[1], MaxLng: values[2], MaxLat: values[3]}
+		if !validLng(bbox.MinLng) || !validLng(bbox.MaxLng) || !validLat(bbox.MinLat) || !validLat(bbox.MaxLat) || bbox.MinLat > bbox.MaxLat {
+			return nil, fmt.Errorf("%w: bbox is out of range", ErrInvalidSpatialFilter)
+		}
+		filter.BBox = bbox
+		used = true
+	}
+
+	if query.Latitude != "" || query.Longitude != "" || query.Radius != "" {
+		lat, latErr := strconv.ParseFloat(query.Latitude, 64)
+		lng, lngErr := strconv.ParseFloat(query.Longitude, 64)
+		radius, radiusErr := strconv.ParseFloat(query.Radius, 64)
+		if latErr != nil || lngErr != nil || radiusErr != nil {
+			return nil, fmt.Errorf("%w: latitude, longitude and radius must be given together", ErrInvalidSpatialFilter)
+		}
+		if !validLat(lat) || !validLng(lng) || !finite(radius) || radius <= 0 || radius > maxSearchRadius {
+			return nil, fmt.Errorf("%w: latitude, longitude or radius is out of range", ErrInvalidSpatialFilter)
+		}
+		filter.Circle = &model.Circle{Lat: lat, Lng: lng, Radius: radius}
+		used = true
+	}
+
+	if query.Polygon != "" {
+		geoJSON, err := util.PolygonGeoJSON(query.Polygon)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidSpatialFilter, err.Error())
+		}
+		filter.Polygon = &geoJSON
+		used = true
+	}
+
+	if query.MaxUncertainty != "" {
+		maxUncertainty, err := strconv.ParseFloat(query.MaxUncertainty, 64)
+		if err != nil || !finite(maxUncertainty) || maxUncertainty < 0 {
+			return nil, fmt.Errorf("%w: max_uncertainty must be metres and not negative", ErrInvalidSpatialFilter)
+		}
+		filter.MaxUncertainty = &maxUncertainty
+		used = true
+	}
+
+	if !used {
+		return nil, nil
+	}
+	return &filter, nil
+}
+
+// parseFloats はカンマ区切りの数字をちょうど count 個読むのだ
+func parseFloats(text string, count int) ([]float64, error) {
+	parts := strings.Split(text, ",")
+	if len(parts) != count {
+		return nil, ErrInvalidSpatialFilter
+	}
+	values := make([]float64, count)
+	for i, part := range parts {
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, err
+		}
+		if !finite(value) {
+			return nil, ErrInvalidSpatialFilter
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// finite は strconv.ParseFloat が読めてしまう NaN と Inf を止めるのだ
+// NaNはどの比べ方でもfalseになるので、範囲の確認をすり抜けてSQLまで行ってしまうのだ
+func finite(value float64) bool { return !math.IsNaN(value) && !math.IsInf(value, 0) }
+
+func validLat(lat float64) bool { return lat >= -90 && lat <= 90 }
+
+func validLng(lng float64) bool { return lng >= -180 && lng <= 180 }
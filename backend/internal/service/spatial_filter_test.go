@@ -0,0 +1,44 @@
+// internal/service/spatial_filter_test.go
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSpatialFilter(t *testing.T) {
+	t.Run("条件が無ければnilなのだ", func(t *testing.T) {
+		filter, err := parseSpatialFilter(&model.SearchQuery{})
+		assert.NoError(t, err)
+		assert.Nil(t, filter)
+	})
+
+	t.Run("NaNやInfは範囲の確認をすり抜けないのだ", func(t *testing.T) {
+		for _, query := range []model.SearchQuery{
+			{Latitude: "35", Longitude: "139", Radius: "NaN"},
+			{Latitude: "35", Longitude: "139", Radius: "+Inf"},
+			{Latitude: "NaN", Longitude: "139", Radius: "100"},
+			{BBox: "139,35,NaN,36"},
+			{MaxUncertainty: "NaN"},
+			{MaxUncertainty: "Inf"},
+		} {
+			_, err := parseSpatialFilter(&query)
+			assert.True(t, errors.Is(err, ErrInvalidSpatialFilter), "%+v", query)
+		}
+	})
+
+	t.Run("交わっているpolygonはエラーなのだ", func(t *testing.T) {
+		_, err := parseSpatialFilter(&model.SearchQuery{Polygon: "POLYGON((0 0, 1 1, 1 0, 0 1, 0 0))"})
+		assert.True(t, errors.Is(err, ErrInvalidSpatialFilter))
+	})
+
+	t.Run("半径と不確かさを読むのだ", func(t *testing.T) {
+		filter, err := parseSpatialFilter(&model.SearchQuery{Latitude: "35", Longitude: "139", Radius: "500", MaxUncertainty: "100"})
+		assert.NoError(t, err)
+		assert.Equal(t, &model.Circle{Lat: 35, Lng: 139, Radius: 500}, filter.Circle)
+		assert.Equal(t, 100.0, *filter.MaxUncertainty)
+	})
+}
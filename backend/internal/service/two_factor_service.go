@@ -0,0 +1,225 @@
+// internal/service/two_factor_service.go
+package service
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/saku-730/web-specimen/backend/config"
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/saku-730/web-specimen/backend/internal/repository"
+	"github.com/saku-730/web-specimen/backend/internal/util"
+)
+
+// recoveryCodeCount は一度に作るリカバリーコードの数なのだ
+const recoveryCodeCount = 10
+
+// 2段階目のコードが、認証アプリのものかリカバリーコードかなのだ
+const (
+	TwoFactorMethodTOTP         = "totp"
+	TwoFactorMethodRecoveryCode = "recovery_code"
+)
+
+// ErrTOTPAlreadyEnabled はもう2段階認証が有効なのに、登録し直そうとした時のエラーなのだ
+var ErrTOTPAlreadyEnabled = errors.New("totp is already enabled")
+
+// ErrTOTPNotEnabled は2段階認証が有効になっていない時のエラーなのだ
+var ErrTOTPNotEnabled = errors.New("totp is not enabled")
+
+// ErrTOTPNotEnrolled は登録を始める前に確認のコードが来た時のエラーなのだ
+var ErrTOTPNotEnrolled = errors.New("totp enrolment has not been started")
+
+// ErrInvalidTwoFactorCode はコードが違う・もう使った時のエラーなのだ
+var ErrInvalidTwoFactorCode = errors.New("invalid two factor code")
+
+type TwoFactorService interface {
+	EnrollTOTP(actor *model.Actor) (*model.TOTPEnrollResponse, error)
+	ConfirmTOTP(actor *model.Actor, code string) (*model.RecoveryCodesResponse, error)
+	DisableTOTP(actor *model.Actor, code string, client *model.ClientInfo) error
+	RegenerateRecoveryCodes(actor *model.Actor, code string, client *model.ClientInfo) (*model.RecoveryCodesResponse, error)
+	ResetTOTP(userID uint) error
+	VerifyCode(user *entity.User, code string) (string, error)
+}
+
+type twoFactorService struct {
+	userRepo      repository.UserRepository
+	twoFactorRepo repository.TwoFactorRepository
+	secretKey     []byte
+	issuer        string
+
+	// ログインした後でも、コードを何度も試されないようにログインと同じ回数で止めるのだ
+	throttle *loginThrottle
+}
+
+func NewTwoFactorService(userRepo repository.UserRepository, twoFactorRepo repository.TwoFactorRepository, loginAuditRepo repository.LoginAuditRepository, cfg *configs.Config) TwoFactorService {
+	return &twoFactorService{
+		userRepo:      userRepo,
+		twoFactorRepo: twoFactorRepo,
+		secretKey:     util.SecretKey(cfg.JWTSecret, "totp"),
+		issuer:        cfg.TOTPIssuer,
+		throttle:      newLoginThrottle(loginAuditRepo, cfg),
+	}
+}
+
+// EnrollTOTP は新しい秘密鍵を作って、認証アプリに読み込ませるURIを返すのだ
+// 確認のコードが来るまでは、ログインの時に2段階目は聞かないのだ
+func (s *twoFactorService) EnrollTOTP(actor *model.Actor) (*model.TOTPEnrollResponse, error) {
+	user, err := s.userRepo.FindByID(actor.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabledAt != nil {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+
+	secret, err := util.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := util.EncryptSecret(s.secretKey, secret)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.twoFactorRepo.SetPendingSecret(user.UserID, encrypted); err != nil {
+		return nil, err
+	}
+
+	account := user.UserName
+	if user.MailAddress != nil {
+		account = *user.MailAddress
+	}
+	return &model.TOTPEnrollResponse{
+		Secret:          secret,
+		ProvisioningURI: util.TOTPProvisioningURI(s.issuer, account, secret),
+	}, nil
+}
+
+// ConfirmTOTP は認証アプリのコードが合ったら2段階認証を有効にして、リカバリーコードを返すのだ
+func (s *twoFactorService) ConfirmTOTP(actor *model.Actor, code string) (*model.RecoveryCodesResponse, error) {
+	user, err := s.userRepo.FindByID(actor.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabledAt != nil {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+	if user.TOTPSecret == nil {
+		return nil, ErrTOTPNotEnrolled
+	}
+
+	secret, err := util.DecryptSecret(s.secretKey, *user.TOTPSecret)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := util.ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.twoFactorRepo.Enable(user.UserID, step, hashes); err != nil {
+		return nil, err
+	}
+	return &model.RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// DisableTOTP は本人が2段階認証をやめるのだ。乗っ取られた時にやめられないように、コードも聞くのだ
+// アクセストークンを盗まれてもコードを総当たりできないように、間違いはログインの失敗と一緒に数えるのだ
+func (s *twoFactorService) DisableTOTP(actor *model.Actor, code string, client *model.ClientInfo) error {
+	user, err := s.userRepo.FindByID(actor.UserID)
+	if err != nil {
+		return err
+	}
+	if _, err := verifyThrottled(s.throttle, s, user, code, client); err != nil {
+		return err
+	}
+	return s.twoFactorRepo.Disable(user.UserID)
+}
+
+// RegenerateRecoveryCodes は古いリカバリーコードを使えなくして、新しいものを返すのだ
+func (s *twoFactorService) RegenerateRecoveryCodes(actor *model.Actor, code string, client *model.ClientInfo) (*model.RecoveryCodesResponse, error) {
+	user, err := s.userRepo.FindByID(actor.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := verifyThrottled(s.throttle, s, user, code, client); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.twoFactorRepo.ReplaceRecoveryCodes(user.UserID, hashes); err != nil {
+		return nil, err
+	}
+	return &model.RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// ResetTOTP は認証アプリもリカバリーコードも無くしたユーザーのために、管理者が2段階認証を外すのだ
+func (s *twoFactorService) ResetTOTP(userID uint) error {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return err
+	}
+	return s.twoFactorRepo.Disable(user.UserID)
+}
+
+// VerifyCode は認証アプリのコードかリカバリーコードを確かめて、どちらだったかを返すのだ
+// どちらも一度使ったら、もう一度は使えないのだ
+func (s *twoFactorService) VerifyCode(user *entity.User, code string) (string, error) {
+	if user.TOTPEnabledAt == nil || user.TOTPSecret == nil {
+		return "", ErrTOTPNotEnabled
+	}
+
+	secret, err := util.DecryptSecret(s.secretKey, *user.TOTPSecret)
+	if err != nil {
+		return "", err
+	}
+	if step, ok := util.ValidateTOTP(secret, code, time.Now()); ok {
+		used, err := s.twoFactorRepo.UseStep(user.UserID, step)
+		if err != nil {
+			return "", err
+		}
+		if !used {
+			return "", ErrInvalidTwoFactorCode
+		}
+		return TwoFactorMethodTOTP, nil
+	}
+
+	used, err := s.twoFactorRepo.UseRecoveryCode(user.UserID, util.HashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return "", err
+	}
+	if !used {
+		return "", ErrInvalidTwoFactorCode
+	}
+	return TwoFactorMethodRecoveryCode, nil
+}
+
+// generateRecoveryCodes は "xxxxx-xxxxx" の形のリカバリーコードと、保存するハッシュを作るのだ
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		secret, err := util.GenerateTOTPSecret()
+		if err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(secret[:10])
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		hashes = append(hashes, util.HashToken(raw))
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode はハイフンや空白、大文字小文字の違いを気にしないようにするのだ
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
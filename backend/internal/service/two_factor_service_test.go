@@ -0,0 +1,56 @@
+// internal/service/two_factor_service_test.go
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/saku-730/web-specimen/backend/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestDisableTOTPLockout(t *testing.T) {
+	key := util.SecretKey("test-secret", "totp")
+	secret, err := util.GenerateTOTPSecret()
+	assert.NoError(t, err)
+	encrypted, err := util.EncryptSecret(key, secret)
+	assert.NoError(t, err)
+
+	mail := "owner@example.com"
+	enabledAt := time.Now()
+	user := &entity.User{UserID: 4, MailAddress: &mail, TOTPSecret: &encrypted, TOTPEnabledAt: &enabledAt}
+
+	userRepo := new(mockUserRepository)
+	userRepo.On("FindByID", uint(4)).Return(user, nil)
+	twoFactorRepo := new(mockTwoFactorRepository)
+	twoFactorRepo.On("UseStep", uint(4), mock.Anything).Return(false, nil).Maybe()
+	twoFactorRepo.On("UseRecoveryCode", uint(4), mock.Anything).Return(false, nil)
+
+	s := &twoFactorService{
+		userRepo:      userRepo,
+		twoFactorRepo: twoFactorRepo,
+		secretKey:     key,
+		throttle:      newTestThrottle(&memoryLoginAuditRepository{}),
+	}
+	actor := &model.Actor{UserID: 4}
+	client := &model.ClientInfo{IPAddress: "192.0.2.7"}
+
+	// しきい値までは、ただの間違いなのだ
+	for i := 0; i < 3; i++ {
+		err := s.DisableTOTP(actor, "wrong-code", client)
+		assert.True(t, errors.Is(err, ErrInvalidTwoFactorCode))
+	}
+
+	// そこからはコードを確かめないで止めるのだ
+	err = s.DisableTOTP(actor, "wrong-code", client)
+	assert.True(t, errors.Is(err, ErrLoginLocked))
+	_, err = s.RegenerateRecoveryCodes(actor, "wrong-code", client)
+	assert.True(t, errors.Is(err, ErrLoginLocked))
+
+	twoFactorRepo.AssertNumberOfCalls(t, "UseRecoveryCode", 3)
+	twoFactorRepo.AssertNotCalled(t, "Disable", uint(4))
+}
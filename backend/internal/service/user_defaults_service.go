@@ -0,0 +1,181 @@
+// internal/service/user_defaults_service.go
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/saku-730/web-specimen/backend/internal/repository"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidDefaults はデフォルト値に存在しないIDが入っていた時のエラーなのだ
+var ErrInvalidDefaults = errors.New("invalid default values")
+
+type UserDefaultsService interface {
+	GetDefaults(userID int) (*model.DefaultValues, error)
+	SaveDefaults(actor *model.Actor, req *model.DefaultValuesUpdate) (*model.DefaultValues, error)
+}
+
+type userDefaultsService struct {
+	defaultsRepo      repository.UserDefaultsRepository
+	projectMemberRepo repository.ProjectMemberRepository
+}
+
+func NewUserDefaultsService(defaultsRepo repository.UserDefaultsRepository, projectMemberRepo repository.ProjectMemberRepository) UserDefaultsService {
+	return &userDefaultsService{defaultsRepo: defaultsRepo, projectMemberRepo: projectMemberRepo}
+}
+
+func (s *userDefaultsService) GetDefaults(userID int) (*model.DefaultValues, error) {
+	return loadDefaultValues(s.defaultsRepo, userID)
+}
+
+// SaveDefaults はデフォルト値を丸ごと置き換えるのだ
+// 名前のカラムはIDから引き直すので、クライアントが古い名前を送ってきても入らないのだ
+func (s *userDefaultsService) SaveDefaults(actor *model.Actor, req *model.DefaultValuesUpdate) (*model.DefaultValues, error) {
+	if req.ProjectID != nil {
+		if err := s.authorizeProject(actor, uint(*req.ProjectID)); err != nil {
+			return nil, err
+		}
+	}
+
+	defaults := defaultsFromUpdate(int(actor.UserID), req)
+	missing, err := s.defaultsRepo.ResolveNames(defaults)
+	if err != nil {
+		return nil, err
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: not found %s", ErrInvalidDefaults, strings.Join(missing, ", "))
+	}
+	if err := s.defaultsRepo.SaveDefaults(defaults); err != nil {
+		return nil, err
+	}
+	return toDefaultValues(defaults), nil
+}
+
+// authorizeProject はデフォルトにするプロジェクトに、actorが参加していてoccurrenceを記録できるかを確かめるのだ
+// 参加していないプロジェクトの名前が、デフォルト値の名前として見えてしまうのも防ぐのだ
+func (s *userDefaultsService) authorizeProject(actor *model.Actor, projectID uint) error {
+	if bypassProjectScope(actor) {
+		return nil
+	}
+	members, err := s.projectMemberRepo.FindActiveByUserID(actor.UserID)
+	if err != nil {
+		return err
+	}
+	for _, member := range members {
+		if member.ProjectID != nil && *member.ProjectID == projectID && model.HasProjectPermission(member.ProjectRole, model.PermissionCreateOccurrence) {
+			return nil
+		}
+	}
+	return &ProjectForbiddenError{ProjectID: projectID, Permission: model.PermissionCreateOccurrence}
+}
+
+// defaultsFromUpdate はネストされたリクエストを、users_defaults と同じフラットなentityにするのだ
+// 名前のカラムは空のままなので、ResolveNames で埋めるのだ
+func defaultsFromUpdate(userID int, req *model.DefaultValuesUpdate) *entity.UserDefault {
+	defaults := &entity.UserDefault{
+		UserID:       userID,
+		ProjectID:    req.ProjectID,
+		IndividualID: req.IndividualID,
+		Lifestage:    req.Lifestage,
+		Sex:          req.Sex,
+		LanguageID:   req.LanguageID,
+		PlaceName:    req.PlaceName,
+		Note:         req.Note,
+	}
+	if c := req.Classification; c != nil {
+		defaults.ClassificationSpecies = c.Species
+		defaults.ClassificationGenus = c.Genus
+		defaults.ClassificationFamily = c.Family
+		defaults.ClassificationOrder = c.Order
+		defaults.ClassificationClass = c.Class
+		defaults.ClassificationPhylum = c.Phylum
+		defaults.ClassificationKingdom = c.Kingdom
+		defaults.ClassificationOthers = c.Others
+	}
+	if o := req.Observation; o != nil {
+		defaults.ObservationUserID = o.ObservationUserID
+		defaults.ObservationMethodID = o.ObservationMethodID
+		defaults.ObservationBehavior = o.Behavior
+		defaults.ObservationObservedAt = o.ObservedAt
+	}
+	if sp := req.Specimen; sp != nil {
+		defaults.SpecimenUserID = sp.SpecimenUserID
+		defaults.SpecimenMethodID = sp.SpecimenMethodsID
+	}
+	if i := req.Identification; i != nil {
+		defaults.IdentificationUserID = i.IdentificationUserID
+		defaults.IdentificationIdentifiedAt = i.IdentifiedAt
+		defaults.IdentificationSourceInfo = i.SourceInfo
+	}
+	return defaults
+}
+
+// loadDefaultValues はユーザーのデフォルト値を読んで、名前をIDから引き直してから返すのだ
+// 保存した後にプロジェクトの名前などが変わっても、古い名前は返さないのだ
+func loadDefaultValues(defaultsRepo repository.UserDefaultsRepository, userID int) (*model.DefaultValues, error) {
+	defaults, err := defaultsRepo.FindDefaultsByUserID(userID)
+	if err != nil {
+		// もしユーザーのデフォルト設定がDBに無かったら、空っぽのデフォルト値を返す
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &model.DefaultValues{UserID: userID}, nil
+		}
+		return nil, err
+	}
+	// 後から消されたIDは、名前が空になるだけにするのだ
+	if _, err := defaultsRepo.ResolveNames(defaults); err != nil {
+		return nil, err
+	}
+	return toDefaultValues(defaults), nil
+}
+
+// toDefaultValues はフラットなentityをネストされたモデルに組み立てるのだ
+func toDefaultValues(entity *entity.UserDefault) *model.DefaultValues {
+	return &model.DefaultValues{
+		UserID:         entity.UserID,
+		UserName:       entity.UserName,
+		ProjectID:      entity.ProjectID,
+		ProjectName:    entity.ProjectName,
+		IndividualID:   entity.IndividualID,
+		Lifestage:      entity.Lifestage,
+		Sex:            entity.Sex,
+		LanguageID:     entity.LanguageID,
+		LanguageCommon: entity.LanguageCommon,
+		PlaceName:      entity.PlaceName,
+		Note:           entity.Note,
+		Classification: model.Classification{
+			Species: entity.ClassificationSpecies,
+			Genus:   entity.ClassificationGenus,
+			Family:  entity.ClassificationFamily,
+			Order:   entity.ClassificationOrder,
+			Class:   entity.ClassificationClass,
+			Phylum:  entity.ClassificationPhylum,
+			Kingdom: entity.ClassificationKingdom,
+			Others:  entity.ClassificationOthers,
+		},
+		Observation: model.Observation{
+			ObservationUserID:     entity.ObservationUserID,
+			ObservationUser:       entity.ObservationUserName,
+			ObservationMethodID:   entity.ObservationMethodID,
+			ObservationMethodName: entity.ObservationMethodName,
+			Behavior:              entity.ObservationBehavior,
+			ObservedAt:            entity.ObservationObservedAt,
+		},
+		Specimen: model.Specimen{
+			SpecimenUserID:        entity.SpecimenUserID,
+			SpecimenUser:          entity.SpecimenUserName,
+			SpecimenMethodsID:     entity.SpecimenMethodID,
+			SpecimenMethodsCommon: entity.SpecimenMethodName,
+		},
+		Identification: model.Identification{
+			IdentificationUserID: entity.IdentificationUserID,
+			IdentificationUser:   entity.IdentificationUserName,
+			IdentifiedAt:         entity.IdentificationIdentifiedAt,
+			SourceInfo:           entity.IdentificationSourceInfo,
+		},
+	}
+}
@@ -0,0 +1,76 @@
+// internal/service/user_defaults_service_test.go
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestSaveDefaults(t *testing.T) {
+	member := &model.Actor{UserID: 1, Role: model.RoleCollector}
+
+	newService := func(defaultsRepo *mockUserDefaultsRepository) *userDefaultsService {
+		memberRepo := new(mockProjectMemberRepository)
+		memberRepo.On("FindActiveByUserID", uint(1)).Return([]entity.ProjectMember{
+			{ProjectID: uintPtr(3), ProjectRole: model.ProjectRoleContributor},
+			{ProjectID: uintPtr(4), ProjectRole: model.ProjectRoleObserver},
+		}, nil)
+		return &userDefaultsService{defaultsRepo: defaultsRepo, projectMemberRepo: memberRepo}
+	}
+
+	t.Run("参加しているプロジェクトなら保存するのだ", func(t *testing.T) {
+		defaultsRepo := new(mockUserDefaultsRepository)
+		defaultsRepo.On("ResolveNames", intPtr(3)).Return([]string{}, nil)
+		defaultsRepo.On("SaveDefaults", mock.MatchedBy(func(d *entity.UserDefault) bool { return d.UserID == 1 })).Return(nil)
+		s := newService(defaultsRepo)
+
+		res, err := s.SaveDefaults(member, &model.DefaultValuesUpdate{ProjectID: intPtr(3)})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, res.UserID)
+		defaultsRepo.AssertExpectations(t)
+	})
+
+	t.Run("参加していないプロジェクトや記録できないプロジェクトはデフォルトにできないのだ", func(t *testing.T) {
+		for _, projectID := range []int{4, 5} {
+			defaultsRepo := new(mockUserDefaultsRepository)
+			s := newService(defaultsRepo)
+
+			_, err := s.SaveDefaults(member, &model.DefaultValuesUpdate{ProjectID: intPtr(projectID)})
+
+			var projectErr *ProjectForbiddenError
+			assert.True(t, errors.As(err, &projectErr))
+			assert.Equal(t, uint(projectID), projectErr.ProjectID)
+			// 名前を引く前に止めるので、他のプロジェクトの名前は分からないのだ
+			defaultsRepo.AssertNotCalled(t, "ResolveNames", mock.Anything)
+			defaultsRepo.AssertNotCalled(t, "SaveDefaults", mock.Anything)
+		}
+	})
+
+	t.Run("管理者はどのプロジェクトでもデフォルトにできるのだ", func(t *testing.T) {
+		defaultsRepo := new(mockUserDefaultsRepository)
+		defaultsRepo.On("ResolveNames", intPtr(5)).Return([]string{}, nil)
+		defaultsRepo.On("SaveDefaults", mock.Anything).Return(nil)
+		s := &userDefaultsService{defaultsRepo: defaultsRepo}
+
+		_, err := s.SaveDefaults(&model.Actor{UserID: 9, Role: model.RoleAdmin}, &model.DefaultValuesUpdate{ProjectID: intPtr(5)})
+		assert.NoError(t, err)
+	})
+
+	t.Run("無いIDが入っていたら保存しないのだ", func(t *testing.T) {
+		defaultsRepo := new(mockUserDefaultsRepository)
+		defaultsRepo.On("ResolveNames", (*int)(nil)).Return([]string{"language_id", "observation_method_id"}, nil)
+		s := newService(defaultsRepo)
+
+		_, err := s.SaveDefaults(member, &model.DefaultValuesUpdate{LanguageID: intPtr(99)})
+
+		assert.True(t, errors.Is(err, ErrInvalidDefaults))
+		assert.Contains(t, err.Error(), "language_id, observation_method_id")
+		defaultsRepo.AssertNotCalled(t, "SaveDefaults", mock.Anything)
+	})
+}
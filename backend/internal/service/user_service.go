@@ -0,0 +1,330 @@
+// internal/service/user_service.go
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/saku-730/web-specimen/backend/internal/repository"
+	"github.com/saku-730/web-specimen/backend/internal/util"
+	"gorm.io/gorm"
+)
+
+// ErrWrongPassword はパスワードを変える時に、今のパスワードが違った時のエラーなのだ
+var ErrWrongPassword = errors.New("old password is wrong")
+
+// ErrCannotDeactivateSelf は自分自身を無効にしようとした時のエラーなのだ
+var ErrCannotDeactivateSelf = errors.New("you cannot deactivate yourself")
+
+// ErrAccountDeactivated は無効にされたユーザーがログインしようとした時のエラーなのだ
+var ErrAccountDeactivated = errors.New("account is deactivated")
+
+// ErrLastAdmin は最後の有効な管理者を無効にしたり、管理者から外そうとした時のエラーなのだ
+var ErrLastAdmin = errors.New("cannot remove the last active admin")
+
+type UserService interface {
+	ListUsers(query *model.UserQuery) (*model.UserListResponse, error)
+	GetUser(actor *model.Actor, id uint) (*model.UserInfo, error)
+	CreateUser(req *model.UserCreate) (*model.UserInfo, error)
+	UpdateUser(ctx context.Context, actor *model.Actor, id uint, req *model.UserUpdate) (*model.UserInfo, error)
+	ChangePassword(actor *model.Actor, id uint, req *model.PasswordChangeRequest) error
+	DeactivateUser(actor *model.Actor, id uint) error
+	ReactivateUser(id uint) error
+}
+
+type userService struct {
+	db             *gorm.DB
+	userRepo       repository.UserRepository
+	tokenRepo      repository.TokenRepository
+	accountService AccountService
+}
+
+func NewUserService(db *gorm.DB, userRepo repository.UserRepository, tokenRepo repository.TokenRepository, accountService AccountService) UserService {
+	return &userService{db: db, userRepo: userRepo, tokenRepo: tokenRepo, accountService: accountService}
+}
+
+func (s *userService) ListUsers(query *model.UserQuery) (*model.UserListResponse, error) {
+	if query.Page <= 0 { query.Page = 1 }
+	query.PerPage = clampPerPage(query.PerPage, 30)
+
+	users, total, err := s.userRepo.FindAll(query.Page, query.PerPage, query.IncludeDeactivated)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []model.UserInfo{}
+	for i := range users {
+		results = append(results, *toUserInfo(&users[i]))
+	}
+
+	totalPages := 0
+	if total > 0 {
+		totalPages = int(math.Ceil(float64(total) / float64(query.PerPage)))
+	}
+
+	return &model.UserListResponse{
+		Results: results,
+		Metadata: model.Metadata{
+			TotalResults: int(total),
+			CurrentPage:  query.Page,
+			PerPage:      query.PerPage,
+			TotalPages:   totalPages,
+		},
+	}, nil
+}
+
+// GetUser は自分か、ユーザーを管理できる人だけが見られるのだ
+func (s *userService) GetUser(actor *model.Actor, id uint) (*model.UserInfo, error) {
+	if err := authorizeUser(actor, id); err != nil {
+		return nil, err
+	}
+	user, err := s.userRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	return toUserInfo(user), nil
+}
+
+// CreateUser は管理者がユーザーを作るのだ。パスワードはbcryptのハッシュにして保存するのだ
+func (s *userService) CreateUser(req *model.UserCreate) (*model.UserInfo, error) {
+	role, err := s.findRole(req.RoleID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.ensureEmailAvailable(req.MailAddress, 0); err != nil {
+		return nil, err
+	}
+
+	passwordHash, err := util.HashPassword(req.Password)
+	if err != nil {
+		return nil, err
+	}
+	displayName := req.DisplayName
+	if displayName == "" {
+		displayName = req.UserName
+	}
+	roleID := int(role.RoleID)
+	user := &entity.User{
+		UserName:    req.UserName,
+		DisplayName: displayName,
+		MailAddress: &req.MailAddress,
+		Password:    &passwordHash,
+		RoleID:      &roleID,
+		Timezone:    req.Timezone,
+	}
+	if err := s.userRepo.Create(s.db, user); err != nil {
+		return nil, err
+	}
+	user.UserRole = *role
+	return toUserInfo(user), nil
+}
+
+// UpdateUser は送られてきた項目だけを書き換えるのだ
+// 役割を変えるのは、ユーザーを管理できる人だけなのだ
+// 自分のメールアドレスは、新しいアドレスに送ったメールで確かめてから変わるのだ
+func (s *userService) UpdateUser(ctx context.Context, actor *model.Actor, id uint, req *model.UserUpdate) (*model.UserInfo, error) {
+	if err := authorizeUser(actor, id); err != nil {
+		return nil, err
+	}
+	if req.RoleID != nil && !model.HasPermission(actor.Role, model.PermissionManageUser) {
+		return nil, fmt.Errorf("%w: changing role_id requires %s", ErrForbidden, model.PermissionManageUser)
+	}
+	user, err := s.userRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]interface{}{}
+	if req.DisplayName != nil {
+		columns["display_name"] = *req.DisplayName
+	}
+	var pendingMailAddress *string
+	if req.MailAddress != nil && (user.MailAddress == nil || *user.MailAddress != *req.MailAddress) {
+		if err := s.ensureEmailAvailable(*req.MailAddress, user.UserID); err != nil {
+			return nil, err
+		}
+		if actor.UserID == user.UserID {
+			pendingMailAddress = req.MailAddress
+		} else {
+			columns["mail_address"] = *req.MailAddress
+		}
+	}
+	if req.Timezone != nil {
+		columns["timezone"] = *req.Timezone
+	}
+	var role *entity.UserRole
+	if req.RoleID != nil {
+		if role, err = s.findRole(req.RoleID); err != nil {
+			return nil, err
+		}
+		columns["role_id"] = *req.RoleID
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if role != nil && role.RoleName != model.RoleAdmin {
+			if err := s.ensureOtherActiveAdmin(tx, user); err != nil {
+				return err
+			}
+		}
+		return s.userRepo.Update(tx, user.UserID, columns)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 役割が変わったら、今のトークンに入っている古い役割を使わせないようにログインし直してもらうのだ
+	if req.RoleID != nil && (user.RoleID == nil || *user.RoleID != *req.RoleID) {
+		if err := s.tokenRepo.RevokeUserTokens(user.UserID); err != nil {
+			return nil, err
+		}
+	}
+
+	if pendingMailAddress != nil {
+		if err := s.accountService.RequestEmailChange(ctx, user, *pendingMailAddress); err != nil {
+			return nil, err
+		}
+	}
+
+	updated, err := s.userRepo.FindByID(user.UserID)
+	if err != nil {
+		return nil, err
+	}
+	info := toUserInfo(updated)
+	info.PendingMailAddress = pendingMailAddress
+	return info, nil
+}
+
+// ChangePassword は本人が今のパスワードを確かめてから、新しいパスワードにするのだ
+// 変えたら他の端末のログインも全部無効にするので、ログインし直してもらうのだ
+func (s *userService) ChangePassword(actor *model.Actor, id uint, req *model.PasswordChangeRequest) error {
+	if actor.UserID != id {
+		return fmt.Errorf("%w: you can only change your own password", ErrForbidden)
+	}
+	user, err := s.userRepo.FindByID(id)
+	if err != nil {
+		return err
+	}
+	if user.Password == nil || !util.CheckPasswordHash(req.OldPassword, *user.Password) {
+		return ErrWrongPassword
+	}
+
+	passwordHash, err := util.HashPassword(req.NewPassword)
+	if err != nil {
+		return err
+	}
+	if err := s.userRepo.UpdatePassword(user.UserID, passwordHash); err != nil {
+		return err
+	}
+	return s.tokenRepo.RevokeUserTokens(user.UserID)
+}
+
+// DeactivateUser はユーザーを消さないで無効にするのだ
+// occurrenceなどの外部キーはそのまま残って、ログインとAPIキーだけが使えなくなるのだ
+func (s *userService) DeactivateUser(actor *model.Actor, id uint) error {
+	if actor.UserID == id {
+		return ErrCannotDeactivateSelf
+	}
+	user, err := s.userRepo.FindByID(id)
+	if err != nil {
+		return err
+	}
+	if user.DeactivatedAt != nil {
+		return nil
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.ensureOtherActiveAdmin(tx, user); err != nil {
+			return err
+		}
+		now := time.Now()
+		return s.userRepo.SetDeactivatedAt(tx, user.UserID, &now)
+	})
+	if err != nil {
+		return err
+	}
+	return s.tokenRepo.RevokeUserTokens(user.UserID)
+}
+
+// ReactivateUser は無効にしたユーザーを元に戻すのだ
+func (s *userService) ReactivateUser(id uint) error {
+	user, err := s.userRepo.FindByID(id)
+	if err != nil {
+		return err
+	}
+	return s.userRepo.SetDeactivatedAt(s.db, user.UserID, nil)
+}
+
+// ensureOtherActiveAdmin はuserが有効な管理者なら、他にも有効な管理者がいるかを確かめるのだ
+// 最後の管理者がいなくなると、誰もユーザーを管理できなくなってしまうのだ
+func (s *userService) ensureOtherActiveAdmin(tx *gorm.DB, user *entity.User) error {
+	adminIDs, err := s.userRepo.LockActiveAdminIDs(tx)
+	if err != nil {
+		return err
+	}
+	if len(adminIDs) == 1 && adminIDs[0] == user.UserID {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+// findRole はrole_idの役割を探すのだ。nilならviewerにするのだ
+func (s *userService) findRole(roleID *int) (*entity.UserRole, error) {
+	var role *entity.UserRole
+	var err error
+	if roleID == nil {
+		role, err = s.userRepo.FindRoleByName(model.RoleViewer)
+	} else {
+		role, err = s.userRepo.FindRoleByID(uint(*roleID))
+	}
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidRole
+		}
+		return nil, err
+	}
+	return role, nil
+}
+
+// ensureEmailAvailable はメールアドレスが他のユーザーに使われていないかを確かめるのだ
+// selfID のユーザーが使っているのは、そのままでいいのだ
+func (s *userService) ensureEmailAvailable(email string, selfID uint) error {
+	user, err := s.userRepo.FindByEmail(email)
+	if err == nil {
+		if user.UserID == selfID {
+			return nil
+		}
+		return ErrEmailTaken
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	return err
+}
+
+// authorizeUser は自分のことか、ユーザーを管理できる役割の時だけ通すのだ
+func authorizeUser(actor *model.Actor, id uint) error {
+	if actor.UserID == id || model.HasPermission(actor.Role, model.PermissionManageUser) {
+		return nil
+	}
+	return fmt.Errorf("%w: requires %s", ErrForbidden, model.PermissionManageUser)
+}
+
+func toUserInfo(user *entity.User) *model.UserInfo {
+	return &model.UserInfo{
+		UserID:           user.UserID,
+		UserName:         user.UserName,
+		DisplayName:      user.DisplayName,
+		MailAddress:      user.MailAddress,
+		RoleID:           user.RoleID,
+		Role:             user.UserRole.RoleName,
+		Timezone:         user.Timezone,
+		TwoFactorEnabled: user.TOTPEnabledAt != nil,
+		CreatedAt:        user.CreatedAt,
+		DeactivatedAt:    user.DeactivatedAt,
+	}
+}
@@ -0,0 +1,157 @@
+// internal/service/user_service_test.go
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/saku-730/web-specimen/backend/internal/entity"
+	"github.com/saku-730/web-specimen/backend/internal/model"
+	"github.com/saku-730/web-specimen/backend/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+func stringPtr(v string) *string { return &v }
+
+func TestUpdateUser(t *testing.T) {
+	self := &model.Actor{UserID: 2, Role: model.RoleCollector}
+	admin := &model.Actor{UserID: 1, Role: model.RoleAdmin}
+
+	t.Run("他の人の情報は変えられないのだ", func(t *testing.T) {
+		s := &userService{}
+		_, err := s.UpdateUser(context.Background(), self, 3, &model.UserUpdate{DisplayName: stringPtr("x")})
+		assert.True(t, errors.Is(err, ErrForbidden))
+	})
+
+	t.Run("自分でも役割は変えられないのだ", func(t *testing.T) {
+		s := &userService{}
+		roleID := 1
+		_, err := s.UpdateUser(context.Background(), self, 2, &model.UserUpdate{RoleID: &roleID})
+		assert.True(t, errors.Is(err, ErrForbidden))
+	})
+
+	t.Run("自分のメールアドレスは確かめるメールを送るだけで、まだ変えないのだ", func(t *testing.T) {
+		user := &entity.User{UserID: 2, MailAddress: stringPtr("old@example.com")}
+		userRepo := new(mockUserRepository)
+		userRepo.On("FindByID", uint(2)).Return(user, nil)
+		userRepo.On("FindByEmail", "victim@example.com").Return(nil, gorm.ErrRecordNotFound)
+		userRepo.On("Update", uint(2), map[string]interface{}{}).Return(nil)
+		accountService := new(mockAccountService)
+		accountService.On("RequestEmailChange", uint(2), "victim@example.com").Return(nil)
+		s := &userService{db: newTestDB(t), userRepo: userRepo, accountService: accountService}
+
+		info, err := s.UpdateUser(context.Background(), self, 2, &model.UserUpdate{MailAddress: stringPtr("victim@example.com")})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "old@example.com", *info.MailAddress)
+		assert.Equal(t, "victim@example.com", *info.PendingMailAddress)
+		userRepo.AssertExpectations(t)
+		accountService.AssertExpectations(t)
+	})
+
+	t.Run("管理者は他の人のメールアドレスをそのまま変えられるのだ", func(t *testing.T) {
+		user := &entity.User{UserID: 2, MailAddress: stringPtr("old@example.com")}
+		userRepo := new(mockUserRepository)
+		userRepo.On("FindByID", uint(2)).Return(user, nil)
+		userRepo.On("FindByEmail", "new@example.com").Return(nil, gorm.ErrRecordNotFound)
+		userRepo.On("Update", uint(2), map[string]interface{}{"mail_address": "new@example.com"}).Return(nil)
+		accountService := new(mockAccountService)
+		s := &userService{db: newTestDB(t), userRepo: userRepo, accountService: accountService}
+
+		info, err := s.UpdateUser(context.Background(), admin, 2, &model.UserUpdate{MailAddress: stringPtr("new@example.com")})
+
+		assert.NoError(t, err)
+		assert.Nil(t, info.PendingMailAddress)
+		userRepo.AssertExpectations(t)
+		accountService.AssertNotCalled(t, "RequestEmailChange", mock.Anything, mock.Anything)
+	})
+
+	t.Run("最後の管理者は管理者から外せないのだ", func(t *testing.T) {
+		roleID := 3
+		user := &entity.User{UserID: 1}
+		userRepo := new(mockUserRepository)
+		userRepo.On("FindByID", uint(1)).Return(user, nil)
+		userRepo.On("FindRoleByID", uint(3)).Return(&entity.UserRole{RoleID: 3, RoleName: model.RoleCurator}, nil)
+		userRepo.On("LockActiveAdminIDs").Return([]uint{1}, nil)
+		s := &userService{db: newTestDB(t), userRepo: userRepo}
+
+		_, err := s.UpdateUser(context.Background(), admin, 1, &model.UserUpdate{RoleID: &roleID})
+
+		assert.True(t, errors.Is(err, ErrLastAdmin))
+		userRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+	})
+}
+
+func TestChangePassword(t *testing.T) {
+	hash, err := util.HashPassword("old-password")
+	assert.NoError(t, err)
+	self := &model.Actor{UserID: 2, Role: model.RoleCollector}
+
+	t.Run("管理者でも他の人のパスワードは変えられないのだ", func(t *testing.T) {
+		s := &userService{}
+		err := s.ChangePassword(&model.Actor{UserID: 1, Role: model.RoleAdmin}, 2, &model.PasswordChangeRequest{OldPassword: "old-password", NewPassword: "new-password"})
+		assert.True(t, errors.Is(err, ErrForbidden))
+	})
+
+	t.Run("今のパスワードが違うと変えないのだ", func(t *testing.T) {
+		userRepo := new(mockUserRepository)
+		userRepo.On("FindByID", uint(2)).Return(&entity.User{UserID: 2, Password: &hash}, nil)
+		s := &userService{userRepo: userRepo}
+
+		err := s.ChangePassword(self, 2, &model.PasswordChangeRequest{OldPassword: "wrong-password", NewPassword: "new-password"})
+
+		assert.True(t, errors.Is(err, ErrWrongPassword))
+		userRepo.AssertNotCalled(t, "UpdatePassword", mock.Anything, mock.Anything)
+	})
+
+	t.Run("変えたら全部のログインを無効にするのだ", func(t *testing.T) {
+		userRepo := new(mockUserRepository)
+		userRepo.On("FindByID", uint(2)).Return(&entity.User{UserID: 2, Password: &hash}, nil)
+		userRepo.On("UpdatePassword", uint(2), mock.Anything).Return(nil)
+		tokenRepo := new(mockTokenRepository)
+		tokenRepo.On("RevokeUserTokens", uint(2)).Return(nil)
+		s := &userService{userRepo: userRepo, tokenRepo: tokenRepo}
+
+		err := s.ChangePassword(self, 2, &model.PasswordChangeRequest{OldPassword: "old-password", NewPassword: "new-password"})
+
+		assert.NoError(t, err)
+		userRepo.AssertExpectations(t)
+		tokenRepo.AssertExpectations(t)
+	})
+}
+
+func TestDeactivateUser(t *testing.T) {
+	admin := &model.Actor{UserID: 1, Role: model.RoleAdmin}
+
+	t.Run("自分は無効にできないのだ", func(t *testing.T) {
+		s := &userService{}
+		assert.True(t, errors.Is(s.DeactivateUser(admin, 1), ErrCannotDeactivateSelf))
+	})
+
+	t.Run("最後の管理者は無効にできないのだ", func(t *testing.T) {
+		userRepo := new(mockUserRepository)
+		userRepo.On("FindByID", uint(5)).Return(&entity.User{UserID: 5}, nil)
+		userRepo.On("LockActiveAdminIDs").Return([]uint{5}, nil)
+		s := &userService{db: newTestDB(t), userRepo: userRepo}
+
+		assert.True(t, errors.Is(s.DeactivateUser(admin, 5), ErrLastAdmin))
+		userRepo.AssertNotCalled(t, "SetDeactivatedAt", mock.Anything, mock.Anything)
+	})
+
+	t.Run("無効にしたらログインも無効にするのだ", func(t *testing.T) {
+		userRepo := new(mockUserRepository)
+		userRepo.On("FindByID", uint(5)).Return(&entity.User{UserID: 5}, nil)
+		userRepo.On("LockActiveAdminIDs").Return([]uint{1}, nil)
+		userRepo.On("SetDeactivatedAt", uint(5), mock.Anything).Return(nil)
+		tokenRepo := new(mockTokenRepository)
+		tokenRepo.On("RevokeUserTokens", uint(5)).Return(nil)
+		s := &userService{db: newTestDB(t), userRepo: userRepo, tokenRepo: tokenRepo}
+
+		assert.NoError(t, s.DeactivateUser(admin, 5))
+		userRepo.AssertExpectations(t)
+		tokenRepo.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,23 @@
+// internal/util/backoff.go
+package util
+
+import "time"
+
+// LockoutDuration は失敗の回数からロックする時間を決めるのだ
+// threshold回までは0で、そこからは1回失敗するたびに base の2倍ずつ長くなって、max で止まるのだ
+func LockoutDuration(failures, threshold int, base, max time.Duration) time.Duration {
+	if threshold <= 0 || failures < threshold {
+		return 0
+	}
+	d := base
+	for i := threshold; i < failures; i++ {
+		d *= 2
+		if d >= max {
+			return max
+		}
+	}
+	if d > max {
+		return max
+	}
+	return d
+}
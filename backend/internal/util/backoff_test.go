@@ -0,0 +1,21 @@
+// internal/util/backoff_test.go
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockoutDuration(t *testing.T) {
+	base := time.Minute
+	max := time.Hour
+
+	assert.Equal(t, time.Duration(0), LockoutDuration(4, 5, base, max))
+	assert.Equal(t, time.Minute, LockoutDuration(5, 5, base, max))
+	assert.Equal(t, 2*time.Minute, LockoutDuration(6, 5, base, max))
+	assert.Equal(t, 8*time.Minute, LockoutDuration(8, 5, base, max))
+	assert.Equal(t, time.Hour, LockoutDuration(100, 5, base, max)) // 大きくなりすぎないのだ
+	assert.Equal(t, time.Duration(0), LockoutDuration(100, 0, base, max))
+}
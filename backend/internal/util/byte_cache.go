@@ -0,0 +1,73 @@
+// internal/util/byte_cache.go
+package util
+
+import (
+	"container/list"
+	"sync"
+)
+
+// ByteCache は合計のバイト数に上限があるLRUのキャッシュなのだ
+// 上限を超えたら、一番長く使われていないものから捨てるのだ
+type ByteCache struct {
+	mu       sync.Mutex
+	maxBytes int
+	bytes    int
+	order    *list.List // 前ほど最近使ったものなのだ
+	entries  map[string]*list.Element
+}
+
+type byteCacheEntry struct {
+	key   string
+	value []byte
+}
+
+func NewByteCache(maxBytes int) *ByteCache {
+	return &ByteCache{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func (c *ByteCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*byteCacheEntry).value, true
+}
+
+// Add は値を入れるのだ。1つで上限より大きい値は入れないのだ
+func (c *ByteCache) Add(key string, value []byte) {
+	if len(value) > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.bytes -= len(element.Value.(*byteCacheEntry).value)
+		c.order.Remove(element)
+	}
+	c.entries[key] = c.order.PushFront(&byteCacheEntry{key: key, value: value})
+	c.bytes += len(value)
+
+	for c.bytes > c.maxBytes {
+		oldest := c.order.Back()
+		entry := oldest.Value.(*byteCacheEntry)
+		c.order.Remove(oldest)
+		delete(c.entries, entry.key)
+		c.bytes -= len(entry.value)
+	}
+}
+
+// Clear は全部捨てるのだ
+func (c *ByteCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	c.entries = make(map[string]*list.Element)
+	c.bytes = 0
+}
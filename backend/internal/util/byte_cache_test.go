@@ -0,0 +1,43 @@
+// internal/util/byte_cache_test.go
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestByteCache(t *testing.T) {
+	t.Run("上限を超えたら一番使われていないものから捨てるのだ", func(t *testing.T) {
+		cache := NewByteCache(10)
+		cache.Add("a", []byte("aaaa"))
+		cache.Add("b", []byte("bbbb"))
+		_, ok := cache.Get("a") // aを使ったので、次に捨てられるのはbなのだ
+		assert.True(t, ok)
+
+		cache.Add("c", []byte("cccc"))
+		_, ok = cache.Get("b")
+		assert.False(t, ok)
+		value, ok := cache.Get("a")
+		assert.True(t, ok)
+		assert.Equal(t, []byte("aaaa"), value)
+		_, ok = cache.Get("c")
+		assert.True(t, ok)
+	})
+
+	t.Run("同じキーは上書きで、大きすぎる値とClearの後は入っていないのだ", func(t *testing.T) {
+		cache := NewByteCache(10)
+		cache.Add("a", []byte("aaaa"))
+		cache.Add("a", []byte("AAAAAAAA"))
+		value, _ := cache.Get("a")
+		assert.Equal(t, []byte("AAAAAAAA"), value)
+
+		cache.Add("big", make([]byte, 11))
+		_, ok := cache.Get("big")
+		assert.False(t, ok)
+
+		cache.Clear()
+		_, ok = cache.Get("a")
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,55 @@
+// internal/util/merge_patch.go
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// MergePatch は RFC 7396 (JSON Merge Patch) の手順で target に patch を当てるのだ
+// patch の中で null になっているキーは消えて、書かれていないキーはそのまま残るのだ
+func MergePatch(target, patch []byte) ([]byte, error) {
+	var targetValue interface{}
+	if len(bytes.TrimSpace(target)) > 0 {
+		if err := decodeJSON(target, &targetValue); err != nil {
+			return nil, err
+		}
+	}
+
+	var patchValue interface{}
+	if err := decodeJSON(patch, &patchValue); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(mergeValue(targetValue, patchValue))
+}
+
+// mergeValue は RFC 7396 の MergePatch(Target, Patch) 関数をそのまま書いたものなのだ
+func mergeValue(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		// オブジェクト以外(配列や文字列など)は丸ごと置き換えるのだ
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = mergeValue(targetObject[key], value)
+	}
+	return targetObject
+}
+
+// decodeJSON は数値の精度が落ちないように json.Number のままデコードするのだ
+func decodeJSON(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
@@ -0,0 +1,47 @@
+// internal/util/merge_patch_test.go
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// RFC 7396 の Appendix A にあるテストケースをそのまま使うのだ
+func TestMergePatch(t *testing.T) {
+	cases := []struct {
+		name     string
+		target   string
+		patch    string
+		expected string
+	}{
+		{"値の置き換え", `{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{"キーの追加", `{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{"nullでキーを消す", `{"a":"b"}`, `{"a":null}`, `{}`},
+		{"nullで片方だけ消す", `{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{"配列は丸ごと置き換え", `{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{"配列で置き換え", `{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{"ネストしたオブジェクト", `{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{"配列の中のオブジェクトはマージしない", `{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{"配列同士", `["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{"オブジェクトを配列で置き換え", `{"a":"b"}`, `["c"]`, `["c"]`},
+		{"オブジェクトをnullで置き換え", `{"a":"foo"}`, `null`, `null`},
+		{"オブジェクトを文字列で置き換え", `{"a":"foo"}`, `"bar"`, `"bar"`},
+		{"patchの中のnullは残らない", `{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{"配列をオブジェクトで置き換え", `[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{"深いところのnull", `{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			merged, err := MergePatch([]byte(tc.target), []byte(tc.patch))
+			assert.NoError(t, err)
+			assert.JSONEq(t, tc.expected, string(merged))
+		})
+	}
+
+	t.Run("壊れたJSONはエラー", func(t *testing.T) {
+		_, err := MergePatch([]byte(`{"a":1}`), []byte(`{"a":`))
+		assert.Error(t, err)
+	})
+}
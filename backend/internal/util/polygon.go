@@ -0,0 +1,368 @@
+// internal/util/polygon.go
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidPolygon はWKTでもGeoJSONでもPolygon/MultiPolygonとして読めなかった時のエラーなのだ
+var ErrInvalidPolygon = errors.New("polygon must be a WKT or GeoJSON Polygon/MultiPolygon in lng/lat")
+
+// polygonCoordinates は1つのPolygonの座標なのだ。[環][点][経度, 緯度] の順で、最初の環が外側なのだ
+type polygonCoordinates [][][]float64
+
+// PolygonGeoJSON はWKTかGeoJSONで書かれたPolygonかMultiPolygonを読んで、GeoJSONのgeometryの文字列にするのだ
+// データベースにはいつもGeoJSONで渡すので、壊れた形はここで止めてSQLのエラーにしないのだ
+// 座標はWGS84の経度・緯度で、高さ (3つ目の値) は捨てるのだ
+func PolygonGeoJSON(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	var polygons []polygonCoordinates
+	var err error
+	if strings.HasPrefix(text, "{") {
+		polygons, err = parseGeoJSONPolygons(text)
+	} else {
+		polygons, err = parseWKTPolygons(text)
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := validatePolygons(polygons); err != nil {
+		return "", err
+	}
+
+	var geometry interface{}
+	if len(polygons) == 1 {
+		geometry = map[string]interface{}{"type": "Polygon", "coordinates": polygons[0]}
+	} else {
+		geometry = map[string]interface{}{"type": "MultiPolygon", "coordinates": polygons}
+	}
+	encoded, err := json.Marshal(geometry)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+func parseGeoJSONPolygons(text string) ([]polygonCoordinates, error) {
+	var geometry struct {
+		Type        string          `json:"type"`
+		Coordinates json.RawMessage `json:"coordinates"`
+	}
+	if err := json.Unmarshal([]byte(text), &geometry); err != nil {
+		return nil, ErrInvalidPolygon
+	}
+
+	switch geometry.Type {
+	case "Polygon":
+		var polygon polygonCoordinates
+		if err := json.Unmarshal(geometry.Coordinates, &polygon); err != nil {
+			return nil, ErrInvalidPolygon
+		}
+		return []polygonCoordinates{polygon}, nil
+	case "MultiPolygon":
+		var polygons []polygonCoordinates
+		if err := json.Unmarshal(geometry.Coordinates, &polygons); err != nil {
+			return nil, ErrInvalidPolygon
+		}
+		return polygons, nil
+	default:
+		return nil, ErrInvalidPolygon
+	}
+}
+
+// parseWKTPolygons は "POLYGON((...))" と "MULTIPOLYGON(((...)))" を読むのだ
+// "SRID=4326;" が前に付いているEWKTも読めるけど、4326以外のSRIDは受け付けないのだ
+func parseWKTPolygons(text string) ([]polygonCoordinates, error) {
+	if strings.HasPrefix(strings.ToUpper(text), "SRID=") {
+		prefix, rest, found := strings.Cut(text, ";")
+		if !found || strings.TrimSpace(prefix[len("SRID="):]) != "4326" {
+			return nil, ErrInvalidPolygon
+		}
+		text = rest
+	}
+
+	w := &wktScanner{text: text}
+	var polygons []polygonCoordinates
+	switch strings.ToUpper(w.word()) {
+	case "POLYGON":
+		polygon, ok := w.polygon()
+		if !ok {
+			return nil, ErrInvalidPolygon
+		}
+		polygons = append(polygons, polygon)
+	case "MULTIPOLYGON":
+		if !w.consume('(') {
+			return nil, ErrInvalidPolygon
+		}
+		for {
+			polygon, ok := w.polygon()
+			if !ok {
+				return nil, ErrInvalidPolygon
+			}
+			polygons = append(polygons, polygon)
+			if !w.consume(',') {
+				break
+			}
+		}
+		if !w.consume(')') {
+			return nil, ErrInvalidPolygon
+		}
+	default:
+		return nil, ErrInvalidPolygon
+	}
+
+	if !w.done() {
+		return nil, ErrInvalidPolygon
+	}
+	return polygons, nil
+}
+
+// validatePolygons は環が閉じていて、座標が経度・緯度の範囲に入っているかを確かめるのだ
+// 辺が交わっている形はPostGISのST_Intersectsがエラーにするので、ここで止めるのだ
+func validatePolygons(polygons []polygonCoordinates) error {
+	if len(polygons) == 0 {
+		return ErrInvalidPolygon
+	}
+	for _, polygon := range polygons {
+		if len(polygon) == 0 {
+			return ErrInvalidPolygon
+		}
+		for _, ring := range polygon {
+			if len(ring) < 4 {
+				return ErrInvalidPolygon
+			}
+			for i, position := range ring {
+				if len(position) < 2 {
+					return ErrInvalidPolygon
+				}
+				position = position[:2]
+				ring[i] = position
+				// NaNはどの比べ方でもfalseになるので、範囲の中にあることを確かめるのだ
+				if !(position[0] >= -180 && position[0] <= 180 && position[1] >= -90 && position[1] <= 90) {
+					return ErrInvalidPolygon
+				}
+			}
+			first, last := ring[0], ring[len(ring)-1]
+			if first[0] != last[0] || first[1] != last[1] {
+				return ErrInvalidPolygon
+			}
+		}
+	}
+	if edgesCross(polygons) {
+		return fmt.Errorf("%w: edges must not cross or touch each other", ErrInvalidPolygon)
+	}
+	return nil
+}
+
+// segment は環の1本の辺なのだ。ring は何番目の環か、index は環の中で何番目の辺かなのだ
+type segment struct {
+	a, b        []float64
+	ring, index int
+	ringLength  int
+}
+
+// edgesCross は辺どうしが交わっていないかを調べるのだ
+// 同じ環の隣り合っていない辺は、触れるだけでもだめなのだ。違う環どうしは1点で触れるのはいいけど、横切るのはだめなのだ
+// 同じ点が続いている時は、長さ0の辺になるので先に取り除くのだ
+func edgesCross(polygons []polygonCoordinates) bool {
+	var segments []segment
+	ringNumber := 0
+	for _, polygon := range polygons {
+		for _, ring := range polygon {
+			var points [][]float64
+			for _, position := range ring {
+				if len(points) == 0 || !samePoint(points[len(points)-1], position) {
+					points = append(points, position)
+				}
+			}
+			if len(points) < 4 {
+				return true
+			}
+			for i := 0; i+1 < len(points); i++ {
+				segments = append(segments, segment{a: points[i], b: points[i+1], ring: ringNumber, index: i, ringLength: len(points) - 1})
+			}
+			ringNumber++
+		}
+	}
+
+	for i := range segments {
+		for j := i + 1; j < len(segments); j++ {
+			s, t := segments[i], segments[j]
+			if s.ring == t.ring {
+				adjacent := t.index == s.index+1 || (s.index == 0 && t.index == s.ringLength-1)
+				if !adjacent && segmentsTouch(s.a, s.b, t.a, t.b) {
+					return true
+				}
+				// 隣り合った辺でも、折り返して重なっていたらだめなのだ
+				if adjacent && collinearOverlap(s, t) {
+					return true
+				}
+				continue
+			}
+			if segmentsCrossProperly(s.a, s.b, t.a, t.b) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func samePoint(p, q []float64) bool { return p[0] == q[0] && p[1] == q[1] }
+
+// orientation は p→q→r が左回りなら正、右回りなら負、一直線なら0を返すのだ
+func orientation(p, q, r []float64) float64 {
+	return (q[0]-p[0])*(r[1]-p[1]) - (q[1]-p[1])*(r[0]-p[0])
+}
+
+// onSegment は一直線に並んでいる r が、p と q の間にあるかを返すのだ
+func onSegment(p, q, r []float64) bool {
+	return math.Min(p[0], q[0]) <= r[0] && r[0] <= math.Max(p[0], q[0]) &&
+		math.Min(p[1], q[1]) <= r[1] && r[1] <= math.Max(p[1], q[1])
+}
+
+// segmentsTouch は2本の辺に1つでも同じ点があるかを返すのだ
+func segmentsTouch(p1, p2, q1, q2 []float64) bool {
+	d1, d2 := orientation(q1, q2, p1), orientation(q1, q2, p2)
+	d3, d4 := orientation(p1, p2, q1), orientation(p1, p2, q2)
+	if ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) && ((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0)) {
+		return true
+	}
+	return (d1 == 0 && onSegment(q1, q2, p1)) || (d2 == 0 && onSegment(q1, q2, p2)) ||
+		(d3 == 0 && onSegment(p1, p2, q1)) || (d4 == 0 && onSegment(p1, p2, q2))
+}
+
+// segmentsCrossProperly は2本の辺が、端ではないところで横切っているかを返すのだ
+func segmentsCrossProperly(p1, p2, q1, q2 []float64) bool {
+	d1, d2 := orientation(q1, q2, p1), orientation(q1, q2, p2)
+	d3, d4 := orientation(p1, p2, q1), orientation(p1, p2, q2)
+	return ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) && ((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0))
+}
+
+// collinearOverlap は共有している頂点で折り返して、隣り合った辺が重なっているかを返すのだ
+func collinearOverlap(s, t segment) bool {
+	// 共有していない方の端が、もう1本の辺の上にあれば重なっているのだ
+	var shared, sOther, tOther []float64
+	switch {
+	case samePoint(s.b, t.a):
+		shared, sOther, tOther = s.b, s.a, t.b
+	case samePoint(s.a, t.b):
+		shared, sOther, tOther = s.a, s.b, t.a
+	default:
+		return false
+	}
+	if orientation(sOther, shared, tOther) != 0 {
+		return false
+	}
+	return onSegment(shared, sOther, tOther) || onSegment(shared, tOther, sOther)
+}
+
+// wktScanner はWKTを前から1文字ずつ読んでいくのだ
+type wktScanner struct {
+	text string
+	pos  int
+}
+
+func (w *wktScanner) skipSpace() {
+	for w.pos < len(w.text) && strings.ContainsRune(" \t\r\n", rune(w.text[w.pos])) {
+		w.pos++
+	}
+}
+
+// word は英字の並びを読むのだ
+func (w *wktScanner) word() string {
+	w.skipSpace()
+	start := w.pos
+	for w.pos < len(w.text) {
+		ch := w.text[w.pos]
+		if (ch < 'A' || ch > 'Z') && (ch < 'a' || ch > 'z') {
+			break
+		}
+		w.pos++
+	}
+	return w.text[start:w.pos]
+}
+
+// consume は次の文字が ch なら読み進めて true を返すのだ
+func (w *wktScanner) consume(ch byte) bool {
+	w.skipSpace()
+	if w.pos < len(w.text) && w.text[w.pos] == ch {
+		w.pos++
+		return true
+	}
+	return false
+}
+
+func (w *wktScanner) number() (float64, bool) {
+	w.skipSpace()
+	start := w.pos
+	for w.pos < len(w.text) && strings.ContainsRune("0123456789+-.eE", rune(w.text[w.pos])) {
+		w.pos++
+	}
+	value, err := strconv.ParseFloat(w.text[start:w.pos], 64)
+	return value, err == nil
+}
+
+// position は "経度 緯度" か "経度 緯度 高さ" を読むのだ
+func (w *wktScanner) position() ([]float64, bool) {
+	lng, ok := w.number()
+	if !ok {
+		return nil, false
+	}
+	lat, ok := w.number()
+	if !ok {
+		return nil, false
+	}
+	w.skipSpace()
+	if w.pos < len(w.text) && w.text[w.pos] != ',' && w.text[w.pos] != ')' {
+		if _, ok := w.number(); !ok {
+			return nil, false
+		}
+	}
+	return []float64{lng, lat}, true
+}
+
+func (w *wktScanner) ring() ([][]float64, bool) {
+	if !w.consume('(') {
+		return nil, false
+	}
+	var ring [][]float64
+	for {
+		position, ok := w.position()
+		if !ok {
+			return nil, false
+		}
+		ring = append(ring, position)
+		if !w.consume(',') {
+			break
+		}
+	}
+	return ring, w.consume(')')
+}
+
+func (w *wktScanner) polygon() (polygonCoordinates, bool) {
+	if !w.consume('(') {
+		return nil, false
+	}
+	var polygon polygonCoordinates
+	for {
+		ring, ok := w.ring()
+		if !ok {
+			return nil, false
+		}
+		polygon = append(polygon, ring)
+		if !w.consume(',') {
+			break
+		}
+	}
+	return polygon, w.consume(')')
+}
+
+func (w *wktScanner) done() bool {
+	w.skipSpace()
+	return w.pos == len(w.text)
+}
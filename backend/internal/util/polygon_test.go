@@ -0,0 +1,61 @@
+// internal/util/polygon_test.go
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolygonGeoJSON(t *testing.T) {
+	square := `{"type":"Polygon","coordinates":[[[139,35],[140,35],[140,36],[139,36],[139,35]]]}`
+
+	t.Run("WKTのPOLYGONはGeoJSONになるのだ", func(t *testing.T) {
+		geoJSON, err := PolygonGeoJSON("POLYGON((139 35, 140 35, 140 36, 139 36, 139 35))")
+		assert.NoError(t, err)
+		assert.JSONEq(t, square, geoJSON)
+	})
+
+	t.Run("SRID付きのEWKTとGeoJSONも同じ形になるのだ", func(t *testing.T) {
+		geoJSON, err := PolygonGeoJSON("SRID=4326;polygon ((139 35,140 35,140 36,139 36,139 35))")
+		assert.NoError(t, err)
+		assert.JSONEq(t, square, geoJSON)
+
+		geoJSON, err = PolygonGeoJSON(`{"type":"Polygon","coordinates":[[[139,35,10],[140,35,10],[140,36,10],[139,36,10],[139,35,10]]]}`)
+		assert.NoError(t, err)
+		assert.JSONEq(t, square, geoJSON) // 高さは捨てるのだ
+	})
+
+	t.Run("MULTIPOLYGONはMultiPolygonのままなのだ", func(t *testing.T) {
+		geoJSON, err := PolygonGeoJSON("MULTIPOLYGON(((0 0, 1 0, 1 1, 0 0)), ((10 10, 11 10, 11 11, 10 10), (10.2 10.1, 10.8 10.1, 10.8 10.7, 10.2 10.1)))")
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"type":"MultiPolygon","coordinates":[[[[0,0],[1,0],[1,1],[0,0]]],[[[10,10],[11,10],[11,11],[10,10]],[[10.2,10.1],[10.8,10.1],[10.8,10.7],[10.2,10.1]]]]}`, geoJSON)
+	})
+
+	t.Run("同じ点が続いていたり、穴が1点で触れているのはいいのだ", func(t *testing.T) {
+		_, err := PolygonGeoJSON("POLYGON((0 0, 4 0, 4 0, 4 4, 0 4, 0 0), (0 0, 1 2, 2 1, 0 0))")
+		assert.NoError(t, err)
+	})
+
+	t.Run("壊れた形や範囲外の座標はエラーなのだ", func(t *testing.T) {
+		for _, text := range []string{
+			"",
+			"POINT(139 35)",
+			"POLYGON((139 35, 140 35, 140 36, 139 36))",          // 閉じていないのだ
+			"POLYGON((139 35, 140 35, 139 35))",                  // 点が足りないのだ
+			"POLYGON((139 35, 140 35, 140 36, 139 36, 139 35)",   // 括弧が足りないのだ
+			"POLYGON((139 35, 140 35, 140 36, 139 36, 139 35))x", // 後ろにゴミがあるのだ
+			"POLYGON((139 95, 140 95, 140 96, 139 96, 139 95))",  // 緯度が範囲外なのだ
+			"SRID=3857;POLYGON((139 35, 140 35, 140 36, 139 36, 139 35))",
+			`{"type":"Point","coordinates":[139,35]}`,
+			`{"type":"Polygon","coordinates":"x"}`,
+			"POLYGON((0 0, 1 1, 1 0, 0 1, 0 0))",                            // 8の字に交わっているのだ
+			"POLYGON((0 0, 2 0, 2 2, 1 0, 0 2, 0 0))",                       // 頂点が辺の上に乗っているのだ
+			"POLYGON((0 0, 2 0, 1 0, 1 1, 0 0))",                            // 辺が折り返して重なっているのだ
+			"POLYGON((0 0, 4 0, 4 4, 0 4, 0 0), (3 1, 5 1, 5 2, 3 2, 3 1))", // 穴が外側の環を横切っているのだ
+		} {
+			_, err := PolygonGeoJSON(text)
+			assert.ErrorIs(t, err, ErrInvalidPolygon, text)
+		}
+	})
+}
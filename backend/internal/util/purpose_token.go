@@ -0,0 +1,37 @@
+// internal/util/purpose_token.go
+package util
+
+import (
+	"errors"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrInvalidPurposeToken は署名・期限・用途のどれかが合わないトークンの時のエラーなのだ
+var ErrInvalidPurposeToken = errors.New("invalid token")
+
+// PurposeClaims はメールで送る招待やパスワード再設定、メールアドレス変更のトークンの中身なのだ
+// 用途(purpose)を入れておいて、別の用途のトークンを使い回せないようにするのだ
+type PurposeClaims struct {
+	Purpose     string `json:"purpose"`
+	Fingerprint string `json:"fpr,omitempty"`   // これが変わったらトークンも使えなくなるのだ
+	Email       string `json:"email,omitempty"` // メールアドレス変更の新しいアドレスなのだ
+	jwt.RegisteredClaims
+}
+
+// SignPurposeToken はClaimsにHS256で署名するのだ
+func SignPurposeToken(secret []byte, claims *PurposeClaims) (string, error) {
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+}
+
+// ParsePurposeToken は署名と期限を確かめて、purposeが合っている時だけ中身を返すのだ
+func ParsePurposeToken(secret []byte, token, purpose string) (*PurposeClaims, error) {
+	claims := &PurposeClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		return secret, nil
+	}, jwt.WithValidMethods([]string{"HS256"}), jwt.WithExpirationRequired())
+	if err != nil || claims.Purpose != purpose {
+		return nil, ErrInvalidPurposeToken
+	}
+	return claims, nil
+}
@@ -0,0 +1,48 @@
+// internal/util/purpose_token_test.go
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPurposeToken(t *testing.T) {
+	secret := []byte("test-secret")
+	newClaims := func(purpose string, expiresIn time.Duration) *PurposeClaims {
+		return &PurposeClaims{
+			Purpose: purpose,
+			RegisteredClaims: jwt.RegisteredClaims{
+				Subject:   "1",
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+			},
+		}
+	}
+
+	t.Run("用途が合っていれば中身が取れるのだ", func(t *testing.T) {
+		token, err := SignPurposeToken(secret, newClaims("password_reset", time.Minute))
+		assert.NoError(t, err)
+
+		claims, err := ParsePurposeToken(secret, token, "password_reset")
+		assert.NoError(t, err)
+		assert.Equal(t, "1", claims.Subject)
+	})
+
+	t.Run("別の用途のトークンは使えないのだ", func(t *testing.T) {
+		token, _ := SignPurposeToken(secret, newClaims("invitation", time.Minute))
+		_, err := ParsePurposeToken(secret, token, "password_reset")
+		assert.ErrorIs(t, err, ErrInvalidPurposeToken)
+	})
+
+	t.Run("期限切れや別の鍵のトークンは使えないのだ", func(t *testing.T) {
+		expired, _ := SignPurposeToken(secret, newClaims("invitation", -time.Minute))
+		_, err := ParsePurposeToken(secret, expired, "invitation")
+		assert.ErrorIs(t, err, ErrInvalidPurposeToken)
+
+		other, _ := SignPurposeToken([]byte("other-secret"), newClaims("invitation", time.Minute))
+		_, err = ParsePurposeToken(secret, other, "invitation")
+		assert.ErrorIs(t, err, ErrInvalidPurposeToken)
+	})
+}
@@ -0,0 +1,59 @@
+// internal/util/secret_box.go
+package util
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+)
+
+// ErrDecryptSecret は暗号文が壊れているか、鍵が違う時のエラーなのだ
+var ErrDecryptSecret = errors.New("failed decrypt secret")
+
+// SecretKey はパスフレーズと用途から、AES-256の鍵を作るのだ
+func SecretKey(passphrase, purpose string) []byte {
+	sum := sha256.Sum256([]byte(purpose + ":" + passphrase))
+	return sum[:]
+}
+
+// EncryptSecret はDBに置いておく秘密(TOTPの鍵など)をAES-GCMで暗号にするのだ
+func EncryptSecret(key []byte, plain string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plain), nil)
+	return base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptSecret は EncryptSecret で暗号にしたものを元に戻すのだ
+func DecryptSecret(key []byte, encrypted string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(encrypted)
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return "", ErrDecryptSecret
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", ErrDecryptSecret
+	}
+	return string(plain), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
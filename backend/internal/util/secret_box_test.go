@@ -0,0 +1,23 @@
+// internal/util/secret_box_test.go
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptSecret(t *testing.T) {
+	key := SecretKey("test-secret", "totp")
+
+	encrypted, err := EncryptSecret(key, "JBSWY3DPEHPK3PXP")
+	assert.NoError(t, err)
+	assert.NotContains(t, encrypted, "JBSWY3DPEHPK3PXP")
+
+	plain, err := DecryptSecret(key, encrypted)
+	assert.NoError(t, err)
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", plain)
+
+	_, err = DecryptSecret(SecretKey("other-secret", "totp"), encrypted)
+	assert.ErrorIs(t, err, ErrDecryptSecret)
+}
@@ -0,0 +1,25 @@
+// internal/util/token.go
+package util
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// GenerateRandomToken は推測できないランダムな文字列を作るのだ (URLに入れても大丈夫な形なのだ)
+func GenerateRandomToken(byteLength int) (string, error) {
+	buf := make([]byte, byteLength)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// HashToken はDBに保存するためにトークンをSHA-256でハッシュにするのだ
+// トークン自体が十分ランダムなので、パスワードと違ってbcryptにする必要は無いのだ
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,23 @@
+// internal/util/token_test.go
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateRandomToken(t *testing.T) {
+	a, err := GenerateRandomToken(32)
+	assert.NoError(t, err)
+	b, err := GenerateRandomToken(32)
+	assert.NoError(t, err)
+
+	assert.Len(t, a, 43) // 32バイトをパディング無しのbase64urlにすると43文字なのだ
+	assert.NotEqual(t, a, b)
+}
+
+func TestHashToken(t *testing.T) {
+	// sha256("abc") の値なのだ
+	assert.Equal(t, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", HashToken("abc"))
+}
@@ -0,0 +1,54 @@
+// internal/util/totp_test.go
+package util
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// RFC 6238 の付録Bのテストベクトル(SHA-1)の下6桁なのだ
+func TestTOTPCode(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, expected := range vectors {
+		code, err := TOTPCode(secret, TOTPStep(time.Unix(unix, 0)))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, code, unix)
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	assert.NoError(t, err)
+	now := time.Unix(1700000000, 0)
+
+	code, _ := TOTPCode(secret, TOTPStep(now)-1)
+	step, ok := ValidateTOTP(secret, code, now)
+	assert.True(t, ok) // 30秒前のコードも時計のずれとして受け付けるのだ
+	assert.Equal(t, TOTPStep(now)-1, step)
+
+	old, _ := TOTPCode(secret, TOTPStep(now)-3)
+	_, ok = ValidateTOTP(secret, old, now)
+	assert.False(t, ok)
+
+	_, ok = ValidateTOTP(secret, "12345", now)
+	assert.False(t, ok)
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri := TOTPProvisioningURI("web-specimen", "curator@example.org", "ABCDEF")
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/web-specimen:curator@example.org?"))
+	assert.Contains(t, uri, "secret=ABCDEF")
+	assert.Contains(t, uri, "issuer=web-specimen")
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"log"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 
@@ -10,6 +11,8 @@ import (
 	"github.com/saku-730/web-specimen/backend/config"
 	"github.com/saku-730/web-specimen/backend/internal/handler"
 	"github.com/saku-730/web-specimen/backend/internal/infrastructure"
+	"github.com/saku-730/web-specimen/backend/internal/mailer"
+	"github.com/saku-730/web-specimen/backend/internal/oidc"
 	"github.com/saku-730/web-specimen/backend/internal/repository"
 	"github.com/saku-730/web-specimen/backend/internal/service"
 	"github.com/saku-730/web-specimen/backend/internal/router"
@@ -27,6 +30,39 @@ func ProfileHandler(c *gin.Context) {
 	})
 }
 
+// newOIDCProvider はOIDC_ISSUER_URLが設定されている時だけIdPのクライアントを作るのだ
+func newOIDCProvider(cfg *configs.Config) *oidc.Provider {
+	if cfg.OIDCIssuerURL == "" {
+		return nil
+	}
+	return oidc.NewProvider(oidc.Config{
+		IssuerURL:    cfg.OIDCIssuerURL,
+		ClientID:     cfg.OIDCClientID,
+		ClientSecret: cfg.OIDCClientSecret,
+		RedirectURL:  cfg.OIDCRedirectURL,
+		Scopes:       strings.Fields(cfg.OIDCScopes),
+	}, nil)
+}
+
+// newMailer はSMTP_HOSTが設定されていればSMTPで送って、無ければログに書くだけにするのだ
+// ログには招待やパスワード再設定のトークンがそのまま出るので、GIN_MODE=release では起動しないのだ
+func newMailer(cfg *configs.Config) mailer.Mailer {
+	if cfg.SMTPHost == "" {
+		if gin.Mode() == gin.ReleaseMode {
+			log.Fatal("SMTP_HOST is not set: refusing to write invitation and password reset tokens to the log in release mode")
+		}
+		log.Println("WARNING: SMTP_HOST is not set. Mails are NOT sent and their links (invitation, password reset, email change tokens) are written to this log. Use this only for development.")
+		return mailer.NewLogMailer()
+	}
+	return mailer.NewSMTPMailer(mailer.SMTPConfig{
+		Host:     cfg.SMTPHost,
+		Port:     cfg.SMTPPort,
+		Username: cfg.SMTPUsername,
+		Password: cfg.SMTPPassword,
+		From:     cfg.MailFrom,
+	})
+}
+
 func main() {
 	// load config
 	cfg, err := configs.LoadConfig()
@@ -45,26 +81,74 @@ func main() {
 	occRepo := repository.NewOccurrenceRepository(db)
 	userRepo := repository.NewUserRepository(db)
 	userDefaultsRepo := repository.NewUserDefaultsRepository(db)
+	entryTemplateRepo := repository.NewEntryTemplateRepository(db)
+	projectRepo := repository.NewProjectRepository(db)
+	observationMethodRepo := repository.NewMethodRepository(db,repository.ObservationMethodKind)
+	specimenMethodRepo := repository.NewMethodRepository(db,repository.SpecimenMethodKind)
+	institutionRepo := repository.NewInstitutionRepository(db)
 	attachmentRepo := repository.NewAttachmentRepository()
 	attachmentGroupRepo := repository.NewAttachmentGroupRepository()
 	fileExtensionRepo := repository.NewFileExtensionRepository()
+	changeLogRepo := repository.NewChangeLogRepository(db)
+	projectMemberRepo := repository.NewProjectMemberRepository(db)
+	tokenRepo := repository.NewTokenRepository(db)
+	apiKeyRepo := repository.NewAPIKeyRepository(db)
+	invitationRepo := repository.NewInvitationRepository(db)
+	loginAuditRepo := repository.NewLoginAuditRepository(db)
+	twoFactorRepo := repository.NewTwoFactorRepository(db)
 
 	// Service層を初期化
-	authService := service.NewAuthService(userRepo,cfg)
-	occService := service.NewOccurrenceService(db,occRepo,userDefaultsRepo,attachmentRepo,attachmentGroupRepo,fileExtensionRepo)
+	twoFactorService := service.NewTwoFactorService(userRepo,twoFactorRepo,loginAuditRepo,cfg)
+	authService := service.NewAuthService(userRepo,tokenRepo,loginAuditRepo,twoFactorService,cfg)
+	apiKeyService := service.NewAPIKeyService(apiKeyRepo)
+	loginAuditService := service.NewLoginAuditService(userRepo,loginAuditRepo)
+	accountService := service.NewAccountService(db,userRepo,invitationRepo,tokenRepo,loginAuditRepo,authService,newMailer(cfg),cfg)
+	oidcService := service.NewOIDCService(db,newOIDCProvider(cfg),userRepo,authService,cfg)
+	userService := service.NewUserService(db,userRepo,tokenRepo,accountService)
+	userDefaultsService := service.NewUserDefaultsService(userDefaultsRepo,projectMemberRepo)
+	templateService := service.NewEntryTemplateService(entryTemplateRepo,userDefaultsRepo,projectMemberRepo,projectRepo)
+	projectService := service.NewProjectService(db,projectRepo,projectMemberRepo,userRepo)
+	observationMethodService := service.NewMethodService(db,observationMethodRepo,changeLogRepo)
+	specimenMethodService := service.NewMethodService(db,specimenMethodRepo,changeLogRepo)
+	institutionService := service.NewInstitutionService(institutionRepo)
+	occService := service.NewOccurrenceService(db,occRepo,userDefaultsRepo,attachmentRepo,attachmentGroupRepo,fileExtensionRepo,changeLogRepo,projectMemberRepo,projectRepo,institutionRepo)
 
 	// Handler層を初期化
 	authHandler := handler.NewAuthHandler(authService)
-	occHandler := handler.NewOccurrenceHandler(occService)
+	occHandler := handler.NewOccurrenceHandler(occService,templateService)
+	apiKeyHandler := handler.NewAPIKeyHandler(apiKeyService)
+	accountHandler := handler.NewAccountHandler(accountService)
+	loginAuditHandler := handler.NewLoginAuditHandler(loginAuditService)
+	twoFactorHandler := handler.NewTwoFactorHandler(twoFactorService)
+	userHandler := handler.NewUserHandler(userService)
+	userDefaultsHandler := handler.NewUserDefaultsHandler(userDefaultsService)
+	templateHandler := handler.NewEntryTemplateHandler(templateService)
+	projectHandler := handler.NewProjectHandler(projectService)
+	observationMethodHandler := handler.NewMethodHandler(observationMethodService)
+	specimenMethodHandler := handler.NewMethodHandler(specimenMethodService)
+	institutionHandler := handler.NewInstitutionHandler(institutionService)
+	oidcHandler := handler.NewOIDCHandler(oidcService, strings.HasPrefix(cfg.OIDCRedirectURL, "https://"))
 
 	// Middlreware
-	authMiddleware := middleware.NewAuthMiddleware(cfg.JWTSecret)
+	authMiddleware := middleware.NewAuthMiddleware(cfg.JWTSecret, authService, apiKeyService)
 
 	//setup router
 
 	appRouter := router.SetupRouter(
 		authHandler,
 		occHandler,
+		apiKeyHandler,
+		oidcHandler,
+		accountHandler,
+		loginAuditHandler,
+		twoFactorHandler,
+		userHandler,
+		userDefaultsHandler,
+		templateHandler,
+		projectHandler,
+		observationMethodHandler,
+		specimenMethodHandler,
+		institutionHandler,
 		authMiddleware,
 	)
 
@@ -0,0 +1,7 @@
+-- +goose Up
+
+ALTER TABLE public.occurrence ADD COLUMN deleted_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX idx_occurrence_deleted_at ON public.occurrence (deleted_at);
+
+-- +goose Down
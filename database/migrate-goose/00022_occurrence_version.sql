@@ -0,0 +1,5 @@
+-- +goose Up
+
+ALTER TABLE public.occurrence ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+
+-- +goose Down
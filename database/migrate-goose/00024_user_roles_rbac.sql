@@ -0,0 +1,12 @@
+-- +goose Up
+
+-- editorをcuratorに名前を変えて、collectorを増やすのだ
+UPDATE public.user_roles SET role_name = 'curator' WHERE role_name = 'editor';
+
+-- 最初のロールはIDを指定して入れてあるので、先に連番を追いつかせてから、IDは連番に任せて名前で入れるのだ
+SELECT setval(pg_get_serial_sequence('public.user_roles', 'role_id'), (SELECT MAX(role_id) FROM public.user_roles));
+
+INSERT INTO public.user_roles (role_name) VALUES ('collector')
+ON CONFLICT (role_name) DO NOTHING;
+
+-- +goose Down
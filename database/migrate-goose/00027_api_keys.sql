@@ -0,0 +1,19 @@
+-- +goose Up
+
+-- スクリプトや測定機器から使うための個人用APIキーなのだ。キーそのものは保存しないで、SHA-256のハッシュだけを持つのだ
+CREATE TABLE public.api_keys (
+	api_key_id SERIAL PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES public.users(user_id),
+	name TEXT NOT NULL,
+	key_prefix TEXT NOT NULL, -- 一覧でどのキーか見分けるための先頭の数文字なのだ
+	key_hash TEXT NOT NULL UNIQUE,
+	scopes JSONB NOT NULL DEFAULT '[]'::jsonb,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+	expires_at TIMESTAMP WITH TIME ZONE,
+	last_used_at TIMESTAMP WITH TIME ZONE,
+	revoked_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_api_keys_user_id ON public.api_keys (user_id);
+
+-- +goose Down
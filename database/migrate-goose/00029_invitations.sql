@@ -0,0 +1,20 @@
+-- +goose Up
+
+-- 管理者からの招待と、メールアドレスを確かめてからの登録の申し込みなのだ
+-- メールで送る署名付きトークンのjtiをtoken_idに持っていて、一度受け入れたら使えなくなるのだ
+CREATE TABLE public.invitations (
+	invitation_id SERIAL PRIMARY KEY,
+	mail_address VARCHAR(255) NOT NULL,
+	role_id INT NOT NULL REFERENCES public.user_roles(role_id),
+	invited_by INT REFERENCES public.users(user_id), -- 自分で登録を申し込んだ時はNULLなのだ
+	token_id TEXT NOT NULL UNIQUE,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+	expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	accepted_at TIMESTAMP WITH TIME ZONE,
+	accepted_user_id INT REFERENCES public.users(user_id),
+	revoked_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_invitations_mail_address ON public.invitations (mail_address);
+
+-- +goose Down
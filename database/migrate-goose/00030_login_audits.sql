@@ -0,0 +1,20 @@
+-- +goose Up
+
+-- ログインの試みを全部記録するのだ。失敗が続いたアカウントやIPアドレスは、ここから数えてしばらくロックするのだ
+-- event は success / failure / locked (ロック中に来た試み) / unlock (管理者がロックを解いた) のどれかなのだ
+CREATE TABLE public.login_audits (
+	login_audit_id BIGSERIAL PRIMARY KEY,
+	user_id INT REFERENCES public.users(user_id), -- 知らないメールアドレスの時はNULLなのだ
+	mail_address VARCHAR(255) NOT NULL, -- 小文字にしてから入れるのだ
+	ip_address TEXT NOT NULL,
+	user_agent TEXT,
+	event TEXT NOT NULL CHECK (event IN ('success', 'failure', 'locked', 'unlock')),
+	detail TEXT, -- 失敗した理由や、誰がロックを解いたかなのだ
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_login_audits_mail_address ON public.login_audits (mail_address, created_at);
+CREATE INDEX idx_login_audits_ip_address ON public.login_audits (ip_address, created_at);
+CREATE INDEX idx_login_audits_user_id ON public.login_audits (user_id, created_at);
+
+-- +goose Down
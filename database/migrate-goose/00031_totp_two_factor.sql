@@ -0,0 +1,25 @@
+-- +goose Up
+
+-- TOTPの2段階認証なのだ。秘密鍵はアプリの鍵で暗号にしてから入れるのだ
+-- totp_enabled_at がNULLの間は、登録の途中でまだ確認のコードが来ていないのだ
+ALTER TABLE public.users ADD COLUMN totp_secret TEXT;
+ALTER TABLE public.users ADD COLUMN totp_enabled_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE public.users ADD COLUMN totp_last_step BIGINT; -- 同じコードを2回使わせないために、最後に使った30秒の番号を覚えるのだ
+
+-- 認証アプリを無くした時のための、一度だけ使えるリカバリーコードなのだ。ハッシュだけを持つのだ
+CREATE TABLE public.totp_recovery_codes (
+	recovery_code_id SERIAL PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES public.users(user_id),
+	code_hash TEXT NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+	used_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_totp_recovery_codes_user_id ON public.totp_recovery_codes (user_id);
+
+-- パスワードは合っていて、2段階目のコードを待っている時の記録なのだ
+ALTER TABLE public.login_audits DROP CONSTRAINT login_audits_event_check;
+ALTER TABLE public.login_audits ADD CONSTRAINT login_audits_event_check
+	CHECK (event IN ('success', 'failure', 'locked', 'unlock', 'challenge'));
+
+-- +goose Down
@@ -0,0 +1,6 @@
+-- +goose Up
+
+-- ユーザーは消さないで無効にするのだ。occurrenceなどから外部キーで参照されているので、行は残しておくのだ
+ALTER TABLE public.users ADD COLUMN deactivated_at TIMESTAMP WITH TIME ZONE;
+
+-- +goose Down
@@ -0,0 +1,9 @@
+-- +goose Up
+
+-- アーカイブしたプロジェクトは、occurrenceもメンバーも読むだけになるのだ
+-- 消さないでアーカイブするので、記録はそのまま残るのだ
+ALTER TABLE public.projects ADD COLUMN archived_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX idx_project_members_project_id ON public.project_members (project_id);
+
+-- +goose Down
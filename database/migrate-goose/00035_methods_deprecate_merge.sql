@@ -0,0 +1,14 @@
+-- +goose Up
+
+-- 観察方法と標本作成方法は消さないで、使わなくなったら deprecated_at を入れるのだ
+-- 古い記録にはそのまま出るけど、作成ページの選択肢からは消えるのだ
+-- 同じものを2つ作ってしまった時は merged_into に残った方のIDを入れて、記録は全部そっちに付け替えるのだ
+ALTER TABLE public.observation_methods
+	ADD COLUMN deprecated_at TIMESTAMP WITH TIME ZONE,
+	ADD COLUMN merged_into INT REFERENCES public.observation_methods(observation_method_id);
+
+ALTER TABLE public.specimen_methods
+	ADD COLUMN deprecated_at TIMESTAMP WITH TIME ZONE,
+	ADD COLUMN merged_into INT REFERENCES public.specimen_methods(specimen_methods_id);
+
+-- +goose Down
@@ -0,0 +1,20 @@
+-- +goose Up
+
+-- institution_id_code はIDとコードしか無かったので、機関の情報をちゃんと持てるようにするのだ
+-- grscicoll_id は GRSciColl の機関のUUID、index_herbariorum_code は Index Herbariorum のコードなのだ
+-- 機関は消さないで、使わなくなったら deactivated_at を入れるのだ。古い標本にはそのまま出るのだ
+ALTER TABLE public.institution_id_code
+	ADD COLUMN institution_name TEXT,
+	ADD COLUMN acronym TEXT,
+	ADD COLUMN address TEXT,
+	ADD COLUMN country_code CHAR(2),
+	ADD COLUMN grscicoll_id UUID,
+	ADD COLUMN index_herbariorum_code TEXT,
+	ADD COLUMN contact_name TEXT,
+	ADD COLUMN contact_email TEXT,
+	ADD COLUMN url TEXT,
+	ADD COLUMN deactivated_at TIMESTAMP WITH TIME ZONE;
+
+CREATE UNIQUE INDEX institution_id_code_grscicoll_id_key ON public.institution_id_code (grscicoll_id);
+
+-- +goose Down
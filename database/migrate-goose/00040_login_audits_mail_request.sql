@@ -0,0 +1,9 @@
+-- +goose Up
+
+-- 登録やパスワード再設定のメールを頼まれた時の記録なのだ
+-- 同じアドレスやIPアドレスに何通も送らせないように、ログインの失敗と同じように数えるのだ
+ALTER TABLE public.login_audits DROP CONSTRAINT login_audits_event_check;
+ALTER TABLE public.login_audits ADD CONSTRAINT login_audits_event_check
+	CHECK (event IN ('success', 'failure', 'locked', 'unlock', 'challenge', 'mail_request'));
+
+-- +goose Down
@@ -0,0 +1 @@
+ALTER TABLE public.occurrence ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,7 @@
+ALTER TABLE public.change_logs
+	ADD COLUMN table_name TEXT,
+	ADD COLUMN occurrence_id INTEGER,
+	ALTER COLUMN date TYPE TIMESTAMP WITH TIME ZONE;
+
+-- occurrenceが完全に消えても履歴は残したいので、occurrence_idには外部キーを付けないのだ
+CREATE INDEX idx_change_logs_occurrence_id ON public.change_logs (occurrence_id, log_id);
@@ -0,0 +1,6 @@
+-- プロジェクトの中での役割なのだ (lead: まとめ役 / contributor: 記録する人 / observer: 見るだけの人)
+ALTER TABLE public.project_members
+	ADD COLUMN project_role TEXT NOT NULL DEFAULT 'contributor'
+	CHECK (project_role IN ('lead', 'contributor', 'observer'));
+
+CREATE INDEX idx_project_members_user_id ON public.project_members (user_id, project_id);
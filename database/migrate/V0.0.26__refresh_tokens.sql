@@ -0,0 +1,24 @@
+-- ログインを続けるためのリフレッシュトークンなのだ。トークンそのものは保存しないで、SHA-256のハッシュだけを持つのだ
+-- 同じログインから回転していったトークンは同じfamily_idを持っていて、使い回しがあったらfamilyごと無効にするのだ
+CREATE TABLE public.refresh_tokens (
+	refresh_token_id SERIAL PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES public.users(user_id),
+	token_hash TEXT NOT NULL UNIQUE,
+	family_id TEXT NOT NULL,
+	access_jti TEXT, -- このトークンと一緒に発行したアクセストークンのjtiなのだ
+	expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+	used_at TIMESTAMP WITH TIME ZONE,
+	revoked_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_refresh_tokens_family_id ON public.refresh_tokens (family_id);
+CREATE INDEX idx_refresh_tokens_user_id ON public.refresh_tokens (user_id);
+
+-- 期限が来る前に無効にしたアクセストークンのjtiなのだ。expires_atを過ぎたら消してもいいのだ
+CREATE TABLE public.revoked_access_tokens (
+	jti TEXT PRIMARY KEY,
+	user_id INT REFERENCES public.users(user_id),
+	expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	revoked_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
@@ -0,0 +1,7 @@
+-- OpenID Connectでログインするユーザーを、IdPの発行者(iss)とsubで見つけられるようにするのだ
+-- パスワードを持たないユーザーもいるので、passwordはNULLのままでいいのだ
+ALTER TABLE public.users ADD COLUMN oidc_issuer TEXT;
+ALTER TABLE public.users ADD COLUMN oidc_subject TEXT;
+
+CREATE UNIQUE INDEX uq_users_oidc_identity ON public.users (oidc_issuer, oidc_subject)
+WHERE oidc_subject IS NOT NULL;
@@ -0,0 +1,15 @@
+-- ユーザーごとに名前を付けて持てる、作成ページの入力テンプレートなのだ
+-- project_id を入れると、そのプロジェクトのメンバーも使えるようになるのだ
+-- 中身は PUT /me/defaults と同じ形のJSONで、名前はIDから読む時に引くのだ
+CREATE TABLE public.entry_templates (
+	template_id SERIAL PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES public.users(user_id) ON DELETE CASCADE,
+	project_id INT REFERENCES public.projects(project_id) ON DELETE SET NULL,
+	template_name VARCHAR(255) NOT NULL,
+	template_values JSONB NOT NULL DEFAULT '{}'::jsonb,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+	UNIQUE (user_id, template_name)
+);
+
+CREATE INDEX idx_entry_templates_project_id ON public.entry_templates (project_id);
@@ -0,0 +1,4 @@
+-- 座標で検索できるように、places.coordinates にGiSTインデックスを付けるのだ
+-- 半径 (ST_DWithin) はgeographyのまま、bboxとpolygonは経度・緯度の平面で比べるのでgeometryにしたものにも付けるのだ
+CREATE INDEX places_coordinates_gist ON public.places USING GIST (coordinates);
+CREATE INDEX places_coordinates_geometry_gist ON public.places USING GIST ((coordinates::geometry));
@@ -0,0 +1,11 @@
+-- places.accuracy は座標の不確かさ (メートル) として使うのだ。マイナスは意味が無いので止めるのだ
+-- 座標はいつもWGS84で入れるけど、geodetic_datum には入力した時の測地系をそのまま残しておくのだ
+-- georeference_source は座標をどうやって決めたか (GPS、地図、地名辞典) なのだ
+ALTER TABLE public.places
+	ADD CONSTRAINT places_accuracy_check CHECK (accuracy >= 0),
+	ADD COLUMN georeference_source TEXT CHECK (georeference_source IN ('gps', 'map', 'gazetteer')),
+	ADD COLUMN geodetic_datum TEXT,
+	ADD COLUMN georeferenced_by TEXT,
+	ADD COLUMN georeferenced_date DATE;
+
+COMMENT ON COLUMN public.places.accuracy IS 'coordinate uncertainty in metres';
@@ -0,0 +1,10 @@
+-- occurrence_generation はoccurrenceが変わるたびに1つ上げる数なのだ。行は1つしか無いのだ
+-- 変えたトランザクションがコミットした後に上げるので、この数が増えた時には変更はもう見えるようになっているのだ
+-- 書き込みのトランザクションの中で上げると、全部の書き込みがこの行のロックを待つことになるので、そうしないのだ
+-- シーケンスは値を取った順とコミットの順が違うことがあるので、地図タイルのキャッシュが古いかを見るのにはこっちを使うのだ
+CREATE TABLE public.occurrence_generation (
+	singleton BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (singleton),
+	generation BIGINT NOT NULL DEFAULT 0
+);
+
+INSERT INTO public.occurrence_generation (singleton, generation) VALUES (TRUE, 0);